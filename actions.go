@@ -0,0 +1,267 @@
+package pdfire
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+var (
+	// ActionClick clicks the element matching Selector.
+	ActionClick = ActionType("click")
+	// ActionFill sets the value of the input matching Selector to Value.
+	ActionFill = ActionType("fill")
+	// ActionEvaluate runs Script in the page and awaits a returned promise.
+	ActionEvaluate = ActionType("evaluate")
+	// ActionWait waits until the element matching Selector is visible or, without
+	// a selector, for Duration.
+	ActionWait = ActionType("wait")
+)
+
+// ActionType is the kind of a PageAction.
+type ActionType string
+
+// PageAction is a step that is executed in the page after it's loaded and
+// before it's printed, e.g. to dismiss a modal or to switch a tab.
+type PageAction struct {
+	Type     ActionType
+	Selector string
+	Value    string
+	Script   string
+	Duration time.Duration
+	// Timeout limits the wait for the element of the action. It defaults to
+	// defaultActionTimeout.
+	Timeout time.Duration
+}
+
+// ActionError is returned when an action of the Actions option fails.
+type ActionError struct {
+	Index int
+	Type  ActionType
+	Err   error
+}
+
+func (e *ActionError) Error() string {
+	return fmt.Sprintf("Action %d (%s) failed: %v.", e.Index+1, e.Type, e.Err)
+}
+
+func (e *ActionError) Unwrap() error {
+	return e.Err
+}
+
+// defaultActionTimeout is how long an action waits for its element.
+const defaultActionTimeout = 10 * time.Second
+
+// clickScript clicks an element the way a user does.
+const clickScript = `(function (selector) {
+	document.querySelector(selector).click();
+	return true;
+})(%s)`
+
+// fillScript sets the value of an input with the native setter, so that
+// frameworks tracking the value notice the change, and dispatches the events
+// of user input.
+const fillScript = `(function (selector, value) {
+	var el = document.querySelector(selector);
+	var proto = Object.getPrototypeOf(el);
+	var desc = Object.getOwnPropertyDescriptor(proto, 'value');
+
+	el.focus();
+
+	if (desc && desc.set) {
+		desc.set.call(el, value);
+	} else {
+		el.value = value;
+	}
+
+	el.dispatchEvent(new Event('input', { bubbles: true }));
+	el.dispatchEvent(new Event('change', { bubbles: true }));
+	return true;
+})(%s, %s)`
+
+// evaluateScript runs a script and resolves when a returned promise settles.
+const evaluateScript = `Promise.resolve((function () {
+	%s
+})()).then(function () { return true; })`
+
+// runActions executes the actions in order.
+func runActions(ctx context.Context, actions []*PageAction) error {
+	for i, action := range actions {
+		if err := runAction(ctx, action); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			return &ActionError{Index: i, Type: action.Type, Err: err}
+		}
+	}
+
+	return nil
+}
+
+func runAction(ctx context.Context, action *PageAction) error {
+	timeout := action.Timeout
+
+	if timeout <= 0 {
+		timeout = defaultActionTimeout
+	}
+
+	if action.Selector != "" {
+		if err := waitForSelectors(ctx, []string{action.Selector}, SelectorPolicyAllOf, SelectorStateVisible, timeout); err != nil {
+			return err
+		}
+	}
+
+	switch action.Type {
+	case ActionClick:
+		sel, err := json.Marshal(action.Selector)
+
+		if err != nil {
+			return err
+		}
+
+		return evaluate(ctx, fmt.Sprintf(clickScript, sel))
+	case ActionFill:
+		sel, err := json.Marshal(action.Selector)
+
+		if err != nil {
+			return err
+		}
+
+		value, err := json.Marshal(action.Value)
+
+		if err != nil {
+			return err
+		}
+
+		return evaluate(ctx, fmt.Sprintf(fillScript, sel, value))
+	case ActionEvaluate:
+		return evaluate(ctx, fmt.Sprintf(evaluateScript, action.Script))
+	case ActionWait:
+		if action.Selector != "" {
+			return nil
+		}
+
+		select {
+		case <-time.After(action.Duration):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func evaluate(ctx context.Context, script string) error {
+	var done bool
+
+	return chromedp.Evaluate(script, &done, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+		return p.WithAwaitPromise(true)
+	}).Do(ctx)
+}
+
+func parseActions(jsonMap map[string]interface{}) ([]*PageAction, error) {
+	raw, ok := jsonMap["actions"]
+
+	if !ok || raw == nil {
+		return make([]*PageAction, 0), nil
+	}
+
+	list, ok := raw.([]interface{})
+
+	if !ok {
+		return nil, &ParseError{
+			Key:   "actions",
+			Value: raw,
+		}
+	}
+
+	actions := make([]*PageAction, 0, len(list))
+
+	for _, item := range list {
+		actionMap, ok := item.(map[string]interface{})
+
+		if !ok {
+			return nil, &ParseError{
+				Key:   "actions",
+				Value: item,
+			}
+		}
+
+		typ, err := parseStringOnly(actionMap, "type", "",
+			string(ActionClick), string(ActionFill), string(ActionEvaluate), string(ActionWait))
+
+		if err != nil {
+			return nil, err
+		}
+
+		selector, err := parseString(actionMap, "selector", "")
+
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := parseString(actionMap, "value", "")
+
+		if err != nil {
+			return nil, err
+		}
+
+		script, err := parseString(actionMap, "script", "")
+
+		if err != nil {
+			return nil, err
+		}
+
+		duration, err := parseDuration(actionMap, "duration", time.Duration(0))
+
+		if err != nil {
+			return nil, err
+		}
+
+		timeout, err := parseDuration(actionMap, "timeout", time.Duration(0))
+
+		if err != nil {
+			return nil, err
+		}
+
+		action := &PageAction{
+			Type:     ActionType(typ),
+			Selector: selector,
+			Value:    value,
+			Script:   script,
+			Duration: duration,
+			Timeout:  timeout,
+		}
+
+		if !action.valid() {
+			return nil, &ParseError{
+				Key:   "actions",
+				Value: item,
+			}
+		}
+
+		actions = append(actions, action)
+	}
+
+	return actions, nil
+}
+
+// valid reports whether the action has the fields its type requires.
+func (a *PageAction) valid() bool {
+	switch a.Type {
+	case ActionClick, ActionFill:
+		return a.Selector != ""
+	case ActionEvaluate:
+		return a.Script != ""
+	case ActionWait:
+		return a.Selector != "" || a.Duration > 0
+	}
+
+	return false
+}
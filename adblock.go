@@ -0,0 +1,434 @@
+package pdfire
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/chromedp/cdproto/network"
+)
+
+// defaultFilterList is the filter list used by BlockAds unless the converter
+// is configured with FilterLists. It blocks the major ad networks.
+const defaultFilterList = `! pdfire default filter list
+||2mdn.net^
+||33across.com^
+||adform.net^
+||adnxs.com^
+||adsafeprotected.com^
+||adsrvr.org^
+||adservice.google.com^
+||advertising.com^
+||amazon-adsystem.com^
+||bidswitch.net^
+||casalemedia.com^
+||criteo.com^
+||criteo.net^
+||doubleclick.net^
+||googleadservices.com^
+||googlesyndication.com^
+||moatads.com^
+||openx.net^
+||outbrain.com^
+||pubmatic.com^
+||rubiconproject.com^
+||smartadserver.com^
+||taboola.com^
+||yieldmo.com^
+`
+
+// filterTypes are the resource types of the filter options, by the types of
+// the DevTools protocol. Documents of the main frame are never blocked;
+// documents of frames are "subdocument".
+var filterTypes = map[network.ResourceType]string{
+	network.ResourceTypeScript:     "script",
+	network.ResourceTypeImage:      "image",
+	network.ResourceTypeStylesheet: "stylesheet",
+	network.ResourceTypeXHR:        "xmlhttprequest",
+	network.ResourceTypeFetch:      "xmlhttprequest",
+	network.ResourceTypeFont:       "font",
+	network.ResourceTypeMedia:      "media",
+	network.ResourceTypePing:       "ping",
+	network.ResourceTypeWebSocket:  "websocket",
+	network.ResourceTypeDocument:   "subdocument",
+}
+
+// knownFilterTypes are the type options of filters that are supported.
+var knownFilterTypes = map[string]bool{
+	"script":         true,
+	"image":          true,
+	"stylesheet":     true,
+	"xmlhttprequest": true,
+	"subdocument":    true,
+	"font":           true,
+	"media":          true,
+	"object":         true,
+	"ping":           true,
+	"websocket":      true,
+	"other":          true,
+}
+
+// FilterList is a compiled list of network filters in the syntax of Adblock
+// Plus and EasyList. Cosmetic filters, regular expressions and filters with
+// unsupported options are skipped.
+type FilterList struct {
+	block filterSet
+	allow filterSet
+}
+
+// filterSet indexes filters anchored to a host, like "||example.com^", by that
+// host, so that a request is only matched against the filters of its host and
+// the generic ones.
+type filterSet struct {
+	hosts   map[string][]*filter
+	generic []*filter
+}
+
+type filter struct {
+	pattern *regexp.Regexp
+	// thirdParty is 1 if the filter only matches third-party requests and -1
+	// if it only matches first-party requests.
+	thirdParty int
+	types      map[string]bool
+	notTypes   map[string]bool
+	domains    []string
+	notDomains []string
+}
+
+// ParseFilterList compiles a filter list.
+func ParseFilterList(r io.Reader) (*FilterList, error) {
+	list := &FilterList{
+		block: filterSet{hosts: make(map[string][]*filter)},
+		allow: filterSet{hosts: make(map[string][]*filter)},
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		list.add(strings.TrimSpace(scanner.Text()))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (l *FilterList) add(line string) {
+	if line == "" || strings.HasPrefix(line, "!") || strings.HasPrefix(line, "[") || isCosmeticFilter(line) {
+		return
+	}
+
+	set := &l.block
+
+	if strings.HasPrefix(line, "@@") {
+		set = &l.allow
+		line = line[2:]
+	}
+
+	pattern, options := line, ""
+
+	if i := strings.LastIndex(line, "$"); i >= 0 {
+		pattern, options = line[:i], line[i+1:]
+	}
+
+	// Regular expression filters are rare and expensive.
+	if pattern == "" || (len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/")) {
+		return
+	}
+
+	f := &filter{}
+	matchCase := false
+
+	if options != "" {
+		for _, option := range strings.Split(options, ",") {
+			negated := strings.HasPrefix(option, "~")
+			name := strings.TrimPrefix(option, "~")
+
+			switch {
+			case name == "third-party" || name == "3p":
+				f.thirdParty = 1
+
+				if negated {
+					f.thirdParty = -1
+				}
+			case name == "first-party" || name == "1p":
+				f.thirdParty = -1
+
+				if negated {
+					f.thirdParty = 1
+				}
+			case name == "match-case":
+				matchCase = true
+			case strings.HasPrefix(name, "domain="):
+				for _, domain := range strings.Split(strings.TrimPrefix(name, "domain="), "|") {
+					if strings.HasPrefix(domain, "~") {
+						f.notDomains = append(f.notDomains, strings.ToLower(domain[1:]))
+					} else if domain != "" {
+						f.domains = append(f.domains, strings.ToLower(domain))
+					}
+				}
+			case knownFilterTypes[name]:
+				if negated {
+					if f.notTypes == nil {
+						f.notTypes = make(map[string]bool)
+					}
+
+					f.notTypes[name] = true
+				} else {
+					if f.types == nil {
+						f.types = make(map[string]bool)
+					}
+
+					f.types[name] = true
+				}
+			default:
+				// Filters with options like popup or csp do something else than
+				// blocking a request.
+				return
+			}
+		}
+	}
+
+	host := ""
+
+	if strings.HasPrefix(pattern, "||") {
+		end := strings.IndexAny(pattern[2:], "^/*|:?")
+
+		if end < 0 {
+			host = pattern[2:]
+		} else if pattern[2+end] != '*' {
+			host = pattern[2 : 2+end]
+		}
+	}
+
+	expr, err := regexp.Compile(filterExpression(pattern, matchCase))
+
+	if err != nil {
+		return
+	}
+
+	f.pattern = expr
+
+	if host != "" {
+		host = strings.ToLower(host)
+		set.hosts[host] = append(set.hosts[host], f)
+	} else {
+		set.generic = append(set.generic, f)
+	}
+}
+
+// isCosmeticFilter reports whether a line hides elements instead of blocking
+// requests.
+func isCosmeticFilter(line string) bool {
+	for _, separator := range []string{"##", "#@#", "#?#", "#$#"} {
+		if strings.Contains(line, separator) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filterExpression translates the pattern of a filter to a regular expression.
+func filterExpression(pattern string, matchCase bool) string {
+	b := strings.Builder{}
+
+	if !matchCase {
+		b.WriteString("(?i)")
+	}
+
+	switch {
+	case strings.HasPrefix(pattern, "||"):
+		b.WriteString(`^[a-z][a-z0-9+.-]*://([^/?#]*\.)?`)
+		pattern = pattern[2:]
+	case strings.HasPrefix(pattern, "|"):
+		b.WriteString("^")
+		pattern = pattern[1:]
+	}
+
+	end := ""
+
+	if strings.HasSuffix(pattern, "|") {
+		end = "$"
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '^':
+			b.WriteString(`(?:[^a-zA-Z0-9_.%-]|$)`)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	b.WriteString(end)
+
+	return b.String()
+}
+
+// Blocks reports whether a request is blocked by the list. documentURL is the
+// URL of the page that sends the request and resourceType is the type of the
+// request in the filter syntax, e.g. "script" or "image".
+func (l *FilterList) Blocks(requestURL, documentURL, resourceType string) bool {
+	u, err := url.Parse(requestURL)
+
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+
+	req := &filterRequest{
+		url:          requestURL,
+		host:         strings.ToLower(u.Hostname()),
+		documentHost: hostname(documentURL),
+		resourceType: resourceType,
+		thirdParty:   site(requestURL) != site(documentURL),
+	}
+
+	return l.block.matches(req) && !l.allow.matches(req)
+}
+
+type filterRequest struct {
+	url          string
+	host         string
+	documentHost string
+	resourceType string
+	thirdParty   bool
+}
+
+func (s *filterSet) matches(req *filterRequest) bool {
+	for host := req.host; host != ""; host = parentDomain(host) {
+		for _, f := range s.hosts[host] {
+			if f.matches(req) {
+				return true
+			}
+		}
+	}
+
+	for _, f := range s.generic {
+		if f.matches(req) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *filter) matches(req *filterRequest) bool {
+	if (f.thirdParty == 1 && !req.thirdParty) || (f.thirdParty == -1 && req.thirdParty) {
+		return false
+	}
+
+	if f.types != nil && !f.types[req.resourceType] {
+		return false
+	}
+
+	if f.notTypes[req.resourceType] {
+		return false
+	}
+
+	if len(f.domains) > 0 && !matchesDomain(req.documentHost, f.domains) {
+		return false
+	}
+
+	if matchesDomain(req.documentHost, f.notDomains) {
+		return false
+	}
+
+	return f.pattern.MatchString(req.url)
+}
+
+// matchesDomain reports whether host is one of the domains or a subdomain of
+// one of them.
+func matchesDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parentDomain returns the host without its first label, or "" for a host
+// with a single label.
+func parentDomain(host string) string {
+	i := strings.Index(host, ".")
+
+	if i < 0 {
+		return ""
+	}
+
+	return host[i+1:]
+}
+
+func hostname(rawurl string) string {
+	u, err := url.Parse(rawurl)
+
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(u.Hostname())
+}
+
+// filterType returns the type of a request in the filter syntax.
+func filterType(resourceType network.ResourceType) string {
+	if name, ok := filterTypes[resourceType]; ok {
+		return name
+	}
+
+	return "other"
+}
+
+var (
+	defaultFilters     *FilterList
+	defaultFiltersOnce sync.Once
+)
+
+// filterList returns the compiled filter list of the converter. The lists are
+// compiled once, by the first conversion that blocks ads.
+func (c *Converter) filterList() (*FilterList, error) {
+	if len(c.options.FilterLists) == 0 {
+		defaultFiltersOnce.Do(func() {
+			defaultFilters, _ = ParseFilterList(strings.NewReader(defaultFilterList))
+		})
+
+		return defaultFilters, nil
+	}
+
+	c.filtersOnce.Do(func() {
+		c.filters, c.filtersErr = loadFilterLists(c.options.FilterLists)
+	})
+
+	return c.filters, c.filtersErr
+}
+
+// loadFilterLists compiles the filter list files into a single list.
+func loadFilterLists(paths []string) (*FilterList, error) {
+	readers := make([]io.Reader, 0, 2*len(paths))
+
+	for _, path := range paths {
+		f, err := os.Open(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer f.Close()
+
+		// Files may lack a trailing newline.
+		readers = append(readers, f, strings.NewReader("\n"))
+	}
+
+	return ParseFilterList(io.MultiReader(readers...))
+}
@@ -0,0 +1,44 @@
+package pdfire_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/imkiptoo/pdfire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterList(t *testing.T) {
+	assert := assert.New(t)
+	list, err := pdfire.ParseFilterList(strings.NewReader(`[Adblock Plus 2.0]
+! Title: Test list
+||ads.example.com^
+||tracker.net^$third-party
+/banner/*$image,domain=news.com|~sports.news.com
+|http://plain.example.org/ad.js|
+@@||ads.example.com/allowed/
+example.com##.ad-slot
+||popups.example.com^$popup
+`))
+
+	assert.Nil(err)
+
+	assert.True(list.Blocks("https://ads.example.com/slot.js", "https://news.com/", "script"))
+	assert.True(list.Blocks("https://cdn.ads.example.com/slot.js", "https://news.com/", "script"))
+	assert.False(list.Blocks("https://badads.example.com/slot.js", "https://news.com/", "script"))
+	assert.False(list.Blocks("https://ads.example.com/allowed/slot.js", "https://news.com/", "script"))
+
+	assert.True(list.Blocks("https://tracker.net/pixel.gif", "https://news.com/", "image"))
+	assert.False(list.Blocks("https://tracker.net/pixel.gif", "https://www.tracker.net/", "image"))
+
+	assert.True(list.Blocks("https://cdn.com/banner/top.png", "https://www.news.com/", "image"))
+	assert.False(list.Blocks("https://cdn.com/banner/top.png", "https://sports.news.com/", "image"))
+	assert.False(list.Blocks("https://cdn.com/banner/top.png", "https://blog.com/", "image"))
+	assert.False(list.Blocks("https://cdn.com/banner/top.js", "https://news.com/", "script"))
+
+	assert.True(list.Blocks("http://plain.example.org/ad.js", "https://news.com/", "script"))
+	assert.False(list.Blocks("http://plain.example.org/ad.js?v=2", "https://news.com/", "script"))
+
+	assert.False(list.Blocks("https://popups.example.com/", "https://news.com/", "subdocument"))
+	assert.False(list.Blocks("https://example.com/", "https://news.com/", "subdocument"))
+}
@@ -0,0 +1,638 @@
+package pdfire
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"unicode/utf16"
+)
+
+var (
+	// ErrArchiveEncryption is returned when a PDF/A is encrypted, which the
+	// standard forbids.
+	ErrArchiveEncryption = errors.New("pdf/a forbids encryption")
+	// ErrArchiveStreams is returned when object streams or cross-reference
+	// streams are turned on for PDF/A-1, which is based on PDF 1.4.
+	ErrArchiveStreams = errors.New("pdf/a-1 forbids object streams and xref streams")
+)
+
+// ArchiveFormats are the PDF/A conformance levels accepted by ArchiveFormat.
+var ArchiveFormats = []string{"pdf/a-1b", "pdf/a-2b", "pdf/a-3b"}
+
+// srgbOutputCondition names the output intent of PDF/As.
+const srgbOutputCondition = "sRGB IEC61966-2.1"
+
+func parseArchiveFormat(jsonMap map[string]interface{}, def string) (string, error) {
+	return parseStringOnly(jsonMap, "archiveFormat", def, append([]string{""}, ArchiveFormats...)...)
+}
+
+// ConvertToArchive prepares a PDF for the PDF/A conformance level format, one
+// of ArchiveFormats. It adds the XMP metadata, the sRGB output intent and a
+// document ID as an incremental update. It returns the findings of
+// CheckArchive, which it can't fix, e.g. fonts that Chrome didn't embed.
+func ConvertToArchive(r io.Reader, w io.Writer, format string) ([]string, error) {
+	part, err := archivePart(format)
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := readPDF(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := doc.trailer["Encrypt"]; ok {
+		return nil, ErrArchiveEncryption
+	}
+
+	u, err := doc.update()
+
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, err := doc.dict(doc.trailer["Root"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	info := pdfDict{}
+
+	if ref, ok := doc.trailer["Info"]; ok {
+		if info, err = doc.dict(ref); err != nil {
+			return nil, err
+		}
+	}
+
+	metadata, err := archiveMetadata(doc, info, part)
+
+	if err != nil {
+		return nil, err
+	}
+
+	profile := u.add(&pdfStream{
+		dict: pdfDict{"N": int64(3)},
+		data: srgbProfile,
+	})
+
+	updated := make(pdfDict, len(catalog)+2)
+
+	for key, v := range catalog {
+		updated[key] = v
+	}
+
+	updated["Metadata"] = u.add(&pdfStream{
+		dict: pdfDict{"Type": pdfName("Metadata"), "Subtype": pdfName("XML")},
+		data: metadata,
+	})
+	updated["OutputIntents"] = []interface{}{pdfDict{
+		"Type":                      pdfName("OutputIntent"),
+		"S":                         pdfName("GTS_PDFA1"),
+		"OutputConditionIdentifier": pdfString(srgbOutputCondition),
+		"Info":                      pdfString(srgbOutputCondition),
+		"DestOutputProfile":         profile,
+	}}
+
+	// PDF/A-3 requires the attached files to be associated with the document.
+	if part == 3 {
+		files, err := embeddedFiles(doc, catalog)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(files) > 0 {
+			updated["AF"] = files
+		}
+	}
+
+	u.set(doc.trailer["Root"].(pdfRef), updated)
+
+	if _, ok := doc.trailer["ID"]; !ok {
+		sum := md5.Sum(doc.data)
+		u.trailer["ID"] = []interface{}{pdfString(sum[:]), pdfString(sum[:])}
+	}
+
+	if err := u.write(w); err != nil {
+		return nil, err
+	}
+
+	return checkArchive(doc, catalog, part)
+}
+
+// CheckArchive returns the findings of a PDF that violate the PDF/A
+// conformance level format. Only the violations that Chrome output may have
+// are checked: fonts that aren't embedded, transparency for PDF/A-1 and
+// attached files for PDF/A-1 and PDF/A-2.
+func CheckArchive(r io.Reader, format string) ([]string, error) {
+	part, err := archivePart(format)
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := readPDF(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := doc.trailer["Encrypt"]; ok {
+		return nil, ErrArchiveEncryption
+	}
+
+	catalog, err := doc.dict(doc.trailer["Root"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	return checkArchive(doc, catalog, part)
+}
+
+func archivePart(format string) (int, error) {
+	for i, f := range ArchiveFormats {
+		if f == format {
+			return i + 1, nil
+		}
+	}
+
+	return 0, &ParseError{Key: "archiveFormat", Value: format}
+}
+
+func checkArchive(doc *pdfDocument, catalog pdfDict, part int) ([]string, error) {
+	findings := make([]string, 0)
+	pages, err := doc.pages()
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := &archiveChecker{
+		doc:   doc,
+		fonts: make(map[string]bool),
+	}
+
+	for i, ref := range pages {
+		page, err := doc.dict(ref)
+
+		if err != nil {
+			return nil, err
+		}
+
+		c.visited = make(map[pdfRef]bool)
+		c.transparent = false
+
+		if group, err := doc.dict(page["Group"]); err == nil && group["S"] == pdfName("Transparency") {
+			c.transparent = true
+		}
+
+		if err := c.resources(page["Resources"]); err != nil {
+			return nil, err
+		}
+
+		if part == 1 && c.transparent {
+			findings = append(findings, fmt.Sprintf("The page %d uses transparency, which PDF/A-1 forbids.", i+1))
+		}
+	}
+
+	for _, name := range sortedKeys(c.fonts) {
+		findings = append(findings, fmt.Sprintf("The font \"%s\" is not embedded.", name))
+	}
+
+	if part < 3 {
+		files, err := embeddedFiles(doc, catalog)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(files) > 0 {
+			findings = append(findings, fmt.Sprintf("The PDF has attached files, which PDF/A-%d forbids.", part))
+		}
+	}
+
+	return findings, nil
+}
+
+// archiveChecker walks the resources of the pages and their form XObjects.
+type archiveChecker struct {
+	doc *pdfDocument
+	// visited are the resources of the current page that were walked.
+	visited map[pdfRef]bool
+	// fonts are the names of the fonts that aren't embedded.
+	fonts map[string]bool
+	// transparent is set if the current page uses transparency.
+	transparent bool
+}
+
+func (c *archiveChecker) resources(obj interface{}) error {
+	if ref, ok := obj.(pdfRef); ok {
+		if c.visited[ref] {
+			return nil
+		}
+
+		c.visited[ref] = true
+	}
+
+	if obj == nil {
+		return nil
+	}
+
+	resources, err := c.doc.dict(obj)
+
+	if err != nil {
+		return err
+	}
+
+	fonts, _ := c.doc.dict(resources["Font"])
+
+	for _, font := range fonts {
+		if err := c.font(font); err != nil {
+			return err
+		}
+	}
+
+	states, _ := c.doc.dict(resources["ExtGState"])
+
+	for _, state := range states {
+		gs, err := c.doc.dict(state)
+
+		if err != nil {
+			return err
+		}
+
+		if smask, ok := gs["SMask"]; ok && smask != pdfName("None") {
+			c.transparent = true
+		}
+
+		for _, key := range []string{"CA", "ca"} {
+			switch alpha := gs[key].(type) {
+			case float64:
+				c.transparent = c.transparent || alpha < 1
+			case int64:
+				c.transparent = c.transparent || alpha < 1
+			}
+		}
+	}
+
+	xobjects, _ := c.doc.dict(resources["XObject"])
+
+	for _, xobject := range xobjects {
+		x, err := c.doc.dict(xobject)
+
+		if err != nil {
+			return err
+		}
+
+		if _, ok := x["SMask"]; ok {
+			c.transparent = true
+		}
+
+		if group, err := c.doc.dict(x["Group"]); err == nil && group["S"] == pdfName("Transparency") {
+			c.transparent = true
+		}
+
+		if x["Subtype"] == pdfName("Form") {
+			if err := c.resources(x["Resources"]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *archiveChecker) font(obj interface{}) error {
+	font, err := c.doc.dict(obj)
+
+	if err != nil {
+		return err
+	}
+
+	// Type 3 fonts are defined by content streams, which are always embedded.
+	if font["Subtype"] == pdfName("Type3") {
+		return nil
+	}
+
+	descriptor := font["FontDescriptor"]
+
+	if font["Subtype"] == pdfName("Type0") {
+		descendants, err := c.doc.resolve(font["DescendantFonts"])
+
+		if err != nil {
+			return err
+		}
+
+		if arr, ok := descendants.([]interface{}); ok && len(arr) > 0 {
+			descendant, err := c.doc.dict(arr[0])
+
+			if err != nil {
+				return err
+			}
+
+			descriptor = descendant["FontDescriptor"]
+		}
+	}
+
+	if descriptor != nil {
+		d, err := c.doc.dict(descriptor)
+
+		if err != nil {
+			return err
+		}
+
+		for _, key := range []string{"FontFile", "FontFile2", "FontFile3"} {
+			if _, ok := d[key]; ok {
+				return nil
+			}
+		}
+	}
+
+	name, _ := font["BaseFont"].(pdfName)
+	c.fonts[string(name)] = true
+
+	return nil
+}
+
+// embeddedFiles returns the file specifications of the attached files. Only
+// name trees of a single node are read, like attachFile writes them.
+func embeddedFiles(doc *pdfDocument, catalog pdfDict) ([]interface{}, error) {
+	files := make([]interface{}, 0)
+
+	if _, ok := catalog["Names"]; !ok {
+		return files, nil
+	}
+
+	names, err := doc.dict(catalog["Names"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := names["EmbeddedFiles"]; !ok {
+		return files, nil
+	}
+
+	tree, err := doc.dict(names["EmbeddedFiles"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	flat, err := doc.resolve(tree["Names"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	arr, _ := flat.([]interface{})
+
+	for i := 1; i < len(arr); i += 2 {
+		files = append(files, arr[i])
+	}
+
+	return files, nil
+}
+
+// archiveMetadata returns the XMP metadata of a PDF/A, which repeats the
+// document information dictionary.
+func archiveMetadata(doc *pdfDocument, info pdfDict, part int) ([]byte, error) {
+	text := func(key string) (string, error) {
+		v, err := doc.resolve(info[key])
+
+		if err != nil {
+			return "", err
+		}
+
+		s, _ := v.(pdfString)
+
+		return decodePDFText(s), nil
+	}
+
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("<?xpacket begin=\"\xEF\xBB\xBF\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	buf.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	buf.WriteString("<rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	buf.WriteString("<rdf:Description rdf:about=\"\"" +
+		" xmlns:pdfaid=\"http://www.aiim.org/pdfa/ns/id/\"" +
+		" xmlns:dc=\"http://purl.org/dc/elements/1.1/\"" +
+		" xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\"" +
+		" xmlns:pdf=\"http://ns.adobe.com/pdf/1.3/\">\n")
+	fmt.Fprintf(buf, "<pdfaid:part>%d</pdfaid:part>\n", part)
+	buf.WriteString("<pdfaid:conformance>B</pdfaid:conformance>\n")
+
+	properties := []struct {
+		key    string
+		format string
+		date   bool
+	}{
+		{"Title", "<dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:title>\n", false},
+		{"Author", "<dc:creator><rdf:Seq><rdf:li>%s</rdf:li></rdf:Seq></dc:creator>\n", false},
+		{"Subject", "<dc:description><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:description>\n", false},
+		{"Keywords", "<pdf:Keywords>%s</pdf:Keywords>\n", false},
+		{"Creator", "<xmp:CreatorTool>%s</xmp:CreatorTool>\n", false},
+		{"Producer", "<pdf:Producer>%s</pdf:Producer>\n", false},
+		{"CreationDate", "<xmp:CreateDate>%s</xmp:CreateDate>\n", true},
+		{"ModDate", "<xmp:ModifyDate>%s</xmp:ModifyDate>\n", true},
+	}
+
+	for _, p := range properties {
+		value, err := text(p.key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if p.date {
+			value = xmpDate(value)
+		}
+
+		if value == "" {
+			continue
+		}
+
+		escaped := bytes.NewBuffer(nil)
+		xml.EscapeText(escaped, []byte(value))
+		fmt.Fprintf(buf, p.format, escaped.String())
+	}
+
+	buf.WriteString("</rdf:Description>\n</rdf:RDF>\n</x:xmpmeta>\n<?xpacket end=\"w\"?>")
+
+	return buf.Bytes(), nil
+}
+
+// decodePDFText decodes a text string, which is either UTF-16 with a byte
+// order mark or, approximately, Latin-1.
+func decodePDFText(s pdfString) string {
+	if len(s) >= 2 && s[0] == 0xFE && s[1] == 0xFF {
+		units := make([]uint16, 0, len(s)/2)
+
+		for i := 2; i+1 < len(s); i += 2 {
+			units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+
+		return string(utf16.Decode(units))
+	}
+
+	runes := make([]rune, len(s))
+
+	for i, b := range s {
+		runes[i] = rune(b)
+	}
+
+	return string(runes)
+}
+
+var pdfDatePattern = regexp.MustCompile(`^D:(\d{4})(\d{2})?(\d{2})?(\d{2})?(\d{2})?(\d{2})?(?:(Z)|([+-])(\d{2})'?(\d{2})?'?)?`)
+
+// xmpDate converts a PDF date, e.g. "D:20191114120000+01'00'", to the date
+// format of XMP, e.g. "2019-11-14T12:00:00+01:00". It returns an empty string
+// for invalid dates.
+func xmpDate(date string) string {
+	m := pdfDatePattern.FindStringSubmatch(date)
+
+	if m == nil {
+		return ""
+	}
+
+	def := func(v, d string) string {
+		if v == "" {
+			return d
+		}
+
+		return v
+	}
+
+	out := fmt.Sprintf("%s-%s-%sT%s:%s:%s", m[1], def(m[2], "01"), def(m[3], "01"),
+		def(m[4], "00"), def(m[5], "00"), def(m[6], "00"))
+
+	switch {
+	case m[7] == "Z":
+		out += "Z"
+	case m[8] != "":
+		out += fmt.Sprintf("%s%s:%s", m[8], m[9], def(m[10], "00"))
+	}
+
+	return out
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// srgbProfile is an ICC profile of the sRGB color space, the output intent of
+// PDF/As. It approximates the tone curve with a gamma of 2.2.
+var srgbProfile = iccProfile(
+	[3]float64{0.9642, 1.0, 0.8249},
+	[3][3]float64{
+		{0.4361, 0.2225, 0.0139},
+		{0.3851, 0.7169, 0.0971},
+		{0.1431, 0.0606, 0.7141},
+	},
+	2.2,
+)
+
+// iccProfile returns a version 2 display profile with the white point, the
+// D50-adapted red, green and blue primaries and the gamma.
+func iccProfile(white [3]float64, primaries [3][3]float64, gamma float64) []byte {
+	type tag struct {
+		sig  string
+		data []byte
+	}
+
+	s15 := func(v float64) uint32 {
+		return uint32(int32(math.Round(v * 65536)))
+	}
+
+	xyz := func(v [3]float64) []byte {
+		b := make([]byte, 20)
+		copy(b, "XYZ ")
+
+		for i, c := range v {
+			binary.BigEndian.PutUint32(b[8+i*4:], s15(c))
+		}
+
+		return b
+	}
+
+	description := "sRGB IEC61966-2.1"
+	desc := make([]byte, 12, 12+len(description)+1+12+67)
+	copy(desc, "desc")
+	binary.BigEndian.PutUint32(desc[8:], uint32(len(description)+1))
+	desc = append(desc, description...)
+	desc = append(desc, 0)
+	// The empty Unicode and ScriptCode descriptions.
+	desc = append(desc, make([]byte, 8+3+67)...)
+
+	copyright := append([]byte("text\x00\x00\x00\x00"), "No copyright, use freely\x00"...)
+
+	curve := make([]byte, 14)
+	copy(curve, "curv")
+	binary.BigEndian.PutUint32(curve[8:], 1)
+	binary.BigEndian.PutUint16(curve[12:], uint16(math.Round(gamma*256)))
+
+	tags := []tag{
+		{"desc", desc},
+		{"cprt", copyright},
+		{"wtpt", xyz(white)},
+		{"rXYZ", xyz(primaries[0])},
+		{"gXYZ", xyz(primaries[1])},
+		{"bXYZ", xyz(primaries[2])},
+		{"rTRC", curve},
+		{"gTRC", curve},
+		{"bTRC", curve},
+	}
+
+	table := make([]byte, 4+12*len(tags))
+	binary.BigEndian.PutUint32(table, uint32(len(tags)))
+	data := make([]byte, 0)
+	offset := 128 + len(table)
+
+	for i, t := range tags {
+		entry := table[4+12*i:]
+		copy(entry, t.sig)
+		binary.BigEndian.PutUint32(entry[4:], uint32(offset+len(data)))
+		binary.BigEndian.PutUint32(entry[8:], uint32(len(t.data)))
+		data = append(data, t.data...)
+
+		// Tags start on 4-byte boundaries.
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header[0:], uint32(128+len(table)+len(data)))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000)
+	copy(header[12:], "mntrRGB XYZ ")
+	// The creation date, 2019-01-01 00:00:00, keeps the profile constant.
+	binary.BigEndian.PutUint16(header[24:], 2019)
+	binary.BigEndian.PutUint16(header[26:], 1)
+	binary.BigEndian.PutUint16(header[28:], 1)
+	copy(header[36:], "acsp")
+
+	for i, c := range white {
+		binary.BigEndian.PutUint32(header[68+i*4:], s15(c))
+	}
+
+	return append(append(header, table...), data...)
+}
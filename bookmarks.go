@@ -0,0 +1,210 @@
+package pdfire
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+var (
+	// ErrBookmarkPage is returned when a bookmark points to a page the document doesn't have.
+	ErrBookmarkPage = errors.New("bookmark points to a non-existent page")
+)
+
+// Bookmark is an entry of the document outline.
+type Bookmark struct {
+	Title string
+	// Page is the number of the page the bookmark points to, starting at 1.
+	Page     int
+	Children []*Bookmark
+}
+
+// AddBookmarks adds a document outline to a PDF, replacing any existing one.
+// The PDF is read and written again with pdfcpu.
+func AddBookmarks(r io.Reader, w io.Writer, bookmarks []*Bookmark) error {
+	return addBookmarks(r, w, bookmarks, nil)
+}
+
+// addBookmarks adds a document outline to a PDF and writes it with the
+// pdfcpu configuration cfg, or the default one if it's nil.
+func addBookmarks(r io.Reader, w io.Writer, bookmarks []*Bookmark, cfg *pdfcpu.Configuration) error {
+	data, err := ioutil.ReadAll(r)
+
+	if err != nil {
+		return err
+	}
+
+	if cfg == nil {
+		cfg = pdfcpu.NewDefaultConfiguration()
+	}
+
+	ctx, err := api.ReadContext(bytes.NewReader(data), cfg)
+
+	if err != nil {
+		return ErrInvalidPDF
+	}
+
+	if len(bookmarks) == 0 {
+		_, err := w.Write(data)
+		return err
+	}
+
+	if ctx.Encrypt != nil {
+		return ErrEncryptedPDF
+	}
+
+	// The validation of pdfcpu overflows the stack on a cyclic page tree, so
+	// only the page tree is walked, which rejects cycles.
+	root, err := ctx.Pages()
+
+	if err != nil || root == nil {
+		return ErrInvalidPDF
+	}
+
+	pages, err := pageRefs(ctx.XRefTable, *root, nil, make(map[int]bool))
+
+	if err != nil {
+		return err
+	}
+
+	catalog, err := ctx.Catalog()
+
+	if err != nil {
+		return err
+	}
+
+	outlines := pdfcpu.Dict{"Type": pdfcpu.Name("Outlines")}
+	outlinesRef, err := ctx.IndRefForNewObject(outlines)
+
+	if err != nil {
+		return err
+	}
+
+	first, last, count, err := addBookmarkItems(ctx.XRefTable, *outlinesRef, bookmarks, pages)
+
+	if err != nil {
+		return err
+	}
+
+	outlines["First"] = first
+	outlines["Last"] = last
+	outlines["Count"] = pdfcpu.Integer(count)
+	catalog["Outlines"] = *outlinesRef
+	catalog["PageMode"] = pdfcpu.Name("UseOutlines")
+
+	return api.WriteContext(ctx, w)
+}
+
+// pageRefs appends the references of the pages below a node of the page tree
+// to refs, in order. A node that was visited already is rejected, so that a
+// cyclic page tree can't recurse forever.
+func pageRefs(xRefTable *pdfcpu.XRefTable, node pdfcpu.IndirectRef, refs []pdfcpu.IndirectRef, visited map[int]bool) ([]pdfcpu.IndirectRef, error) {
+	if visited[node.ObjectNumber.Value()] {
+		return nil, ErrInvalidPDF
+	}
+
+	visited[node.ObjectNumber.Value()] = true
+	dict, err := xRefTable.DereferenceDict(node)
+
+	if err != nil || dict == nil {
+		return nil, ErrInvalidPDF
+	}
+
+	if t := dict.Type(); t != nil && *t == "Page" {
+		return append(refs, node), nil
+	}
+
+	kids, err := xRefTable.DereferenceArray(dict["Kids"])
+
+	if err != nil {
+		return nil, ErrInvalidPDF
+	}
+
+	for _, kid := range kids {
+		ref, ok := kid.(pdfcpu.IndirectRef)
+
+		if !ok {
+			return nil, ErrInvalidPDF
+		}
+
+		if refs, err = pageRefs(xRefTable, ref, refs, visited); err != nil {
+			return nil, err
+		}
+	}
+
+	return refs, nil
+}
+
+// addBookmarkItems adds the outline items of bookmarks below parent and
+// returns the first and last item and the number of visible descendants.
+func addBookmarkItems(xRefTable *pdfcpu.XRefTable, parent pdfcpu.IndirectRef, bookmarks []*Bookmark, pages []pdfcpu.IndirectRef) (pdfcpu.IndirectRef, pdfcpu.IndirectRef, int, error) {
+	items := make([]pdfcpu.Dict, len(bookmarks))
+	refs := make([]pdfcpu.IndirectRef, len(bookmarks))
+
+	for i := range bookmarks {
+		items[i] = pdfcpu.Dict{}
+		ref, err := xRefTable.IndRefForNewObject(items[i])
+
+		if err != nil {
+			return pdfcpu.IndirectRef{}, pdfcpu.IndirectRef{}, 0, err
+		}
+
+		refs[i] = *ref
+	}
+
+	count := 0
+
+	for i, b := range bookmarks {
+		if b.Page < 1 || b.Page > len(pages) {
+			return pdfcpu.IndirectRef{}, pdfcpu.IndirectRef{}, 0, ErrBookmarkPage
+		}
+
+		item := items[i]
+		item["Title"] = bookmarkTitle(b.Title)
+		item["Parent"] = parent
+		item["Dest"] = pdfcpu.Array{pages[b.Page-1], pdfcpu.Name("Fit")}
+
+		if i > 0 {
+			item["Prev"] = refs[i-1]
+		}
+
+		if i < len(refs)-1 {
+			item["Next"] = refs[i+1]
+		}
+
+		count++
+
+		if len(b.Children) > 0 {
+			first, last, n, err := addBookmarkItems(xRefTable, refs[i], b.Children, pages)
+
+			if err != nil {
+				return pdfcpu.IndirectRef{}, pdfcpu.IndirectRef{}, 0, err
+			}
+
+			item["First"] = first
+			item["Last"] = last
+			item["Count"] = pdfcpu.Integer(n)
+			count += n
+		}
+	}
+
+	return refs[0], refs[len(refs)-1], count, nil
+}
+
+// bookmarkTitle encodes a title as a literal string, or as a hex string in
+// UTF-16 if it isn't plain ASCII.
+func bookmarkTitle(title string) pdfcpu.Object {
+	text := pdfText(title)
+
+	if string(text) != title {
+		return pdfcpu.NewHexLiteral(text)
+	}
+
+	escaped, _ := pdfcpu.Escape(title)
+
+	return pdfcpu.StringLiteral(*escaped)
+}
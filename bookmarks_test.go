@@ -0,0 +1,139 @@
+package pdfire_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/imkiptoo/pdfire"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/stretchr/testify/assert"
+)
+
+// outlineItems returns the outline items of a PDF depth-first, as the title
+// and the number of the page they point to, indented by their level.
+func outlineItems(t *testing.T, data []byte) []string {
+	ctx, err := api.ReadContext(bytes.NewReader(data), pdfcpu.NewDefaultConfiguration())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	catalog, err := ctx.Catalog()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := ctx.DereferenceDict(*catalog.IndirectRefEntry("Pages"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kids, _ := ctx.DereferenceArray(root["Kids"])
+	pages := make(map[int]int, len(kids))
+
+	for i, kid := range kids {
+		pages[kid.(pdfcpu.IndirectRef).ObjectNumber.Value()] = i + 1
+	}
+
+	outlines, err := ctx.DereferenceDict(catalog["Outlines"])
+
+	if err != nil || outlines == nil {
+		return nil
+	}
+
+	var items []string
+	var walk func(first pdfcpu.Object, indent string)
+
+	walk = func(first pdfcpu.Object, indent string) {
+		for o := first; o != nil; {
+			item, err := ctx.DereferenceDict(o)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			title, _ := ctx.DereferenceText(item["Title"])
+			dest, _ := ctx.DereferenceArray(item["Dest"])
+			items = append(items, fmt.Sprintf("%s%s:%d", indent, title, pages[dest[0].(pdfcpu.IndirectRef).ObjectNumber.Value()]))
+			walk(item["First"], indent+"  ")
+			o = item["Next"]
+		}
+	}
+
+	walk(outlines["First"], "")
+
+	return items
+}
+
+func TestAddBookmarks(t *testing.T) {
+	assert := assert.New(t)
+	wd, _ := os.Getwd()
+	src, _ := ioutil.ReadFile(filepath.Join(wd, "testdata/pages.pdf"))
+
+	out := bytes.NewBuffer(make([]byte, 0))
+	err := pdfire.AddBookmarks(bytes.NewReader(src), out, []*pdfire.Bookmark{
+		{Title: "Intro", Page: 1, Children: []*pdfire.Bookmark{{Title: "Details", Page: 2}}},
+		{Title: "Zusammenfassung (Überblick)", Page: 2},
+	})
+
+	assert.Nil(err)
+	assert.Equal([]string{"Intro:1", "  Details:2", "Zusammenfassung (Überblick):2"}, outlineItems(t, out.Bytes()))
+
+	pages, err := pdfire.PageCount(bytes.NewReader(out.Bytes()))
+
+	assert.Nil(err)
+	assert.Equal(2, pages)
+
+	again := bytes.NewBuffer(make([]byte, 0))
+	err = pdfire.AddBookmarks(bytes.NewReader(out.Bytes()), again, []*pdfire.Bookmark{
+		{Title: "Summary", Page: 2},
+	})
+
+	assert.Nil(err)
+	assert.Equal([]string{"Summary:2"}, outlineItems(t, again.Bytes()))
+}
+
+func TestAddBookmarksCyclicPageTree(t *testing.T) {
+	assert := assert.New(t)
+	wd, _ := os.Getwd()
+	src, _ := ioutil.ReadFile(filepath.Join(wd, "testdata/pages.pdf"))
+
+	// The first page is replaced by the root of the page tree.
+	cyclic := bytes.Replace(src, []byte("/Kids [3 0 R"), []byte("/Kids [2 0 R"), 1)
+
+	err := pdfire.AddBookmarks(bytes.NewReader(cyclic), ioutil.Discard, []*pdfire.Bookmark{
+		{Title: "Page", Page: 1},
+	})
+
+	assert.NotNil(err)
+}
+
+func TestAddBookmarksInvalidPage(t *testing.T) {
+	assert := assert.New(t)
+	wd, _ := os.Getwd()
+	src, _ := ioutil.ReadFile(filepath.Join(wd, "testdata/pages.pdf"))
+
+	err := pdfire.AddBookmarks(bytes.NewReader(src), ioutil.Discard, []*pdfire.Bookmark{
+		{Title: "Missing", Page: 3},
+	})
+
+	assert.Equal(pdfire.ErrBookmarkPage, err)
+}
+
+func TestAddBookmarksInvalidPDF(t *testing.T) {
+	assert := assert.New(t)
+
+	err := pdfire.AddBookmarks(strings.NewReader("<html></html>"), ioutil.Discard, []*pdfire.Bookmark{
+		{Title: "Page", Page: 1},
+	})
+
+	assert.Equal(pdfire.ErrInvalidPDF, err)
+}
@@ -0,0 +1,465 @@
+package pdfire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/chromedp"
+)
+
+var (
+	// ErrUnknownChannel is returned when the configured Chrome channel is not supported.
+	ErrUnknownChannel = errors.New("unknown chrome channel")
+	// ErrBrowserNotFound is returned when no Chrome executable can be found for the configured channel.
+	ErrBrowserNotFound = errors.New("chrome executable not found")
+	// ErrUnknownSandboxPreset is returned when the configured sandbox preset is not supported.
+	ErrUnknownSandboxPreset = errors.New("unknown sandbox preset")
+	// ErrChromeWSURLNotAllowed is returned when a conversion connects to a remote
+	// Chrome although the converter doesn't allow it.
+	ErrChromeWSURLNotAllowed = errors.New("chrome websocket urls are not allowed")
+	// ErrRemoteChromeArgs is returned when a conversion with Chrome arguments
+	// runs in a remote Chrome, which was started with its own arguments.
+	ErrRemoteChromeArgs = errors.New("chrome arguments cannot be applied to a remote chrome")
+)
+
+// channelExecutables are the executable names and paths looked up for each channel, in order.
+var channelExecutables = map[Channel][]string{
+	ChannelStable: {
+		"google-chrome-stable",
+		"google-chrome",
+		"chrome",
+		"chrome.exe",
+		`C:\Program Files\Google\Chrome\Application\chrome.exe`,
+		`C:\Program Files (x86)\Google\Chrome\Application\chrome.exe`,
+		"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
+	},
+	ChannelBeta: {
+		"google-chrome-beta",
+		`C:\Program Files\Google\Chrome Beta\Application\chrome.exe`,
+		`C:\Program Files (x86)\Google\Chrome Beta\Application\chrome.exe`,
+		"/Applications/Google Chrome Beta.app/Contents/MacOS/Google Chrome Beta",
+	},
+	ChannelHeadlessShell: {
+		"chrome-headless-shell",
+		"headless_shell",
+		"headless-shell",
+	},
+}
+
+// defaultExecutables are the executable names and paths chromedp looks up when
+// neither an ExecPath nor a Channel is configured.
+var defaultExecutables = []string{
+	"headless_shell",
+	"headless-shell",
+	"chromium",
+	"chromium-browser",
+	"google-chrome",
+	"google-chrome-stable",
+	"google-chrome-beta",
+	"google-chrome-unstable",
+	"/usr/bin/google-chrome",
+	"chrome",
+	"chrome.exe",
+	`C:\Program Files (x86)\Google\Chrome\Application\chrome.exe`,
+	"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
+}
+
+// ChromeArgError is returned when a conversion requests a Chrome flag that is not allowed by the converter.
+type ChromeArgError struct {
+	Arg string
+}
+
+func (e *ChromeArgError) Error() string {
+	return fmt.Sprintf("Chrome argument \"%s\" is not allowed.", e.Arg)
+}
+
+// BrowserVersion is the version information reported by the browser.
+type BrowserVersion struct {
+	ExecPath        string `json:"execPath,omitempty"`
+	Product         string `json:"product"`
+	Revision        string `json:"revision"`
+	ProtocolVersion string `json:"protocolVersion"`
+	UserAgent       string `json:"userAgent"`
+	JSVersion       string `json:"jsVersion"`
+}
+
+// Version returns the version of the converter's browser. It's read from a
+// running pooled browser without taking one of its tabs, or from a newly
+// launched browser, and cached afterwards, so that health checks neither wait
+// for a free tab nor launch a browser every time. The ExecPath is empty for a
+// remote Chrome.
+func (c *Converter) Version(ctx context.Context) (*BrowserVersion, error) {
+	c.mu.Lock()
+	cached := c.version
+	c.mu.Unlock()
+
+	if cached != nil {
+		version := *cached
+		return &version, nil
+	}
+
+	var execPath string
+	var err error
+
+	if c.options.ChromeWSURL == "" {
+		if execPath, err = resolveExecPath(c.options); err != nil {
+			return nil, err
+		}
+	}
+
+	version := &BrowserVersion{
+		ExecPath: execPath,
+	}
+
+	if b := c.runningBrowser(); b != nil {
+		err = version.read(ctx, b)
+	} else {
+		err = c.readVersion(ctx, version)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	copied := *version
+
+	c.mu.Lock()
+	c.version = &copied
+	c.mu.Unlock()
+
+	return version, nil
+}
+
+// runningBrowser returns a running browser of the pool, if any.
+func (c *Converter) runningBrowser() *chromedp.Browser {
+	if c.pool == nil {
+		return nil
+	}
+
+	return c.pool.running()
+}
+
+// readVersion reads the version from the browser of a new tab.
+func (c *Converter) readVersion(ctx context.Context, version *BrowserVersion) error {
+	ctx, cancel, err := c.newTabContext(ctx, nil, "")
+
+	if err != nil {
+		return err
+	}
+
+	defer cancel()
+
+	return chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		return version.read(ctx, chromedp.FromContext(ctx).Browser)
+	}))
+}
+
+func (v *BrowserVersion) read(ctx context.Context, b *chromedp.Browser) error {
+	var err error
+	v.ProtocolVersion, v.Product, v.Revision, v.UserAgent, v.JSVersion, err = browser.GetVersion().Do(cdp.WithExecutor(ctx, b))
+
+	return err
+}
+
+// newTabContext returns a chromedp context for a single conversion. Pooled
+// browsers are used unless the conversion needs its own Chrome arguments or
+// its own remote Chrome at wsURL.
+func (c *Converter) newTabContext(ctx context.Context, args []string, wsURL string) (context.Context, context.CancelFunc, error) {
+	if wsURL != "" && !c.options.AllowChromeWSURL {
+		return nil, nil, ErrChromeWSURLNotAllowed
+	}
+
+	if c.pool != nil && len(args) == 0 && wsURL == "" {
+		return c.pool.newTab(ctx)
+	}
+
+	if wsURL == "" {
+		wsURL = c.options.ChromeWSURL
+	}
+
+	if wsURL != "" {
+		if len(args) > 0 {
+			return nil, nil, ErrRemoteChromeArgs
+		}
+
+		return newRemoteTab(ctx, wsURL)
+	}
+
+	return c.newBrowserContext(ctx, args)
+}
+
+// newRemoteTab connects to the remote Chrome at wsURL and creates a tab in a
+// new browser context, so that conversions sharing the remote Chrome are
+// isolated. Cancelling the returned context closes the tab and the
+// connection, but not the remote Chrome.
+func newRemoteTab(ctx context.Context, wsURL string) (context.Context, context.CancelFunc, error) {
+	b, err := connectRemote(context.Background(), wsURL)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tabCtx, cancelTab, err := openTab(ctx, b)
+
+	if err != nil {
+		b.cancel()
+		return nil, nil, err
+	}
+
+	return tabCtx, func() {
+		cancelTab()
+		b.cancel()
+	}, nil
+}
+
+// connectRemote connects to the remote Chrome at wsURL.
+func connectRemote(ctx context.Context, wsURL string) (*pooledBrowser, error) {
+	allocCtx, cancelAlloc := chromedp.NewRemoteAllocator(ctx, wsURL)
+	browserCtx, cancelBrowser := chromedp.NewContext(allocCtx)
+	b := &pooledBrowser{
+		ctx: browserCtx,
+		cancel: func() {
+			cancelBrowser()
+			cancelAlloc()
+		},
+	}
+
+	if err := chromedp.Run(browserCtx); err != nil {
+		b.cancel()
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (c *Converter) newBrowserContext(ctx context.Context, args []string) (context.Context, context.CancelFunc, error) {
+	opts, err := allocatorOptions(c.options)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	argOpts, err := chromeArgOptions(c.options, args)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts = append(opts, argOpts...)
+
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(ctx, opts...)
+	browserCtx, cancelBrowser := chromedp.NewContext(allocCtx)
+
+	return browserCtx, func() {
+		cancelBrowser()
+		cancelAlloc()
+	}, nil
+}
+
+func allocatorOptions(options *ConverterOptions) ([]chromedp.ExecAllocatorOption, error) {
+	opts := make([]chromedp.ExecAllocatorOption, len(chromedp.DefaultExecAllocatorOptions))
+	copy(opts, chromedp.DefaultExecAllocatorOptions[:])
+
+	execPath, err := resolveExecPath(options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if execPath != "" {
+		opts = append(opts, chromedp.ExecPath(execPath))
+	}
+
+	sandboxOpts, err := sandboxOptions(options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts, sandboxOpts...)
+
+	extensionOpts, err := extensionOptions(options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts, extensionOpts...)
+
+	fontOpts, err := fontConfigOptions(options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts, fontOpts...)
+
+	if options.MaxOldSpaceSize > 0 {
+		opts = append(opts, chromedp.Flag("js-flags", fmt.Sprintf("--max-old-space-size=%d", options.MaxOldSpaceSize)))
+	}
+
+	return opts, nil
+}
+
+func extensionOptions(options *ConverterOptions) ([]chromedp.ExecAllocatorOption, error) {
+	if len(options.Extensions) == 0 {
+		return nil, nil
+	}
+
+	paths := make([]string, 0, len(options.Extensions))
+
+	for _, ext := range options.Extensions {
+		path, err := filepath.Abs(ext)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := os.Stat(filepath.Join(path, "manifest.json")); err != nil {
+			return nil, err
+		}
+
+		paths = append(paths, path)
+	}
+
+	list := strings.Join(paths, ",")
+
+	return []chromedp.ExecAllocatorOption{
+		chromedp.Flag("headless", "new"),
+		chromedp.Flag("disable-extensions", false),
+		chromedp.Flag("load-extension", list),
+		chromedp.Flag("disable-extensions-except", list),
+	}, nil
+}
+
+func sandboxOptions(options *ConverterOptions) ([]chromedp.ExecAllocatorOption, error) {
+	if options.NoSandbox {
+		return []chromedp.ExecAllocatorOption{chromedp.NoSandbox}, nil
+	}
+
+	switch options.Sandbox {
+	case SandboxDefault:
+		return nil, nil
+	case SandboxUserNamespace:
+		return []chromedp.ExecAllocatorOption{
+			chromedp.Flag("no-sandbox", false),
+			chromedp.Flag("disable-setuid-sandbox", true),
+		}, nil
+	case SandboxSeccomp:
+		return []chromedp.ExecAllocatorOption{
+			chromedp.Flag("no-sandbox", false),
+			chromedp.Flag("disable-setuid-sandbox", true),
+			chromedp.Flag("disable-namespace-sandbox", true),
+		}, nil
+	}
+
+	return nil, ErrUnknownSandboxPreset
+}
+
+// chromeArgOptions converts per-conversion Chrome arguments like "--lang=de" into
+// allocator options, rejecting every flag that isn't allowed by the converter.
+func chromeArgOptions(options *ConverterOptions, args []string) ([]chromedp.ExecAllocatorOption, error) {
+	opts := make([]chromedp.ExecAllocatorOption, 0, len(args))
+
+	for _, arg := range args {
+		parts := strings.SplitN(strings.TrimLeft(strings.TrimSpace(arg), "-"), "=", 2)
+		name := parts[0]
+
+		if name == "" || !isAllowedChromeArg(options, name) {
+			return nil, &ChromeArgError{
+				Arg: arg,
+			}
+		}
+
+		if len(parts) == 1 {
+			opts = append(opts, chromedp.Flag(name, true))
+			continue
+		}
+
+		opts = append(opts, chromedp.Flag(name, parts[1]))
+
+		// Chrome ignores --lang on Linux and reads the UI language from the environment instead.
+		if name == "lang" {
+			opts = append(opts, chromedp.Env("LANGUAGE="+parts[1]))
+		}
+	}
+
+	return opts, nil
+}
+
+func isAllowedChromeArg(options *ConverterOptions, name string) bool {
+	for _, allowed := range options.AllowedChromeArgs {
+		if allowed == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveExecPath returns the Chrome executable for the options. An empty path
+// means that chromedp's default lookup should be used.
+func resolveExecPath(options *ConverterOptions) (string, error) {
+	if options.ExecPath != "" {
+		return options.ExecPath, nil
+	}
+
+	if options.Channel == "" {
+		return "", nil
+	}
+
+	candidates, ok := channelExecutables[options.Channel]
+
+	if !ok {
+		return "", ErrUnknownChannel
+	}
+
+	for _, candidate := range candidates {
+		if path, err := exec.LookPath(candidate); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", ErrBrowserNotFound
+}
+
+// findExecPath returns the path of the Chrome executable that is launched for
+// the options. Unlike resolveExecPath, it fails with ErrBrowserNotFound if the
+// ExecPath doesn't exist or, without an ExecPath or Channel, none of the
+// defaultExecutables is found.
+func findExecPath(options *ConverterOptions) (string, error) {
+	execPath, err := resolveExecPath(options)
+
+	if err != nil {
+		return "", err
+	}
+
+	if execPath != "" {
+		if _, err := os.Stat(execPath); err == nil {
+			return execPath, nil
+		}
+
+		// A name without a directory is looked up in the PATH, like Chrome
+		// is launched.
+		if path, err := exec.LookPath(execPath); err == nil {
+			return path, nil
+		}
+
+		return "", ErrBrowserNotFound
+	}
+
+	for _, candidate := range defaultExecutables {
+		if path, err := exec.LookPath(candidate); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", ErrBrowserNotFound
+}
@@ -1,6 +1,7 @@
 package pdfire
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -89,24 +90,109 @@ var (
 
 // ConversionOptions are the conversion options.
 type ConversionOptions struct {
-	HTML                   string
-	URL                    string
-	PDFParams              *page.PrintToPDFParams `json:"pdfParams"`
-	ViewportWidth          int64
-	ViewportHeight         int64
-	BlockAds               bool
-	Selector               string
-	WaitForSelector        string
-	WaitForSelectorTimeout time.Duration
-	WaitUntil              string
-	WaitUntilTimeout       time.Duration
-	Delay                  time.Duration
-	Timeout                time.Duration
-	Headers                map[string]interface{}
-	EmulateMedia           Media
-	OwnerPassword          string
-	UserPassword           string
-	Watermark              *WatermarkConfig
+	HTML                    string
+	URL                     string
+	PDFParams               *page.PrintToPDFParams `json:"pdfParams"`
+	ViewportWidth           int64
+	ViewportHeight          int64
+	BlockAds                bool
+	Selector                string
+	WaitForSelector         string
+	WaitForSelectorTimeout  time.Duration
+	WaitUntil               string
+	WaitUntilTimeout        time.Duration
+	Delay                   time.Duration
+	Timeout                 time.Duration
+	Headers                 map[string]interface{}
+	EmulateMedia            Media
+	OwnerPassword           string
+	UserPassword            string
+	Watermark               *WatermarkConfig
+	ChromeArgs              []string
+	MaxJSHeapSize           int64
+	MaxCPUTime              time.Duration
+	Sanitize                bool
+	BlockDownloads          bool
+	BlockPopups             bool
+	BypassServiceWorker     bool
+	DisableCache            bool
+	Offline                 bool
+	BlockThirdPartyCookies  bool
+	OriginHeaders           map[string]string `json:"-"`
+	Selectors               []string
+	SelectorPageBreaks      bool
+	URLs                    []string
+	Crawl                   *CrawlOptions
+	FailOnConsoleError      bool
+	TemplateData            map[string]interface{}
+	TemplateImages          map[string]string
+	FirstPageHeaderTemplate string
+	FirstPageFooterTemplate string
+	HeaderFooterPageRanges  string
+	PagedJS                 bool
+	WaitForMath             bool
+	Fonts                   []*Font
+	WaitForImages           bool
+	WaitForImagesTimeout    time.Duration
+	CompareMedia            bool
+	WaitForSelectorState    SelectorState
+	WaitForSelectors        []string
+	WaitForSelectorPolicy   SelectorPolicy
+	SelectorMode            SelectorMode
+	HideSelectors           []string
+	RemoveSelectors         []string
+	ReplaceContent          map[string]string
+	HeadersScope            HeadersScope
+	Provenance              bool
+	LandscapePageRanges     string
+	Language                string
+	ForcedColors            bool
+	PDFVersion              string
+	ObjectStreams           StreamMode
+	XRefStreams             StreamMode
+	NavigationTimeout       time.Duration
+	HeaderTemplateURL       string
+	FooterTemplateURL       string
+	HeaderTemplateID        string
+	FooterTemplateID        string
+	ChromeWSURL             string
+	WaitForFunction         string
+	WaitForFunctionTimeout  time.Duration
+	WaitForFonts            bool
+	AutoScroll              bool
+	Actions                 []*PageAction
+	Method                  string
+	Body                    string
+	ContentType             string
+	Cookies                 []*Cookie
+	Auth                    *Credentials
+	ColorScheme             ColorScheme
+	Device                  string
+	DeviceScaleFactor       float64
+	BlockResources          []string
+	MaxRedirects            int64
+	FailOnRedirectTo        []string
+	FailOnHTTPError         bool
+	FailOnResourceErrors    bool
+	IgnoreResourceErrors    []string
+	ArchiveFormat           string
+	TaggedPDF               bool
+	Outline                 OutlineMode
+	Linearize               bool
+	Optimize                bool
+	Deterministic           bool
+	Signature               *SignatureConfig
+	OnProgress              func(Progress)        `json:"-"`
+	OnStats                 func(*Stats)          `json:"-"`
+	OnDownloadBlocked       func(url string)      `json:"-"`
+	OnConsoleMessage        func(*ConsoleMessage) `json:"-"`
+
+	// document is the HTML served at htmlDocumentURL by HTML conversions.
+	document string
+	// adFilters block the requests of ads if BlockAds is set.
+	adFilters *FilterList
+	// urlGuard blocks the requests that the converter doesn't allow.
+	urlGuard *urlGuard
 }
 
 // Media is a CSS media.
@@ -119,6 +205,39 @@ type WatermarkConfig struct {
 	Pages []string
 }
 
+// urls returns URL followed by URLs.
+func (o *ConversionOptions) urls() []string {
+	urls := make([]string, 0, len(o.URLs)+1)
+
+	if o.URL != "" {
+		urls = append(urls, o.URL)
+	}
+
+	return append(urls, o.URLs...)
+}
+
+// selectors returns Selector followed by Selectors.
+func (o *ConversionOptions) selectors() []string {
+	selectors := make([]string, 0, len(o.Selectors)+1)
+
+	if o.Selector != "" {
+		selectors = append(selectors, o.Selector)
+	}
+
+	return append(selectors, o.Selectors...)
+}
+
+// waitForSelectors returns WaitForSelector followed by WaitForSelectors.
+func (o *ConversionOptions) waitForSelectors() []string {
+	selectors := make([]string, 0, len(o.WaitForSelectors)+1)
+
+	if o.WaitForSelector != "" {
+		selectors = append(selectors, o.WaitForSelector)
+	}
+
+	return append(selectors, o.WaitForSelectors...)
+}
+
 // ParseError is returned when a PDF parameter cannot be parsed from a request body.
 type ParseError struct {
 	Key   string
@@ -129,14 +248,49 @@ func (e *ParseError) Error() string {
 	return fmt.Sprintf("Could not parse param \"%s\" (%v).", e.Key, e.Value)
 }
 
+// DurationError is returned when a duration param is neither a number of
+// milliseconds nor a duration string.
+type DurationError struct {
+	Key   string
+	Value string
+}
+
+func (e *DurationError) Error() string {
+	return fmt.Sprintf("Could not parse duration \"%s\" of param \"%s\". Use milliseconds or a duration like \"30s\", \"1500ms\" or \"2m\".", e.Value, e.Key)
+}
+
 // NewConversionOptions returns new converter options with default values.
 func NewConversionOptions() *ConversionOptions {
 	return &ConversionOptions{
-		ViewportWidth:  1920,
-		ViewportHeight: 1080,
-		WaitUntil:      "load",
-		Headers:        make(map[string]interface{}),
-		EmulateMedia:   MediaScreen,
+		ViewportWidth:         1920,
+		ViewportHeight:        1080,
+		WaitUntil:             "load",
+		Headers:               make(map[string]interface{}),
+		EmulateMedia:          MediaScreen,
+		ChromeArgs:            make([]string, 0),
+		OriginHeaders:         make(map[string]string),
+		Selectors:             make([]string, 0),
+		URLs:                  make([]string, 0),
+		TemplateData:          make(map[string]interface{}),
+		TemplateImages:        make(map[string]string),
+		Fonts:                 make([]*Font, 0),
+		WaitForSelectorState:  SelectorStateAttached,
+		WaitForSelectors:      make([]string, 0),
+		WaitForSelectorPolicy: SelectorPolicyAllOf,
+		SelectorMode:          SelectorModeExtract,
+		HideSelectors:         make([]string, 0),
+		RemoveSelectors:       make([]string, 0),
+		ReplaceContent:        make(map[string]string),
+		HeadersScope:          HeadersScopeAll,
+		ObjectStreams:         StreamModeAuto,
+		XRefStreams:           StreamModeAuto,
+		Actions:               make([]*PageAction, 0),
+		Method:                "GET",
+		Cookies:               make([]*Cookie, 0),
+		BlockResources:        make([]string, 0),
+		FailOnRedirectTo:      make([]string, 0),
+		IgnoreResourceErrors:  make([]string, 0),
+		Outline:               OutlineModeNone,
 		PDFParams: &page.PrintToPDFParams{
 			Scale:           1.0,
 			PaperWidth:      8.5,
@@ -156,178 +310,633 @@ func NewConversionOptionsFromJSONString(json string) (*ConversionOptions, error)
 	return NewConversionOptionsFromJSON(strings.NewReader(json))
 }
 
-// NewConversionOptionsFromJSON returns new converter options from JSON.
-func NewConversionOptionsFromJSON(r io.Reader) (*ConversionOptions, error) {
-	options := NewConversionOptions()
-	params := options.PDFParams
-	jsonMap := make(map[string]interface{})
+// NewConversionOptionsFromJSON returns new converter options from JSON.
+func NewConversionOptionsFromJSON(r io.Reader) (*ConversionOptions, error) {
+	options := NewConversionOptions()
+	params := options.PDFParams
+	jsonMap := make(map[string]interface{})
+
+	if err := json.NewDecoder(r).Decode(&jsonMap); err != nil {
+		return nil, ErrInvalidJSON
+	}
+
+	html, err := parseString(jsonMap, "html", "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := parseString(jsonMap, "url", "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	landscape, err := parseBool(jsonMap, "landscape", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	displayHeaderFooter, err := parseBool(jsonMap, "displayHeaderFooter", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	printBackground, err := parseBool(jsonMap, "printBackground", true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	scale, err := parseFloat64(jsonMap, "scale", 1.0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	paperWidth, err := parseUnit(jsonMap, "paperWidth", options.PDFParams.PaperWidth)
+
+	if err != nil {
+		return nil, err
+	}
+
+	paperHeight, err := parseUnit(jsonMap, "paperHeight", options.PDFParams.PaperHeight)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if format, err := parseString(jsonMap, "format", ""); err == nil {
+		format = strings.ToLower(format)
+
+		if f, ok := PaperFormats[format]; ok {
+			paperWidth = f.Width
+			paperHeight = f.Height
+		}
+	}
+
+	// Percentages of margins refer to the size of the page as printed.
+	pageWidth, pageHeight := paperWidth, paperHeight
+
+	if landscape {
+		pageWidth, pageHeight = pageHeight, pageWidth
+	}
+
+	marginTop, marginRight, marginBottom, marginLeft, err := parseMarginsFix(jsonMap, pageWidth, pageHeight)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ignoreInvalidPageRanges, err := parseBool(jsonMap, "ignoreInvalidPageRanges", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pageRanges, err := parsePageRangesString(jsonMap, "pageRanges", ignoreInvalidPageRanges)
+
+	if err != nil {
+		return nil, err
+	}
+
+	headerTemplate, err := parseString(jsonMap, "headerTemplate", "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	footerTemplate, err := parseString(jsonMap, "footerTemplate", "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	preferCSSPageSize, err := parseBool(jsonMap, "preferCSSPageSize", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	viewportWidth, err := parseInt64(jsonMap, "viewportWidth", 1920)
+
+	if err != nil {
+		return nil, err
+	}
+
+	viewportHeight, err := parseInt64(jsonMap, "viewportHeight", 1080)
+
+	if err != nil {
+		return nil, err
+	}
+
+	blockAds, err := parseBool(jsonMap, "blockAds", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	selector, selectorList, err := parseSelector(jsonMap)
+
+	if err != nil {
+		return nil, err
+	}
+
+	waitForSelector, waitForSelectors, err := parseWaitForSelector(jsonMap)
+
+	if err != nil {
+		return nil, err
+	}
+
+	waitForSelectorTimeout, err := parseDuration(jsonMap, "waitForSelectorTimeout", time.Duration(0))
+
+	if err != nil {
+		return nil, err
+	}
+
+	waitUntil, err := parseStringOnly(jsonMap, "waitUntil", "load", "load", "dom", "networkidle0", "networkidle2")
+
+	if err != nil {
+		return nil, err
+	}
+
+	waitUntilTimeout, err := parseDuration(jsonMap, "waitUntilTimeout", time.Duration(0))
+
+	if err != nil {
+		return nil, err
+	}
+
+	delay, err := parseDuration(jsonMap, "delay", time.Duration(0))
+
+	if err != nil {
+		return nil, err
+	}
+
+	timeout, err := parseDuration(jsonMap, "timeout", time.Duration(0))
+
+	if err != nil {
+		return nil, err
+	}
+
+	headers, err := parseHeaders(jsonMap)
+
+	if err != nil {
+		return nil, err
+	}
+
+	emulateMedia, err := parseEmulateMedia(jsonMap, MediaScreen)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ownerPassword, err := parseString(jsonMap, "ownerPassword", "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	userPassword, err := parseString(jsonMap, "userPassword", "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	chromeArgs, err := parseStrings(jsonMap, "chromeArgs", make([]string, 0))
+
+	if err != nil {
+		return nil, err
+	}
+
+	maxJSHeapSize, err := parseInt64(jsonMap, "maxJSHeapSize", 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	maxCPUTime, err := parseDuration(jsonMap, "maxCPUTime", time.Duration(0))
+
+	if err != nil {
+		return nil, err
+	}
+
+	sanitize, err := parseBool(jsonMap, "sanitize", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	blockDownloads, err := parseBool(jsonMap, "blockDownloads", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	blockPopups, err := parseBool(jsonMap, "blockPopups", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bypassServiceWorker, err := parseBool(jsonMap, "bypassServiceWorker", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	disableCache, err := parseBool(jsonMap, "disableCache", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	offline, err := parseBool(jsonMap, "offline", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	blockThirdPartyCookies, err := parseBool(jsonMap, "blockThirdPartyCookies", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	selectors, err := parseStrings(jsonMap, "selectors", make([]string, 0))
+
+	if err != nil {
+		return nil, err
+	}
+
+	selectorPageBreaks, err := parseBool(jsonMap, "selectorPageBreaks", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	urls, err := parseStrings(jsonMap, "urls", make([]string, 0))
+
+	if err != nil {
+		return nil, err
+	}
+
+	crawl, err := parseCrawl(jsonMap)
+
+	if err != nil {
+		return nil, err
+	}
+
+	failOnConsoleError, err := parseBool(jsonMap, "failOnConsoleError", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	templateData, err := parseMap(jsonMap, "templateData")
+
+	if err != nil {
+		return nil, err
+	}
+
+	templateImages, err := parseStringMap(jsonMap, "templateImages")
+
+	if err != nil {
+		return nil, err
+	}
+
+	firstPageHeaderTemplate, err := parseString(jsonMap, "firstPageHeaderTemplate", "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	firstPageFooterTemplate, err := parseString(jsonMap, "firstPageFooterTemplate", "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	headerFooterPageRanges, err := parsePageRangesString(jsonMap, "headerFooterPageRanges", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pagedjs, err := parseBool(jsonMap, "pagedjs", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	waitForMath, err := parseBool(jsonMap, "waitForMath", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fonts, err := parseFonts(jsonMap)
+
+	if err != nil {
+		return nil, err
+	}
+
+	waitForImages, err := parseBool(jsonMap, "waitForImages", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	waitForImagesTimeout, err := parseDuration(jsonMap, "waitForImagesTimeout", time.Duration(0))
+
+	if err != nil {
+		return nil, err
+	}
+
+	compareMedia, err := parseBool(jsonMap, "compareMedia", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	waitForSelectorState, err := parseSelectorState(jsonMap, SelectorStateAttached)
+
+	if err != nil {
+		return nil, err
+	}
+
+	waitForSelectorPolicy, err := parseSelectorPolicy(jsonMap, SelectorPolicyAllOf)
+
+	if err != nil {
+		return nil, err
+	}
+
+	selectorMode, err := parseSelectorMode(jsonMap, SelectorModeExtract)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hideSelectors, err := parseStrings(jsonMap, "hideSelectors", make([]string, 0))
+
+	if err != nil {
+		return nil, err
+	}
+
+	removeSelectors, err := parseStrings(jsonMap, "removeSelectors", make([]string, 0))
+
+	if err != nil {
+		return nil, err
+	}
+
+	replaceContent, err := parseStringMap(jsonMap, "replaceContent")
+
+	if err != nil {
+		return nil, err
+	}
+
+	headersScope, err := parseHeadersScope(jsonMap, HeadersScopeAll)
+
+	if err != nil {
+		return nil, err
+	}
+
+	provenance, err := parseBool(jsonMap, "provenance", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	landscapePageRanges, err := parsePageRangesString(jsonMap, "landscapePageRanges", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	language, err := parseString(jsonMap, "language", "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	forcedColors, err := parseBool(jsonMap, "forcedColors", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pdfVersion, err := parsePDFVersion(jsonMap, options.PDFVersion)
+
+	if err != nil {
+		return nil, err
+	}
+
+	objectStreams, err := parseStreamMode(jsonMap, "objectStreams", options.ObjectStreams)
+
+	if err != nil {
+		return nil, err
+	}
+
+	xrefStreams, err := parseStreamMode(jsonMap, "xrefStreams", options.XRefStreams)
+
+	if err != nil {
+		return nil, err
+	}
+
+	navigationTimeout, err := parseDuration(jsonMap, "navigationTimeout", options.NavigationTimeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	headerTemplateURL, err := parseString(jsonMap, "headerTemplateUrl", options.HeaderTemplateURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	footerTemplateURL, err := parseString(jsonMap, "footerTemplateUrl", options.FooterTemplateURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	headerTemplateID, err := parseString(jsonMap, "headerTemplateId", options.HeaderTemplateID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	footerTemplateID, err := parseString(jsonMap, "footerTemplateId", options.FooterTemplateID)
 
-	if err := json.NewDecoder(r).Decode(&jsonMap); err != nil {
-		return nil, ErrInvalidJSON
+	if err != nil {
+		return nil, err
 	}
 
-	html, err := parseString(jsonMap, "html", "")
+	chromeWSURL, err := parseString(jsonMap, "chromeWSURL", options.ChromeWSURL)
 
 	if err != nil {
 		return nil, err
 	}
 
-	url, err := parseString(jsonMap, "url", "")
+	transferMode, err := parseTransferMode(jsonMap, params.TransferMode)
 
 	if err != nil {
 		return nil, err
 	}
 
-	landscape, err := parseBool(jsonMap, "landscape", false)
+	waitForFunction, err := parseString(jsonMap, "waitForFunction", "")
 
 	if err != nil {
 		return nil, err
 	}
 
-	displayHeaderFooter, err := parseBool(jsonMap, "displayHeaderFooter", false)
+	waitForFunctionTimeout, err := parseDuration(jsonMap, "waitForFunctionTimeout", time.Duration(0))
 
 	if err != nil {
 		return nil, err
 	}
 
-	printBackground, err := parseBool(jsonMap, "printBackground", true)
+	waitForFonts, err := parseBool(jsonMap, "waitForFonts", false)
 
 	if err != nil {
 		return nil, err
 	}
 
-	scale, err := parseFloat64(jsonMap, "scale", 1.0)
+	autoScroll, err := parseBool(jsonMap, "autoScroll", false)
 
 	if err != nil {
 		return nil, err
 	}
 
-	paperWidth, err := parseUnit(jsonMap, "paperWidth", options.PDFParams.PaperWidth)
+	actions, err := parseActions(jsonMap)
 
 	if err != nil {
 		return nil, err
 	}
 
-	paperHeight, err := parseUnit(jsonMap, "paperHeight", options.PDFParams.PaperHeight)
+	method, err := parseMethod(jsonMap)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if format, err := parseString(jsonMap, "format", ""); err == nil {
-		format = strings.ToLower(format)
+	body, err := parseBody(jsonMap)
 
-		if f, ok := PaperFormats[format]; ok {
-			paperWidth = f.Width
-			paperHeight = f.Height
-		}
+	if err != nil {
+		return nil, err
 	}
 
-	marginTop, marginRight, marginBottom, marginLeft, err := parseMarginsFix(jsonMap)
+	contentType, err := parseString(jsonMap, "contentType", "")
+
+	if err != nil {
+		return nil, err
+	}
 
-	pageRanges, err := parseString(jsonMap, "pageRanges", "")
+	cookies, err := parseCookies(jsonMap)
 
 	if err != nil {
 		return nil, err
 	}
 
-	headerTemplate, err := parseString(jsonMap, "headerTemplate", "")
+	auth, err := parseAuth(jsonMap)
 
 	if err != nil {
 		return nil, err
 	}
 
-	footerTemplate, err := parseString(jsonMap, "footerTemplate", "")
+	colorScheme, err := parseColorScheme(jsonMap)
 
 	if err != nil {
 		return nil, err
 	}
 
-	preferCSSPageSize, err := parseBool(jsonMap, "preferCSSPageSize", false)
+	device, err := parseDevice(jsonMap)
 
 	if err != nil {
 		return nil, err
 	}
 
-	viewportWidth, err := parseInt64(jsonMap, "viewportWidth", 1920)
+	deviceScaleFactor, err := parseFloat64(jsonMap, "deviceScaleFactor", 0)
 
 	if err != nil {
 		return nil, err
 	}
 
-	viewportHeight, err := parseInt64(jsonMap, "viewportHeight", 1080)
+	blockResources, err := parseBlockResources(jsonMap)
 
 	if err != nil {
 		return nil, err
 	}
 
-	blockAds, err := parseBool(jsonMap, "blockAds", false)
+	maxRedirects, err := parseMaxRedirects(jsonMap)
 
 	if err != nil {
 		return nil, err
 	}
 
-	selector, err := parseString(jsonMap, "selector", "")
+	failOnRedirectTo, err := parseFailOnRedirectTo(jsonMap)
 
 	if err != nil {
 		return nil, err
 	}
 
-	waitForSelector, err := parseString(jsonMap, "waitForSelector", "")
+	failOnHTTPError, err := parseBool(jsonMap, "failOnHTTPError", false)
 
 	if err != nil {
 		return nil, err
 	}
 
-	waitForSelectorTimeout, err := parseDuration(jsonMap, "waitForSelectorTimeout", time.Duration(0))
+	failOnResourceErrors, err := parseBool(jsonMap, "failOnResourceErrors", false)
 
 	if err != nil {
 		return nil, err
 	}
 
-	waitUntil, err := parseStringOnly(jsonMap, "waitUntil", "load", "load", "dom")
+	ignoreResourceErrors, err := parseIgnoreResourceErrors(jsonMap)
 
 	if err != nil {
 		return nil, err
 	}
 
-	waitUntilTimeout, err := parseDuration(jsonMap, "waitUntilTimeout", time.Duration(0))
+	archiveFormat, err := parseArchiveFormat(jsonMap, options.ArchiveFormat)
 
 	if err != nil {
 		return nil, err
 	}
 
-	delay, err := parseDuration(jsonMap, "delay", time.Duration(0))
+	taggedPDF, err := parseBool(jsonMap, "taggedPDF", false)
 
 	if err != nil {
 		return nil, err
 	}
 
-	timeout, err := parseDuration(jsonMap, "timeout", time.Duration(0))
+	outline, err := parseOutlineMode(jsonMap, OutlineModeNone)
 
 	if err != nil {
 		return nil, err
 	}
 
-	headers, err := parseHeaders(jsonMap)
+	linearize, err := parseBool(jsonMap, "linearize", false)
 
 	if err != nil {
 		return nil, err
 	}
 
-	emulateMedia, err := parseEmulateMedia(jsonMap, MediaScreen)
+	optimize, err := parseBool(jsonMap, "optimize", false)
 
 	if err != nil {
 		return nil, err
 	}
 
-	ownerPassword, err := parseString(jsonMap, "ownerPassword", "")
+	deterministic, err := parseBool(jsonMap, "deterministic", false)
 
 	if err != nil {
 		return nil, err
 	}
 
-	userPassword, err := parseString(jsonMap, "userPassword", "")
+	signature, err := parseSignature(jsonMap)
 
 	if err != nil {
 		return nil, err
@@ -336,6 +945,7 @@ func NewConversionOptionsFromJSON(r io.Reader) (*ConversionOptions, error) {
 	options.HTML = html
 	options.URL = url
 	params.Landscape = landscape
+	params.TransferMode = transferMode
 	params.DisplayHeaderFooter = displayHeaderFooter
 	params.PrintBackground = printBackground
 	params.Scale = scale
@@ -346,6 +956,7 @@ func NewConversionOptionsFromJSON(r io.Reader) (*ConversionOptions, error) {
 	params.MarginLeft = marginLeft
 	params.MarginRight = marginRight
 	params.PageRanges = pageRanges
+	params.IgnoreInvalidPageRanges = ignoreInvalidPageRanges
 	params.HeaderTemplate = headerTemplate
 	params.FooterTemplate = footerTemplate
 	params.PreferCSSPageSize = preferCSSPageSize
@@ -363,6 +974,79 @@ func NewConversionOptionsFromJSON(r io.Reader) (*ConversionOptions, error) {
 	options.EmulateMedia = emulateMedia
 	options.OwnerPassword = ownerPassword
 	options.UserPassword = userPassword
+	options.ChromeArgs = chromeArgs
+	options.MaxJSHeapSize = maxJSHeapSize
+	options.MaxCPUTime = maxCPUTime
+	options.Sanitize = sanitize
+	options.BlockDownloads = blockDownloads
+	options.BlockPopups = blockPopups
+	options.BypassServiceWorker = bypassServiceWorker
+	options.DisableCache = disableCache
+	options.Offline = offline
+	options.BlockThirdPartyCookies = blockThirdPartyCookies
+	options.Selectors = append(selectorList, selectors...)
+	options.SelectorPageBreaks = selectorPageBreaks
+	options.URLs = urls
+	options.Crawl = crawl
+	options.FailOnConsoleError = failOnConsoleError
+	options.TemplateData = templateData
+	options.TemplateImages = templateImages
+	options.FirstPageHeaderTemplate = firstPageHeaderTemplate
+	options.FirstPageFooterTemplate = firstPageFooterTemplate
+	options.HeaderFooterPageRanges = headerFooterPageRanges
+	options.PagedJS = pagedjs
+	options.WaitForMath = waitForMath
+	options.Fonts = fonts
+	options.WaitForImages = waitForImages
+	options.WaitForImagesTimeout = waitForImagesTimeout
+	options.CompareMedia = compareMedia
+	options.WaitForSelectorState = waitForSelectorState
+	options.WaitForSelectors = waitForSelectors
+	options.WaitForSelectorPolicy = waitForSelectorPolicy
+	options.SelectorMode = selectorMode
+	options.HideSelectors = hideSelectors
+	options.RemoveSelectors = removeSelectors
+	options.ReplaceContent = replaceContent
+	options.HeadersScope = headersScope
+	options.Provenance = provenance
+	options.LandscapePageRanges = landscapePageRanges
+	options.Language = language
+	options.ForcedColors = forcedColors
+	options.PDFVersion = pdfVersion
+	options.ObjectStreams = objectStreams
+	options.XRefStreams = xrefStreams
+	options.NavigationTimeout = navigationTimeout
+	options.HeaderTemplateURL = headerTemplateURL
+	options.FooterTemplateURL = footerTemplateURL
+	options.HeaderTemplateID = headerTemplateID
+	options.FooterTemplateID = footerTemplateID
+	options.ChromeWSURL = chromeWSURL
+	options.WaitForFunction = waitForFunction
+	options.WaitForFunctionTimeout = waitForFunctionTimeout
+	options.WaitForFonts = waitForFonts
+	options.AutoScroll = autoScroll
+	options.Actions = actions
+	options.Method = method
+	options.Body = body
+	options.ContentType = contentType
+	options.Cookies = cookies
+	options.Auth = auth
+	options.ColorScheme = colorScheme
+	options.Device = device
+	options.DeviceScaleFactor = deviceScaleFactor
+	options.BlockResources = blockResources
+	options.MaxRedirects = maxRedirects
+	options.FailOnRedirectTo = failOnRedirectTo
+	options.FailOnHTTPError = failOnHTTPError
+	options.FailOnResourceErrors = failOnResourceErrors
+	options.IgnoreResourceErrors = ignoreResourceErrors
+	options.ArchiveFormat = archiveFormat
+	options.TaggedPDF = taggedPDF
+	options.Outline = outline
+	options.Linearize = linearize
+	options.Optimize = optimize
+	options.Deterministic = deterministic
+	options.Signature = signature
 
 	return options, nil
 }
@@ -425,18 +1109,44 @@ func parseFloat64(jsonMap map[string]interface{}, key string, def float64) (floa
 	return v, nil
 }
 
+// parseDuration parses a duration given in milliseconds, e.g. 1500, or as a
+// duration string, e.g. "1.5s", "1500ms" or "2m". Negative durations are 0.
 func parseDuration(jsonMap map[string]interface{}, key string, def time.Duration) (time.Duration, error) {
-	val, err := parseInt64(jsonMap, key, 0)
+	value, ok := jsonMap[key]
 
-	if err != nil {
-		return 0, err
+	if !ok {
+		return def, nil
+	}
+
+	var d time.Duration
+
+	switch v := value.(type) {
+	case string:
+		var err error
+
+		if ms, perr := strconv.ParseInt(strings.TrimSpace(v), 10, 64); perr == nil {
+			d = time.Duration(ms) * time.Millisecond
+		} else if d, err = time.ParseDuration(strings.TrimSpace(v)); err != nil {
+			return 0, &DurationError{
+				Key:   key,
+				Value: v,
+			}
+		}
+	default:
+		ms, err := parseInt64(jsonMap, key, 0)
+
+		if err != nil {
+			return 0, err
+		}
+
+		d = time.Duration(ms) * time.Millisecond
 	}
 
-	if val < 0 {
-		val = 0
+	if d < 0 {
+		d = 0
 	}
 
-	return time.Duration(val) * time.Millisecond, nil
+	return d, nil
 }
 
 func parseString(jsonMap map[string]interface{}, key, def string) (string, error) {
@@ -535,6 +1245,12 @@ func parseStringOnly(jsonMap map[string]interface{}, key, def string, allowed ..
 }
 
 func parseUnit(jsonMap map[string]interface{}, key string, def float64) (float64, error) {
+	return parseRelativeUnit(jsonMap, key, def, 0)
+}
+
+// parseRelativeUnit parses a length like parseUnit, which may also be given in
+// percent of relative, e.g. "5%". Percentages aren't allowed if relative is 0.
+func parseRelativeUnit(jsonMap map[string]interface{}, key string, def, relative float64) (float64, error) {
 	raw, ok := jsonMap[key]
 
 	if !ok {
@@ -554,7 +1270,7 @@ func parseUnit(jsonMap map[string]interface{}, key string, def float64) (float64
 		}
 	}
 
-	in, err := stringToInch(sval)
+	in, err := relativeToInch(sval, relative)
 
 	if err != nil {
 		return 0, &ParseError{
@@ -566,6 +1282,28 @@ func parseUnit(jsonMap map[string]interface{}, key string, def float64) (float64
 	return in, nil
 }
 
+// relativeToInch converts a length to inches like stringToInch. Percentages,
+// e.g. "5%", are converted relative to the given length in inches.
+func relativeToInch(raw string, relative float64) (float64, error) {
+	value := strings.TrimSpace(raw)
+
+	if !strings.HasSuffix(value, "%") {
+		return stringToInch(value)
+	}
+
+	if relative <= 0 {
+		return 0, errors.New("invalid unit")
+	}
+
+	percent, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(value, "%")), 64)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return math.Round(percent*relative) / 100, nil
+}
+
 func stringToInch(raw string) (float64, error) {
 	if len(raw) < 2 {
 		return 0, errors.New("invalid unit")
@@ -598,8 +1336,8 @@ func pixelToInch(pixel float64) float64 {
 	return math.Round((pixel*100)/96) / 100
 }
 
-func parseMarginsFix(jsonMap map[string]interface{}) (float64, float64, float64, float64, error) {
-	mt, mr, mb, ml, err := parseMargins(jsonMap)
+func parseMarginsFix(jsonMap map[string]interface{}, width, height float64) (float64, float64, float64, float64, error) {
+	mt, mr, mb, ml, err := parseMargins(jsonMap, width, height)
 
 	if err != nil {
 		return mt, mr, mb, ml, err
@@ -618,37 +1356,39 @@ func parseMarginsFix(jsonMap map[string]interface{}) (float64, float64, float64,
 	return mt, mr, mb, ml, err
 }
 
-func parseMargins(jsonMap map[string]interface{}) (float64, float64, float64, float64, error) {
+// parseMargins parses the margins in inches. Percentages refer to the height
+// of the page for the top and bottom margin and to its width otherwise.
+func parseMargins(jsonMap map[string]interface{}, width, height float64) (float64, float64, float64, float64, error) {
 	if margin, err := parseFloat64(jsonMap, "margin", -1); err == nil && margin > -1 {
 		m := pixelToInch(margin)
 		return m, m, m, m, nil
 	}
 
 	if margin, err := parseString(jsonMap, "margin", ""); err == nil && margin != "" {
-		return parseMarginsFrom(margin)
+		return parseMarginsFrom(margin, width, height)
 	}
 
 	var marginTop, marginRight, marginBottom, marginLeft float64
 
-	marginTop, err := parseUnit(jsonMap, "marginTop", 0.4)
+	marginTop, err := parseRelativeUnit(jsonMap, "marginTop", 0.4, height)
 
 	if err != nil {
 		return marginTop, marginRight, marginBottom, 0, err
 	}
 
-	marginRight, err = parseUnit(jsonMap, "marginRight", 0.4)
+	marginRight, err = parseRelativeUnit(jsonMap, "marginRight", 0.4, width)
 
 	if err != nil {
 		return marginTop, marginRight, marginBottom, 0, err
 	}
 
-	marginBottom, err = parseUnit(jsonMap, "marginBottom", 0.4)
+	marginBottom, err = parseRelativeUnit(jsonMap, "marginBottom", 0.4, height)
 
 	if err != nil {
 		return marginTop, marginRight, marginBottom, 0, err
 	}
 
-	marginLeft, err = parseUnit(jsonMap, "marginLeft", 0.4)
+	marginLeft, err = parseRelativeUnit(jsonMap, "marginLeft", 0.4, width)
 
 	if err != nil {
 		return marginTop, marginRight, marginBottom, 0, err
@@ -657,8 +1397,8 @@ func parseMargins(jsonMap map[string]interface{}) (float64, float64, float64, fl
 	return marginTop, marginRight, marginBottom, marginLeft, nil
 }
 
-func parseMarginsFrom(raw string) (float64, float64, float64, float64, error) {
-	values := strings.Split(strings.Trim(raw, " "), " ")
+func parseMarginsFrom(raw string, width, height float64) (float64, float64, float64, float64, error) {
+	values := strings.Fields(raw)
 
 	if len(values) == 0 {
 		return 0, 0, 0, 0, &ParseError{
@@ -667,64 +1407,159 @@ func parseMarginsFrom(raw string) (float64, float64, float64, float64, error) {
 		}
 	}
 
-	var mt, mr, mb, ml float64
+	// The values are expanded to top, right, bottom and left like in CSS.
+	switch len(values) {
+	case 1:
+		values = []string{values[0], values[0], values[0], values[0]}
+	case 2:
+		values = []string{values[0], values[1], values[0], values[1]}
+	case 3:
+		values = []string{values[0], values[1], values[2], values[1]}
+	default:
+		values = values[:4]
+	}
 
-	mt, err := stringToInch(values[0])
+	margins := make([]float64, 4)
 
-	if err != nil {
-		return 0, 0, 0, 0, err
+	for i, value := range values {
+		relative := width
+
+		if i%2 == 0 {
+			relative = height
+		}
+
+		m, err := relativeToInch(value, relative)
+
+		if err != nil {
+			return 0, 0, 0, 0, err
+		}
+
+		margins[i] = m
 	}
 
-	if len(values) == 1 {
-		return mt, mt, mt, mt, nil
+	return margins[0], margins[1], margins[2], margins[3], nil
+}
+
+func parseHeaders(jsonMap map[string]interface{}) (map[string]interface{}, error) {
+	raw, ok := jsonMap["headers"]
+
+	if !ok {
+		return make(map[string]interface{}), nil
 	}
 
-	mr, err = stringToInch(values[1])
+	headers, ok := raw.(map[string]interface{})
 
-	if err != nil {
-		return 0, 0, 0, 0, err
+	if !ok {
+		return nil, &ParseError{
+			Key:   "headers",
+			Value: raw,
+		}
 	}
 
-	if len(values) == 2 {
-		return mt, mr, mt, mr, nil
+	return headers, nil
+}
+
+func parseCrawl(jsonMap map[string]interface{}) (*CrawlOptions, error) {
+	raw, ok := jsonMap["crawl"]
+
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	crawlMap, ok := raw.(map[string]interface{})
+
+	if !ok {
+		return nil, &ParseError{
+			Key:   "crawl",
+			Value: raw,
+		}
+	}
+
+	crawl := NewCrawlOptions()
+
+	include, err := parseStrings(crawlMap, "include", crawl.Include)
+
+	if err != nil {
+		return nil, err
 	}
 
-	mb, err = stringToInch(values[2])
+	exclude, err := parseStrings(crawlMap, "exclude", crawl.Exclude)
 
 	if err != nil {
-		return 0, 0, 0, 0, err
+		return nil, err
 	}
 
-	if len(values) == 3 {
-		return mt, mr, mb, mr, nil
+	maxDepth, err := parseInt64(crawlMap, "maxDepth", int64(crawl.MaxDepth))
+
+	if err != nil {
+		return nil, err
 	}
 
-	ml, err = stringToInch(values[3])
+	maxPages, err := parseInt64(crawlMap, "maxPages", int64(crawl.MaxPages))
 
 	if err != nil {
-		return 0, 0, 0, 0, err
+		return nil, err
+	}
+
+	for _, pattern := range append(include, exclude...) {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, &ParseError{
+				Key:   "crawl",
+				Value: pattern,
+			}
+		}
 	}
 
-	return mt, mr, mb, ml, nil
+	crawl.Include = include
+	crawl.Exclude = exclude
+	crawl.MaxDepth = int(maxDepth)
+	crawl.MaxPages = int(maxPages)
+
+	return crawl, nil
 }
 
-func parseHeaders(jsonMap map[string]interface{}) (map[string]interface{}, error) {
-	raw, ok := jsonMap["headers"]
+func parseMap(jsonMap map[string]interface{}, key string) (map[string]interface{}, error) {
+	raw, ok := jsonMap[key]
 
 	if !ok {
 		return make(map[string]interface{}), nil
 	}
 
-	headers, ok := raw.(map[string]interface{})
+	m, ok := raw.(map[string]interface{})
 
 	if !ok {
 		return nil, &ParseError{
-			Key:   "headers",
+			Key:   key,
 			Value: raw,
 		}
 	}
 
-	return headers, nil
+	return m, nil
+}
+
+func parseStringMap(jsonMap map[string]interface{}, key string) (map[string]string, error) {
+	raw, err := parseMap(jsonMap, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]string, len(raw))
+
+	for k, v := range raw {
+		s, ok := v.(string)
+
+		if !ok {
+			return nil, &ParseError{
+				Key:   key,
+				Value: v,
+			}
+		}
+
+		m[k] = s
+	}
+
+	return m, nil
 }
 
 func parseEmulateMedia(jsonMap map[string]interface{}, def Media) (Media, error) {
@@ -754,3 +1589,205 @@ func parseEmulateMedia(jsonMap map[string]interface{}, def Media) (Media, error)
 
 	return media, nil
 }
+
+// parsePageRangesString parses page ranges like "1-5, 8, 11-". If lenient is
+// true, ranges like "3-2" are ignored instead of being rejected.
+func parsePageRangesString(jsonMap map[string]interface{}, key string, lenient bool) (string, error) {
+	s, err := parseString(jsonMap, key, "")
+
+	if err != nil || s == "" {
+		return s, err
+	}
+
+	if _, err := parsePageRangesLenient(s, lenient); err != nil {
+		return "", &ParseError{
+			Key:   key,
+			Value: s,
+		}
+	}
+
+	return s, nil
+}
+
+func parseFonts(jsonMap map[string]interface{}) ([]*Font, error) {
+	raw, ok := jsonMap["fonts"]
+
+	if !ok || raw == nil {
+		return make([]*Font, 0), nil
+	}
+
+	list, ok := raw.([]interface{})
+
+	if !ok {
+		return nil, &ParseError{
+			Key:   "fonts",
+			Value: raw,
+		}
+	}
+
+	fonts := make([]*Font, 0, len(list))
+
+	for _, item := range list {
+		fontMap, ok := item.(map[string]interface{})
+
+		if !ok {
+			return nil, &ParseError{
+				Key:   "fonts",
+				Value: item,
+			}
+		}
+
+		family, err := parseString(fontMap, "family", "")
+
+		if err != nil {
+			return nil, err
+		}
+
+		url, err := parseString(fontMap, "url", "")
+
+		if err != nil {
+			return nil, err
+		}
+
+		encoded, err := parseString(fontMap, "data", "")
+
+		if err != nil {
+			return nil, err
+		}
+
+		weight, err := parseString(fontMap, "weight", "")
+
+		if err != nil {
+			return nil, err
+		}
+
+		style, err := parseString(fontMap, "style", "")
+
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := base64.StdEncoding.DecodeString(encoded)
+
+		if err != nil || family == "" || (url == "" && len(data) == 0) {
+			return nil, &ParseError{
+				Key:   "fonts",
+				Value: item,
+			}
+		}
+
+		fonts = append(fonts, &Font{
+			Family: family,
+			URL:    url,
+			Data:   data,
+			Weight: weight,
+			Style:  style,
+		})
+	}
+
+	return fonts, nil
+}
+
+func parseSelectorState(jsonMap map[string]interface{}, def SelectorState) (SelectorState, error) {
+	state, err := parseStringOnly(jsonMap, "waitForSelectorState", string(def),
+		string(SelectorStateAttached), string(SelectorStateVisible), string(SelectorStateHidden))
+
+	return SelectorState(state), err
+}
+
+// parseSelector parses "selector", which is either a selector or a list of
+// selectors that are printed in order.
+func parseSelector(jsonMap map[string]interface{}) (string, []string, error) {
+	if _, ok := jsonMap["selector"].([]interface{}); ok {
+		selectors, err := parseStrings(jsonMap, "selector", make([]string, 0))
+
+		return "", selectors, err
+	}
+
+	selector, err := parseString(jsonMap, "selector", "")
+
+	return selector, make([]string, 0), err
+}
+
+// parseWaitForSelector parses "waitForSelector", which is either a selector or
+// a list of selectors.
+func parseWaitForSelector(jsonMap map[string]interface{}) (string, []string, error) {
+	if _, ok := jsonMap["waitForSelector"].([]interface{}); ok {
+		selectors, err := parseStrings(jsonMap, "waitForSelector", make([]string, 0))
+
+		return "", selectors, err
+	}
+
+	selector, err := parseString(jsonMap, "waitForSelector", "")
+
+	return selector, make([]string, 0), err
+}
+
+func parseSelectorPolicy(jsonMap map[string]interface{}, def SelectorPolicy) (SelectorPolicy, error) {
+	policy, err := parseStringOnly(jsonMap, "waitForSelectorPolicy", string(def),
+		string(SelectorPolicyAllOf), string(SelectorPolicyAnyOf))
+
+	return SelectorPolicy(policy), err
+}
+
+func parseSelectorMode(jsonMap map[string]interface{}, def SelectorMode) (SelectorMode, error) {
+	mode, err := parseStringOnly(jsonMap, "selectorMode", string(def),
+		string(SelectorModeExtract), string(SelectorModeIsolate))
+
+	return SelectorMode(mode), err
+}
+
+func parseHeadersScope(jsonMap map[string]interface{}, def HeadersScope) (HeadersScope, error) {
+	scope, err := parseStringOnly(jsonMap, "headersScope", string(def),
+		string(HeadersScopeAll), string(HeadersScopeDocument), string(HeadersScopeOrigin))
+
+	return HeadersScope(scope), err
+}
+
+func parseWatermark(jsonMap map[string]interface{}) (*WatermarkConfig, error) {
+	raw, ok := jsonMap["watermark"]
+
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	watermarkMap, ok := raw.(map[string]interface{})
+
+	if !ok {
+		return nil, &ParseError{
+			Key:   "watermark",
+			Value: raw,
+		}
+	}
+
+	query, err := parseString(watermarkMap, "query", "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	onTop, err := parseBool(watermarkMap, "onTop", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := parseStrings(watermarkMap, "pages", nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if query == "" {
+		return nil, &ParseError{
+			Key:   "watermark",
+			Value: raw,
+		}
+	}
+
+	return &WatermarkConfig{
+		Query: query,
+		OnTop: onTop,
+		Pages: pages,
+	}, nil
+}
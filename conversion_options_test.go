@@ -3,6 +3,7 @@ package pdfire_test
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -47,6 +48,74 @@ func TestNewConversionOptions(t *testing.T) {
 	assert.Equal(pdfire.MediaScreen, options.EmulateMedia)
 	assert.Equal("", options.OwnerPassword)
 	assert.Equal("", options.UserPassword)
+	assert.Equal([]string{}, options.ChromeArgs)
+	assert.Equal(int64(0), options.MaxJSHeapSize)
+	assert.Equal(time.Duration(0), options.MaxCPUTime)
+	assert.Equal(false, options.Sanitize)
+	assert.Equal(false, options.BlockDownloads)
+	assert.Equal(false, options.BlockPopups)
+	assert.Equal(false, options.BypassServiceWorker)
+	assert.Equal(false, options.DisableCache)
+	assert.Equal(false, options.Offline)
+	assert.Equal(false, options.BlockThirdPartyCookies)
+	assert.Equal(map[string]string{}, options.OriginHeaders)
+	assert.Equal([]string{}, options.Selectors)
+	assert.Equal(false, options.SelectorPageBreaks)
+	assert.Equal([]string{}, options.URLs)
+	assert.Nil(options.Crawl)
+	assert.Equal(false, options.FailOnConsoleError)
+	assert.Equal(map[string]interface{}{}, options.TemplateData)
+	assert.Equal(map[string]string{}, options.TemplateImages)
+	assert.Equal("", options.FirstPageHeaderTemplate)
+	assert.Equal("", options.FirstPageFooterTemplate)
+	assert.Equal("", options.HeaderFooterPageRanges)
+	assert.Equal(false, options.PagedJS)
+	assert.Equal(false, options.WaitForMath)
+	assert.Equal([]*pdfire.Font{}, options.Fonts)
+	assert.Equal(false, options.WaitForImages)
+	assert.Equal(time.Duration(0), options.WaitForImagesTimeout)
+	assert.Equal(false, options.CompareMedia)
+	assert.Equal(pdfire.SelectorStateAttached, options.WaitForSelectorState)
+	assert.Equal([]string{}, options.WaitForSelectors)
+	assert.Equal(pdfire.SelectorPolicyAllOf, options.WaitForSelectorPolicy)
+	assert.Equal(pdfire.SelectorModeExtract, options.SelectorMode)
+	assert.Equal([]string{}, options.HideSelectors)
+	assert.Equal([]string{}, options.RemoveSelectors)
+	assert.Equal(map[string]string{}, options.ReplaceContent)
+	assert.Equal(pdfire.HeadersScopeAll, options.HeadersScope)
+	assert.Equal(false, options.Provenance)
+	assert.Equal("", options.LandscapePageRanges)
+	assert.Equal("", options.Language)
+	assert.Equal(false, options.ForcedColors)
+	assert.Equal(pdfire.StreamModeAuto, options.ObjectStreams)
+	assert.Equal(pdfire.StreamModeAuto, options.XRefStreams)
+	assert.Equal(time.Duration(0), options.NavigationTimeout)
+	assert.Equal("", options.WaitForFunction)
+	assert.Equal(time.Duration(0), options.WaitForFunctionTimeout)
+	assert.Equal(false, options.WaitForFonts)
+	assert.Equal(false, options.AutoScroll)
+	assert.Equal([]*pdfire.PageAction{}, options.Actions)
+	assert.Equal("GET", options.Method)
+	assert.Equal("", options.Body)
+	assert.Equal("", options.ContentType)
+	assert.Equal([]*pdfire.Cookie{}, options.Cookies)
+	assert.Equal((*pdfire.Credentials)(nil), options.Auth)
+	assert.Equal(pdfire.ColorScheme(""), options.ColorScheme)
+	assert.Equal("", options.Device)
+	assert.Equal(0.0, options.DeviceScaleFactor)
+	assert.Equal([]string{}, options.BlockResources)
+	assert.Equal(int64(0), options.MaxRedirects)
+	assert.Equal([]string{}, options.FailOnRedirectTo)
+	assert.Equal(false, options.FailOnHTTPError)
+	assert.Equal(false, options.FailOnResourceErrors)
+	assert.Equal([]string{}, options.IgnoreResourceErrors)
+	assert.Equal("", options.ArchiveFormat)
+	assert.Equal(false, options.TaggedPDF)
+	assert.Equal(pdfire.OutlineModeNone, options.Outline)
+	assert.Equal(false, options.Linearize)
+	assert.Equal(false, options.Optimize)
+	assert.Equal(false, options.Deterministic)
+	assert.Nil(options.Signature)
 }
 
 func TestNewConversionOptionsFromJSON(t *testing.T) {
@@ -73,6 +142,7 @@ func TestNewConversionOptionsFromJSON(t *testing.T) {
 	assert.Equal(0.3, options.PDFParams.MarginLeft)
 	assert.Equal(0.7, options.PDFParams.MarginRight)
 	assert.Equal("1-3", options.PDFParams.PageRanges)
+	assert.Equal(true, options.PDFParams.IgnoreInvalidPageRanges)
 	assert.Equal("<p>HEADER</p>", options.PDFParams.HeaderTemplate)
 	assert.Equal("<p>FOOTER</p>", options.PDFParams.FooterTemplate)
 	assert.Equal(true, options.PDFParams.PreferCSSPageSize)
@@ -92,6 +162,260 @@ func TestNewConversionOptionsFromJSON(t *testing.T) {
 	assert.Equal(pdfire.MediaPrint, options.EmulateMedia)
 	assert.Equal("ownerpw", options.OwnerPassword)
 	assert.Equal("userpw", options.UserPassword)
+	assert.Equal([]string{"--lang=de", "--force-color-profile=srgb"}, options.ChromeArgs)
+	assert.Equal(int64(67108864), options.MaxJSHeapSize)
+	assert.Equal(time.Duration(5000)*time.Millisecond, options.MaxCPUTime)
+	assert.Equal(true, options.Sanitize)
+	assert.Equal(true, options.BlockDownloads)
+	assert.Equal(true, options.BlockPopups)
+	assert.Equal(true, options.BypassServiceWorker)
+	assert.Equal(true, options.DisableCache)
+	assert.Equal(true, options.Offline)
+	assert.Equal(true, options.BlockThirdPartyCookies)
+	assert.Equal([]string{"#header", ".chart"}, options.Selectors)
+	assert.Equal(true, options.SelectorPageBreaks)
+	assert.Equal([]string{"https://example.com/login", "https://example.com/report"}, options.URLs)
+	assert.Equal(&pdfire.CrawlOptions{Include: []string{`^https://example\.com/docs/`}, Exclude: []string{`\.pdf$`}, MaxDepth: 3, MaxPages: 20}, options.Crawl)
+	assert.Equal(true, options.FailOnConsoleError)
+	assert.Equal(map[string]interface{}{"customerName": "ACME", "total": 12.5}, options.TemplateData)
+	assert.Equal(map[string]string{"logo": "iVBORw0KGgo="}, options.TemplateImages)
+	assert.Equal(`<div class="letterhead">ACME</div>`, options.FirstPageHeaderTemplate)
+	assert.Equal("<div>Page 1</div>", options.FirstPageFooterTemplate)
+	assert.Equal("2-9", options.HeaderFooterPageRanges)
+	assert.Equal(true, options.PagedJS)
+	assert.Equal(true, options.WaitForMath)
+	assert.Equal([]*pdfire.Font{{Family: "ACME Sans", URL: "https://example.com/acme.woff2", Data: []byte{}, Weight: "bold"}, {Family: "ACME Mono", Data: []byte("wOF2")}}, options.Fonts)
+	assert.Equal(true, options.WaitForImages)
+	assert.Equal(time.Duration(5000)*time.Millisecond, options.WaitForImagesTimeout)
+	assert.Equal(true, options.CompareMedia)
+	assert.Equal(pdfire.SelectorStateVisible, options.WaitForSelectorState)
+	assert.Equal([]string{}, options.WaitForSelectors)
+	assert.Equal(pdfire.SelectorPolicyAnyOf, options.WaitForSelectorPolicy)
+	assert.Equal(pdfire.SelectorModeIsolate, options.SelectorMode)
+	assert.Equal([]string{"#cookie-banner", ".chat-widget"}, options.HideSelectors)
+	assert.Equal([]string{".sticky-header"}, options.RemoveSelectors)
+	assert.Equal(map[string]string{"#customer-name": "ACME Corp"}, options.ReplaceContent)
+	assert.Equal(pdfire.HeadersScopeOrigin, options.HeadersScope)
+	assert.Equal(true, options.Provenance)
+	assert.Equal("3-4", options.LandscapePageRanges)
+	assert.Equal("de-CH, de;q=0.9", options.Language)
+	assert.Equal(true, options.ForcedColors)
+	assert.Equal("1.7", options.PDFVersion)
+	assert.Equal(pdfire.StreamModeOff, options.ObjectStreams)
+	assert.Equal(pdfire.StreamModeOff, options.XRefStreams)
+	assert.Equal(15*time.Second, options.NavigationTimeout)
+	assert.Equal("https://example.com/header.html", options.HeaderTemplateURL)
+	assert.Equal("https://example.com/footer.html", options.FooterTemplateURL)
+	assert.Equal("letterhead", options.HeaderTemplateID)
+	assert.Equal("legal-footer", options.FooterTemplateID)
+	assert.Equal("ws://chrome:9222/devtools/browser/b0b8a4fb", options.ChromeWSURL)
+	assert.Equal("window.__APP_READY === true", options.WaitForFunction)
+	assert.Equal(5*time.Second, options.WaitForFunctionTimeout)
+	assert.Equal(true, options.WaitForFonts)
+	assert.Equal(true, options.AutoScroll)
+	assert.Equal([]*pdfire.PageAction{{Type: pdfire.ActionClick, Selector: "#accept-cookies"}, {Type: pdfire.ActionFill, Selector: "#search", Value: "invoices"}, {Type: pdfire.ActionEvaluate, Script: "window.scrollTo(0, 0)"}, {Type: pdfire.ActionWait, Duration: 500 * time.Millisecond, Timeout: 2 * time.Second}}, options.Actions)
+	assert.Equal("POST", options.Method)
+	assert.Equal("from=2019-01-01&to=2019-12-31", options.Body)
+	assert.Equal("application/x-www-form-urlencoded", options.ContentType)
+	assert.Equal([]*pdfire.Cookie{{Name: "session", Value: "abc123", Domain: "example.com", Path: "/", Secure: true, HTTPOnly: true, Expires: time.Unix(1893456000, 0)}}, options.Cookies)
+	assert.Equal(&pdfire.Credentials{Username: "reports", Password: "secret"}, options.Auth)
+	assert.Equal(pdfire.ColorSchemeDark, options.ColorScheme)
+	assert.Equal("iphone-14", options.Device)
+	assert.Equal(2.0, options.DeviceScaleFactor)
+	assert.Equal([]string{"image", "font", "media"}, options.BlockResources)
+	assert.Equal(int64(3), options.MaxRedirects)
+	assert.Equal([]string{"https://*/login*"}, options.FailOnRedirectTo)
+	assert.Equal(true, options.FailOnHTTPError)
+	assert.Equal(true, options.FailOnResourceErrors)
+	assert.Equal([]string{"*.analytics.example.com"}, options.IgnoreResourceErrors)
+	assert.Equal("pdf/a-2b", options.ArchiveFormat)
+	assert.Equal(true, options.TaggedPDF)
+	assert.Equal(pdfire.OutlineModeHeadings, options.Outline)
+	assert.Equal(true, options.Linearize)
+	assert.Equal(true, options.Optimize)
+	assert.Equal(true, options.Deterministic)
+	assert.Equal(&pdfire.SignatureConfig{
+		Certificate:  []byte("signature"),
+		Password:     "secret",
+		TimestampURL: "https://tsa.example.com",
+		Reason:       "Invoice",
+		Location:     "Nairobi",
+	}, options.Signature)
+}
+
+func TestNewConversionOptionsFromJSONDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	options, err := pdfire.NewConversionOptionsFromJSONString(`{}`)
+
+	assert.Nil(err)
+	assert.Equal(false, options.BlockDownloads)
+	assert.Equal(false, options.BlockPopups)
+	assert.Equal(false, options.WaitForMath)
+}
+
+func TestNewConversionOptionsFromJSONTransferMode(t *testing.T) {
+	assert := assert.New(t)
+
+	options, err := pdfire.NewConversionOptionsFromJSONString(`{"transferMode": "stream"}`)
+
+	assert.Nil(err)
+	assert.Equal(page.PrintToPDFTransferModeReturnAsStream, options.PDFParams.TransferMode)
+
+	options, err = pdfire.NewConversionOptionsFromJSONString(`{"transferMode": "ReturnAsStream"}`)
+
+	assert.Nil(options)
+	assert.Equal(&pdfire.ParseError{Key: "transferMode", Value: "ReturnAsStream"}, err)
+}
+
+func TestNewConversionOptionsFromJSONWaitUntilNetworkIdle(t *testing.T) {
+	assert := assert.New(t)
+
+	options, err := pdfire.NewConversionOptionsFromJSONString(`{"waitUntil": "networkidle2"}`)
+
+	assert.Nil(err)
+	assert.Equal("networkidle2", options.WaitUntil)
+
+	options, err = pdfire.NewConversionOptionsFromJSONString(`{"waitUntil": "networkidle"}`)
+
+	assert.Nil(options)
+	assert.Equal(&pdfire.ParseError{Key: "waitUntil", Value: "networkidle"}, err)
+}
+
+func TestNewConversionOptionsFromJSONRedirects(t *testing.T) {
+	assert := assert.New(t)
+
+	options, err := pdfire.NewConversionOptionsFromJSONString(`{"maxRedirects": -1}`)
+
+	assert.Nil(options)
+	assert.Equal(&pdfire.ParseError{Key: "maxRedirects", Value: int64(-1)}, err)
+
+	options, err = pdfire.NewConversionOptionsFromJSONString(`{"failOnRedirectTo": ["10.0.0.0/8"]}`)
+
+	assert.Nil(options)
+	assert.Equal(&pdfire.ParseError{Key: "failOnRedirectTo", Value: "10.0.0.0/8"}, err)
+}
+
+func TestNewConversionOptionsFromJSONActions(t *testing.T) {
+	assert := assert.New(t)
+
+	options, err := pdfire.NewConversionOptionsFromJSONString(`{"actions": [{"type": "click"}]}`)
+
+	assert.Nil(options)
+	assert.Equal(&pdfire.ParseError{Key: "actions", Value: map[string]interface{}{"type": "click"}}, err)
+
+	options, err = pdfire.NewConversionOptionsFromJSONString(`{"actions": [{"type": "hover", "selector": "#menu"}]}`)
+
+	assert.Nil(options)
+	assert.Equal(&pdfire.ParseError{Key: "type", Value: "hover"}, err)
+}
+
+func TestNewConversionOptionsFromJSONBody(t *testing.T) {
+	assert := assert.New(t)
+
+	options, err := pdfire.NewConversionOptionsFromJSONString(`{"method": "PUT", "body": "{\"from\": 2019}", "contentType": "application/json"}`)
+
+	assert.Nil(err)
+	assert.Equal("PUT", options.Method)
+	assert.Equal(`{"from": 2019}`, options.Body)
+
+	options, err = pdfire.NewConversionOptionsFromJSONString(`{"method": "post"}`)
+
+	assert.Nil(options)
+	assert.Equal(&pdfire.ParseError{Key: "method", Value: "post"}, err)
+
+	options, err = pdfire.NewConversionOptionsFromJSONString(`{"body": {"ids": [1, 2]}}`)
+
+	assert.Nil(options)
+	assert.IsType(&pdfire.ParseError{}, err)
+}
+
+func TestNewConversionOptionsFromJSONSelectorList(t *testing.T) {
+	assert := assert.New(t)
+
+	options, err := pdfire.NewConversionOptionsFromJSONString(`{"selector": ["#chart", "#table"], "selectors": [".footer"], "selectorPageBreaks": true}`)
+
+	assert.Nil(err)
+	assert.Equal("", options.Selector)
+	assert.Equal([]string{"#chart", "#table", ".footer"}, options.Selectors)
+	assert.True(options.SelectorPageBreaks)
+}
+
+func TestNewConversionOptionsFromJSONWaitForSelectors(t *testing.T) {
+	assert := assert.New(t)
+	reader := strings.NewReader(`{"html": "<p></p>", "waitForSelector": ["#chart", "#table"]}`)
+
+	options, err := pdfire.NewConversionOptionsFromJSON(reader)
+
+	assert.Nil(err)
+	assert.Equal("", options.WaitForSelector)
+	assert.Equal([]string{"#chart", "#table"}, options.WaitForSelectors)
+	assert.Equal(pdfire.SelectorPolicyAllOf, options.WaitForSelectorPolicy)
+}
+
+func TestNewConversionOptionsFromJSONDurations(t *testing.T) {
+	assert := assert.New(t)
+	reader := strings.NewReader(`{"html": "<p></p>", "timeout": "30s", "delay": "1500ms", "waitUntilTimeout": "2m", "waitForSelectorTimeout": "250", "maxCPUTime": 500}`)
+
+	options, err := pdfire.NewConversionOptionsFromJSON(reader)
+
+	assert.Nil(err)
+	assert.Equal(30*time.Second, options.Timeout)
+	assert.Equal(1500*time.Millisecond, options.Delay)
+	assert.Equal(2*time.Minute, options.WaitUntilTimeout)
+	assert.Equal(250*time.Millisecond, options.WaitForSelectorTimeout)
+	assert.Equal(500*time.Millisecond, options.MaxCPUTime)
+
+	options, err = pdfire.NewConversionOptionsFromJSON(strings.NewReader(`{"html": "<p></p>", "timeout": "30 seconds"}`))
+
+	assert.Nil(options)
+	assert.Equal(&pdfire.DurationError{Key: "timeout", Value: "30 seconds"}, err)
+	assert.Equal(`Could not parse duration "30 seconds" of param "timeout". Use milliseconds or a duration like "30s", "1500ms" or "2m".`, err.Error())
+}
+
+func TestNewConversionOptionsFromJSONPercentMargins(t *testing.T) {
+	assert := assert.New(t)
+	reader := strings.NewReader(`{"html": "<p></p>", "format": "a4", "marginTop": "10%", "marginLeft": "5%"}`)
+
+	options, err := pdfire.NewConversionOptionsFromJSON(reader)
+
+	assert.Nil(err)
+	assert.Equal(1.17, options.PDFParams.MarginTop)
+	assert.Equal(0.41, options.PDFParams.MarginLeft)
+
+	reader = strings.NewReader(`{"html": "<p></p>", "landscape": true, "margin": "10% 5%"}`)
+	options, err = pdfire.NewConversionOptionsFromJSON(reader)
+
+	assert.Nil(err)
+	assert.Equal(0.85, options.PDFParams.MarginTop)
+	assert.Equal(0.55, options.PDFParams.MarginRight)
+	assert.Equal(0.85, options.PDFParams.MarginBottom)
+	assert.Equal(0.55, options.PDFParams.MarginLeft)
+
+	options, err = pdfire.NewConversionOptionsFromJSON(strings.NewReader(`{"html": "<p></p>", "paperWidth": "50%"}`))
+
+	assert.Nil(options)
+	assert.IsType(&pdfire.ParseError{}, err)
+}
+
+func TestNewConversionOptionsFromJSONPageRanges(t *testing.T) {
+	assert := assert.New(t)
+
+	options, err := pdfire.NewConversionOptionsFromJSON(strings.NewReader(`{"html": "<p></p>", "pageRanges": "1-3, x"}`))
+
+	assert.Nil(options)
+	assert.Equal(&pdfire.ParseError{Key: "pageRanges", Value: "1-3, x"}, err)
+
+	options, err = pdfire.NewConversionOptionsFromJSON(strings.NewReader(`{"html": "<p></p>", "pageRanges": "5-3"}`))
+
+	assert.Nil(options)
+	assert.Equal(&pdfire.ParseError{Key: "pageRanges", Value: "5-3"}, err)
+
+	options, err = pdfire.NewConversionOptionsFromJSON(strings.NewReader(`{"html": "<p></p>", "pageRanges": "5-3, 1", "ignoreInvalidPageRanges": true}`))
+
+	assert.Nil(err)
+	assert.Equal("5-3, 1", options.PDFParams.PageRanges)
+	assert.Equal(true, options.PDFParams.IgnoreInvalidPageRanges)
 }
 
 func TestNewConversionOptionsFromJSONInvalid(t *testing.T) {
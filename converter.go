@@ -4,31 +4,43 @@ import (
 	"bytes"
 	"context"
 	"errors"
-	"fmt"
 	"io"
-	"os"
-	"path/filepath"
+	"io/ioutil"
+	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/chromedp/cdproto/cdp"
-	"github.com/chromedp/cdproto/dom"
-	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/inspector"
 	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/cdproto/target"
 	"github.com/chromedp/chromedp"
-	"github.com/google/uuid"
 	"github.com/pdfcpu/pdfcpu/pkg/api"
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
 )
 
 var (
-	// ErrTimeout is returned when the conversion times out.
+	// ErrTimeout is returned when the conversion times out. Conversions that
+	// time out while running return a *TimeoutError, which wraps it.
 	ErrTimeout = errors.New("conversion timed out")
-	// ErrWaitUntilTimeout is returned when the Chrome DevTools times out while waiting for the "load" or "DOMContentLoaded" event.
+	// ErrWaitUntilTimeout is returned when the Chrome DevTools times out while waiting for the "load" or "DOMContentLoaded" event or for the network to be idle.
 	ErrWaitUntilTimeout = errors.New("WaitUntil timed out")
+	// ErrNavigationTimeout is returned when a navigation doesn't finish within NavigationTimeout.
+	ErrNavigationTimeout = errors.New("navigation timed out")
 	// ErrNoBody is returned when the page has no 'body' element.
 	ErrNoBody = errors.New("page has no 'body' element")
+	// ErrFileURLNotAllowed is returned when a file:// URL is converted although the converter disallows it.
+	ErrFileURLNotAllowed = errors.New("file:// urls are not allowed")
+	// ErrOfflineURL is returned when a remote URL is converted in offline mode.
+	ErrOfflineURL = errors.New("only html and file:// urls can be converted offline")
+	// ErrTooManyConversions is returned when MaxConcurrency conversions are
+	// running and the QueuePolicy rejects further ones.
+	ErrTooManyConversions = errors.New("too many conversions")
 )
 
 type result struct {
@@ -36,141 +48,833 @@ type result struct {
 	buf   *bytes.Buffer
 }
 
-// Convert creates a PDF from the given options.
-func Convert(ctx context.Context, w io.Writer, options *ConversionOptions) error {
-	if options.URL != "" {
-		return ConvertURL(ctx, w, options)
+// BatchResult is the outcome of a single conversion of ConvertAll.
+type BatchResult struct {
+	PDF []byte
+	Err error
+}
+
+// Engine creates PDFs. It is implemented by Converter, so that applications can
+// depend on it and replace it in tests, e.g. with pdfiretest.MockEngine.
+type Engine interface {
+	Convert(ctx context.Context, w io.Writer, options *ConversionOptions) error
+	Merge(ctx context.Context, w io.Writer, options *MergeOptions) error
+}
+
+var _ Engine = (*Converter)(nil)
+
+// Converter creates PDFs using a configured Chrome browser.
+type Converter struct {
+	options *ConverterOptions
+	pool    *browserPool
+	mu      sync.Mutex
+	running sync.WaitGroup
+	closed  chan struct{}
+	once    sync.Once
+	slots   chan struct{}
+	// filters is the compiled FilterLists, see filterList.
+	filters     *FilterList
+	filtersErr  error
+	filtersOnce sync.Once
+	// version is cached by Version.
+	version *BrowserVersion
+}
+
+// NewConverter returns a new converter for the given options.
+func NewConverter(options *ConverterOptions) *Converter {
+	c := &Converter{
+		options: options,
+		closed:  make(chan struct{}),
 	}
 
-	return ConvertHTML(ctx, w, options)
+	if options.PoolSize > 0 {
+		c.pool = newBrowserPool(options)
+	}
+
+	if options.MaxConcurrency > 0 {
+		c.slots = make(chan struct{}, options.MaxConcurrency)
+	}
+
+	return c
 }
 
-// ConvertHTML creates a PDF from an HTML string.
-func ConvertHTML(ctx context.Context, w io.Writer, options *ConversionOptions) error {
-	ctx, cancel := conversionContext(ctx, options)
+// Warmup launches the converter's browsers ahead of the first conversion, so
+// that it doesn't pay the cold-start penalty. If WarmupRender is set, a trivial
+// document is rendered in every browser as well. Warmup fails if one of the
+// RequiredFonts is missing.
+func (c *Converter) Warmup(ctx context.Context) error {
+	if err := c.CheckFonts(ctx); err != nil {
+		return err
+	}
+
+	if c.pool != nil {
+		return c.pool.warmup(ctx, c.options.WarmupRender)
+	}
+
+	ctx, cancel, err := c.newBrowserContext(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
 	defer cancel()
 
-	ctx, cancel = chromedp.NewContext(ctx)
+	if !c.options.WarmupRender {
+		return chromedp.Run(ctx)
+	}
+
+	return chromedp.Run(ctx, warmupActions()...)
+}
+
+// Healthy reports whether the converter can run conversions right away. For a
+// pool, every running browser must respond and at least one must be running,
+// e.g. after Warmup. Without a pool, the remote Chrome must respond or the
+// Chrome executable must exist, as every conversion launches its own browser.
+func (c *Converter) Healthy(ctx context.Context) error {
+	select {
+	case <-c.closed:
+		return ErrConverterClosed
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
 	defer cancel()
 
-	id := uuid.New()
-	r := strings.NewReader(options.HTML)
-	file, err := createAndCloseHTMLFile(id, r)
+	if c.pool != nil {
+		return c.pool.healthy(ctx)
+	}
+
+	if c.options.ChromeWSURL != "" {
+		b, err := connectRemote(ctx, c.options.ChromeWSURL)
+
+		if err != nil {
+			return err
+		}
+
+		defer b.cancel()
+
+		return ping(ctx, b)
+	}
+
+	_, err := findExecPath(c.options)
+
+	return err
+}
+
+// Close cancels the running conversions, waits until they have closed their
+// tabs and removed their temporary files, and stops all browsers kept by the
+// converter. Conversions started afterwards fail with ErrConverterClosed.
+// Close may be called multiple times.
+func (c *Converter) Close() error {
+	c.once.Do(func() {
+		c.mu.Lock()
+		close(c.closed)
+		c.mu.Unlock()
+
+		c.running.Wait()
+
+		if c.pool != nil {
+			c.pool.close()
+		}
+	})
+
+	return nil
+}
+
+// track registers a conversion, which is cancelled when the converter is
+// closed. The returned function must be called when the conversion has
+// released all of its resources.
+func (c *Converter) track(ctx context.Context) (context.Context, func(), error) {
+	release, err := c.acquireSlot(ctx)
 
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	beforeNavAction, waiter := beforeNavigation(options)
-	buf := bytes.NewBuffer([]byte{})
+	c.mu.Lock()
 
-	if err := chromedp.Run(
-		ctx,
-		beforeNavAction,
-		chromedp.Navigate(fmt.Sprintf("file://%s", file.Name())),
-		afterNavigation(options, waiter),
-		printToPDFAction(buf, options),
-	); err != nil {
-		if err == context.DeadlineExceeded {
-			return ErrTimeout
+	select {
+	case <-c.closed:
+		c.mu.Unlock()
+		release()
+		return nil, nil, ErrConverterClosed
+	default:
+	}
+
+	c.running.Add(1)
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-c.closed:
+			cancel()
+		case <-done:
 		}
+	}()
+
+	return ctx, func() {
+		close(done)
+		cancel()
+		c.running.Done()
+		release()
+	}, nil
+}
+
+// acquireSlot reserves one of the MaxConcurrency slots. Depending on the
+// QueuePolicy, it waits for a free slot or fails with ErrTooManyConversions.
+// The returned function frees the slot.
+func (c *Converter) acquireSlot(ctx context.Context) (func(), error) {
+	if c.slots == nil {
+		return func() {}, nil
+	}
+
+	release := func() { <-c.slots }
+
+	select {
+	case c.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if c.options.QueuePolicy == QueuePolicyReject {
+		return nil, ErrTooManyConversions
+	}
+
+	select {
+	case c.slots <- struct{}{}:
+		return release, nil
+	case <-c.closed:
+		return nil, ErrConverterClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+var defaultConverter = NewConverter(NewConverterOptions())
+
+// Convert creates a PDF from the given options.
+func Convert(ctx context.Context, w io.Writer, options *ConversionOptions) error {
+	return defaultConverter.Convert(ctx, w, options)
+}
+
+// ConvertHTML creates a PDF from an HTML string.
+func ConvertHTML(ctx context.Context, w io.Writer, options *ConversionOptions) error {
+	return defaultConverter.ConvertHTML(ctx, w, options)
+}
+
+// withAdFilters returns a copy of the options that blocks the requests matching
+// the filter list of the converter.
+func (c *Converter) withAdFilters(options *ConversionOptions) (*ConversionOptions, error) {
+	filters, err := c.filterList()
+
+	if err != nil {
+		return nil, err
+	}
+
+	copied := *options
+	copied.adFilters = filters
+
+	return &copied, nil
+}
+
+// withURLGuard returns a copy of the options that blocks the requests denied
+// by the URLPolicy and BlockPrivateNetworks of the converter.
+func (c *Converter) withURLGuard(options *ConversionOptions) *ConversionOptions {
+	guard := c.urlGuard()
 
+	if guard == nil {
+		return options
+	}
+
+	copied := *options
+	copied.urlGuard = guard
+
+	return &copied
+}
+
+// ConvertURL creates a PDF from a URL.
+func ConvertURL(ctx context.Context, w io.Writer, options *ConversionOptions) error {
+	return defaultConverter.ConvertURL(ctx, w, options)
+}
+
+// Merge creates multiple PDFs and merges them together into a single file.
+func Merge(ctx context.Context, w io.Writer, options *MergeOptions) error {
+	return defaultConverter.Merge(ctx, w, options)
+}
+
+// ConvertAll creates a PDF for each of the given options, running at most
+// concurrency conversions in parallel. The results have the same order as the
+// options. If concurrency is not positive, all conversions run in parallel.
+func ConvertAll(ctx context.Context, options []*ConversionOptions, concurrency int) []*BatchResult {
+	return defaultConverter.ConvertAll(ctx, options, concurrency)
+}
+
+// Convert creates a PDF from the given options. When it returns, the tab of the
+// conversion is closed and its temporary files are removed, also if the
+// conversion failed or ctx was cancelled.
+func (c *Converter) Convert(ctx context.Context, w io.Writer, options *ConversionOptions) error {
+	if len(options.urls()) > 0 {
+		return c.ConvertURL(ctx, w, options)
+	}
+
+	return c.ConvertHTML(ctx, w, options)
+}
+
+// ConvertHTML creates a PDF from an HTML string. The HTML is served from
+// memory at a synthetic URL and never written to disk.
+func (c *Converter) ConvertHTML(ctx context.Context, w io.Writer, options *ConversionOptions) error {
+	ctx, done, err := c.track(ctx)
+
+	if err != nil {
 		return err
 	}
 
-	if err := os.Remove(file.Name()); err != nil {
+	defer done()
+
+	options, err = withHTMLDocument(options)
+
+	if err != nil {
 		return err
 	}
 
-	if options.Watermark != nil {
-		if buf, err = watermark(buf, options.Watermark); err != nil {
-			return err
+	return c.convert(ctx, w, options, htmlDocumentURL)
+}
+
+// withHTMLDocument returns a copy of the options that serves their (sanitized)
+// HTML at htmlDocumentURL.
+func withHTMLDocument(options *ConversionOptions) (*ConversionOptions, error) {
+	src := options.HTML
+
+	if options.Sanitize {
+		var err error
+
+		if src, err = SanitizeHTML(src); err != nil {
+			return nil, err
 		}
 	}
 
-	buf, err = secure(buf, options.OwnerPassword, options.UserPassword)
+	copied := *options
+	copied.document = src
+
+	return &copied, nil
+}
+
+// ConvertURL creates a PDF from a URL. If multiple URLs are given, they are
+// visited in order by the same tab and their PDFs are concatenated.
+func (c *Converter) ConvertURL(ctx context.Context, w io.Writer, options *ConversionOptions) error {
+	if err := c.validateURLs(options); err != nil {
+		return err
+	}
+
+	if err := c.checkURLs(ctx, options); err != nil {
+		return err
+	}
+
+	ctx, done, err := c.track(ctx)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = io.Copy(w, buf)
+	defer done()
 
-	return err
+	return c.convert(ctx, w, options, options.urls()...)
 }
 
-// ConvertURL creates a PDF from a URL.
-func ConvertURL(ctx context.Context, w io.Writer, options *ConversionOptions) error {
+// Validate checks the options against the converter's configuration without
+// launching a browser. It returns the error that a conversion would fail with
+// right away.
+func (c *Converter) Validate(options *ConversionOptions) error {
+	if err := c.validateURLs(options); err != nil {
+		return err
+	}
+
+	if err := c.checkURLs(context.Background(), options); err != nil {
+		return err
+	}
+
+	if _, err := chromeArgOptions(c.options, options.ChromeArgs); err != nil {
+		return err
+	}
+
+	if _, err := printSegments(options); err != nil {
+		return err
+	}
+
+	if _, err := options.device(); err != nil {
+		return err
+	}
+
+	if err := validateBlockResources(options.BlockResources); err != nil {
+		return err
+	}
+
+	if _, err := newRedirectTracker(options); err != nil {
+		return err
+	}
+
+	if err := validateOutput(options.postProcessOptions()); err != nil {
+		return err
+	}
+
+	if options.Crawl != nil {
+		if options.CompareMedia {
+			return ErrCompareMediaCrawl
+		}
+
+		if _, err := newCrawler(options); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Converter) validateURLs(options *ConversionOptions) error {
+	for _, u := range options.urls() {
+		if c.options.DisallowFileURLs && isFileURL(u) {
+			return ErrFileURLNotAllowed
+		}
+
+		if options.Offline && !isFileURL(u) {
+			return ErrOfflineURL
+		}
+	}
+
+	if options.Body != "" && (options.Method == "" || options.Method == http.MethodGet) {
+		return ErrBodyWithGET
+	}
+
+	if options.ChromeWSURL != "" && !c.options.AllowChromeWSURL {
+		return ErrChromeWSURLNotAllowed
+	}
+
+	if options.Offline && (options.HeaderTemplateURL != "" || options.FooterTemplateURL != "") {
+		return ErrOfflineURL
+	}
+
+	return nil
+}
+
+func (c *Converter) convert(ctx context.Context, w io.Writer, options *ConversionOptions, locations ...string) error {
 	ctx, cancel := conversionContext(ctx, options)
 	defer cancel()
 
-	ctx, cancel = chromedp.NewContext(ctx)
-	defer cancel()
+	ctx, timer := withPhaseTimer(ctx)
+	timer.enter(PhaseBrowser)
 
-	beforeNavAction, waiter := beforeNavigation(options)
-	buf := bytes.NewBuffer([]byte{})
+	// The templates are loaded with the URL guard, like the page.
+	options = c.withURLGuard(options)
+	options, err := loadTemplates(ctx, options, c.options.Templates)
 
-	if err := chromedp.Run(
-		ctx,
-		beforeNavAction,
-		chromedp.Navigate(options.URL),
-		afterNavigation(options, waiter),
-		printToPDFAction(buf, options),
-	); err != nil {
-		if err == context.DeadlineExceeded {
-			return ErrTimeout
+	if err != nil {
+		return err
+	}
+
+	if options, err = inlineTemplateImages(ctx, options); err != nil {
+		return err
+	}
+
+	if options.BlockAds {
+		if options, err = c.withAdFilters(options); err != nil {
+			return err
+		}
+	}
+
+	if options.Crawl != nil && options.CompareMedia {
+		return ErrCompareMediaCrawl
+	}
+
+	var r *rendering
+	var direct *countingWriter
+	result := resultFrom(ctx)
+
+	if options.streamsDirectly(ctx, locations) {
+		direct = &countingWriter{w: w}
+	}
+
+	err = retryOnCrash(c.options.CrashRetries, func(n int) error {
+		if n > 1 {
+			result.warn("The tab crashed and the conversion was retried (attempt %d).", n)
+		}
+
+		r, err = c.render(ctx, timer, options, locations, direct)
+
+		// The part of the PDF written to w can't be taken back.
+		if err == errTargetCrashed && direct != nil && direct.n > 0 {
+			return &ChromeCrashedError{Attempts: n}
 		}
 
 		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if options.OnStats != nil {
+		options.OnStats(r.stats)
+	}
+
+	if direct != nil {
+		options.progress(StageDone, direct.n)
+		return nil
 	}
 
-	var err error
+	bufs := r.bufs
 
-	if options.Watermark != nil {
-		if buf, err = watermark(buf, options.Watermark); err != nil {
+	if r.crawl != nil {
+		bufs = r.crawl.pdfs()
+	}
+
+	// The pages are counted before post-processing, which may encrypt the PDF.
+	if result != nil {
+		if result.Pages, err = countPages(bufs); err != nil {
 			return err
 		}
 	}
 
-	buf, err = secure(buf, options.OwnerPassword, options.UserPassword)
+	timer.enter(PhasePostProcess)
+	buf, err := postProcess(ctx, bufs, r.crawl, r.outline, options)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = io.Copy(w, buf)
+	if options.CompareMedia {
+		printBuf, err := postProcess(ctx, r.printBufs, nil, nil, options)
+
+		if err != nil {
+			return err
+		}
+
+		if buf, err = zipMediaPDFs(buf, printBuf); err != nil {
+			return err
+		}
+	}
+
+	if result != nil {
+		result.Size = int64(buf.Len())
+		result.Phases = timer.durations()
+		result.Options = options
+	}
+
+	n, err := io.Copy(w, buf)
+
+	if err == nil {
+		options.progress(StageDone, n)
+	}
 
 	return err
 }
 
+// rendering is the result of rendering the locations of a conversion in a tab.
+type rendering struct {
+	bufs      []*bytes.Buffer
+	printBufs []*bytes.Buffer
+	crawl     *crawler
+	outline   *headingOutline
+	stats     *Stats
+}
+
+// render navigates a new tab to the locations and prints them. If direct is
+// set, the PDF is printed to it instead of the buffers of the rendering. It
+// returns errTargetCrashed if the tab crashes, so that it can be retried.
+func (c *Converter) render(ctx context.Context, timer *phaseTimer, options *ConversionOptions, locations []string, direct *countingWriter) (*rendering, error) {
+	timer.enter(PhaseBrowser)
+	options.progress(StageBrowser, 0)
+	tabCtx, cancel, err := c.newTabContext(ctx, options.ChromeArgs, options.ChromeWSURL)
+
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, timer.timeoutError()
+		}
+
+		return nil, err
+	}
+
+	defer cancel()
+
+	var crawl *crawler
+
+	if options.Crawl != nil {
+		if crawl, err = newCrawler(options); err != nil {
+			return nil, err
+		}
+	}
+
+	// A crawl has an outline of its pages instead.
+	var outline *headingOutline
+
+	if options.Outline == OutlineModeHeadings && crawl == nil {
+		outline = &headingOutline{}
+	}
+
+	beforeNavAction, events := beforeNavigation(options)
+	bufs := make([]*bytes.Buffer, len(locations))
+	printBufs := make([]*bytes.Buffer, len(locations))
+	stats := &statsCollector{}
+	actions := []chromedp.Action{beforeNavAction}
+
+	if crawl != nil {
+		actions = append(actions, crawl.action(locations, events))
+		locations = nil
+	}
+
+	for i, location := range locations {
+		bufs[i] = bytes.NewBuffer([]byte{})
+		var pdf io.Writer = bufs[i]
+
+		if direct != nil {
+			pdf = direct
+		}
+
+		printAction := printToPDFAction(pdf, options, outline)
+
+		// With CompareMedia, bufs are printed with screen media.
+		if options.CompareMedia {
+			printBufs[i] = bytes.NewBuffer([]byte{})
+			printAction = printMediaAction(bufs[i], printBufs[i], options)
+		}
+
+		actions = append(actions,
+			progressAction(options, StageNavigation),
+			phaseAction(PhaseNavigation),
+			navigate(location, options.NavigationTimeout),
+			progressAction(options, StageWait),
+			afterNavigation(options, events),
+			progressAction(options, StagePrint),
+			phaseAction(PhasePrint),
+			printAction,
+		)
+	}
+
+	if options.OnStats != nil {
+		actions = append(append([]chromedp.Action{stats.before()}, actions...), stats.after())
+	}
+
+	// A crashed target doesn't answer anymore, so the actions waiting for it
+	// are aborted.
+	runCtx, cancelRun := context.WithCancel(tabCtx)
+	defer cancelRun()
+
+	events.onCrash = cancelRun
+	events.onFail = cancelRun
+	limits := newLimiter(options, int64(c.options.MaxOldSpaceSize)<<20)
+
+	if limits.enabled() {
+		var cancelLimits context.CancelFunc
+		runCtx, cancelLimits = context.WithCancel(runCtx)
+		defer cancelLimits()
+
+		actions = append([]chromedp.Action{limits.start(cancelLimits)}, actions...)
+	}
+
+	err = chromedp.Run(runCtx, actions...)
+
+	if lerr := limits.stop(); lerr != nil {
+		return nil, lerr
+	}
+
+	// A failure of the page, like a denied document or redirect, aborts the
+	// conversion and takes precedence over the error of the aborted actions.
+	if ferr := events.failure(); ferr != nil {
+		return nil, ferr
+	}
+
+	if err != nil {
+		if err == context.DeadlineExceeded || ctx.Err() == context.DeadlineExceeded {
+			return nil, timer.timeoutError()
+		}
+
+		if events.hasCrashed() {
+			if oerr := limits.outOfMemory(); oerr != nil {
+				return nil, oerr
+			}
+
+			return nil, errTargetCrashed
+		}
+
+		return nil, err
+	}
+
+	return &rendering{
+		bufs:      bufs,
+		printBufs: printBufs,
+		crawl:     crawl,
+		outline:   outline,
+		stats:     stats.stats,
+	}, nil
+}
+
+// postProcess concatenates the printed PDFs and applies the bookmarks of a
+// crawl or the outline of the headings, the watermark, the encryption and the
+// PDF/A conversion, whose findings are warnings of the result of ctx.
+func postProcess(ctx context.Context, bufs []*bytes.Buffer, crawl *crawler, outline *headingOutline, options *ConversionOptions) (*bytes.Buffer, error) {
+	postProcessOptions := options.postProcessOptions()
+	postProcessOptions.warn = resultFrom(ctx).warn
+	buf, err := concatPDFs(bufs, postProcessOptions.writeConfiguration())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if crawl != nil {
+		if buf, err = crawl.addBookmarks(buf, postProcessOptions.writeConfiguration()); err != nil {
+			return nil, err
+		}
+	}
+
+	if outline != nil {
+		if buf, err = outline.addBookmarks(buf, postProcessOptions.writeConfiguration()); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.Provenance {
+		if buf, err = addProvenance(buf, options); err != nil {
+			return nil, err
+		}
+	}
+
+	options.progress(StagePostProcess, int64(buf.Len()))
+
+	return processPDF(ctx, buf, postProcessOptions)
+}
+
+// postProcessOptions returns the post-processing part of the options.
+func (o *ConversionOptions) postProcessOptions() *PostProcessOptions {
+	options := &PostProcessOptions{
+		OwnerPassword: o.OwnerPassword,
+		UserPassword:  o.UserPassword,
+		Watermark:     o.Watermark,
+		PDFVersion:    o.PDFVersion,
+		ObjectStreams: o.ObjectStreams,
+		XRefStreams:   o.XRefStreams,
+		ArchiveFormat: o.ArchiveFormat,
+		Linearize:     o.Linearize,
+		Optimize:      o.Optimize,
+		Deterministic: o.Deterministic,
+		Signature:     o.Signature,
+	}
+
+	// The timestamp authority is requested with the URL guard of the page.
+	if o.urlGuard != nil {
+		options.URLPolicy = o.urlGuard.policy
+		options.BlockPrivateNetworks = o.urlGuard.privateNetworks
+	}
+
+	return options
+}
+
 // Merge creates multiple PDFs and merges them together into a single file.
-func Merge(ctx context.Context, w io.Writer, options *MergeOptions) error {
+func (c *Converter) Merge(ctx context.Context, w io.Writer, options *MergeOptions) error {
 	for _, convopt := range options.Documents {
 		convopt.OwnerPassword = ""
 		convopt.UserPassword = ""
 	}
 
+	// The remaining conversions are cancelled as soon as one fails, and Merge
+	// waits for all of them, so that no conversion outlives it.
+	ctx, cancel := context.WithCancel(ctx)
 	cres := make(chan result, len(options.Documents))
 	cerr := make(chan error, len(options.Documents))
+	var wg sync.WaitGroup
+
+	// Every document records its own result.
+	merged := resultFrom(ctx)
+
+	if merged != nil {
+		merged.Documents = make([]*Result, len(options.Documents))
+	}
+
+	for i, convopt := range options.Documents {
+		wg.Add(1)
+		docCtx := ctx
+
+		if merged != nil {
+			docCtx, merged.Documents[i] = withResult(ctx)
+		}
+
+		go func(ctx context.Context, i int, convopt *ConversionOptions) {
+			defer wg.Done()
+			c.forMerge(ctx, i, convopt, cres, cerr)
+		}(docCtx, i, convopt)
+	}
+
+	err := mergeDocs(ctx, w, options, cres, cerr)
+	cancel()
+	wg.Wait()
+
+	return err
+}
+
+// ConvertAll creates a PDF for each of the given options, running at most
+// concurrency conversions in parallel. The results have the same order as the
+// options. If concurrency is not positive, all conversions run in parallel.
+func (c *Converter) ConvertAll(ctx context.Context, options []*ConversionOptions, concurrency int) []*BatchResult {
+	if concurrency <= 0 {
+		concurrency = len(options)
+	}
+
+	results := make([]*BatchResult, len(options))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, convopt := range options {
+		wg.Add(1)
+
+		go func(i int, convopt *ConversionOptions) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results[i] = &BatchResult{Err: batchError(ctx)}
+				return
+			}
+
+			defer func() { <-sem }()
 
-	for i, convopt := range options.Documents {
-		go forMerge(ctx, i, convopt, cres, cerr)
+			buf := bytes.NewBuffer([]byte{})
+			err := c.Convert(ctx, buf, convopt)
+
+			results[i] = &BatchResult{
+				PDF: buf.Bytes(),
+				Err: err,
+			}
+		}(i, convopt)
 	}
 
-	err := mergeDocs(ctx, w, options, cres, cerr)
+	wg.Wait()
 
-	if err != nil {
-		return err
+	return results
+}
+
+// batchError returns the error of a conversion that was never started because
+// ctx is done. Only a deadline is reported as ErrTimeout.
+func batchError(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return ErrTimeout
 	}
 
-	return nil
+	return ctx.Err()
 }
 
-func forMerge(ctx context.Context, index int, options *ConversionOptions, cres chan<- result, cerr chan<- error) {
+func (c *Converter) forMerge(ctx context.Context, index int, options *ConversionOptions, cres chan<- result, cerr chan<- error) {
 	buf := bytes.NewBuffer([]byte{})
+	start := time.Now()
 
-	if err := Convert(ctx, buf, options); err != nil {
+	if err := c.Convert(ctx, buf, options); err != nil {
 		cerr <- err
+		return
+	}
+
+	if result := resultFrom(ctx); result != nil {
+		result.Duration = time.Since(start)
 	}
 
 	cres <- result{
@@ -199,28 +903,56 @@ func mergeDocs(ctx context.Context, w io.Writer, options *MergeOptions, cres <-c
 		}
 	}
 
-	readers := make([]io.ReadSeeker, len(bufs))
-
-	for i, buf := range bufs {
-		readers[i] = bytes.NewReader(buf.Bytes())
-	}
+	merged, err := concatPDFs(bufs, nil)
 
-	merged := bytes.NewBuffer([]byte{})
-	if err := api.Merge(readers, merged, nil); err != nil {
+	if err != nil {
 		return err
 	}
 
-	b, err := secure(merged, options.OwnerPassword, options.UserPassword)
+	b, err := secure(merged, &PostProcessOptions{
+		OwnerPassword: options.OwnerPassword,
+		UserPassword:  options.UserPassword,
+	})
 
 	if err != nil {
 		return err
 	}
 
+	if result := resultFrom(ctx); result != nil {
+		for _, doc := range result.Documents {
+			result.Pages += doc.Pages
+		}
+
+		result.Size = int64(b.Len())
+	}
+
 	_, err = io.Copy(w, b)
 
 	return err
 }
 
+// concatPDFs merges PDFs into a single one, in order. The default pdfcpu
+// configuration is used if cfg is nil.
+func concatPDFs(bufs []*bytes.Buffer, cfg *pdfcpu.Configuration) (*bytes.Buffer, error) {
+	if len(bufs) == 1 {
+		return bufs[0], nil
+	}
+
+	readers := make([]io.ReadSeeker, len(bufs))
+
+	for i, buf := range bufs {
+		readers[i] = bytes.NewReader(buf.Bytes())
+	}
+
+	merged := bytes.NewBuffer([]byte{})
+
+	if err := api.Merge(readers, merged, cfg); err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
+
 func conversionContext(ctx context.Context, options *ConversionOptions) (context.Context, context.CancelFunc) {
 	var cancel context.CancelFunc
 
@@ -233,25 +965,27 @@ func conversionContext(ctx context.Context, options *ConversionOptions) (context
 	return ctx, cancel
 }
 
-func createAndCloseHTMLFile(id uuid.UUID, r io.Reader) (*os.File, error) {
-	os.MkdirAll(filepath.Join(os.TempDir(), "pdfire/tmp/html"), os.ModePerm)
-	file, err := os.Create(filepath.Join(os.TempDir(), fmt.Sprintf("pdfire/tmp/html/%s.html", id.String())))
+func isFileURL(rawurl string) bool {
+	u, err := url.Parse(strings.TrimSpace(rawurl))
 
 	if err != nil {
-		return nil, err
+		return false
 	}
 
-	defer file.Close()
-	_, err = io.Copy(file, r)
-
-	return file, nil
+	return strings.EqualFold(u.Scheme, "file")
 }
 
-func beforeNavigation(options *ConversionOptions) (chromedp.ActionFunc, <-chan bool) {
-	waiter := make(chan bool, 1)
+func beforeNavigation(options *ConversionOptions) (chromedp.ActionFunc, *pageEvents) {
+	events := newPageEvents()
 
 	return func(ctx context.Context) error {
-		if err := emulation.SetDeviceMetricsOverride(options.ViewportWidth, options.ViewportHeight, 1, false).Do(ctx); err != nil {
+		device, err := options.device()
+
+		if err != nil {
+			return err
+		}
+
+		if err := emulateDevice(ctx, device); err != nil {
 			return err
 		}
 
@@ -263,82 +997,376 @@ func beforeNavigation(options *ConversionOptions) (chromedp.ActionFunc, <-chan b
 			return err
 		}
 
-		if err := network.SetExtraHTTPHeaders(options.Headers).Do(ctx); err != nil {
+		if len(options.Cookies) > 0 {
+			location := htmlDocumentURL
+
+			if urls := options.urls(); len(urls) > 0 {
+				location = urls[0]
+			}
+
+			if err := setCookies(ctx, options.Cookies, location); err != nil {
+				return err
+			}
+		}
+
+		if options.HeadersScope == HeadersScopeAll {
+			if err := network.SetExtraHTTPHeaders(options.Headers).Do(ctx); err != nil {
+				return err
+			}
+		}
+
+		// Offline mode fails every network request, so the document cannot load
+		// remote resources or send data anywhere.
+		if options.Offline {
+			if err := network.EmulateNetworkConditions(true, 0, -1, -1).Do(ctx); err != nil {
+				return err
+			}
+		}
+
+		if options.DisableCache {
+			if err := network.SetCacheDisabled(true).Do(ctx); err != nil {
+				return err
+			}
+		}
+
+		if options.BypassServiceWorker {
+			if err := network.SetBypassServiceWorker(true).Do(ctx); err != nil {
+				return err
+			}
+		}
+
+		if err := emulateMedia(ctx, options.EmulateMedia, options); err != nil {
+			return err
+		}
+
+		if options.BlockDownloads {
+			if err := page.SetDownloadBehavior(page.SetDownloadBehaviorBehaviorDeny).Do(ctx); err != nil {
+				return err
+			}
+		}
+
+		if options.Language != "" || device.UserAgent != "" {
+			if err := setLanguage(ctx, options.Language, device.UserAgent); err != nil {
+				return err
+			}
+		}
+
+		if options.BlockPopups {
+			if _, err := page.AddScriptToEvaluateOnNewDocument(blockPopupsScript).Do(ctx); err != nil {
+				return err
+			}
+		}
+
+		if options.BlockThirdPartyCookies {
+			if _, err := page.AddScriptToEvaluateOnNewDocument(blockThirdPartyCookiesScript).Do(ctx); err != nil {
+				return err
+			}
+		}
+
+		if len(options.Fonts) > 0 {
+			script, err := fontsScript(options.Fonts)
+
+			if err != nil {
+				return err
+			}
+
+			if _, err := page.AddScriptToEvaluateOnNewDocument(script).Do(ctx); err != nil {
+				return err
+			}
+		}
+
+		if options.PagedJS {
+			script, err := loadPagedJS(ctx)
+
+			if err != nil {
+				return err
+			}
+
+			if _, err := page.AddScriptToEvaluateOnNewDocument(pagedJSConfig + "\n" + script).Do(ctx); err != nil {
+				return err
+			}
+		}
+
+		if _, ok := networkIdleEvents[options.WaitUntil]; ok {
+			if err := page.SetLifecycleEventsEnabled(true).Do(ctx); err != nil {
+				return err
+			}
+		}
+
+		// The console is captured whenever someone reads it.
+		if options.FailOnConsoleError || options.OnConsoleMessage != nil || resultFrom(ctx) != nil {
+			if err := runtime.Enable().Do(ctx); err != nil {
+				return err
+			}
+		}
+
+		if err := validateBlockResources(options.BlockResources); err != nil {
+			return err
+		}
+
+		redirects, err := newRedirectTracker(options)
+
+		if err != nil {
 			return err
 		}
 
-		if err := emulation.SetEmulatedMedia().WithMedia(string(options.EmulateMedia)).Do(ctx); err != nil {
+		resources, err := newResourceTracker(options)
+
+		if err != nil {
 			return err
 		}
 
+		events.resources = resources
+
+		c := chromedp.FromContext(ctx)
+		requests := newInterceptor(options, cdp.FrameID(c.Target.TargetID), events)
+
+		if requests.enabled() {
+			if err := requests.enable(ctx); err != nil {
+				return err
+			}
+		}
+
 		chromedp.ListenTarget(ctx, func(ev interface{}) {
-			switch ev.(type) {
+			switch ev := ev.(type) {
+			case *fetch.EventRequestPaused:
+				go requests.handle(ctx, ev)
+			case *fetch.EventAuthRequired:
+				go requests.handleAuth(ctx, ev)
+			case *target.EventTargetCreated:
+				if options.BlockPopups && ev.TargetInfo.OpenerID == c.Target.TargetID {
+					go closeTarget(c.Browser, ev.TargetInfo.TargetID)
+				}
+			case *page.EventDownloadWillBegin:
+				if options.BlockDownloads {
+					resultFrom(ctx).warn("Blocked the download of \"%s\".", ev.URL)
+
+					if options.OnDownloadBlocked != nil {
+						options.OnDownloadBlocked(ev.URL)
+					}
+				}
 			case *page.EventLoadEventFired:
 				if options.WaitUntil == "load" {
-					waiter <- true
+					events.load()
 				}
 			case *page.EventDomContentEventFired:
 				if options.WaitUntil == "dom" {
-					waiter <- true
+					events.load()
+				}
+			case *page.EventLifecycleEvent:
+				if ev.FrameID != cdp.FrameID(c.Target.TargetID) {
+					break
+				}
+
+				// The events of the previous document are replayed when the
+				// lifecycle events are enabled, init starts a new document.
+				if ev.Name == "init" {
+					events.reset()
+				} else if ev.Name == networkIdleEvents[options.WaitUntil] {
+					events.load()
+				}
+			case *network.EventRequestWillBeSent:
+				if resources.enabled {
+					resources.request(ev)
+				}
+
+				if !redirects.enabled() || ev.Type != network.ResourceTypeDocument || ev.FrameID != cdp.FrameID(c.Target.TargetID) {
+					break
+				}
+
+				if ev.RedirectResponse == nil {
+					redirects.start(ev.Request.URL)
+				} else if err := redirects.follow(ev.Request.URL); err != nil {
+					events.fail(err)
+				}
+			case *network.EventLoadingFailed:
+				if resources.enabled {
+					resources.fail(ev)
+				}
+			case *network.EventLoadingFinished:
+				if resources.enabled {
+					resources.finish(ev.RequestID)
 				}
+			case *network.EventResponseReceived:
+				if resources.enabled {
+					resources.respond(ev)
+				}
+
+				if ev.Type == network.ResourceTypeDocument && ev.FrameID == cdp.FrameID(c.Target.TargetID) {
+					resultFrom(ctx).setDocument(ev.Response.URL, ev.Response.Status)
+
+					if options.urlGuard != nil {
+						if err := options.urlGuard.checkRemoteAddress(ev.Response.URL, ev.Response.RemoteIPAddress); err != nil {
+							events.fail(err)
+						}
+					}
+
+					if options.FailOnHTTPError && ev.Response.Status >= 400 {
+						events.fail(&HTTPError{URL: ev.Response.URL, Status: ev.Response.Status})
+					}
+				}
+			case *inspector.EventTargetCrashed, *inspector.EventDetached:
+				events.crash()
+			case *runtime.EventExceptionThrown:
+				message := ev.ExceptionDetails.Error()
+				events.addError(message)
+				logConsole(ctx, options, &ConsoleMessage{Type: "exception", Text: message})
+			case *runtime.EventConsoleAPICalled:
+				message := consoleMessage(ev.Args)
+
+				if ev.Type == runtime.APITypeError {
+					events.addError(message)
+				}
+
+				logConsole(ctx, options, &ConsoleMessage{Type: string(ev.Type), Text: message})
 			}
 		})
 
 		return nil
-	}, waiter
+	}, events
+}
+
+// networkIdleEvents maps the network idle WaitUntil values to the lifecycle
+// events of Chrome. networkIdle fires after 500ms without network connections,
+// networkAlmostIdle after 500ms with at most 2.
+var networkIdleEvents = map[string]string{
+	"networkidle0": "networkIdle",
+	"networkidle2": "networkAlmostIdle",
+}
+
+// blockPopupsScript disables window.open, like a popup blocker does.
+const blockPopupsScript = `window.open = function () { return null; };`
+
+// closeTarget closes a target, e.g. a popup opened by the converted page.
+func closeTarget(browser *chromedp.Browser, id target.ID) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	target.CloseTarget(id).Do(cdp.WithExecutor(ctx, browser))
 }
 
-func afterNavigation(options *ConversionOptions, waiter <-chan bool) chromedp.ActionFunc {
+func afterNavigation(options *ConversionOptions, events *pageEvents) chromedp.ActionFunc {
 	return func(ctx context.Context) error {
-		if options.WaitForSelector != "" {
-			var waitCtx context.Context
-			var cancel context.CancelFunc
+		if selectors := options.waitForSelectors(); len(selectors) > 0 {
+			enterPhase(ctx, PhaseWaitForSelector)
+
+			if err := waitForSelectors(ctx, selectors, options.WaitForSelectorPolicy, options.WaitForSelectorState, options.WaitForSelectorTimeout); err != nil {
+				return err
+			}
+		}
+
+		enterPhase(ctx, PhaseWaitUntil)
+
+		if err := waitLoaded(ctx, events, options.WaitUntilTimeout); err != nil {
+			return err
+		}
+
+		if options.WaitForFunction != "" {
+			enterPhase(ctx, PhaseWaitForFunction)
+
+			if err := waitForFunction(ctx, options.WaitForFunction, options.WaitForFunctionTimeout); err != nil {
+				return err
+			}
+		}
+
+		enterPhase(ctx, PhaseWaitForResources)
+
+		if options.AutoScroll {
+			if err := autoScroll(ctx); err != nil {
+				return err
+			}
+		}
 
-			if options.WaitForSelectorTimeout > 0 {
-				waitCtx, cancel = context.WithCancel(ctx)
-			} else {
-				waitCtx, cancel = context.WithTimeout(ctx, time.Duration(options.WaitForSelectorTimeout)*time.Millisecond)
+		if options.WaitForImages {
+			if err := waitForImages(ctx, options.WaitForImagesTimeout); err != nil {
+				return err
 			}
+		}
 
-			defer cancel()
+		if len(options.Fonts) > 0 {
+			if err := waitForFonts(ctx, options.Fonts); err != nil {
+				return err
+			}
+		} else if options.WaitForFonts {
+			if err := waitForWebFonts(ctx); err != nil {
+				return err
+			}
+		}
 
-			if err := chromedp.WaitReady(options.WaitForSelector).Do(waitCtx); err != nil {
+		if options.WaitForMath {
+			if err := waitForMath(ctx); err != nil {
 				return err
 			}
 		}
 
-		if options.WaitUntilTimeout > 0 {
-			if !<-waiterTimeout(waiter, time.Duration(options.WaitUntilTimeout)*time.Millisecond) {
-				return ErrWaitUntilTimeout
+		if len(options.Actions) > 0 {
+			enterPhase(ctx, PhaseActions)
+
+			if err := runActions(ctx, options.Actions); err != nil {
+				return err
 			}
-		} else {
-			<-waiter
 		}
 
 		if options.Delay > 0 {
-			<-time.After(options.Delay)
+			enterPhase(ctx, PhaseDelay)
+
+			select {
+			case <-time.After(options.Delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		enterPhase(ctx, PhaseDOM)
+
+		if selectors := options.selectors(); len(selectors) > 0 {
+			if err := scrollIntoView(ctx, selectors); err != nil {
+				return err
+			}
+
+			extract := extractSelectors
+
+			if options.SelectorMode == SelectorModeIsolate {
+				extract = isolateSelectors
+			}
+
+			if err := extract(ctx, selectors, options.SelectorPageBreaks); err != nil {
+				return err
+			}
 		}
 
-		if options.Selector != "" {
-			htmlb := strings.Builder{}
-			htmlb.WriteString("<body>")
+		if len(options.ReplaceContent) > 0 {
+			if err := replaceContent(ctx, options.ReplaceContent); err != nil {
+				return err
+			}
+		}
 
-			var elhtml string
-			if err := chromedp.OuterHTML(options.Selector, &elhtml).Do(ctx); err != nil {
+		if len(options.HideSelectors) > 0 {
+			if err := hideSelectors(ctx, options.HideSelectors, false); err != nil {
 				return err
 			}
+		}
 
-			htmlb.WriteString(elhtml)
-			htmlb.WriteString("</body>")
+		if len(options.RemoveSelectors) > 0 {
+			if err := hideSelectors(ctx, options.RemoveSelectors, true); err != nil {
+				return err
+			}
+		}
 
-			var nodes []*cdp.Node
-			if err := chromedp.Nodes("body", &nodes, chromedp.ByQuery).Do(ctx); err != nil || len(nodes) == 0 {
+		if options.PagedJS {
+			if err := renderPagedJS(ctx); err != nil {
 				return err
 			}
+		}
 
-			body := nodes[0]
+		if options.FailOnConsoleError {
+			if err := events.consoleError(); err != nil {
+				return err
+			}
+		}
 
-			if err := dom.SetOuterHTML(body.NodeID, htmlb.String()).Do(ctx); err != nil {
+		if options.FailOnResourceErrors {
+			if err := events.resources.resourceError(); err != nil {
 				return err
 			}
 		}
@@ -347,44 +1375,161 @@ func afterNavigation(options *ConversionOptions, waiter <-chan bool) chromedp.Ac
 	}
 }
 
-func waiterTimeout(waiter <-chan bool, d time.Duration) <-chan bool {
-	towaiter := make(chan bool)
+// waitLoaded waits for the WaitUntil event of the page. A timeout of 0 waits
+// until ctx is done.
+func waitLoaded(ctx context.Context, events *pageEvents, timeout time.Duration) error {
+	var expired <-chan time.Time
 
-	go func() {
-		select {
-		case <-waiter:
-			towaiter <- true
-		case <-time.NewTimer(d).C:
-			towaiter <- false
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-events.loaded:
+		return nil
+	case <-expired:
+		return ErrWaitUntilTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// navigate navigates to the location and waits until it's loaded. Unless
+// timeout is zero, it fails with ErrNavigationTimeout after timeout, so that
+// slow sites fail fast without shortening the timeout of the conversion.
+func navigate(location string, timeout time.Duration) chromedp.ActionFunc {
+	return func(ctx context.Context) error {
+		if timeout <= 0 {
+			return chromedp.Navigate(location).Do(ctx)
 		}
-	}()
 
-	return towaiter
+		navCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		err := chromedp.Navigate(location).Do(navCtx)
+
+		if err != nil && ctx.Err() == nil && navCtx.Err() == context.DeadlineExceeded {
+			return ErrNavigationTimeout
+		}
+
+		return err
+	}
+}
+
+func warmupActions() []chromedp.Action {
+	return []chromedp.Action{
+		chromedp.Navigate("about:blank"),
+		printToPDFAction(ioutil.Discard, NewConversionOptions(), nil),
+	}
 }
 
-func printToPDFAction(w io.Writer, options *ConversionOptions) chromedp.ActionFunc {
+// printToPDFAction prints the page to w. If outline is set, the headings of
+// the page are added to it.
+func printToPDFAction(w io.Writer, options *ConversionOptions, outline *headingOutline) chromedp.ActionFunc {
 	return func(ctx context.Context) error {
-		data, _, err := options.PDFParams.Do(ctx)
+		segments, err := printSegments(options)
+
+		if err != nil {
+			return err
+		}
+
+		var headings []*heading
+
+		if outline != nil {
+			if headings, err = markHeadings(ctx); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+
+		if options.Deterministic {
+			now = deterministicDate
+		}
+
+		// A single segment is printed straight to w, in stream mode chunk by
+		// chunk.
+		if len(segments) == 1 && outline == nil {
+			return printPDF(ctx, segmentParams(segments[0], options, now, false), options, w)
+		}
+
+		bufs := make([]*bytes.Buffer, 0, len(segments))
+
+		for _, segment := range segments {
+			buf := bytes.NewBuffer([]byte{})
+			err := printPDF(ctx, segmentParams(segment, options, now, len(segments) > 1), options, buf)
+
+			if err != nil {
+				// The remaining segments start after the last page of the document.
+				if len(bufs) > 0 && isPageRangeError(err) {
+					break
+				}
+
+				return err
+			}
+
+			bufs = append(bufs, buf)
+		}
+
+		if outline != nil {
+			if err := outline.addDocument(headings, bufs); err != nil {
+				return err
+			}
+		}
+
+		buf, err := concatPDFs(bufs, options.postProcessOptions().writeConfiguration())
 
 		if err != nil {
 			return err
 		}
 
-		_, err = w.Write(data)
+		options.progress(StagePrint, int64(buf.Len()))
+		_, err = w.Write(buf.Bytes())
 
 		return err
 	}
 }
 
-func secure(buf *bytes.Buffer, ownerPw, userPw string) (*bytes.Buffer, error) {
-	if ownerPw == "" && userPw == "" {
+// segmentParams returns the print parameters of a segment. The page ranges
+// of the segment replace those of the options if ranges is set.
+func segmentParams(segment *printSegment, options *ConversionOptions, now time.Time, ranges bool) *page.PrintToPDFParams {
+	params := *options.PDFParams
+	params.DisplayHeaderFooter = segment.displayHeaderFooter
+	params.Landscape = segment.landscape
+	params.HeaderTemplate = renderTemplate(segment.headerTemplate, options.TemplateData, now)
+	params.FooterTemplate = renderTemplate(segment.footerTemplate, options.TemplateData, now)
+
+	if ranges {
+		params.PageRanges = formatPageRanges(segment.ranges)
+	}
+
+	// Paged.js lays out the pages including their margins.
+	if options.PagedJS {
+		params.PreferCSSPageSize = true
+		params.MarginTop, params.MarginRight, params.MarginBottom, params.MarginLeft = 0, 0, 0, 0
+	}
+
+	return &params
+}
+
+// isPageRangeError reports whether Chrome rejected page ranges beyond the end
+// of the document.
+func isPageRangeError(err error) bool {
+	return strings.Contains(err.Error(), "Page range exceeds page count")
+}
+
+func secure(buf *bytes.Buffer, options *PostProcessOptions) (*bytes.Buffer, error) {
+	if options.OwnerPassword == "" && options.UserPassword == "" {
 		return buf, nil
 	}
 
-	cfg := pdfcpu.NewAESConfiguration(userPw, ownerPw, 256)
+	cfg := pdfcpu.NewAESConfiguration(options.UserPassword, options.OwnerPassword, 256)
 	final := bytes.NewBuffer([]byte{})
 
 	cfg.Cmd = pdfcpu.ENCRYPT
+	options.configureWrite(cfg)
 
 	if err := api.Optimize(bytes.NewReader(buf.Bytes()), final, cfg); err != nil {
 		return nil, err
@@ -393,7 +1538,7 @@ func secure(buf *bytes.Buffer, ownerPw, userPw string) (*bytes.Buffer, error) {
 	return final, nil
 }
 
-func watermark(buf *bytes.Buffer, config *WatermarkConfig) (*bytes.Buffer, error) {
+func watermark(buf *bytes.Buffer, config *WatermarkConfig, cfg *pdfcpu.Configuration) (*bytes.Buffer, error) {
 	wm, err := pdfcpu.ParseWatermarkDetails(config.Query, config.OnTop)
 
 	if err != nil {
@@ -402,7 +1547,7 @@ func watermark(buf *bytes.Buffer, config *WatermarkConfig) (*bytes.Buffer, error
 
 	w := bytes.NewBuffer([]byte{})
 
-	if err := api.AddWatermarks(bytes.NewReader(buf.Bytes()), w, config.Pages, wm, nil); err != nil {
+	if err := api.AddWatermarks(bytes.NewReader(buf.Bytes()), w, config.Pages, wm, cfg); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,94 @@
+package pdfire_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/imkiptoo/pdfire"
+)
+
+// benchmarkHTML returns a document with the given number of paragraphs.
+func benchmarkHTML(paragraphs int) string {
+	p := "<p>Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.</p>"
+
+	return "<html><body>" + strings.Repeat(p, paragraphs) + "</body></html>"
+}
+
+func BenchmarkConvertHTML(b *testing.B) {
+	converter := pdfire.NewConverter(pdfire.NewConverterOptions())
+	defer converter.Close()
+
+	for _, paragraphs := range []int{10, 1000, 10000} {
+		html := benchmarkHTML(paragraphs)
+
+		b.Run(fmt.Sprintf("%dKB", len(html)/1024), func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				options := pdfire.NewConversionOptions()
+				options.HTML = html
+
+				if err := converter.Convert(context.Background(), ioutil.Discard, options); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkConvertAll(b *testing.B) {
+	converterOptions := pdfire.NewConverterOptions()
+	converterOptions.PoolSize = 4
+	converter := pdfire.NewConverter(converterOptions)
+	defer converter.Close()
+
+	if err := converter.Warmup(context.Background()); err != nil {
+		b.Fatal(err)
+	}
+
+	html := benchmarkHTML(100)
+
+	for _, concurrency := range []int{1, 4, 8} {
+		b.Run(fmt.Sprintf("concurrency-%d", concurrency), func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				options := make([]*pdfire.ConversionOptions, concurrency)
+
+				for j := range options {
+					options[j] = pdfire.NewConversionOptions()
+					options[j].HTML = html
+				}
+
+				for _, res := range converter.ConvertAll(context.Background(), options, concurrency) {
+					if res.Err != nil {
+						b.Fatal(res.Err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMergeFiles(b *testing.B) {
+	wd, _ := os.Getwd()
+	src, _ := ioutil.ReadFile(filepath.Join(wd, "testdata/pages.pdf"))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		files := []*pdfire.MergeFile{
+			{PDF: bytes.NewReader(src), Title: "First"},
+			{PDF: bytes.NewReader(src), Title: "Second"},
+		}
+
+		if err := pdfire.MergeFiles(context.Background(), ioutil.Discard, files, pdfire.NewPostProcessOptions()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
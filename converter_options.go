@@ -0,0 +1,139 @@
+package pdfire
+
+var (
+	// ChannelStable is the stable Chrome release channel.
+	ChannelStable = Channel("stable")
+	// ChannelBeta is the beta Chrome release channel.
+	ChannelBeta = Channel("beta")
+	// ChannelHeadlessShell is the standalone "chrome-headless-shell" build.
+	ChannelHeadlessShell = Channel("chrome-headless-shell")
+)
+
+var (
+	// SandboxDefault keeps chromedp's default sandbox behavior, which disables
+	// the sandbox when running as root.
+	SandboxDefault = SandboxPreset("")
+	// SandboxUserNamespace enforces the sandbox using unprivileged user namespaces
+	// and seccomp-bpf, without the setuid helper. Suited for containers that
+	// allow user namespaces.
+	SandboxUserNamespace = SandboxPreset("userns")
+	// SandboxSeccomp enforces only the seccomp-bpf sandbox. Suited for containers
+	// that forbid user namespaces.
+	SandboxSeccomp = SandboxPreset("seccomp")
+)
+
+var (
+	// QueuePolicyWait makes conversions wait until they can run.
+	QueuePolicyWait = QueuePolicy("wait")
+	// QueuePolicyReject fails conversions with ErrTooManyConversions.
+	QueuePolicyReject = QueuePolicy("reject")
+)
+
+// ConverterOptions are the converter options.
+type ConverterOptions struct {
+	// ExecPath is the path to the Chrome executable. It takes precedence over Channel.
+	ExecPath string
+	// Channel selects the Chrome executable by release channel. If both ExecPath
+	// and Channel are empty, chromedp's default lookup is used.
+	Channel Channel
+	// NoSandbox disables the Chrome sandbox entirely. It takes precedence over Sandbox.
+	NoSandbox bool
+	// Sandbox is the sandbox preset.
+	Sandbox SandboxPreset
+	// DisallowFileURLs rejects URL conversions of file:// URLs.
+	DisallowFileURLs bool
+	// AllowedChromeArgs are the Chrome flags (without leading dashes) that may be
+	// passed per conversion through ConversionOptions.ChromeArgs.
+	AllowedChromeArgs []string
+	// Extensions are paths to unpacked extensions loaded into every browser.
+	// Extensions require Chrome's new headless mode, which is enabled
+	// automatically; the chrome-headless-shell channel cannot load extensions.
+	Extensions []string
+	// PoolSize is the maximum number of long-lived browsers kept by the converter.
+	// Each conversion runs in a new tab with an isolated browser context. If zero,
+	// every conversion launches its own browser.
+	PoolSize int
+	// TabsPerBrowser is the number of conversions that share a pooled browser
+	// at once, each in its own tab and browser context. If zero, every pooled
+	// browser runs one conversion at a time.
+	TabsPerBrowser int
+	// MaxOldSpaceSize limits the V8 old generation heap of every renderer, in
+	// megabytes. Pages exceeding it crash their tab instead of the host, and
+	// the conversion fails with a *ResourceLimitError without a retry.
+	MaxOldSpaceSize int
+	// WarmupRender makes Warmup render a trivial document in every browser.
+	WarmupRender bool
+	// FontDirs are directories with fonts that Chrome can use in addition to the
+	// installed fonts, e.g. Noto Color Emoji and Noto CJK. Requires fontconfig.
+	FontDirs []string
+	// RequiredFonts are the font families that Chrome must be able to render,
+	// e.g. FallbackFonts. Warmup and CheckFonts fail if one of them is missing.
+	RequiredFonts []string
+	// CrashRetries is how often a conversion is retried on a new tab when its
+	// tab crashes. A *ChromeCrashedError is returned when all attempts crash.
+	CrashRetries int
+	// ChromeWSURL is the DevTools WebSocket URL of a running Chrome, e.g.
+	// "ws://chrome:9222/devtools/browser/<id>". If set, no browser is launched
+	// and conversions run in tabs of the remote Chrome.
+	ChromeWSURL string
+	// AllowChromeWSURL allows conversions to connect to their own remote Chrome
+	// through ConversionOptions.ChromeWSURL.
+	AllowChromeWSURL bool
+	// MaxConcurrency limits the number of conversions and previews running at
+	// once. If zero, it's unlimited.
+	MaxConcurrency int
+	// QueuePolicy decides whether conversions beyond MaxConcurrency wait for a
+	// running one to finish or fail right away.
+	QueuePolicy QueuePolicy
+	// FilterLists are paths to filter lists in the syntax of Adblock Plus and
+	// EasyList, which block the requests of ads for conversions with BlockAds.
+	// If empty, a bundled list of the major ad networks is used.
+	FilterLists []string
+	// URLPolicy restricts the URLs that conversions may render and request.
+	URLPolicy *URLPolicy
+	// BlockPrivateNetworks rejects conversions of URLs that aren't http or https
+	// or whose host is localhost or resolves to a loopback, private or
+	// link-local address, including the documents they redirect to. Requests of
+	// the pages to such hosts are blocked.
+	BlockPrivateNetworks bool
+	// Templates are stored header and footer templates by ID, which
+	// conversions reference through HeaderTemplateID and FooterTemplateID, so
+	// that shared templates don't have to be sent with every conversion.
+	Templates map[string]string
+}
+
+// Channel is a Chrome release channel.
+type Channel string
+
+// SandboxPreset is a Chrome sandbox configuration preset.
+type SandboxPreset string
+
+// QueuePolicy decides what happens to conversions beyond MaxConcurrency.
+type QueuePolicy string
+
+// NewConverterOptions returns new converter options with default values.
+func NewConverterOptions() *ConverterOptions {
+	return &ConverterOptions{
+		AllowedChromeArgs: []string{
+			"force-color-profile",
+			"font-render-hinting",
+			"lang",
+		},
+		Extensions:    make([]string, 0),
+		FontDirs:      make([]string, 0),
+		RequiredFonts: make([]string, 0),
+		FilterLists:   make([]string, 0),
+		Templates:     make(map[string]string),
+		CrashRetries:  2,
+		QueuePolicy:   QueuePolicyWait,
+	}
+}
+
+// tabsPerBrowser returns the number of concurrent tabs of a pooled browser.
+func (o *ConverterOptions) tabsPerBrowser() int {
+	if o.TabsPerBrowser < 1 {
+		return 1
+	}
+
+	return o.TabsPerBrowser
+}
@@ -0,0 +1,138 @@
+package pdfire_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/imkiptoo/pdfire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewConverterOptions(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConverterOptions()
+
+	assert.Equal("", options.ExecPath)
+	assert.Equal(pdfire.Channel(""), options.Channel)
+	assert.Equal(false, options.NoSandbox)
+	assert.Equal(pdfire.SandboxDefault, options.Sandbox)
+	assert.Equal(false, options.DisallowFileURLs)
+	assert.Equal([]string{"force-color-profile", "font-render-hinting", "lang"}, options.AllowedChromeArgs)
+	assert.Equal([]string{}, options.Extensions)
+	assert.Equal(0, options.PoolSize)
+	assert.Equal(false, options.WarmupRender)
+	assert.Equal([]string{}, options.FontDirs)
+	assert.Equal([]string{}, options.RequiredFonts)
+	assert.Equal([]string{}, options.FilterLists)
+	assert.Equal(2, options.CrashRetries)
+	assert.Equal(0, options.TabsPerBrowser)
+	assert.Equal("", options.ChromeWSURL)
+	assert.Equal(false, options.AllowChromeWSURL)
+	assert.Equal(0, options.MaxConcurrency)
+	assert.Equal(pdfire.QueuePolicyWait, options.QueuePolicy)
+}
+
+func TestConverterUnknownChannel(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConverterOptions()
+	options.Channel = pdfire.Channel("nightly")
+
+	version, err := pdfire.NewConverter(options).Version(context.Background())
+
+	assert.Nil(version)
+	assert.Equal(pdfire.ErrUnknownChannel, err)
+}
+
+func TestConverterUnknownSandboxPreset(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConverterOptions()
+	options.Sandbox = pdfire.SandboxPreset("unknown")
+
+	version, err := pdfire.NewConverter(options).Version(context.Background())
+
+	assert.Nil(version)
+	assert.Equal(pdfire.ErrUnknownSandboxPreset, err)
+}
+
+func TestConverterMissingFontDir(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConverterOptions()
+	options.FontDirs = []string{"testdata/missing-fonts"}
+
+	version, err := pdfire.NewConverter(options).Version(context.Background())
+
+	assert.Nil(version)
+	assert.True(os.IsNotExist(err))
+}
+
+func TestConverterDisallowFileURLs(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConverterOptions()
+	options.DisallowFileURLs = true
+
+	convopts := pdfire.NewConversionOptions()
+	convopts.URL = "FILE:///etc/passwd"
+
+	err := pdfire.NewConverter(options).Convert(context.Background(), ioutil.Discard, convopts)
+
+	assert.Equal(pdfire.ErrFileURLNotAllowed, err)
+}
+
+func TestConverterChromeArgNotAllowed(t *testing.T) {
+	assert := assert.New(t)
+	convopts := pdfire.NewConversionOptions()
+	convopts.ChromeArgs = []string{"--lang=de", "--remote-debugging-address=0.0.0.0"}
+
+	err := pdfire.NewConverter(pdfire.NewConverterOptions()).Convert(context.Background(), ioutil.Discard, convopts)
+
+	assert.Equal(&pdfire.ChromeArgError{Arg: "--remote-debugging-address=0.0.0.0"}, err)
+}
+
+func TestConverterMissingExtension(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConverterOptions()
+	options.Extensions = []string{"testdata/no-such-extension"}
+
+	version, err := pdfire.NewConverter(options).Version(context.Background())
+
+	assert.Nil(version)
+	assert.True(os.IsNotExist(err))
+}
+
+func TestConverterValidate(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConverterOptions()
+	options.DisallowFileURLs = true
+	converter := pdfire.NewConverter(options)
+
+	convopts := pdfire.NewConversionOptions()
+	convopts.URL = "https://example.com"
+
+	assert.Nil(converter.Validate(convopts))
+
+	convopts.ChromeArgs = []string{"--remote-debugging-port=9222"}
+
+	assert.IsType(&pdfire.ChromeArgError{}, converter.Validate(convopts))
+
+	convopts.ChromeArgs = []string{}
+	convopts.PDFParams.PageRanges = "3-1"
+
+	assert.Equal(pdfire.ErrInvalidPageRanges, converter.Validate(convopts))
+
+	convopts.PDFParams.PageRanges = ""
+	convopts.Device = "nokia-3310"
+
+	assert.Equal(&pdfire.DeviceError{Device: "nokia-3310"}, converter.Validate(convopts))
+
+	convopts.Device = ""
+	convopts.DeviceScaleFactor = -1
+
+	assert.Equal(&pdfire.ParseError{Key: "deviceScaleFactor", Value: -1.0}, converter.Validate(convopts))
+
+	convopts.DeviceScaleFactor = 0
+	convopts.URL = "file:///etc/passwd"
+
+	assert.Equal(pdfire.ErrFileURLNotAllowed, converter.Validate(convopts))
+}
@@ -1,16 +1,32 @@
 package pdfire_test
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
+	"encoding/base64"
 	"flag"
+	"image"
+	"image/png"
 	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/chromedp/cdproto/page"
 	"github.com/imkiptoo/pdfire"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
 )
 
 func TestMain(m *testing.M) {
@@ -58,3 +74,1664 @@ func TestConvertURL(t *testing.T) {
 		t.Error("Generated PDF is smaller than the provided HTML.")
 	}
 }
+
+func TestConverterPool(t *testing.T) {
+	assert := assert.New(t)
+	converterOptions := pdfire.NewConverterOptions()
+	converterOptions.PoolSize = 1
+	converterOptions.WarmupRender = true
+	converter := pdfire.NewConverter(converterOptions)
+	defer converter.Close()
+
+	assert.Nil(converter.Warmup(context.Background()))
+
+	for i := 0; i < 2; i++ {
+		pdf := bytes.NewBuffer(make([]byte, 0))
+		options := pdfire.NewConversionOptions()
+		options.HTML = "<p>Pooled</p>"
+		err := converter.Convert(context.Background(), pdf, options)
+
+		assert.Nil(err)
+		assert.True(pdf.Len() > 0)
+	}
+}
+
+func TestConverterTabsPerBrowser(t *testing.T) {
+	assert := assert.New(t)
+	converterOptions := pdfire.NewConverterOptions()
+	converterOptions.PoolSize = 1
+	converterOptions.TabsPerBrowser = 2
+	converterOptions.WarmupRender = true
+	converter := pdfire.NewConverter(converterOptions)
+	defer converter.Close()
+
+	assert.Nil(converter.Warmup(context.Background()))
+
+	options := make([]*pdfire.ConversionOptions, 4)
+
+	for i := range options {
+		options[i] = pdfire.NewConversionOptions()
+		options[i].HTML = "<p>Shared browser</p>"
+	}
+
+	for _, result := range converter.ConvertAll(context.Background(), options, 4) {
+		assert.Nil(result.Err)
+		assert.True(len(result.PDF) > 0)
+	}
+}
+
+func TestConverterHealthy(t *testing.T) {
+	assert := assert.New(t)
+	converterOptions := pdfire.NewConverterOptions()
+	converterOptions.PoolSize = 1
+	converter := pdfire.NewConverter(converterOptions)
+
+	assert.Equal(pdfire.ErrNoBrowser, converter.Healthy(context.Background()))
+
+	converter.Close()
+
+	assert.Equal(pdfire.ErrConverterClosed, converter.Healthy(context.Background()))
+}
+
+func TestConverterHealthyExecPath(t *testing.T) {
+	assert := assert.New(t)
+	converterOptions := pdfire.NewConverterOptions()
+	converterOptions.ExecPath = "testdata/no-such-chrome"
+
+	assert.Equal(pdfire.ErrBrowserNotFound, pdfire.NewConverter(converterOptions).Healthy(context.Background()))
+
+	converterOptions.ExecPath = os.Args[0]
+
+	assert.Nil(pdfire.NewConverter(converterOptions).Healthy(context.Background()))
+}
+
+func TestConverterMaxConcurrency(t *testing.T) {
+	assert := assert.New(t)
+	converterOptions := pdfire.NewConverterOptions()
+	converterOptions.MaxConcurrency = 1
+	converterOptions.QueuePolicy = pdfire.QueuePolicyReject
+	converter := pdfire.NewConverter(converterOptions)
+	defer converter.Close()
+
+	started := make(chan struct{})
+	options := pdfire.NewConversionOptions()
+	options.HTML = "<p>Slow</p>"
+	options.WaitForSelector = "#never"
+	options.OnProgress = func(p pdfire.Progress) {
+		select {
+		case <-started:
+		default:
+			close(started)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- converter.Convert(ctx, ioutil.Discard, options)
+	}()
+
+	<-started
+
+	err := converter.Convert(context.Background(), ioutil.Discard, pdfire.NewConversionOptions())
+
+	assert.Equal(pdfire.ErrTooManyConversions, err)
+
+	cancel()
+	<-done
+}
+
+func TestConverterClosed(t *testing.T) {
+	assert := assert.New(t)
+	converterOptions := pdfire.NewConverterOptions()
+	converterOptions.PoolSize = 1
+	converter := pdfire.NewConverter(converterOptions)
+	converter.Close()
+
+	err := converter.Convert(context.Background(), bytes.NewBuffer(make([]byte, 0)), pdfire.NewConversionOptions())
+
+	assert.Equal(pdfire.ErrConverterClosed, err)
+}
+
+func TestConvertOfflineURL(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.URL = "https://example.com"
+	options.Offline = true
+
+	err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(pdfire.ErrOfflineURL, err)
+}
+
+func TestConvertAll(t *testing.T) {
+	assert := assert.New(t)
+	options := make([]*pdfire.ConversionOptions, 3)
+
+	for i := range options {
+		options[i] = pdfire.NewConversionOptions()
+		options[i].HTML = "<p>Batch</p>"
+	}
+
+	options[1].ChromeArgs = []string{"--not-allowed"}
+
+	results := pdfire.ConvertAll(context.Background(), options, 2)
+
+	assert.Len(results, 3)
+	assert.Nil(results[0].Err)
+	assert.True(len(results[0].PDF) > 0)
+	assert.IsType(&pdfire.ChromeArgError{}, results[1].Err)
+	assert.Nil(results[2].Err)
+	assert.True(len(results[2].PDF) > 0)
+}
+
+func TestConvertAllCanceled(t *testing.T) {
+	assert := assert.New(t)
+	options := make([]*pdfire.ConversionOptions, 2)
+
+	for i := range options {
+		options[i] = pdfire.NewConversionOptions()
+		options[i].HTML = "<p>Batch</p>"
+		options[i].Delay = 10 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Second, cancel)
+
+	results := pdfire.ConvertAll(ctx, options, 1)
+
+	assert.Len(results, 2)
+	assert.Equal(context.Canceled, results[1].Err)
+}
+
+func TestConvertAllTimeout(t *testing.T) {
+	assert := assert.New(t)
+	options := make([]*pdfire.ConversionOptions, 2)
+
+	for i := range options {
+		options[i] = pdfire.NewConversionOptions()
+		options[i].HTML = "<p>Batch</p>"
+		options[i].Delay = 10 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	results := pdfire.ConvertAll(ctx, options, 1)
+
+	assert.Len(results, 2)
+	assert.Equal(pdfire.ErrTimeout, results[1].Err)
+}
+
+func TestConvertProgress(t *testing.T) {
+	assert := assert.New(t)
+	stages := make([]pdfire.ProgressStage, 0)
+	options := pdfire.NewConversionOptions()
+	options.HTML = "<p>Progress</p>"
+	options.OnProgress = func(p pdfire.Progress) {
+		if len(stages) == 0 || stages[len(stages)-1] != p.Stage {
+			stages = append(stages, p.Stage)
+		}
+	}
+
+	err := pdfire.Convert(context.Background(), bytes.NewBuffer(make([]byte, 0)), options)
+
+	assert.Nil(err)
+	assert.Equal([]pdfire.ProgressStage{
+		pdfire.StageBrowser,
+		pdfire.StageNavigation,
+		pdfire.StageWait,
+		pdfire.StagePrint,
+		pdfire.StagePostProcess,
+		pdfire.StageDone,
+	}, stages)
+}
+
+func TestConvertStats(t *testing.T) {
+	assert := assert.New(t)
+	var stats *pdfire.Stats
+	options := pdfire.NewConversionOptions()
+	options.HTML = "<p>Stats</p>"
+	options.OnStats = func(s *pdfire.Stats) {
+		stats = s
+	}
+
+	err := pdfire.Convert(context.Background(), bytes.NewBuffer(make([]byte, 0)), options)
+
+	require.NoError(t, err)
+	require.NotNil(t, stats)
+	assert.True(stats.JSHeapUsedSize > 0)
+	assert.NotEmpty(stats.Metrics)
+}
+
+func TestConvertResourceLimit(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = "<script>var a = []; setInterval(function () { a.push(new Array(1e6).fill(1)); }, 1);</script>"
+	options.MaxJSHeapSize = 16 * 1024 * 1024
+	options.Delay = 10 * time.Second
+
+	err := pdfire.Convert(context.Background(), bytes.NewBuffer(make([]byte, 0)), options)
+
+	assert.IsType(&pdfire.ResourceLimitError{}, err)
+}
+
+func TestConvertConsoleError(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<script>console.error("chart failed"); undefinedFunction();</script>`
+	options.FailOnConsoleError = true
+
+	err := pdfire.Convert(context.Background(), bytes.NewBuffer(make([]byte, 0)), options)
+
+	if assert.IsType(&pdfire.ConsoleError{}, err) {
+		assert.Len(err.(*pdfire.ConsoleError).Messages, 2)
+		assert.Equal("chart failed", err.(*pdfire.ConsoleError).Messages[0])
+	}
+}
+
+func TestConvertWaitForSelector(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<div id="chart" style="display: none"></div><script>setTimeout(function () { document.getElementById("chart").style.display = "block"; document.getElementById("chart").textContent = "ready"; }, 200);</script>`
+	options.WaitForSelector = "#chart"
+	options.WaitForSelectorState = pdfire.SelectorStateVisible
+	options.WaitForSelectorTimeout = 5 * time.Second
+
+	err := pdfire.Convert(context.Background(), bytes.NewBuffer(make([]byte, 0)), options)
+
+	assert.Nil(err)
+
+	options.WaitForSelectorState = pdfire.SelectorStateHidden
+	options.HTML = `<div id="spinner">Loading</div><script>setTimeout(function () { document.getElementById("spinner").remove(); }, 200);</script>`
+	options.WaitForSelector = "#spinner"
+
+	err = pdfire.Convert(context.Background(), bytes.NewBuffer(make([]byte, 0)), options)
+
+	assert.Nil(err)
+}
+
+func TestConvertWaitForSelectorTimeout(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<div id="chart" style="display: none"></div>`
+	options.WaitForSelector = "#chart"
+	options.WaitForSelectorState = pdfire.SelectorStateVisible
+	options.WaitForSelectorTimeout = 300 * time.Millisecond
+
+	start := time.Now()
+	err := pdfire.Convert(context.Background(), bytes.NewBuffer(make([]byte, 0)), options)
+
+	assert.Equal(pdfire.ErrWaitForSelectorTimeout, err)
+	assert.True(time.Since(start) < 10*time.Second)
+}
+
+func TestConvertWaitForSelectorsAnyOf(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<div id="table"></div><script>setTimeout(function () { document.body.appendChild(document.createElement("canvas")).id = "chart"; }, 200);</script>`
+	options.WaitForSelectors = []string{"#chart", "#missing"}
+	options.WaitForSelectorPolicy = pdfire.SelectorPolicyAnyOf
+	options.WaitForSelectorTimeout = 5 * time.Second
+
+	err := pdfire.Convert(context.Background(), bytes.NewBuffer(make([]byte, 0)), options)
+
+	assert.Nil(err)
+
+	options.WaitForSelectorPolicy = pdfire.SelectorPolicyAllOf
+	options.WaitForSelectorTimeout = 500 * time.Millisecond
+
+	err = pdfire.Convert(context.Background(), bytes.NewBuffer(make([]byte, 0)), options)
+
+	assert.Equal(pdfire.ErrWaitForSelectorTimeout, err)
+}
+
+func TestConvertWaitForFunction(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<script>setTimeout(function () { window.__APP_READY = true; }, 200);</script>`
+	options.WaitForFunction = "window.__APP_READY === true"
+	options.WaitForFunctionTimeout = 5 * time.Second
+
+	err := pdfire.Convert(context.Background(), bytes.NewBuffer(make([]byte, 0)), options)
+
+	assert.Nil(err)
+
+	options.WaitForFunction = "window.__NEVER_READY"
+	options.WaitForFunctionTimeout = 300 * time.Millisecond
+
+	err = pdfire.Convert(context.Background(), bytes.NewBuffer(make([]byte, 0)), options)
+
+	assert.Equal(pdfire.ErrWaitForFunctionTimeout, err)
+}
+
+func TestConvertWaitForFonts(t *testing.T) {
+	assert := assert.New(t)
+	var served int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<style>@font-face { font-family: Slow; src: url(/slow.woff2); } p { font-family: Slow; }</style><p>Invoice</p>`))
+	})
+	mux.HandleFunc("/slow.woff2", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+		atomic.StoreInt32(&served, 1)
+		w.WriteHeader(http.StatusNotFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	options := pdfire.NewConversionOptions()
+	options.URL = server.URL
+	options.WaitForFonts = true
+
+	err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Nil(err)
+	assert.Equal(int32(1), atomic.LoadInt32(&served))
+}
+
+func TestConvertAutoScroll(t *testing.T) {
+	assert := assert.New(t)
+	var requested int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<div style="height: 5000px"></div><div id="lazy"></div><script>
+			new IntersectionObserver(function (entries, observer) {
+				if (entries[0].isIntersecting) {
+					observer.disconnect();
+					fetch("/lazy");
+				}
+			}).observe(document.getElementById("lazy"));
+		</script>`))
+	})
+	mux.HandleFunc("/lazy", func(w http.ResponseWriter, r *http.Request) {
+		atomic.StoreInt32(&requested, 1)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	options := pdfire.NewConversionOptions()
+	options.URL = server.URL
+	options.AutoScroll = true
+
+	err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Nil(err)
+	assert.Equal(int32(1), atomic.LoadInt32(&requested))
+}
+
+func TestConvertActions(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<div id="modal"><button id="close" onclick="this.parentNode.remove()">Close</button></div><input id="name">`
+	options.Actions = []*pdfire.PageAction{
+		{Type: pdfire.ActionClick, Selector: "#close"},
+		{Type: pdfire.ActionFill, Selector: "#name", Value: "ACME"},
+		{Type: pdfire.ActionEvaluate, Script: `if (document.getElementById("modal") || document.getElementById("name").value !== "ACME") { throw new Error("not ready"); }`},
+		{Type: pdfire.ActionWait, Duration: 100 * time.Millisecond},
+	}
+
+	err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Nil(err)
+
+	options.Actions = []*pdfire.PageAction{
+		{Type: pdfire.ActionClick, Selector: "#missing", Timeout: 300 * time.Millisecond},
+	}
+
+	err = pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(&pdfire.ActionError{Index: 0, Type: pdfire.ActionClick, Err: pdfire.ErrWaitForSelectorTimeout}, err)
+	assert.Equal("Action 1 (click) failed: WaitForSelector timed out.", err.Error())
+}
+
+func TestConvertColorScheme(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<style>@media (prefers-color-scheme: dark) { body { background: black; } }</style><p>Docs</p>`
+	options.ColorScheme = pdfire.ColorSchemeDark
+	options.WaitForFunction = `matchMedia("(prefers-color-scheme: dark)").matches`
+	options.WaitForFunctionTimeout = time.Second
+
+	err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Nil(err)
+
+	options.ColorScheme = pdfire.ColorSchemeLight
+
+	err = pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(pdfire.ErrWaitForFunctionTimeout, err)
+}
+
+func TestConvertDevice(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = "<p>Mobile</p>"
+	options.Device = "iphone-14"
+	options.Language = "de-CH"
+	options.WaitForFunction = `innerWidth === 390 && devicePixelRatio === 3 && /iPhone/.test(navigator.userAgent) && navigator.language === "de-CH"`
+	options.WaitForFunctionTimeout = time.Second
+
+	err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Nil(err)
+
+	options.Device = ""
+	options.DeviceScaleFactor = 2
+	options.WaitForFunction = "innerWidth === 1920 && devicePixelRatio === 2"
+
+	err = pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Nil(err)
+}
+
+func TestConvertSelectorModeExtract(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<body class="dark"><style>.dark .card h2 { color: red; }</style><nav>Menu</nav><main class="card"><h2 id="title">Title</h2><canvas id="chart"></canvas></main></body>`
+	options.Selectors = []string{"#chart", "#title"}
+	options.SelectorPageBreaks = true
+
+	err := pdfire.Convert(context.Background(), bytes.NewBuffer(make([]byte, 0)), options)
+
+	assert.Nil(err)
+
+	options.Selectors = []string{"#missing"}
+	start := time.Now()
+
+	err = pdfire.Convert(context.Background(), bytes.NewBuffer(make([]byte, 0)), options)
+
+	assert.NotNil(err)
+	assert.True(time.Since(start) < 10*time.Second)
+}
+
+func TestConvertSelectorModeIsolate(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<style>.card h2 { color: red; }</style><nav>Menu</nav><main class="card"><h2 id="title">Title</h2><p>Text</p></main>`
+	options.Selector = "#title"
+	options.SelectorMode = pdfire.SelectorModeIsolate
+
+	err := pdfire.Convert(context.Background(), bytes.NewBuffer(make([]byte, 0)), options)
+
+	assert.Nil(err)
+
+	options.Selector = "#missing"
+
+	err = pdfire.Convert(context.Background(), bytes.NewBuffer(make([]byte, 0)), options)
+
+	assert.NotNil(err)
+}
+
+func TestConvertHideSelectors(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<div id="cookie-banner">Accept cookies</div><p>Report</p>`
+	options.HideSelectors = []string{"#cookie-banner", ".chat-widget"}
+
+	err := pdfire.Convert(context.Background(), bytes.NewBuffer(make([]byte, 0)), options)
+
+	assert.Nil(err)
+
+	options.HideSelectors = []string{"#cookie-banner {"}
+
+	err = pdfire.Convert(context.Background(), bytes.NewBuffer(make([]byte, 0)), options)
+
+	assert.NotNil(err)
+}
+
+func TestConvertRemoveSelectors(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<header class="sticky-header" style="position: sticky; top: 0; height: 200px">Menu</header><p>Report</p>`
+	options.RemoveSelectors = []string{".sticky-header"}
+
+	err := pdfire.Convert(context.Background(), bytes.NewBuffer(make([]byte, 0)), options)
+
+	assert.Nil(err)
+}
+
+func TestConvertReplaceContent(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<p>Dear <span id="customer-name">customer</span>,</p><script>if (document.getElementById("customer-name").textContent !== "customer") console.error("replaced too early");</script>`
+	options.ReplaceContent = map[string]string{"#customer-name": "<b>ACME Corp</b>"}
+	options.FailOnConsoleError = true
+
+	err := pdfire.Convert(context.Background(), bytes.NewBuffer(make([]byte, 0)), options)
+
+	assert.Nil(err)
+}
+
+func TestPreview(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<h1>Invoice</h1>`
+	converter := pdfire.NewConverter(pdfire.NewConverterOptions())
+
+	img := bytes.NewBuffer(make([]byte, 0))
+	err := converter.Preview(context.Background(), img, options, 400)
+
+	assert.Nil(err)
+	assert.True(bytes.HasPrefix(img.Bytes(), []byte("\x89PNG")))
+}
+
+func TestPreviewInvalidWidth(t *testing.T) {
+	assert := assert.New(t)
+	converter := pdfire.NewConverter(pdfire.NewConverterOptions())
+
+	err := converter.Preview(context.Background(), ioutil.Discard, pdfire.NewConversionOptions(), 0)
+
+	assert.Equal(pdfire.ErrInvalidPreviewWidth, err)
+}
+
+func TestConverterClose(t *testing.T) {
+	assert := assert.New(t)
+	converter := pdfire.NewConverter(pdfire.NewConverterOptions())
+
+	assert.Nil(converter.Close())
+	assert.Nil(converter.Close())
+
+	options := pdfire.NewConversionOptions()
+	options.HTML = "<p>Closed</p>"
+	err := converter.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(pdfire.ErrConverterClosed, err)
+}
+
+func TestConvertHTMLWritesNoTempFile(t *testing.T) {
+	assert := assert.New(t)
+	converter := pdfire.NewConverter(pdfire.NewConverterOptions())
+	defer converter.Close()
+	tmp := filepath.Join(os.TempDir(), "pdfire/tmp/html")
+	before, _ := ioutil.ReadDir(tmp)
+
+	options := pdfire.NewConversionOptions()
+	options.HTML = "<p>Failing</p>"
+	options.ChromeArgs = []string{"--remote-debugging-port=9222"}
+	err := converter.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.NotNil(err)
+
+	after, _ := ioutil.ReadDir(tmp)
+
+	assert.Equal(len(before), len(after))
+}
+
+func TestMergeWaitsForConversions(t *testing.T) {
+	assert := assert.New(t)
+	converter := pdfire.NewConverter(pdfire.NewConverterOptions())
+	defer converter.Close()
+	goroutines := runtime.NumGoroutine()
+	options := pdfire.NewMergeOptions()
+
+	for i := 0; i < 5; i++ {
+		doc := pdfire.NewConversionOptions()
+		doc.URL = "https://example.com"
+		doc.Offline = true
+		options.Documents = append(options.Documents, doc)
+	}
+
+	err := converter.Merge(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(pdfire.ErrOfflineURL, err)
+	assert.True(runtime.NumGoroutine() <= goroutines)
+}
+
+func TestConvertTimeoutPhase(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = "<p>No chart</p>"
+	options.WaitForSelector = "#chart"
+	options.Timeout = 3 * time.Second
+
+	err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	if assert.IsType(&pdfire.TimeoutError{}, err) {
+		timeout := err.(*pdfire.TimeoutError)
+
+		assert.Equal(pdfire.PhaseWaitForSelector, timeout.Phase)
+		assert.Equal(pdfire.PhaseBrowser, timeout.Completed[0].Phase)
+	}
+}
+
+func TestConvertNavigationTimeout(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(3 * time.Second)
+		w.Write([]byte("<p>Slow</p>"))
+	}))
+	defer server.Close()
+
+	options := pdfire.NewConversionOptions()
+	options.URL = server.URL
+	options.NavigationTimeout = 500 * time.Millisecond
+	options.Timeout = 30 * time.Second
+
+	err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(pdfire.ErrNavigationTimeout, err)
+}
+
+func TestConvertWaitUntilNetworkIdle(t *testing.T) {
+	assert := assert.New(t)
+	var fetched int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<p id="data"></p><script>
+			window.addEventListener("load", function () {
+				fetch("/data").then(function (r) { return r.text(); }).then(function (text) {
+					document.getElementById("data").textContent = text;
+				});
+			});
+		</script>`))
+	})
+	mux.HandleFunc("/data", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+		w.Write([]byte("Loaded"))
+		atomic.StoreInt32(&fetched, 1)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	options := pdfire.NewConversionOptions()
+	options.URL = server.URL
+	options.WaitUntil = "networkidle0"
+	options.WaitUntilTimeout = 10 * time.Second
+
+	err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Nil(err)
+	assert.Equal(int32(1), atomic.LoadInt32(&fetched))
+}
+
+func TestConvertMethodAndBody(t *testing.T) {
+	assert := assert.New(t)
+	var method, contentType, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/report" {
+			data, _ := ioutil.ReadAll(r.Body)
+			method, contentType, body = r.Method, r.Header.Get("Content-Type"), string(data)
+		}
+
+		w.Write([]byte("<p>Report</p>"))
+	}))
+	defer server.Close()
+
+	options := pdfire.NewConversionOptions()
+	options.URL = server.URL + "/report"
+	options.Method = http.MethodPost
+	options.Body = "from=2019-01-01&to=2019-12-31"
+
+	err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Nil(err)
+	assert.Equal(http.MethodPost, method)
+	assert.Equal("application/x-www-form-urlencoded", contentType)
+	assert.Equal(options.Body, body)
+
+	options.Method = http.MethodGet
+	err = pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(pdfire.ErrBodyWithGET, err)
+}
+
+func TestConvertCookies(t *testing.T) {
+	assert := assert.New(t)
+	var session string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("session"); err == nil {
+			session = cookie.Value
+		}
+
+		w.Write([]byte("<p>Account</p>"))
+	}))
+	defer server.Close()
+
+	options := pdfire.NewConversionOptions()
+	options.URL = server.URL
+	options.Cookies = []*pdfire.Cookie{{Name: "session", Value: "abc123", HTTPOnly: true}}
+
+	err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Nil(err)
+	assert.Equal("abc123", session)
+}
+
+func TestConvertAuth(t *testing.T) {
+	assert := assert.New(t)
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "reports" || password != "secret" {
+			if r.URL.Path == "/" {
+				atomic.AddInt32(&attempts, 1)
+			}
+
+			w.Header().Set("WWW-Authenticate", `Basic realm="reports"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Write([]byte("<p>Report</p>"))
+	}))
+	defer server.Close()
+
+	options := pdfire.NewConversionOptions()
+	options.URL = server.URL
+	options.Auth = &pdfire.Credentials{Username: "reports", Password: "secret"}
+
+	result, err := pdfire.ConvertWithResult(context.Background(), ioutil.Discard, options)
+
+	assert.Nil(err)
+	assert.Equal(int64(http.StatusOK), result.Status)
+
+	atomic.StoreInt32(&attempts, 0)
+	options.Auth = &pdfire.Credentials{Username: "reports", Password: "wrong"}
+
+	result, err = pdfire.ConvertWithResult(context.Background(), ioutil.Discard, options)
+
+	assert.Nil(err)
+	assert.Equal(int64(http.StatusUnauthorized), result.Status)
+	assert.Equal(int32(2), atomic.LoadInt32(&attempts))
+}
+
+func TestConvertBlockResources(t *testing.T) {
+	assert := assert.New(t)
+	var images, fonts int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<style>@font-face { font-family: Brand; src: url(/brand.woff2); } p { font-family: Brand; }</style><img src="/logo.png"><p>Report</p>`))
+	})
+	mux.HandleFunc("/logo.png", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&images, 1)
+	})
+	mux.HandleFunc("/brand.woff2", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fonts, 1)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	options := pdfire.NewConversionOptions()
+	options.URL = server.URL
+	options.BlockResources = []string{"image", "font"}
+
+	err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Nil(err)
+	assert.Equal(int32(0), atomic.LoadInt32(&images))
+	assert.Equal(int32(0), atomic.LoadInt32(&fonts))
+
+	options.BlockResources = []string{"document"}
+	err = pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(&pdfire.ParseError{Key: "blockResources", Value: "document"}, err)
+}
+
+func TestConvertBlockAdsFilterLists(t *testing.T) {
+	assert := assert.New(t)
+	var ads, logos int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<img src="/ads/banner.png"><img src="/logo.png"><p>Article</p>`))
+	})
+	mux.HandleFunc("/ads/banner.png", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&ads, 1)
+	})
+	mux.HandleFunc("/logo.png", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&logos, 1)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	list, _ := ioutil.TempFile("", "filters-*.txt")
+	defer os.Remove(list.Name())
+	list.WriteString("/ads/*$image\n")
+	list.Close()
+
+	converterOptions := pdfire.NewConverterOptions()
+	converterOptions.FilterLists = []string{list.Name()}
+	converter := pdfire.NewConverter(converterOptions)
+
+	options := pdfire.NewConversionOptions()
+	options.URL = server.URL
+	options.BlockAds = true
+
+	err := converter.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Nil(err)
+	assert.Equal(int32(0), atomic.LoadInt32(&ads))
+	assert.Equal(int32(1), atomic.LoadInt32(&logos))
+}
+
+func TestConvertHeaderTemplateURL(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	options := pdfire.NewConversionOptions()
+	options.HTML = "<p>Invoice</p>"
+	options.PDFParams.DisplayHeaderFooter = true
+	options.HeaderTemplateURL = server.URL + "/header.html"
+
+	err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	if assert.IsType(&pdfire.TemplateLoadError{}, err) {
+		assert.Equal(server.URL+"/header.html", err.(*pdfire.TemplateLoadError).URL)
+	}
+
+	options.Offline = true
+	err = pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(pdfire.ErrOfflineURL, err)
+}
+
+func TestConvertHeaderTemplateID(t *testing.T) {
+	assert := assert.New(t)
+	converterOptions := pdfire.NewConverterOptions()
+	converterOptions.Templates["letterhead"] = `<div style="font-size: 10px">ACME Letterhead</div>`
+	converterOptions.Templates["empty"] = "<span></span>"
+	converter := pdfire.NewConverter(converterOptions)
+	defer converter.Close()
+
+	options := pdfire.NewConversionOptions()
+	options.HTML = "<p>Invoice</p>"
+	options.PDFParams.DisplayHeaderFooter = true
+	options.HeaderTemplateID = "empty"
+	empty := bytes.NewBuffer(make([]byte, 0))
+
+	err := converter.Convert(context.Background(), empty, options)
+
+	assert.Nil(err)
+
+	options.HeaderTemplateID = "letterhead"
+	pdf := bytes.NewBuffer(make([]byte, 0))
+	err = converter.Convert(context.Background(), pdf, options)
+
+	assert.Nil(err)
+	assert.True(pdf.Len() > empty.Len())
+
+	options.HeaderTemplateID = "missing"
+	err = converter.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(&pdfire.UnknownTemplateError{ID: "missing"}, err)
+}
+
+func TestConvertTemplateImageContentType(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Internal</p>"))
+	}))
+	defer server.Close()
+
+	options := pdfire.NewConversionOptions()
+	options.HTML = "<p>Invoice</p>"
+	options.PDFParams.DisplayHeaderFooter = true
+	options.PDFParams.HeaderTemplate = `<img src="` + server.URL + `/logo.png">`
+
+	err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	if assert.IsType(&pdfire.TemplateImageError{}, err) {
+		assert.Equal(server.URL+"/logo.png", err.(*pdfire.TemplateImageError).URL)
+	}
+}
+
+func TestConvertWithResult(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<p>One</p><p style="break-before: page">Two</p>`
+	pdf := bytes.NewBuffer(make([]byte, 0))
+
+	result, err := pdfire.ConvertWithResult(context.Background(), pdf, options)
+
+	assert.Nil(err)
+	assert.Equal(2, result.Pages)
+	assert.Equal(int64(pdf.Len()), result.Size)
+	assert.Equal(pdfire.PhaseBrowser, result.Phases[0].Phase)
+	assert.Equal(pdfire.PhasePostProcess, result.Phases[len(result.Phases)-1].Phase)
+	assert.Equal([]string{}, result.Warnings)
+	assert.Equal(options.HTML, result.Options.HTML)
+	assert.True(result.Duration > 0)
+	assert.Equal("", result.FinalURL)
+	assert.Equal(int64(0), result.Status)
+}
+
+func TestConvertWithResultConsole(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<script>console.log("rendering", 2); console.warn("deprecated"); throw new Error("boom");</script>`
+	messages := make([]*pdfire.ConsoleMessage, 0)
+	options.OnConsoleMessage = func(message *pdfire.ConsoleMessage) {
+		messages = append(messages, message)
+	}
+
+	result, err := pdfire.ConvertWithResult(context.Background(), ioutil.Discard, options)
+
+	assert.Nil(err)
+	assert.Len(result.Console, 3)
+	assert.Equal(&pdfire.ConsoleMessage{Type: "log", Text: "rendering 2"}, result.Console[0])
+	assert.Equal(&pdfire.ConsoleMessage{Type: "warning", Text: "deprecated"}, result.Console[1])
+	assert.Equal("exception", result.Console[2].Type)
+	assert.Contains(result.Console[2].Text, "boom")
+	assert.Equal(result.Console, messages)
+}
+
+func TestConvertWithResultURL(t *testing.T) {
+	assert := assert.New(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/missing", http.StatusFound)
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<p>Not found</p>"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	options := pdfire.NewConversionOptions()
+	options.URL = server.URL + "/old"
+
+	result, err := pdfire.ConvertWithResult(context.Background(), ioutil.Discard, options)
+
+	assert.Nil(err)
+	assert.Equal(server.URL+"/missing", result.FinalURL)
+	assert.Equal(int64(http.StatusNotFound), result.Status)
+	assert.Equal(1, result.Pages)
+}
+
+func TestConvertFailOnHTTPError(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("<p>Internal Server Error</p>"))
+	}))
+	defer server.Close()
+
+	options := pdfire.NewConversionOptions()
+	options.URL = server.URL + "/invoice"
+
+	err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Nil(err)
+
+	options.FailOnHTTPError = true
+	err = pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(&pdfire.HTTPError{URL: server.URL + "/invoice", Status: http.StatusInternalServerError}, err)
+}
+
+func TestConvertFailOnResourceErrors(t *testing.T) {
+	assert := assert.New(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/invoice", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<link rel="stylesheet" href="/style.css"><img src="/logo.png"><img src="/pixel.png">`))
+	})
+	mux.HandleFunc("/style.css", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+		w.Write([]byte("p { color: red; }"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	options := pdfire.NewConversionOptions()
+	options.URL = server.URL + "/invoice"
+
+	err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Nil(err)
+
+	options.FailOnResourceErrors = true
+	options.IgnoreResourceErrors = []string{"http://*/pixel.png"}
+	err = pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(&pdfire.ResourceError{Failures: []string{server.URL + "/logo.png (404)"}}, err)
+}
+
+func TestConvertRedirects(t *testing.T) {
+	assert := assert.New(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/report", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/reports/2024", http.StatusFound)
+	})
+	mux.HandleFunc("/reports/2024", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/login?next=/reports/2024", http.StatusFound)
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<p>Sign in</p>"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	options := pdfire.NewConversionOptions()
+	options.URL = server.URL + "/report"
+	options.MaxRedirects = 1
+
+	err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(&pdfire.TooManyRedirectsError{URL: server.URL + "/report", MaxRedirects: 1}, err)
+
+	options.MaxRedirects = 0
+	options.FailOnRedirectTo = []string{"http://*/login*"}
+
+	err = pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(&pdfire.RedirectError{URL: server.URL + "/report", Location: server.URL + "/login?next=/reports/2024"}, err)
+}
+
+func TestConvertChromeWSURL(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = "<p>Remote</p>"
+	options.ChromeWSURL = "ws://127.0.0.1:9222/devtools/browser/remote"
+
+	err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(pdfire.ErrChromeWSURLNotAllowed, err)
+
+	converterOptions := pdfire.NewConverterOptions()
+	converterOptions.AllowChromeWSURL = true
+	converter := pdfire.NewConverter(converterOptions)
+	options.ChromeArgs = []string{"lang=de"}
+
+	err = converter.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(pdfire.ErrRemoteChromeArgs, err)
+}
+
+func TestConvertTransferModeStream(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<p>One</p><p style="break-before: page">Two</p>`
+	options.PDFParams.TransferMode = page.PrintToPDFTransferModeReturnAsStream
+	pdf := bytes.NewBuffer(make([]byte, 0))
+
+	err := pdfire.Convert(context.Background(), pdf, options)
+
+	assert.Nil(err)
+
+	pages, err := pdfire.PageCount(pdf)
+
+	assert.Nil(err)
+	assert.Equal(2, pages)
+}
+
+// writeCounter counts the writes of a conversion.
+type writeCounter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *writeCounter) Write(p []byte) (int, error) {
+	w.writes++
+
+	return w.Buffer.Write(p)
+}
+
+func TestConvertTransferModeStreamDirect(t *testing.T) {
+	assert := assert.New(t)
+	img := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	rand.New(rand.NewSource(1)).Read(img.Pix)
+	encoded := bytes.NewBuffer(make([]byte, 0))
+
+	assert.Nil(png.Encode(encoded, img))
+
+	// The incompressible image results in a PDF of multiple chunks, which are
+	// written as they're read.
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<img src="data:image/png;base64,` + base64.StdEncoding.EncodeToString(encoded.Bytes()) + `">`
+	options.PDFParams.TransferMode = page.PrintToPDFTransferModeReturnAsStream
+	pdf := &writeCounter{}
+
+	err := pdfire.Convert(context.Background(), pdf, options)
+
+	assert.Nil(err)
+	assert.True(pdf.Len() > 1<<20)
+	assert.True(pdf.writes > 1)
+
+	pages, err := pdfire.PageCount(bytes.NewReader(pdf.Bytes()))
+
+	assert.Nil(err)
+	assert.Equal(1, pages)
+
+	// Post-processing needs the whole PDF, which is written at once.
+	options.Optimize = true
+	pdf = &writeCounter{}
+	err = pdfire.Convert(context.Background(), pdf, options)
+
+	assert.Nil(err)
+	assert.Equal(1, pdf.writes)
+}
+
+func TestConvertTaggedPDF(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<h1>Invoice</h1><p>Total</p>`
+	pdf := bytes.NewBuffer(make([]byte, 0))
+
+	err := pdfire.Convert(context.Background(), pdf, options)
+
+	assert.Nil(err)
+	assert.NotContains(pdf.String(), "/StructTreeRoot")
+
+	options.TaggedPDF = true
+	pdf.Reset()
+	err = pdfire.Convert(context.Background(), pdf, options)
+
+	assert.Nil(err)
+	assert.Contains(pdf.String(), "/StructTreeRoot")
+}
+
+func TestConvertOutlineHeadings(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<h1>Report</h1><h2>Revenue</h2><h1 style="break-before: page">Summary</h1><h4>Ignored</h4>`
+	options.Outline = pdfire.OutlineModeHeadings
+	pdf := bytes.NewBuffer(make([]byte, 0))
+
+	err := pdfire.Convert(context.Background(), pdf, options)
+
+	assert.Nil(err)
+	assert.Equal([]string{"Report:1", "  Revenue:1", "Summary:2"}, outlineItems(t, pdf.Bytes()))
+}
+
+func TestConvertCrashRetries(t *testing.T) {
+	assert := assert.New(t)
+	converterOptions := pdfire.NewConverterOptions()
+	converterOptions.CrashRetries = 1
+	converter := pdfire.NewConverter(converterOptions)
+	options := pdfire.NewConversionOptions()
+	options.URL = "chrome://crash"
+	options.Timeout = 30 * time.Second
+
+	err := converter.ConvertURL(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(&pdfire.ChromeCrashedError{Attempts: 2}, err)
+}
+
+func TestConvertOldSpaceLimit(t *testing.T) {
+	assert := assert.New(t)
+	var loads int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			atomic.AddInt32(&loads, 1)
+		}
+
+		w.Write([]byte("<script>var a = []; setInterval(function () { for (var i = 0; i < 8; i++) { a.push(new Array(1e6).fill(i)); } }, 20);</script>"))
+	}))
+	defer server.Close()
+
+	converterOptions := pdfire.NewConverterOptions()
+	converterOptions.MaxOldSpaceSize = 64
+	converterOptions.CrashRetries = 2
+	converter := pdfire.NewConverter(converterOptions)
+	defer converter.Close()
+	options := pdfire.NewConversionOptions()
+	options.URL = server.URL
+	options.Delay = 30 * time.Second
+
+	err := converter.Convert(context.Background(), ioutil.Discard, options)
+
+	if assert.IsType(&pdfire.ResourceLimitError{}, err) {
+		assert.Equal(pdfire.ResourceJSHeap, err.(*pdfire.ResourceLimitError).Resource)
+		assert.Equal(int64(64<<20), err.(*pdfire.ResourceLimitError).Limit)
+		assert.True(err.(*pdfire.ResourceLimitError).Crashed)
+	}
+
+	assert.Equal(int32(1), atomic.LoadInt32(&loads))
+}
+
+func TestResourceLimitErrorCrashed(t *testing.T) {
+	assert := assert.New(t)
+	err := &pdfire.ResourceLimitError{
+		Resource: pdfire.ResourceJSHeap,
+		Limit:    64 << 20,
+		Usage:    50 << 20,
+		Crashed:  true,
+	}
+
+	assert.Equal("Conversion crashed near the jsHeap limit (52428800 of 67108864).", err.Error())
+
+	err.Crashed = false
+	err.Usage = 70 << 20
+
+	assert.Equal("Conversion exceeded the jsHeap limit (73400320 > 67108864).", err.Error())
+}
+
+func TestConvertLandscapePageRanges(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<p>One</p><p style="break-before: page">Two</p><p style="break-before: page">Three</p>`
+	options.LandscapePageRanges = "2"
+	pdf := bytes.NewBuffer(make([]byte, 0))
+
+	err := pdfire.Convert(context.Background(), pdf, options)
+
+	assert.Nil(err)
+
+	pages, err := pdfire.InspectPages(pdf)
+
+	assert.Nil(err)
+
+	if assert.Len(pages, 3) {
+		assert.True(pages[0].Width < pages[0].Height)
+		assert.True(pages[1].Width > pages[1].Height)
+		assert.True(pages[2].Width < pages[2].Height)
+	}
+}
+
+func TestConvertSelectorScrollIntoView(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<div style="height: 5000px"></div>
+<div id="list"></div>
+<script>
+	var list = document.getElementById('list');
+
+	new IntersectionObserver(function (entries) {
+		if (entries[0].isIntersecting && !list.children.length) {
+			list.innerHTML = '<div style="height: 3000px">Rendered when visible</div>';
+		}
+	}).observe(list);
+</script>`
+	options.Selector = "#list"
+	pdf := bytes.NewBuffer(make([]byte, 0))
+
+	err := pdfire.Convert(context.Background(), pdf, options)
+
+	assert.Nil(err)
+
+	pages, err := pdfire.PageCount(pdf)
+
+	assert.Nil(err)
+	assert.True(pages > 1)
+}
+
+func TestConvertBlockThirdPartyCookies(t *testing.T) {
+	assert := assert.New(t)
+	var thirdPartyCookie, firstPartyCookie string
+	var checked int32
+	thirdParty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/set" {
+			w.Header().Set("Set-Cookie", "tracker=1; SameSite=None; Secure")
+			return
+		}
+
+		thirdPartyCookie = r.Header.Get("Cookie")
+		atomic.StoreInt32(&checked, 1)
+	}))
+	defer thirdParty.Close()
+
+	// The widget is loaded from another site, as cookies don't tell ports apart.
+	widgetURL := strings.Replace(thirdParty.URL, "127.0.0.1", "localhost", 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/account" {
+			firstPartyCookie = r.Header.Get("Cookie")
+			return
+		}
+
+		w.Header().Set("Set-Cookie", "session=abc123")
+		w.Write([]byte(`<script>
+			function check() {
+				var img = new Image();
+				img.onload = img.onerror = function () {
+					fetch("/account").then(function () { window.__done = true; });
+				};
+				img.src = "` + widgetURL + `/check";
+			}
+		</script><img src="` + widgetURL + `/set" onload="check()" onerror="check()">`))
+	}))
+	defer server.Close()
+
+	options := pdfire.NewConversionOptions()
+	options.URL = server.URL
+	options.BlockThirdPartyCookies = true
+	options.WaitForFunction = "window.__done === true"
+	options.WaitForFunctionTimeout = 5 * time.Second
+
+	err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Nil(err)
+	assert.Equal(int32(1), atomic.LoadInt32(&checked))
+	assert.Equal("", thirdPartyCookie)
+	assert.Equal("session=abc123", firstPartyCookie)
+}
+
+func TestConvertSelectorsPageBreaks(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<nav>Menu</nav><h1 id="title">Report</h1><table id="table"><tr><td>Revenue</td></tr></table><div id="chart" style="height: 200px">Chart</div>`
+	options.Selectors = []string{"#title", "#chart"}
+
+	for breaks, expected := range map[bool]int{false: 1, true: 2} {
+		options.SelectorPageBreaks = breaks
+		pdf := bytes.NewBuffer(make([]byte, 0))
+
+		err := pdfire.Convert(context.Background(), pdf, options)
+
+		assert.Nil(err)
+
+		pages, err := pdfire.PageCount(pdf)
+
+		assert.Nil(err)
+		assert.Equal(expected, pages, "page breaks: %v", breaks)
+	}
+}
+
+func TestConvertURLsSharedSession(t *testing.T) {
+	assert := assert.New(t)
+	var session string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=abc123")
+		w.Write([]byte("<p>Welcome</p>"))
+	})
+	mux.HandleFunc("/report", func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("session"); err == nil {
+			session = cookie.Value
+		}
+
+		w.Write([]byte(`<p>Report</p><p style="break-before: page">Appendix</p>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	options := pdfire.NewConversionOptions()
+	options.URLs = []string{server.URL + "/login", server.URL + "/report"}
+	pdf := bytes.NewBuffer(make([]byte, 0))
+
+	err := pdfire.Convert(context.Background(), pdf, options)
+
+	assert.Nil(err)
+	assert.Equal("abc123", session)
+
+	pages, err := pdfire.PageCount(pdf)
+
+	assert.Nil(err)
+	assert.Equal(3, pages)
+}
+
+// sectionsHTML is a document of three pages with the same content.
+const sectionsHTML = `<p>Section</p><p style="break-before: page">Section</p><p style="break-before: page">Section</p>`
+
+func TestConvertFirstPageHeaderTemplate(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = sectionsHTML
+
+	for _, letterhead := range []string{"", `<div style="font-size: 12px">ACME Letterhead</div>`} {
+		options.FirstPageHeaderTemplate = letterhead
+		pdf := bytes.NewBuffer(make([]byte, 0))
+
+		err := pdfire.Convert(context.Background(), pdf, options)
+
+		assert.Nil(err)
+
+		pages, err := pdfire.InspectPages(pdf)
+
+		assert.Nil(err)
+
+		if !assert.Len(pages, 3) {
+			continue
+		}
+
+		assert.Equal(letterhead == "", pages[0].ContentHash == pages[1].ContentHash)
+		assert.Equal(pages[1].ContentHash, pages[2].ContentHash)
+	}
+}
+
+func TestConvertHeaderFooterPageRanges(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = sectionsHTML
+	options.PDFParams.DisplayHeaderFooter = true
+	options.PDFParams.HeaderTemplate = `<div style="font-size: 12px">ACME</div>`
+	options.PDFParams.FooterTemplate = "<span></span>"
+
+	for _, ranges := range []string{"", "2"} {
+		options.HeaderFooterPageRanges = ranges
+		pdf := bytes.NewBuffer(make([]byte, 0))
+
+		err := pdfire.Convert(context.Background(), pdf, options)
+
+		assert.Nil(err)
+
+		pages, err := pdfire.InspectPages(pdf)
+
+		assert.Nil(err)
+
+		if !assert.Len(pages, 3) {
+			continue
+		}
+
+		assert.Equal(ranges == "", pages[0].ContentHash == pages[1].ContentHash)
+		assert.Equal(ranges == "", pages[2].ContentHash == pages[1].ContentHash)
+	}
+}
+
+func TestConvertPagedJS(t *testing.T) {
+	assert := assert.New(t)
+	// The stand-in polyfill adds a page once it's done, like Paged.js lays out
+	// the document when it's asked to preview it.
+	polyfill := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/paged.polyfill.js" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write([]byte(`window.PagedPolyfill = {
+			preview: function () {
+				return new Promise(function (resolve) {
+					setTimeout(function () {
+						var p = document.createElement("p");
+						p.style.breakBefore = "page";
+						p.textContent = "Laid out";
+						document.body.appendChild(p);
+						resolve();
+					}, 500);
+				});
+			}
+		};`))
+	}))
+	defer polyfill.Close()
+
+	defer func(url string) { pdfire.PagedJSURL = url }(pdfire.PagedJSURL)
+	pdfire.PagedJSURL = polyfill.URL + "/paged.polyfill.js"
+
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<style>@page { size: 100mm 100mm; }</style><p>Report</p>`
+	options.PagedJS = true
+	pdf := bytes.NewBuffer(make([]byte, 0))
+
+	err := pdfire.Convert(context.Background(), pdf, options)
+
+	assert.Nil(err)
+
+	pages, err := pdfire.InspectPages(pdf)
+
+	assert.Nil(err)
+
+	if assert.Len(pages, 2) {
+		assert.InDelta(283.46, pages[0].Width, 0.5)
+		assert.InDelta(283.46, pages[0].Height, 0.5)
+	}
+
+	pdfire.PagedJSURL = polyfill.URL + "/missing.js"
+	err = pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.IsType(&pdfire.PagedJSError{}, err)
+}
+
+func TestConvertFonts(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "font/ttf")
+		w.Write(gomono.TTF)
+	}))
+	defer server.Close()
+
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<p style="font-family: 'ACME Sans'">Invoice</p><p style="font-family: 'ACME Mono'">INV-2019-001</p>`
+	options.Fonts = []*pdfire.Font{
+		{Family: "ACME Sans", Data: goregular.TTF},
+		{Family: "ACME Mono", URL: server.URL + "/acme-mono.ttf"},
+	}
+	options.WaitForFonts = true
+	pdf := bytes.NewBuffer(make([]byte, 0))
+
+	err := pdfire.Convert(context.Background(), pdf, options)
+
+	assert.Nil(err)
+	// Chrome embeds subsets of the fonts, named after their PostScript names.
+	assert.Contains(pdf.String(), "+GoRegular")
+	assert.Contains(pdf.String(), "+GoMono")
+}
+
+func TestConvertWaitForImages(t *testing.T) {
+	assert := assert.New(t)
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	rand.New(rand.NewSource(1)).Read(img.Pix)
+	encoded := bytes.NewBuffer(make([]byte, 0))
+
+	assert.Nil(png.Encode(encoded, img))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<p>Chart</p><script>
+			addEventListener("load", function () {
+				document.body.appendChild(new Image()).src = "/chart.png";
+			});
+		</script>`))
+	})
+	mux.HandleFunc("/chart.png", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(encoded.Bytes())
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	options := pdfire.NewConversionOptions()
+	options.URL = server.URL
+
+	// The image is only requested after the load event, so the page is
+	// printed without it unless the images are waited for.
+	for _, wait := range []bool{false, true} {
+		options.WaitForImages = wait
+		options.WaitForImagesTimeout = 5 * time.Second
+		pdf := bytes.NewBuffer(make([]byte, 0))
+
+		err := pdfire.Convert(context.Background(), pdf, options)
+
+		assert.Nil(err)
+		assert.Equal(wait, strings.Contains(pdf.String(), "/Subtype /Image"), "wait for images: %v", wait)
+	}
+
+	options.WaitForImagesTimeout = 300 * time.Millisecond
+	err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(pdfire.ErrWaitForImagesTimeout, err)
+}
+
+func TestConvertCompareMedia(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<style>@media screen { .slide { break-after: page; } }</style><div class="slide">One</div><div class="slide">Two</div><div class="slide">Three</div>`
+	options.CompareMedia = true
+	buf := bytes.NewBuffer(make([]byte, 0))
+
+	err := pdfire.Convert(context.Background(), buf, options)
+
+	assert.Nil(err)
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+
+	require.NoError(t, err)
+
+	pages := make(map[string]int)
+
+	for _, file := range archive.File {
+		r, err := file.Open()
+
+		require.NoError(t, err)
+
+		pages[file.Name], err = pdfire.PageCount(r)
+		r.Close()
+
+		assert.Nil(err)
+	}
+
+	assert.Equal(map[string]int{"screen.pdf": 3, "print.pdf": 1}, pages)
+}
+
+func TestConvertHeadersScope(t *testing.T) {
+	assert := assert.New(t)
+	var mu sync.Mutex
+	var received map[string]bool
+	record := func(name string, r *http.Request) {
+		mu.Lock()
+		received[name] = r.Header.Get("X-Token") == "secret"
+		mu.Unlock()
+	}
+	thirdParty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/pixel.png" {
+			record("third-party", r)
+		}
+	}))
+	defer thirdParty.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/logo.png":
+			record("asset", r)
+			return
+		case "/":
+			record("document", r)
+		}
+
+		w.Write([]byte(`<img src="/logo.png"><img src="` + thirdParty.URL + `/pixel.png">`))
+	}))
+	defer server.Close()
+
+	for scope, expected := range map[pdfire.HeadersScope]map[string]bool{
+		pdfire.HeadersScopeAll:      {"document": true, "asset": true, "third-party": true},
+		pdfire.HeadersScopeOrigin:   {"document": true, "asset": true, "third-party": false},
+		pdfire.HeadersScopeDocument: {"document": true, "asset": false, "third-party": false},
+	} {
+		received = make(map[string]bool)
+		options := pdfire.NewConversionOptions()
+		options.URL = server.URL
+		options.Headers = map[string]interface{}{"X-Token": "secret"}
+		options.HeadersScope = scope
+
+		err := pdfire.Convert(context.Background(), ioutil.Discard, options)
+
+		assert.Nil(err)
+
+		mu.Lock()
+		assert.Equal(expected, received, "scope: %s", scope)
+		mu.Unlock()
+	}
+}
+
+func TestConvertForcedColors(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConversionOptions()
+	options.HTML = `<style>.contrast { display: none; } @media (forced-colors: active) { .contrast { display: block; break-before: page; } }</style><p>Report</p><p class="contrast">High contrast</p>`
+
+	for forced, expected := range map[bool]int{false: 1, true: 2} {
+		options.ForcedColors = forced
+		pdf := bytes.NewBuffer(make([]byte, 0))
+
+		err := pdfire.Convert(context.Background(), pdf, options)
+
+		assert.Nil(err)
+
+		pages, err := pdfire.PageCount(pdf)
+
+		assert.Nil(err)
+		assert.Equal(expected, pages, "forced colors: %v", forced)
+	}
+}
@@ -0,0 +1,152 @@
+package pdfire
+
+import (
+	"context"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+)
+
+// Cookie is a cookie that is set before the page is requested, e.g. the
+// session cookie of an authenticated page.
+type Cookie struct {
+	Name  string
+	Value string
+	// Domain is the domain of the cookie. The cookie belongs to the host of the
+	// first converted URL if it's empty.
+	Domain   string
+	Path     string
+	Secure   bool
+	HTTPOnly bool
+	// Expires is the expiry of the cookie. A zero time makes it a session
+	// cookie.
+	Expires time.Time
+}
+
+// setCookies sets the cookies in the browser context of the tab.
+func setCookies(ctx context.Context, cookies []*Cookie, location string) error {
+	params := make([]*network.CookieParam, 0, len(cookies))
+
+	for _, cookie := range cookies {
+		param := &network.CookieParam{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Secure:   cookie.Secure,
+			HTTPOnly: cookie.HTTPOnly,
+		}
+
+		if cookie.Domain == "" {
+			param.URL = location
+		}
+
+		if !cookie.Expires.IsZero() {
+			expires := cdp.TimeSinceEpoch(cookie.Expires)
+			param.Expires = &expires
+		}
+
+		params = append(params, param)
+	}
+
+	return network.SetCookies(params).Do(ctx)
+}
+
+func parseCookies(jsonMap map[string]interface{}) ([]*Cookie, error) {
+	raw, ok := jsonMap["cookies"]
+
+	if !ok || raw == nil {
+		return make([]*Cookie, 0), nil
+	}
+
+	list, ok := raw.([]interface{})
+
+	if !ok {
+		return nil, &ParseError{
+			Key:   "cookies",
+			Value: raw,
+		}
+	}
+
+	cookies := make([]*Cookie, 0, len(list))
+
+	for _, item := range list {
+		cookieMap, ok := item.(map[string]interface{})
+
+		if !ok {
+			return nil, &ParseError{
+				Key:   "cookies",
+				Value: item,
+			}
+		}
+
+		name, err := parseString(cookieMap, "name", "")
+
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := parseString(cookieMap, "value", "")
+
+		if err != nil {
+			return nil, err
+		}
+
+		domain, err := parseString(cookieMap, "domain", "")
+
+		if err != nil {
+			return nil, err
+		}
+
+		path, err := parseString(cookieMap, "path", "")
+
+		if err != nil {
+			return nil, err
+		}
+
+		secure, err := parseBool(cookieMap, "secure", false)
+
+		if err != nil {
+			return nil, err
+		}
+
+		httpOnly, err := parseBool(cookieMap, "httpOnly", false)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// expires is given in seconds since the UNIX epoch, like in the
+		// DevTools protocol.
+		expires, err := parseInt64(cookieMap, "expires", 0)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if name == "" {
+			return nil, &ParseError{
+				Key:   "cookies",
+				Value: item,
+			}
+		}
+
+		cookie := &Cookie{
+			Name:     name,
+			Value:    value,
+			Domain:   domain,
+			Path:     path,
+			Secure:   secure,
+			HTTPOnly: httpOnly,
+		}
+
+		if expires > 0 {
+			cookie.Expires = time.Unix(expires, 0)
+		}
+
+		cookies = append(cookies, cookie)
+	}
+
+	return cookies, nil
+}
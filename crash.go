@@ -0,0 +1,47 @@
+package pdfire
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrChromeCrashed is returned when the render target crashes in every
+	// attempt of a conversion. Conversions return a *ChromeCrashedError, which
+	// wraps it.
+	ErrChromeCrashed = errors.New("chrome crashed")
+)
+
+// errTargetCrashed is returned by an attempt whose target crashed.
+var errTargetCrashed = errors.New("target crashed")
+
+// ChromeCrashedError is returned when the render target crashed in every
+// attempt of a conversion.
+type ChromeCrashedError struct {
+	Attempts int
+}
+
+func (e *ChromeCrashedError) Error() string {
+	return fmt.Sprintf("Chrome crashed while rendering the page (%d attempts).", e.Attempts)
+}
+
+// Unwrap returns ErrChromeCrashed.
+func (e *ChromeCrashedError) Unwrap() error {
+	return ErrChromeCrashed
+}
+
+// retryOnCrash runs attempt again while its target crashes, but at most
+// retries times. attempt is called with the number of the attempt.
+func retryOnCrash(retries int, attempt func(n int) error) error {
+	for n := 1; ; n++ {
+		err := attempt(n)
+
+		if err != errTargetCrashed {
+			return err
+		}
+
+		if n > retries {
+			return &ChromeCrashedError{Attempts: n}
+		}
+	}
+}
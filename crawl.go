@@ -0,0 +1,273 @@
+package pdfire
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"regexp"
+
+	"github.com/chromedp/chromedp"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+// CrawlOptions configure a crawl. A crawl follows the links of the converted
+// URL and creates a single PDF with a bookmark for every visited page.
+type CrawlOptions struct {
+	// Include are regular expressions of which a link must match at least one
+	// to be followed. If empty, every link to the origin of the start URL is.
+	Include []string
+	// Exclude are regular expressions of links that are never followed.
+	Exclude []string
+	// MaxDepth is the maximum number of links between the start URL and a page.
+	MaxDepth int
+	// MaxPages is the maximum number of converted pages.
+	MaxPages int
+}
+
+// NewCrawlOptions returns new crawl options with default values.
+func NewCrawlOptions() *CrawlOptions {
+	return &CrawlOptions{
+		Include:  make([]string, 0),
+		Exclude:  make([]string, 0),
+		MaxDepth: 2,
+		MaxPages: 100,
+	}
+}
+
+// crawlLinksScript returns the absolute URLs of all links of the page.
+const crawlLinksScript = `Array.from(document.querySelectorAll('a[href]'), function (a) { return a.href; })`
+
+type crawler struct {
+	options *ConversionOptions
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	pages   []*crawledPage
+}
+
+type crawledPage struct {
+	url   string
+	title string
+	pdf   *bytes.Buffer
+}
+
+type crawlTarget struct {
+	url    *url.URL
+	origin string
+	depth  int
+}
+
+func newCrawler(options *ConversionOptions) (*crawler, error) {
+	include, err := compilePatterns(options.Crawl.Include)
+
+	if err != nil {
+		return nil, err
+	}
+
+	exclude, err := compilePatterns(options.Crawl.Exclude)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &crawler{
+		options: options,
+		include: include,
+		exclude: exclude,
+	}, nil
+}
+
+// action visits the start URLs and the pages linked from them breadth-first
+// and prints every page. Links are collected from the page as it's printed,
+// i.e. after the selectors have been applied.
+func (c *crawler) action(starts []string, events *pageEvents) chromedp.ActionFunc {
+	return func(ctx context.Context) error {
+		queue := make([]*crawlTarget, 0, len(starts))
+		visited := make(map[string]bool)
+
+		for _, start := range starts {
+			u, err := url.Parse(start)
+
+			if err != nil {
+				return err
+			}
+
+			u.Fragment = ""
+			visited[u.String()] = true
+			queue = append(queue, &crawlTarget{url: u, origin: u.Scheme + "://" + u.Host})
+		}
+
+		for len(queue) > 0 && (c.options.Crawl.MaxPages <= 0 || len(c.pages) < c.options.Crawl.MaxPages) {
+			target := queue[0]
+			queue = queue[1:]
+
+			// Discard load events of pages that failed to load.
+			events.reset()
+
+			c.options.progress(StageNavigation, 0)
+			enterPhase(ctx, PhaseNavigation)
+
+			if err := navigate(target.url.String(), c.options.NavigationTimeout)(ctx); err != nil {
+				if target.depth == 0 {
+					return err
+				}
+
+				continue
+			}
+
+			c.options.progress(StageWait, 0)
+
+			if err := afterNavigation(c.options, events).Do(ctx); err != nil {
+				return err
+			}
+
+			var title string
+			var links []string
+
+			if err := chromedp.Evaluate(`document.title`, &title).Do(ctx); err != nil {
+				return err
+			}
+
+			if err := chromedp.Evaluate(crawlLinksScript, &links).Do(ctx); err != nil {
+				return err
+			}
+
+			page := &crawledPage{
+				url:   target.url.String(),
+				title: title,
+				pdf:   bytes.NewBuffer([]byte{}),
+			}
+
+			c.options.progress(StagePrint, 0)
+			enterPhase(ctx, PhasePrint)
+
+			if err := printToPDFAction(page.pdf, c.options, nil).Do(ctx); err != nil {
+				return err
+			}
+
+			c.pages = append(c.pages, page)
+
+			if target.depth >= c.options.Crawl.MaxDepth {
+				continue
+			}
+
+			for _, link := range links {
+				u, err := url.Parse(link)
+
+				if err != nil {
+					continue
+				}
+
+				u.Fragment = ""
+
+				if visited[u.String()] || !c.follows(target.origin, u) {
+					continue
+				}
+
+				visited[u.String()] = true
+				queue = append(queue, &crawlTarget{url: u, origin: target.origin, depth: target.depth + 1})
+			}
+		}
+
+		return nil
+	}
+}
+
+// follows reports whether a link should be crawled.
+func (c *crawler) follows(origin string, u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+
+	link := u.String()
+
+	for _, re := range c.exclude {
+		if re.MatchString(link) {
+			return false
+		}
+	}
+
+	if len(c.include) == 0 {
+		return u.Scheme+"://"+u.Host == origin
+	}
+
+	for _, re := range c.include {
+		if re.MatchString(link) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *crawler) pdfs() []*bytes.Buffer {
+	bufs := make([]*bytes.Buffer, len(c.pages))
+
+	for i, page := range c.pages {
+		bufs[i] = page.pdf
+	}
+
+	return bufs
+}
+
+// addBookmarks adds a bookmark for every crawled page to the combined PDF,
+// which is written with the pdfcpu configuration cfg.
+func (c *crawler) addBookmarks(buf *bytes.Buffer, cfg *pdfcpu.Configuration) (*bytes.Buffer, error) {
+	bookmarks, err := c.bookmarks()
+
+	if err != nil {
+		return nil, err
+	}
+
+	out := bytes.NewBuffer([]byte{})
+
+	if err := addBookmarks(buf, out, bookmarks, cfg); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// bookmarks returns a bookmark for the first page of every crawled page.
+func (c *crawler) bookmarks() ([]*Bookmark, error) {
+	bookmarks := make([]*Bookmark, len(c.pages))
+	offset := 1
+
+	for i, page := range c.pages {
+		title := page.title
+
+		if title == "" {
+			title = page.url
+		}
+
+		bookmarks[i] = &Bookmark{
+			Title: title,
+			Page:  offset,
+		}
+
+		pages, err := PageCount(bytes.NewReader(page.pdf.Bytes()))
+
+		if err != nil {
+			return nil, err
+		}
+
+		offset += pages
+	}
+
+	return bookmarks, nil
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, re)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,294 @@
+package pdfire
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrDeterministicEncryption is returned when Deterministic is set together
+	// with a password. Encryption uses random salts, so encrypted PDFs differ on
+	// every run.
+	ErrDeterministicEncryption = errors.New("deterministic pdfs can't be encrypted")
+	// ErrNotDeterministic is returned when the dates of a deterministic PDF are
+	// in compressed object streams, where they can't be normalized.
+	ErrNotDeterministic = errors.New("the pdf dates can't be normalized")
+)
+
+// deterministicDate replaces the creation and modification dates of
+// deterministic PDFs and the current date of their header and footer
+// templates.
+var deterministicDate = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// deterministicProducer replaces the producer of deterministic PDFs, which
+// contains the versions of Chrome and pdfcpu.
+const deterministicProducer = "pdfire"
+
+// normalizePDF replaces the dates, producers and document IDs of a PDF with
+// fixed values, so that identical documents result in identical bytes. The
+// Info dictionaries and trailers of all revisions are changed in place, as an
+// incremental update would keep the original values. They are located through
+// the cross-reference sections, so that the content of streams is never
+// touched. The values are padded with spaces, so that the offsets of the xref
+// tables stay valid. The document ID is the MD5 hash of the normalized PDF.
+func normalizePDF(buf *bytes.Buffer) (*bytes.Buffer, error) {
+	data := append([]byte(nil), buf.Bytes()...)
+	sections, err := xrefSections(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	date := []byte("(" + pdfDate(deterministicDate) + ")")
+	producer := []byte("(" + deterministicProducer + ")")
+	ids := make([]pdfEntry, 0, len(sections))
+	infos := make(map[int]bool)
+
+	for _, section := range sections {
+		if ref, ok := section.trailer["Info"].(pdfRef); ok {
+			infos[ref.num] = true
+		}
+	}
+
+	for _, section := range sections {
+		if id, ok := dictEntries(data, section.trailerStart)["ID"]; ok {
+			if _, ok := id.value.([]interface{}); ok {
+				ids = append(ids, id)
+			}
+		}
+
+		for num := range infos {
+			if _, ok := section.doc.compressed[num]; ok {
+				return nil, ErrNotDeterministic
+			}
+
+			offset, ok := section.doc.offsets[num]
+
+			if !ok || offset < 0 {
+				continue
+			}
+
+			start, err := objectStart(data, offset)
+
+			if err != nil {
+				return nil, err
+			}
+
+			for key, entry := range dictEntries(data, start) {
+				if _, ok := entry.value.(pdfString); !ok {
+					continue
+				}
+
+				switch key {
+				case "CreationDate", "ModDate":
+					overwrite(data, entry.key, entry.start, entry.end, date)
+				case "Producer":
+					overwrite(data, entry.key, entry.start, entry.end, producer)
+				}
+			}
+		}
+	}
+
+	for _, id := range ids {
+		overwrite(data, id.key, id.start, id.end, documentID(make([]byte, md5.Size)))
+	}
+
+	sum := md5.Sum(data)
+
+	for _, id := range ids {
+		overwrite(data, id.key, id.start, id.end, documentID(sum[:]))
+	}
+
+	if err := checkNormalized(data, pdfString(pdfDate(deterministicDate))); err != nil {
+		return nil, err
+	}
+
+	return bytes.NewBuffer(data), nil
+}
+
+// xrefSection is a cross-reference section of a revision of a PDF. Its
+// document only has the objects of the section.
+type xrefSection struct {
+	doc          *pdfDocument
+	trailer      pdfDict
+	trailerStart int
+}
+
+// xrefSections returns the cross-reference sections of a PDF, newest first.
+func xrefSections(data []byte) ([]*xrefSection, error) {
+	doc, err := readPDF(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	sections := make([]*xrefSection, 0, 2)
+	seen := make(map[int64]bool)
+
+	for offset := doc.startxref; !seen[offset]; {
+		seen[offset] = true
+		section := &xrefSection{
+			doc: &pdfDocument{
+				data:       data,
+				offsets:    make(map[int]int64),
+				compressed: make(map[int][2]int),
+				objStms:    make(map[int]*pdfObjStm),
+			},
+		}
+
+		if section.trailer, err = section.doc.readXRef(offset); err != nil {
+			return nil, err
+		}
+
+		if section.trailerStart, err = trailerStart(data, offset); err != nil {
+			return nil, err
+		}
+
+		sections = append(sections, section)
+		prev, ok := section.trailer["Prev"].(int64)
+
+		if !ok {
+			break
+		}
+
+		offset = prev
+	}
+
+	return sections, nil
+}
+
+// trailerStart returns the position of the trailer dictionary of the
+// cross-reference section at offset, which is the dictionary of the stream
+// for cross-reference streams.
+func trailerStart(data []byte, offset int64) (int, error) {
+	p := &pdfParser{data: data, pos: int(offset)}
+
+	if p.keyword() != "xref" {
+		return objectStart(data, offset)
+	}
+
+	// The entries of the table are numbers, so the first keyword after them
+	// is the trailer.
+	i := bytes.Index(data[p.pos:], []byte("trailer"))
+
+	if i < 0 {
+		return 0, ErrInvalidPDF
+	}
+
+	return p.pos + i + len("trailer"), nil
+}
+
+// objectStart returns the position of the value of the object at offset.
+func objectStart(data []byte, offset int64) (int, error) {
+	p := &pdfParser{data: data, pos: int(offset)}
+	_, ok1 := p.object().(int64)
+	_, ok2 := p.object().(int64)
+
+	if !ok1 || !ok2 || p.keyword() != "obj" {
+		return 0, ErrInvalidPDF
+	}
+
+	return p.pos, nil
+}
+
+// pdfEntry is an entry of a dictionary, with the positions of its key and of
+// the start and end of its value.
+type pdfEntry struct {
+	key, start, end int
+	value           interface{}
+}
+
+// dictEntries returns the entries of the dictionary at pos, or nil if there
+// is none.
+func dictEntries(data []byte, pos int) map[string]pdfEntry {
+	p := &pdfParser{data: data, pos: pos}
+	p.skip()
+
+	if !bytes.HasPrefix(data[p.pos:], []byte("<<")) {
+		return nil
+	}
+
+	p.pos += 2
+	entries := make(map[string]pdfEntry)
+
+	for {
+		p.skip()
+
+		if p.pos >= len(data) || data[p.pos] == '>' {
+			return entries
+		}
+
+		key := p.pos
+		name, ok := p.object().(pdfName)
+
+		if !ok {
+			continue
+		}
+
+		p.skip()
+		start := p.pos
+		value := p.object()
+		entries[string(name)] = pdfEntry{key: key, start: start, end: p.pos, value: value}
+	}
+}
+
+// overwrite replaces the value of the entry at key, whose value spans from
+// start to end. The entry is removed if the new value doesn't fit.
+func overwrite(data []byte, key, start, end int, value []byte) {
+	if len(value) > end-start {
+		start, value = key, nil
+	}
+
+	n := copy(data[start:end], value)
+
+	for i := start + n; i < end; i++ {
+		data[i] = ' '
+	}
+}
+
+// documentID encodes both parts of a document ID.
+func documentID(sum []byte) []byte {
+	return []byte(fmt.Sprintf("[<%X><%X>]", sum, sum))
+}
+
+// checkNormalized checks that the Info dictionary of the last revision has
+// the normalized dates.
+func checkNormalized(data []byte, date pdfString) error {
+	doc, err := readPDF(bytes.NewReader(data))
+
+	if err != nil {
+		return err
+	}
+
+	if _, ok := doc.trailer["Info"]; !ok {
+		return nil
+	}
+
+	info, err := doc.dict(doc.trailer["Info"])
+
+	if err != nil {
+		return err
+	}
+
+	for _, key := range []string{"CreationDate", "ModDate"} {
+		value, err := doc.resolve(info[key])
+
+		if err != nil {
+			return err
+		}
+
+		if s, ok := value.(pdfString); value != nil && (!ok || !bytes.Equal(s, date)) {
+			return ErrNotDeterministic
+		}
+	}
+
+	return nil
+}
+
+// pdfDate formats a date like "D:20191114120000Z".
+func pdfDate(t time.Time) string {
+	return t.UTC().Format("D:20060102150405Z")
+}
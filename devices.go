@@ -0,0 +1,132 @@
+package pdfire
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chromedp/cdproto/emulation"
+)
+
+// Device is a preset of the emulated screen and browser of a device.
+type Device struct {
+	// Name is the display name of the device, e.g. "iPhone 14".
+	Name              string
+	ViewportWidth     int64
+	ViewportHeight    int64
+	DeviceScaleFactor float64
+	Mobile            bool
+	UserAgent         string
+}
+
+// Devices are the presets of the Device option by their key.
+var Devices = map[string]*Device{
+	"iphone-se": {
+		Name:              "iPhone SE",
+		ViewportWidth:     375,
+		ViewportHeight:    667,
+		DeviceScaleFactor: 2,
+		Mobile:            true,
+		UserAgent:         "Mozilla/5.0 (iPhone; CPU iPhone OS 16_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.0 Mobile/15E148 Safari/604.1",
+	},
+	"iphone-14": {
+		Name:              "iPhone 14",
+		ViewportWidth:     390,
+		ViewportHeight:    844,
+		DeviceScaleFactor: 3,
+		Mobile:            true,
+		UserAgent:         "Mozilla/5.0 (iPhone; CPU iPhone OS 16_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.0 Mobile/15E148 Safari/604.1",
+	},
+	"ipad": {
+		Name:              "iPad",
+		ViewportWidth:     810,
+		ViewportHeight:    1080,
+		DeviceScaleFactor: 2,
+		Mobile:            true,
+		UserAgent:         "Mozilla/5.0 (iPad; CPU OS 16_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.0 Mobile/15E148 Safari/604.1",
+	},
+	"pixel-7": {
+		Name:              "Pixel 7",
+		ViewportWidth:     412,
+		ViewportHeight:    915,
+		DeviceScaleFactor: 2.625,
+		Mobile:            true,
+		UserAgent:         "Mozilla/5.0 (Linux; Android 13; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Mobile Safari/537.36",
+	},
+	"galaxy-s23": {
+		Name:              "Galaxy S23",
+		ViewportWidth:     360,
+		ViewportHeight:    780,
+		DeviceScaleFactor: 3,
+		Mobile:            true,
+		UserAgent:         "Mozilla/5.0 (Linux; Android 13; SM-S911B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Mobile Safari/537.36",
+	},
+}
+
+// DeviceError is returned when the Device option names no preset.
+type DeviceError struct {
+	Device string
+}
+
+func (e *DeviceError) Error() string {
+	return fmt.Sprintf("Unknown device \"%s\".", e.Device)
+}
+
+// maxDeviceScaleFactor is the highest DeviceScaleFactor. Higher factors make
+// little difference in print but multiply the memory of the rendered page.
+const maxDeviceScaleFactor = 8
+
+// device returns the emulated device of the options. Without a Device preset,
+// it's a desktop with the viewport of the options. DeviceScaleFactor, unless
+// it's zero, overrides the one of the device.
+func (o *ConversionOptions) device() (*Device, error) {
+	if o.DeviceScaleFactor < 0 || o.DeviceScaleFactor > maxDeviceScaleFactor {
+		return nil, &ParseError{Key: "deviceScaleFactor", Value: o.DeviceScaleFactor}
+	}
+
+	device := &Device{
+		ViewportWidth:     o.ViewportWidth,
+		ViewportHeight:    o.ViewportHeight,
+		DeviceScaleFactor: 1,
+	}
+
+	if o.Device != "" {
+		preset, ok := Devices[o.Device]
+
+		if !ok {
+			return nil, &DeviceError{Device: o.Device}
+		}
+
+		copied := *preset
+		device = &copied
+	}
+
+	if o.DeviceScaleFactor > 0 {
+		device.DeviceScaleFactor = o.DeviceScaleFactor
+	}
+
+	return device, nil
+}
+
+// emulateDevice emulates the screen and, for mobile devices, the touch input
+// of a device. Its user agent is set by setLanguage.
+func emulateDevice(ctx context.Context, device *Device) error {
+	if err := emulation.SetDeviceMetricsOverride(device.ViewportWidth, device.ViewportHeight, device.DeviceScaleFactor, device.Mobile).Do(ctx); err != nil {
+		return err
+	}
+
+	if !device.Mobile {
+		return nil
+	}
+
+	return emulation.SetTouchEmulationEnabled(true).Do(ctx)
+}
+
+func parseDevice(jsonMap map[string]interface{}) (string, error) {
+	names := []string{""}
+
+	for name := range Devices {
+		names = append(names, name)
+	}
+
+	return parseStringOnly(jsonMap, "device", "", names...)
+}
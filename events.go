@@ -0,0 +1,189 @@
+package pdfire
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/chromedp/cdproto/runtime"
+)
+
+// ConsoleError is returned when FailOnConsoleError is set and the page threw
+// an uncaught exception or logged an error to the console.
+type ConsoleError struct {
+	Messages []string
+}
+
+func (e *ConsoleError) Error() string {
+	return fmt.Sprintf("The page logged errors: %s.", strings.Join(e.Messages, "; "))
+}
+
+// HTTPError is returned when FailOnHTTPError is set and a converted document
+// was answered with an error status.
+type HTTPError struct {
+	URL    string
+	Status int64
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("The URL \"%s\" returned the status %d.", e.URL, e.Status)
+}
+
+// ConsoleMessage is a message that the page logged to the console, or an
+// uncaught exception.
+type ConsoleMessage struct {
+	// Type is the console method, e.g. "log" or "error", or "exception" for an
+	// uncaught exception.
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// pageEvents collects the events of a tab that the conversion waits for or
+// reports on.
+type pageEvents struct {
+	loaded chan bool
+	mu     sync.Mutex
+	errors []string
+	// crashed is closed when the target crashed or was detached.
+	crashed   chan struct{}
+	crashOnce sync.Once
+	// onCrash is called once when the target crashes, e.g. to abort the
+	// actions waiting for the target.
+	onCrash func()
+	// failed is the first error of the page that fails the conversion, e.g. a
+	// denied main document.
+	failed error
+	// onFail is called once when the page fails the conversion, e.g. to abort
+	// the actions waiting for the target.
+	onFail func()
+	// resources records the failed resources of the page.
+	resources *resourceTracker
+}
+
+func newPageEvents() *pageEvents {
+	return &pageEvents{
+		loaded:  make(chan bool, 1),
+		crashed: make(chan struct{}),
+	}
+}
+
+// load signals that the page reached the awaited load state. It never blocks
+// the event listener.
+func (e *pageEvents) load() {
+	select {
+	case e.loaded <- true:
+	default:
+	}
+}
+
+// reset discards a load signal of a previous navigation.
+func (e *pageEvents) reset() {
+	select {
+	case <-e.loaded:
+	default:
+	}
+}
+
+// crash signals that the target crashed. It never blocks the event listener.
+func (e *pageEvents) crash() {
+	e.crashOnce.Do(func() {
+		close(e.crashed)
+
+		if e.onCrash != nil {
+			e.onCrash()
+		}
+	})
+}
+
+// hasCrashed reports whether the target crashed.
+func (e *pageEvents) hasCrashed() bool {
+	select {
+	case <-e.crashed:
+		return true
+	default:
+		return false
+	}
+}
+
+// fail records an error that fails the conversion. Only the first one is
+// kept. It never blocks the event listener.
+func (e *pageEvents) fail(err error) {
+	e.mu.Lock()
+	first := e.failed == nil
+
+	if first {
+		e.failed = err
+	}
+
+	e.mu.Unlock()
+
+	if first && e.onFail != nil {
+		e.onFail()
+	}
+}
+
+// failure returns the error that failed the conversion, if any.
+func (e *pageEvents) failure() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.failed
+}
+
+func (e *pageEvents) addError(message string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.errors = append(e.errors, message)
+}
+
+// logConsole reports a console message to the result of ctx and the
+// OnConsoleMessage callback.
+func logConsole(ctx context.Context, options *ConversionOptions, message *ConsoleMessage) {
+	resultFrom(ctx).logConsole(message)
+
+	if options.OnConsoleMessage != nil {
+		options.OnConsoleMessage(message)
+	}
+}
+
+// consoleError returns the errors logged so far, if any.
+func (e *pageEvents) consoleError() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.errors) == 0 {
+		return nil
+	}
+
+	messages := make([]string, len(e.errors))
+	copy(messages, e.errors)
+
+	return &ConsoleError{
+		Messages: messages,
+	}
+}
+
+// consoleMessage formats the arguments of a console call like the console does.
+func consoleMessage(args []*runtime.RemoteObject) string {
+	parts := make([]string, 0, len(args))
+
+	for _, arg := range args {
+		var s string
+
+		switch {
+		case arg.Type == runtime.TypeString && json.Unmarshal(arg.Value, &s) == nil:
+			parts = append(parts, s)
+		case arg.Description != "":
+			parts = append(parts, arg.Description)
+		case len(arg.Value) > 0:
+			parts = append(parts, string(arg.Value))
+		default:
+			parts = append(parts, string(arg.Type))
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
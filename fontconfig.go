@@ -0,0 +1,174 @@
+package pdfire
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/css"
+	"github.com/chromedp/chromedp"
+)
+
+// FallbackFonts are the font families that render emoji and CJK text. Chrome
+// renders tofu boxes for these characters if no such font is installed.
+var FallbackFonts = []string{
+	"Noto Color Emoji",
+	"Noto Sans CJK SC",
+}
+
+// fontSample contains Latin, CJK and emoji characters, so that every required
+// font renders at least some of them.
+const fontSample = "Aa 中文 日本語 한국어 😀"
+
+// MissingFontsError is returned when fonts required by the converter are not available to Chrome.
+type MissingFontsError struct {
+	Families []string
+}
+
+func (e *MissingFontsError) Error() string {
+	return fmt.Sprintf("Fonts are missing: %s.", strings.Join(e.Families, ", "))
+}
+
+// CheckFonts verifies that Chrome renders text with every font of
+// RequiredFonts and returns a MissingFontsError otherwise.
+func (c *Converter) CheckFonts(ctx context.Context) error {
+	if len(c.options.RequiredFonts) == 0 {
+		return nil
+	}
+
+	ctx, cancel, err := c.newTabContext(ctx, nil, "")
+
+	if err != nil {
+		return err
+	}
+
+	defer cancel()
+
+	doc := strings.Builder{}
+
+	for _, family := range c.options.RequiredFonts {
+		fmt.Fprintf(&doc, `<p style="font-family: '%s'">%s</p>`, html.EscapeString(family), fontSample)
+	}
+
+	missing := make([]string, 0)
+
+	if err := chromedp.Run(ctx,
+		chromedp.Navigate("data:text/html;charset=utf-8,"+url.PathEscape(doc.String())),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			if err := css.Enable().Do(ctx); err != nil {
+				return err
+			}
+
+			var nodes []*cdp.Node
+
+			if err := chromedp.Nodes("p", &nodes, chromedp.ByQueryAll).Do(ctx); err != nil {
+				return err
+			}
+
+			for i, node := range nodes {
+				fonts, err := css.GetPlatformFontsForNode(node.NodeID).Do(ctx)
+
+				if err != nil {
+					return err
+				}
+
+				if !usesFont(fonts, c.options.RequiredFonts[i]) {
+					missing = append(missing, c.options.RequiredFonts[i])
+				}
+			}
+
+			return nil
+		}),
+	); err != nil {
+		return err
+	}
+
+	if len(missing) > 0 {
+		return &MissingFontsError{
+			Families: missing,
+		}
+	}
+
+	return nil
+}
+
+func usesFont(fonts []*css.PlatformFontUsage, family string) bool {
+	for _, font := range fonts {
+		if strings.EqualFold(font.FamilyName, family) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fontConfigOptions makes the fonts of FontDirs available to Chrome through a
+// fontconfig file that extends the system configuration.
+func fontConfigOptions(options *ConverterOptions) ([]chromedp.ExecAllocatorOption, error) {
+	if len(options.FontDirs) == 0 {
+		return nil, nil
+	}
+
+	conf := strings.Builder{}
+	conf.WriteString("<?xml version=\"1.0\"?>\n<!DOCTYPE fontconfig SYSTEM \"fonts.dtd\">\n<fontconfig>\n")
+	conf.WriteString("  <include ignore_missing=\"yes\">/etc/fonts/fonts.conf</include>\n")
+
+	for _, dir := range options.FontDirs {
+		path, err := filepath.Abs(dir)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(&conf, "  <dir>%s</dir>\n", html.EscapeString(path))
+	}
+
+	conf.WriteString("</fontconfig>\n")
+
+	sum := sha1.Sum([]byte(conf.String()))
+	path := filepath.Join(os.TempDir(), "pdfire-fonts-"+hex.EncodeToString(sum[:8])+".conf")
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := writeFileAtomic(path, []byte(conf.String())); err != nil {
+			return nil, err
+		}
+	}
+
+	return []chromedp.ExecAllocatorOption{
+		chromedp.Env("FONTCONFIG_FILE=" + path),
+	}, nil
+}
+
+// writeFileAtomic writes a file that concurrent readers never see partially.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,140 @@
+package pdfire
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// Font is a font that is registered in the page before it's rendered, so the
+// page can use fonts that aren't installed.
+type Font struct {
+	// Family is the font family that the CSS of the page refers to.
+	Family string
+	// URL is the URL of the font file. It's ignored if Data is set.
+	URL string
+	// Data is the font file, e.g. a WOFF2 or TTF file.
+	Data []byte
+	// Weight is the font-weight descriptor, e.g. "bold" or "100 900".
+	Weight string
+	// Style is the font-style descriptor, e.g. "italic".
+	Style string
+}
+
+// FontError is returned when a font of the Fonts option cannot be loaded.
+type FontError struct {
+	Family string
+}
+
+func (e *FontError) Error() string {
+	return fmt.Sprintf("Could not load font \"%s\".", e.Family)
+}
+
+// registerFontsScript registers fonts with the FontFace API, which isn't
+// restricted by the content security policy for font data.
+const registerFontsScript = `(function (fonts) {
+	fonts.forEach(function (font) {
+		var source = font.data
+			? Uint8Array.from(atob(font.data), function (c) { return c.charCodeAt(0); }).buffer
+			: 'url(' + JSON.stringify(font.url) + ')';
+		var face = new FontFace(font.family, source, { weight: font.weight || 'normal', style: font.style || 'normal' });
+
+		document.fonts.add(face);
+		face.load().catch(function () {});
+	});
+})(%s);`
+
+// failedFontsScript resolves with the families of the fonts that failed to load.
+const failedFontsScript = `document.fonts.ready.then(function () {
+	var failed = [];
+
+	document.fonts.forEach(function (face) {
+		if (face.status === 'error') {
+			failed.push(face.family.replace(/^["']|["']$/g, ''));
+		}
+	});
+
+	return failed;
+})`
+
+// fontsReadyScript resolves when the web fonts of the page are loaded. Reading
+// the layout first starts the loads of the fonts that the page uses.
+const fontsReadyScript = `(function () {
+	if (!document.fonts) {
+		return Promise.resolve(true);
+	}
+
+	if (document.body) {
+		document.body.getBoundingClientRect();
+	}
+
+	return document.fonts.ready.then(function () { return true; });
+})()`
+
+func fontsScript(fonts []*Font) (string, error) {
+	type jsFont struct {
+		Family string `json:"family"`
+		URL    string `json:"url,omitempty"`
+		Data   string `json:"data,omitempty"`
+		Weight string `json:"weight,omitempty"`
+		Style  string `json:"style,omitempty"`
+	}
+
+	jsFonts := make([]jsFont, len(fonts))
+
+	for i, font := range fonts {
+		jsFonts[i] = jsFont{
+			Family: font.Family,
+			URL:    font.URL,
+			Data:   base64.StdEncoding.EncodeToString(font.Data),
+			Weight: font.Weight,
+			Style:  font.Style,
+		}
+	}
+
+	data, err := json.Marshal(jsFonts)
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(registerFontsScript, data), nil
+}
+
+// waitForFonts waits until the fonts are loaded and fails if one of them
+// couldn't be loaded.
+func waitForFonts(ctx context.Context, fonts []*Font) error {
+	var failed []string
+
+	err := chromedp.Evaluate(failedFontsScript, &failed, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+		return p.WithAwaitPromise(true)
+	}).Do(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	for _, font := range fonts {
+		for _, family := range failed {
+			if family == font.Family {
+				return &FontError{Family: font.Family}
+			}
+		}
+	}
+
+	return nil
+}
+
+// waitForWebFonts waits until the web fonts of the page are loaded, so that
+// the PDF isn't printed with fallback fonts.
+func waitForWebFonts(ctx context.Context) error {
+	var done bool
+
+	return chromedp.Evaluate(fontsReadyScript, &done, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+		return p.WithAwaitPromise(true)
+	}).Do(ctx)
+}
@@ -0,0 +1,71 @@
+package pdfire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+var (
+	// ErrWaitForFunctionTimeout is returned when the WaitForFunction expression isn't truthy within WaitForFunctionTimeout.
+	ErrWaitForFunctionTimeout = errors.New("WaitForFunction timed out")
+)
+
+// functionPollInterval is how often the WaitForFunction expression is evaluated.
+const functionPollInterval = 100 * time.Millisecond
+
+// waitForFunctionScript evaluates the expression and resolves with whether its
+// value is truthy. A promise is awaited first.
+const waitForFunctionScript = `Promise.resolve((function () {
+	return (%s
+	);
+})()).then(function (value) { return !!value; })`
+
+// waitForFunction polls the page until the JavaScript expression is truthy. An
+// expression that throws fails the conversion. A timeout of zero waits as long
+// as the conversion may take.
+func waitForFunction(ctx context.Context, expression string, timeout time.Duration) error {
+	waitCtx, cancel := ctx, context.CancelFunc(func() {})
+
+	if timeout > 0 {
+		waitCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	defer cancel()
+
+	script := fmt.Sprintf(waitForFunctionScript, expression)
+
+	for {
+		var ok bool
+
+		err := chromedp.Evaluate(script, &ok, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+			return p.WithAwaitPromise(true)
+		}).Do(waitCtx)
+
+		if err != nil {
+			if ctx.Err() == nil && waitCtx.Err() == context.DeadlineExceeded {
+				return ErrWaitForFunctionTimeout
+			}
+
+			return err
+		}
+
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-time.After(functionPollInterval):
+		case <-waitCtx.Done():
+			if ctx.Err() == nil {
+				return ErrWaitForFunctionTimeout
+			}
+
+			return ctx.Err()
+		}
+	}
+}
@@ -6,20 +6,17 @@ require (
 	github.com/chromedp/cdproto v0.0.0-20191003000610-799a06e3acec
 	github.com/chromedp/chromedp v0.4.1
 	github.com/go-chi/chi v4.0.2+incompatible
-	github.com/google/uuid v1.1.1
 	github.com/hhrutter/lzw v0.0.0-20190829144645-6f07a24e8650 // indirect
 	github.com/hhrutter/tiff v0.0.0-20190829141212-736cae8d0bc7 // indirect
 	github.com/kr/pretty v0.1.0 // indirect
 	github.com/kr/pty v1.1.8 // indirect
+	github.com/mailru/easyjson v0.7.0
 	github.com/pdfcpu/pdfcpu v0.2.5
 	github.com/stretchr/objx v0.2.0 // indirect
 	github.com/stretchr/testify v1.4.0
 	github.com/unrolled/render v1.0.1
-	golang.org/x/crypto v0.0.0-20190829043050-9756ffdc2472 // indirect
-	golang.org/x/image v0.0.0-20190910094157-69e4b8554b2a // indirect
-	golang.org/x/net v0.0.0-20190827160401-ba9fcec4b297 // indirect
-	golang.org/x/sys v0.0.0-20191003212358-c178f38b412c // indirect
-	golang.org/x/text v0.3.2 // indirect
-	golang.org/x/tools v0.0.0-20190829051458-42f498d34c4d // indirect
+	golang.org/x/crypto v0.14.0
+	golang.org/x/image v0.0.0-20190910094157-69e4b8554b2a
+	golang.org/x/net v0.17.0
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
 )
@@ -0,0 +1,57 @@
+package pdfire
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+var (
+	// ErrWaitForImagesTimeout is returned when the images of the page don't load within WaitForImagesTimeout.
+	ErrWaitForImagesTimeout = errors.New("WaitForImages timed out")
+)
+
+// waitForImagesScript resolves when every image of the page has loaded or
+// failed to load. Lazy images are loaded eagerly, as they would never load
+// outside of the viewport.
+const waitForImagesScript = `Promise.all(Array.from(document.images, function (img) {
+	if (img.loading === 'lazy') {
+		img.loading = 'eager';
+	}
+
+	if (img.complete) {
+		return null;
+	}
+
+	return new Promise(function (resolve) {
+		img.addEventListener('load', resolve, { once: true });
+		img.addEventListener('error', resolve, { once: true });
+	});
+})).then(function () { return true; })`
+
+// waitForImages waits until the images of the page are loaded. A timeout of
+// zero waits as long as the conversion may take.
+func waitForImages(ctx context.Context, timeout time.Duration) error {
+	waitCtx, cancel := ctx, context.CancelFunc(func() {})
+
+	if timeout > 0 {
+		waitCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	defer cancel()
+
+	var done bool
+
+	err := chromedp.Evaluate(waitForImagesScript, &done, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+		return p.WithAwaitPromise(true)
+	}).Do(waitCtx)
+
+	if err != nil && ctx.Err() == nil && waitCtx.Err() == context.DeadlineExceeded {
+		return ErrWaitForImagesTimeout
+	}
+
+	return err
+}
@@ -0,0 +1,153 @@
+package pdfire
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+)
+
+// PageInfo describes a page of a PDF.
+type PageInfo struct {
+	// Width and Height are the size of the page's media box in points.
+	Width  float64
+	Height float64
+	// ContentHash is the hex-encoded SHA-256 hash of the decoded content
+	// streams of the page. Pages with equal hashes draw the same content,
+	// unless the resources they refer to differ.
+	ContentHash string
+}
+
+// InspectPages returns information about every page of a PDF, in order.
+func InspectPages(r io.Reader) ([]*PageInfo, error) {
+	doc, err := readPDF(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := doc.pages()
+
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make([]*PageInfo, len(refs))
+
+	for i, ref := range refs {
+		if pages[i], err = doc.pageInfo(ref); err != nil {
+			return nil, err
+		}
+	}
+
+	return pages, nil
+}
+
+func (d *pdfDocument) pageInfo(ref pdfRef) (*PageInfo, error) {
+	page, err := d.dict(ref)
+
+	if err != nil {
+		return nil, err
+	}
+
+	box, err := d.inherited(page, "MediaBox")
+
+	if err != nil {
+		return nil, err
+	}
+
+	arr, _ := box.([]interface{})
+
+	if len(arr) != 4 {
+		return nil, ErrInvalidPDF
+	}
+
+	coords := make([]float64, 4)
+
+	for i, v := range arr {
+		v, err := d.resolve(v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if coords[i], err = pdfNumber(v); err != nil {
+			return nil, err
+		}
+	}
+
+	hash := sha256.New()
+	contents, err := d.resolve(page["Contents"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	streams, ok := contents.([]interface{})
+
+	if !ok && contents != nil {
+		streams = []interface{}{contents}
+	}
+
+	for _, obj := range streams {
+		obj, err := d.resolve(obj)
+
+		if err != nil {
+			return nil, err
+		}
+
+		stream, ok := obj.(*pdfStream)
+
+		if !ok {
+			return nil, ErrInvalidPDF
+		}
+
+		data, err := d.decode(stream)
+
+		if err != nil {
+			return nil, err
+		}
+
+		hash.Write(data)
+	}
+
+	return &PageInfo{
+		Width:       coords[2] - coords[0],
+		Height:      coords[3] - coords[1],
+		ContentHash: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// inherited returns an attribute of a page, which may be set on one of the
+// page tree nodes above it.
+func (d *pdfDocument) inherited(node pdfDict, key string) (interface{}, error) {
+	for i := 0; i < 32 && node != nil; i++ {
+		if value, ok := node[key]; ok {
+			return d.resolve(value)
+		}
+
+		parent, ok := node["Parent"]
+
+		if !ok {
+			break
+		}
+
+		var err error
+
+		if node, err = d.dict(parent); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, ErrInvalidPDF
+}
+
+func pdfNumber(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	}
+
+	return 0, ErrInvalidPDF
+}
@@ -0,0 +1,615 @@
+package pdfire
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"golang.org/x/net/publicsuffix"
+)
+
+var (
+	// ErrBodyWithGET is returned when a Body is sent with the GET method.
+	ErrBodyWithGET = errors.New("a body can't be sent with the GET method")
+)
+
+// Methods are the request methods accepted by Method.
+var Methods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+var (
+	// HeadersScopeAll sends the Headers with every request of the page.
+	HeadersScopeAll = HeadersScope("all")
+	// HeadersScopeDocument sends the Headers only with the request of the main
+	// document, as long as it has the origin of the converted URL.
+	HeadersScopeDocument = HeadersScope("document")
+	// HeadersScopeOrigin sends the Headers with all requests to the origin of
+	// the converted URL.
+	HeadersScopeOrigin = HeadersScope("origin")
+)
+
+// HeadersScope decides which requests of a page are sent with the Headers.
+type HeadersScope string
+
+// blockableResources are the resource types accepted by BlockResources.
+var blockableResources = map[string]network.ResourceType{
+	"image":      network.ResourceTypeImage,
+	"font":       network.ResourceTypeFont,
+	"media":      network.ResourceTypeMedia,
+	"script":     network.ResourceTypeScript,
+	"stylesheet": network.ResourceTypeStylesheet,
+	"xhr":        network.ResourceTypeXHR,
+	"fetch":      network.ResourceTypeFetch,
+	"manifest":   network.ResourceTypeManifest,
+	"other":      network.ResourceTypeOther,
+}
+
+// validateBlockResources checks that BlockResources only names known types.
+func validateBlockResources(resources []string) error {
+	for _, name := range resources {
+		if _, ok := blockableResources[name]; !ok {
+			return &ParseError{Key: "blockResources", Value: name}
+		}
+	}
+
+	return nil
+}
+
+// Credentials answer the HTTP authentication challenges, e.g. of Basic or
+// Digest authentication, of the converted origins.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// htmlDocumentURL is the URL that HTML conversions navigate to. The interceptor
+// answers it with the HTML of the conversion, so that the HTML never touches
+// the disk. Hosts below "localhost" never leave the machine and make the page a
+// secure context. Other requests to its origin are blocked, as they would
+// otherwise reach the loopback interface.
+const (
+	htmlDocumentOrigin = "http://document.pdfire.localhost"
+	htmlDocumentURL    = htmlDocumentOrigin + "/"
+)
+
+// interceptor pauses the requests of a conversion using the Fetch domain and
+// decides how each of them continues.
+type interceptor struct {
+	options *ConversionOptions
+	frameID cdp.FrameID
+	mu      sync.Mutex
+	topSite string
+	// documentURL is the URL requested by the main frame, which the ad filters
+	// match the requests of the page against.
+	documentURL string
+	// sent holds the converted URLs whose request was sent with Method.
+	sent map[string]bool
+	// answered holds the requests whose challenge was answered with the Auth
+	// credentials, so that rejected credentials aren't sent again.
+	answered map[fetch.RequestID]bool
+	// events records the main documents denied by the URL guard.
+	events *pageEvents
+}
+
+func newInterceptor(options *ConversionOptions, frameID cdp.FrameID, events *pageEvents) *interceptor {
+	return &interceptor{
+		options:  options,
+		frameID:  frameID,
+		sent:     make(map[string]bool),
+		answered: make(map[fetch.RequestID]bool),
+		events:   events,
+	}
+}
+
+func (i *interceptor) enabled() bool {
+	return len(i.patterns()) > 0
+}
+
+func (i *interceptor) patterns() []*fetch.RequestPattern {
+	patterns := make([]*fetch.RequestPattern, 0)
+
+	if i.options.document != "" {
+		patterns = append(patterns, &fetch.RequestPattern{URLPattern: htmlDocumentOrigin + "/*", RequestStage: fetch.RequestStageRequest})
+	}
+
+	if ((len(i.options.OriginHeaders) > 0 || i.scopesHeaders() || i.options.Auth != nil) && len(i.options.urls()) > 0) || i.options.adFilters != nil || i.options.urlGuard != nil {
+		patterns = append(patterns, &fetch.RequestPattern{URLPattern: "*", RequestStage: fetch.RequestStageRequest})
+	}
+
+	if i.overridesRequest() && len(i.options.urls()) > 0 {
+		patterns = append(patterns, &fetch.RequestPattern{URLPattern: "*", ResourceType: network.ResourceTypeDocument, RequestStage: fetch.RequestStageRequest})
+	}
+
+	for _, name := range i.options.BlockResources {
+		if resourceType, ok := blockableResources[name]; ok {
+			patterns = append(patterns, &fetch.RequestPattern{URLPattern: "*", ResourceType: resourceType, RequestStage: fetch.RequestStageRequest})
+		}
+	}
+
+	if i.options.BlockThirdPartyCookies {
+		patterns = append(patterns, &fetch.RequestPattern{URLPattern: "*", RequestStage: fetch.RequestStageResponse})
+	}
+
+	return patterns
+}
+
+func (i *interceptor) enable(ctx context.Context) error {
+	return fetch.Enable().
+		WithPatterns(i.patterns()).
+		WithHandleAuthRequests(i.options.Auth != nil).
+		Do(ctx)
+}
+
+// handle continues a paused request. It sends commands to the browser, so it
+// must not be called from within an event listener.
+func (i *interceptor) handle(ctx context.Context, ev *fetch.EventRequestPaused) {
+	if i.options.document != "" && isSameOrigin(ev.Request.URL, htmlDocumentURL) {
+		i.serveDocument(ctx, ev)
+		return
+	}
+
+	if ev.ResponseStatusCode != 0 || ev.ResponseErrorReason != "" {
+		i.handleResponse(ctx, ev)
+		return
+	}
+
+	if i.deniesURL(ctx, ev) {
+		fetch.FailRequest(ev.RequestID, network.ErrorReasonBlockedByClient).Do(ctx)
+		return
+	}
+
+	if i.blocksAd(ev) {
+		fetch.FailRequest(ev.RequestID, network.ErrorReasonBlockedByClient).Do(ctx)
+		return
+	}
+
+	if i.blocksResource(ev.ResourceType) {
+		fetch.FailRequest(ev.RequestID, network.ErrorReasonBlockedByClient).Do(ctx)
+		return
+	}
+
+	i.handleRequest(ctx, ev)
+}
+
+// blocksAd reports whether a request is blocked by the ad filters. The main
+// document is never blocked.
+func (i *interceptor) blocksAd(ev *fetch.EventRequestPaused) bool {
+	if i.options.adFilters == nil {
+		return false
+	}
+
+	i.mu.Lock()
+
+	if ev.ResourceType == network.ResourceTypeDocument && ev.FrameID == i.frameID {
+		i.documentURL = ev.Request.URL
+		i.mu.Unlock()
+
+		return false
+	}
+
+	documentURL := i.documentURL
+	i.mu.Unlock()
+
+	return i.options.adFilters.Blocks(ev.Request.URL, documentURL, filterType(ev.ResourceType))
+}
+
+// deniesURL reports whether a request is denied by the URL guard. Documents
+// must be allowed as well, which covers redirects of the converted URLs and
+// frames. A denied main document fails the conversion.
+func (i *interceptor) deniesURL(ctx context.Context, ev *fetch.EventRequestPaused) bool {
+	if i.options.urlGuard == nil {
+		return false
+	}
+
+	document := ev.ResourceType == network.ResourceTypeDocument
+	err := i.options.urlGuard.check(ctx, ev.Request.URL, document)
+
+	if err == nil {
+		return false
+	}
+
+	if document && ev.FrameID == i.frameID && i.events != nil {
+		i.events.fail(err)
+	}
+
+	return true
+}
+
+// blocksResource reports whether requests of the resource type are blocked.
+func (i *interceptor) blocksResource(resourceType network.ResourceType) bool {
+	for _, name := range i.options.BlockResources {
+		if blockableResources[name] == resourceType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// serveDocument answers the request of htmlDocumentURL with the HTML of the
+// conversion and blocks all other requests to its origin.
+func (i *interceptor) serveDocument(ctx context.Context, ev *fetch.EventRequestPaused) {
+	if ev.Request.URL != htmlDocumentURL || ev.ResourceType != network.ResourceTypeDocument {
+		fetch.FailRequest(ev.RequestID, network.ErrorReasonBlockedByClient).Do(ctx)
+		return
+	}
+
+	fetch.FulfillRequest(ev.RequestID, http.StatusOK).
+		WithResponseHeaders([]*fetch.HeaderEntry{
+			{Name: "Content-Type", Value: "text/html; charset=utf-8"},
+			{Name: "Cache-Control", Value: "no-store"},
+		}).
+		WithBody(base64.StdEncoding.EncodeToString([]byte(i.options.document))).
+		Do(ctx)
+}
+
+// handleAuth answers an authentication challenge with the Auth credentials.
+// Challenges of proxies and other origins are canceled, as are challenges
+// that rejected the credentials. It must not be called from within an event
+// listener.
+func (i *interceptor) handleAuth(ctx context.Context, ev *fetch.EventAuthRequired) {
+	response := &fetch.AuthChallengeResponse{
+		Response: fetch.AuthChallengeResponseResponseCancelAuth,
+	}
+
+	if i.answersChallenge(ev) {
+		response = &fetch.AuthChallengeResponse{
+			Response: fetch.AuthChallengeResponseResponseProvideCredentials,
+			Username: i.options.Auth.Username,
+			Password: i.options.Auth.Password,
+		}
+	}
+
+	fetch.ContinueWithAuth(ev.RequestID, response).Do(ctx)
+}
+
+func (i *interceptor) answersChallenge(ev *fetch.EventAuthRequired) bool {
+	if i.options.Auth == nil || ev.AuthChallenge.Source == fetch.AuthChallengeSourceProxy || !i.isConvertedOrigin(ev.Request.URL) {
+		return false
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.answered[ev.RequestID] {
+		return false
+	}
+
+	i.answered[ev.RequestID] = true
+
+	return true
+}
+
+// scopesHeaders reports whether the Headers are only sent with some requests.
+func (i *interceptor) scopesHeaders() bool {
+	return len(i.options.Headers) > 0 && i.options.HeadersScope != HeadersScopeAll
+}
+
+// overridesRequest reports whether the converted URLs are requested with
+// another method or body than a navigation has.
+func (i *interceptor) overridesRequest() bool {
+	return (i.options.Method != "" && i.options.Method != http.MethodGet) || i.options.Body != ""
+}
+
+func (i *interceptor) handleRequest(ctx context.Context, ev *fetch.EventRequestPaused) {
+	cont := fetch.ContinueRequest(ev.RequestID)
+	extra := i.requestHeaders(ev)
+
+	if i.overrideRequest(ev) {
+		cont = cont.WithMethod(i.options.Method).WithPostData(i.options.Body)
+
+		if i.options.Body != "" {
+			extra["Content-Type"] = i.contentType()
+		}
+	}
+
+	if len(extra) > 0 {
+		headers := make([]*fetch.HeaderEntry, 0, len(ev.Request.Headers)+len(extra))
+		overridden := make(map[string]bool)
+
+		for name, value := range extra {
+			headers = append(headers, &fetch.HeaderEntry{Name: name, Value: value})
+			overridden[http.CanonicalHeaderKey(name)] = true
+		}
+
+		for name, value := range ev.Request.Headers {
+			if !overridden[http.CanonicalHeaderKey(name)] {
+				headers = append(headers, &fetch.HeaderEntry{Name: name, Value: fmt.Sprint(value)})
+			}
+		}
+
+		cont = cont.WithHeaders(headers)
+	}
+
+	cont.Do(ctx)
+}
+
+// requestHeaders returns the headers added to a paused request.
+func (i *interceptor) requestHeaders(ev *fetch.EventRequestPaused) map[string]string {
+	headers := make(map[string]string)
+
+	if !i.isConvertedOrigin(ev.Request.URL) {
+		return headers
+	}
+
+	mainDocument := ev.ResourceType == network.ResourceTypeDocument && ev.FrameID == i.frameID
+
+	if i.scopesHeaders() && (i.options.HeadersScope == HeadersScopeOrigin || mainDocument) {
+		for name, value := range i.options.Headers {
+			headers[name] = fmt.Sprint(value)
+		}
+	}
+
+	for name, value := range i.options.OriginHeaders {
+		headers[name] = value
+	}
+
+	return headers
+}
+
+// overrideRequest reports whether the paused request is the navigation to a
+// converted URL that is sent with Method and Body. Each URL is only overridden
+// once, so that redirects back to it are followed with GET.
+func (i *interceptor) overrideRequest(ev *fetch.EventRequestPaused) bool {
+	if !i.overridesRequest() || ev.ResourceType != network.ResourceTypeDocument || ev.FrameID != i.frameID {
+		return false
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, u := range i.options.urls() {
+		if sameURL(ev.Request.URL, u) && !i.sent[u] {
+			i.sent[u] = true
+			return true
+		}
+	}
+
+	return false
+}
+
+// contentType returns the Content-Type of the Body. Fields of a form are sent
+// by default.
+func (i *interceptor) contentType() string {
+	if i.options.ContentType != "" {
+		return i.options.ContentType
+	}
+
+	return "application/x-www-form-urlencoded"
+}
+
+// isConvertedOrigin reports whether a URL has the origin of a converted URL.
+func (i *interceptor) isConvertedOrigin(rawurl string) bool {
+	for _, u := range i.options.urls() {
+		if isSameOrigin(rawurl, u) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (i *interceptor) handleResponse(ctx context.Context, ev *fetch.EventRequestPaused) {
+	if ev.ResourceType == network.ResourceTypeDocument && ev.FrameID == i.frameID {
+		i.setTopSite(ev.Request.URL)
+	}
+
+	if ev.ResponseErrorReason == "" && i.options.BlockThirdPartyCookies &&
+		hasHeader(ev.ResponseHeaders, "Set-Cookie") && i.isThirdParty(ev.Request.URL) {
+		if err := fulfillWithoutCookies(ctx, ev); err == nil {
+			return
+		}
+	}
+
+	fetch.ContinueRequest(ev.RequestID).Do(ctx)
+}
+
+func (i *interceptor) setTopSite(rawurl string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.topSite = site(rawurl)
+}
+
+// isThirdParty reports whether a URL belongs to another site than the main
+// document. Every remote URL is third-party to HTML conversions.
+func (i *interceptor) isThirdParty(rawurl string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.topSite == "" || site(rawurl) != i.topSite
+}
+
+// fulfillWithoutCookies answers a paused response with its own body and
+// headers, except for the Set-Cookie headers.
+func fulfillWithoutCookies(ctx context.Context, ev *fetch.EventRequestPaused) error {
+	headers := make([]*fetch.HeaderEntry, 0, len(ev.ResponseHeaders))
+
+	for _, h := range ev.ResponseHeaders {
+		if !strings.EqualFold(h.Name, "Set-Cookie") {
+			headers = append(headers, h)
+		}
+	}
+
+	body, err := fetch.GetResponseBody(ev.RequestID).Do(ctx)
+
+	if err != nil {
+		body = nil
+	}
+
+	return fetch.FulfillRequest(ev.RequestID, ev.ResponseStatusCode).
+		WithResponseHeaders(headers).
+		WithBody(base64.StdEncoding.EncodeToString(body)).
+		Do(ctx)
+}
+
+func hasHeader(headers []*fetch.HeaderEntry, name string) bool {
+	for _, h := range headers {
+		if strings.EqualFold(h.Name, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isSameOrigin(a, b string) bool {
+	ua, err := url.Parse(a)
+
+	if err != nil {
+		return false
+	}
+
+	ub, err := url.Parse(b)
+
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Host, ub.Host)
+}
+
+// sameURL reports whether two URLs are equal once Chrome normalized them, e.g.
+// "https://example.com" and "https://example.com/".
+func sameURL(a, b string) bool {
+	ua, err := url.Parse(a)
+
+	if err != nil {
+		return false
+	}
+
+	ub, err := url.Parse(b)
+
+	if err != nil {
+		return false
+	}
+
+	for _, u := range []*url.URL{ua, ub} {
+		u.Fragment = ""
+		u.Scheme = strings.ToLower(u.Scheme)
+		u.Host = strings.ToLower(u.Host)
+
+		if u.Path == "" {
+			u.Path = "/"
+		}
+	}
+
+	return ua.String() == ub.String()
+}
+
+func parseBlockResources(jsonMap map[string]interface{}) ([]string, error) {
+	resources, err := parseStrings(jsonMap, "blockResources", make([]string, 0))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateBlockResources(resources); err != nil {
+		return nil, err
+	}
+
+	return resources, nil
+}
+
+func parseAuth(jsonMap map[string]interface{}) (*Credentials, error) {
+	raw, ok := jsonMap["auth"]
+
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	authMap, ok := raw.(map[string]interface{})
+
+	if !ok {
+		return nil, &ParseError{Key: "auth", Value: raw}
+	}
+
+	username, err := parseString(authMap, "username", "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := parseString(authMap, "password", "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credentials{Username: username, Password: password}, nil
+}
+
+func parseMethod(jsonMap map[string]interface{}) (string, error) {
+	return parseStringOnly(jsonMap, "method", http.MethodGet, Methods...)
+}
+
+// parseBody parses "body", which is either the body itself or an object of
+// form fields.
+func parseBody(jsonMap map[string]interface{}) (string, error) {
+	fields, ok := jsonMap["body"].(map[string]interface{})
+
+	if !ok {
+		return parseString(jsonMap, "body", "")
+	}
+
+	values := url.Values{}
+
+	for name, value := range fields {
+		switch v := value.(type) {
+		case string:
+			values.Set(name, v)
+		case float64, bool:
+			values.Set(name, fmt.Sprint(v))
+		default:
+			return "", &ParseError{Key: "body", Value: fields}
+		}
+	}
+
+	return values.Encode(), nil
+}
+
+// site returns the registrable domain of a URL, e.g. "example.co.uk" for
+// "https://www.example.co.uk/". Hosts without one, like IP addresses and
+// "localhost", are returned as they are.
+func site(rawurl string) string {
+	u, err := url.Parse(rawurl)
+
+	if err != nil {
+		return ""
+	}
+
+	host := strings.ToLower(u.Hostname())
+
+	if host == "" || net.ParseIP(host) != nil {
+		return host
+	}
+
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return domain
+	}
+
+	return host
+}
+
+// blockThirdPartyCookiesScript disables document.cookie in frames whose origin
+// differs from the one of the top-level document.
+const blockThirdPartyCookiesScript = `(function () {
+	var origins = window.location.ancestorOrigins;
+
+	if (!origins || origins.length === 0 || origins[origins.length - 1] === window.origin) {
+		return;
+	}
+
+	Object.defineProperty(document, 'cookie', {
+		get: function () { return ''; },
+		set: function () {}
+	});
+})();`
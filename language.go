@@ -0,0 +1,89 @@
+package pdfire
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// languageScript overrides navigator.language and navigator.languages.
+const languageScript = `(function (languages) {
+	var proto = Object.getPrototypeOf(navigator);
+
+	Object.defineProperty(proto, 'language', {
+		get: function () { return languages[0]; }
+	});
+
+	Object.defineProperty(proto, 'languages', {
+		get: function () { return languages.slice(); }
+	});
+})(%s);`
+
+// languageTags returns the language tags of an Accept-Language value like
+// "de-CH, de;q=0.9, en;q=0.8", in order.
+func languageTags(language string) []string {
+	tags := make([]string, 0)
+
+	for _, part := range strings.Split(language, ",") {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+
+		if tag != "" && tag != "*" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// setLanguage sends language as the Accept-Language header of the page's
+// requests and makes it the language of navigator. Both are overridden along
+// with the user agent, which is the one of the browser unless userAgent is set.
+func setLanguage(ctx context.Context, language, userAgent string) error {
+	tags := languageTags(language)
+
+	if len(tags) == 0 && userAgent == "" {
+		return nil
+	}
+
+	if userAgent == "" {
+		c := chromedp.FromContext(ctx)
+		_, _, _, browserAgent, _, err := browser.GetVersion().Do(cdp.WithExecutor(ctx, c.Browser))
+
+		if err != nil {
+			return err
+		}
+
+		userAgent = browserAgent
+	}
+
+	override := emulation.SetUserAgentOverride(userAgent)
+
+	if len(tags) > 0 {
+		override = override.WithAcceptLanguage(language)
+	}
+
+	if err := override.Do(ctx); err != nil {
+		return err
+	}
+
+	if len(tags) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(tags)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = page.AddScriptToEvaluateOnNewDocument(fmt.Sprintf(languageScript, data)).Do(ctx)
+
+	return err
+}
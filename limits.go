@@ -0,0 +1,188 @@
+package pdfire
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/performance"
+	"github.com/chromedp/chromedp"
+)
+
+// limitInterval is the interval in which the resource usage of a conversion is checked.
+const limitInterval = 250 * time.Millisecond
+
+var (
+	// ResourceJSHeap is the JavaScript heap of the page, measured in bytes.
+	ResourceJSHeap = Resource("jsHeap")
+	// ResourceCPUTime is the main thread task time of the page.
+	ResourceCPUTime = Resource("cpuTime")
+)
+
+// Resource is a resource whose usage can be limited per conversion.
+type Resource string
+
+// ResourceLimitError is returned when a conversion exceeds a resource limit,
+// including a tab that crashed when its heap came near the MaxOldSpaceSize of
+// the converter. Limit and Usage are bytes for ResourceJSHeap and nanoseconds
+// for ResourceCPUTime.
+type ResourceLimitError struct {
+	Resource Resource
+	Limit    int64
+	Usage    int64
+	// Crashed is set when the tab crashed near the limit, in which case Usage
+	// is the last measured usage and may be below Limit.
+	Crashed bool
+}
+
+func (e *ResourceLimitError) Error() string {
+	if e.Crashed {
+		return fmt.Sprintf("Conversion crashed near the %s limit (%d of %d).", e.Resource, e.Usage, e.Limit)
+	}
+
+	if e.Resource == ResourceCPUTime {
+		return fmt.Sprintf("Conversion exceeded the %s limit (%v > %v).", e.Resource, time.Duration(e.Usage), time.Duration(e.Limit))
+	}
+
+	return fmt.Sprintf("Conversion exceeded the %s limit (%d > %d).", e.Resource, e.Usage, e.Limit)
+}
+
+// oldSpaceThreshold is the share of the MaxOldSpaceSize of the converter from
+// which a crash of the tab is taken for V8 running out of memory.
+const oldSpaceThreshold = 0.75
+
+// limiter aborts a conversion when it exceeds the limits of its options. It
+// also records the peak heap size, which tells whether a crash was caused by
+// the old space limit of the converter.
+type limiter struct {
+	options     *ConversionOptions
+	maxOldSpace int64
+	done        chan struct{}
+	once        sync.Once
+	mu          sync.Mutex
+	err         error
+	peakHeap    int64
+}
+
+// newLimiter returns a limiter for the options. maxOldSpace is the
+// MaxOldSpaceSize of the converter in bytes, or zero.
+func newLimiter(options *ConversionOptions, maxOldSpace int64) *limiter {
+	return &limiter{
+		options:     options,
+		maxOldSpace: maxOldSpace,
+		done:        make(chan struct{}),
+	}
+}
+
+func (l *limiter) enabled() bool {
+	return l.options.MaxJSHeapSize > 0 || l.options.MaxCPUTime > 0 || l.maxOldSpace > 0
+}
+
+// start returns an action that starts watching the page's resource usage.
+// When a limit is exceeded, cancel is called to abort the conversion.
+func (l *limiter) start(cancel context.CancelFunc) chromedp.ActionFunc {
+	return func(ctx context.Context) error {
+		if err := performance.Enable().Do(ctx); err != nil {
+			return err
+		}
+
+		go l.watch(ctx, cancel)
+
+		return nil
+	}
+}
+
+func (l *limiter) watch(ctx context.Context, cancel context.CancelFunc) {
+	ticker := time.NewTicker(limitInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-l.done:
+			return
+		case <-ticker.C:
+		}
+
+		metrics, err := performance.GetMetrics().Do(ctx)
+
+		if err != nil {
+			continue
+		}
+
+		if err := l.check(metrics); err != nil {
+			l.mu.Lock()
+			l.err = err
+			l.mu.Unlock()
+			cancel()
+
+			return
+		}
+	}
+}
+
+func (l *limiter) check(metrics []*performance.Metric) error {
+	for _, m := range metrics {
+		switch m.Name {
+		case "JSHeapTotalSize":
+			l.mu.Lock()
+
+			if size := int64(m.Value); size > l.peakHeap {
+				l.peakHeap = size
+			}
+
+			l.mu.Unlock()
+		case "JSHeapUsedSize":
+			if usage := int64(m.Value); l.options.MaxJSHeapSize > 0 && usage > l.options.MaxJSHeapSize {
+				return &ResourceLimitError{
+					Resource: ResourceJSHeap,
+					Limit:    l.options.MaxJSHeapSize,
+					Usage:    usage,
+				}
+			}
+		case "TaskDuration":
+			if usage := seconds(m.Value); l.options.MaxCPUTime > 0 && usage > l.options.MaxCPUTime {
+				return &ResourceLimitError{
+					Resource: ResourceCPUTime,
+					Limit:    int64(l.options.MaxCPUTime),
+					Usage:    int64(usage),
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// stop stops watching and returns the exceeded limit, if any.
+func (l *limiter) stop() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.err
+}
+
+// outOfMemory returns a crashed *ResourceLimitError if the heap came near the
+// old space limit before the tab crashed. V8 crashes the tab when it runs out of
+// memory, which a retry wouldn't fix.
+func (l *limiter) outOfMemory() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxOldSpace == 0 || float64(l.peakHeap) < oldSpaceThreshold*float64(l.maxOldSpace) {
+		return nil
+	}
+
+	return &ResourceLimitError{
+		Resource: ResourceJSHeap,
+		Limit:    l.maxOldSpace,
+		Usage:    l.peakHeap,
+		Crashed:  true,
+	}
+}
@@ -0,0 +1,113 @@
+package pdfire
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrQPDFNotFound is returned when Linearize is set and no qpdf executable
+	// is installed.
+	ErrQPDFNotFound = errors.New("qpdf not found")
+)
+
+// qpdfExecutables are the names of the qpdf executable, in order of preference.
+var qpdfExecutables = []string{"qpdf"}
+
+// LinearizeError is returned when qpdf fails to linearize a PDF.
+type LinearizeError struct {
+	Output string
+	Err    error
+}
+
+func (e *LinearizeError) Error() string {
+	return fmt.Sprintf("Could not linearize PDF (%v): %s", e.Err, e.Output)
+}
+
+// linearize rewrites a PDF with qpdf for fast web view, so that viewers can
+// display the first page before the whole file is loaded. Only the signature
+// may follow, as incremental updates undo the linearization. Encrypted PDFs
+// keep their encryption.
+func linearize(buf *bytes.Buffer, options *PostProcessOptions) (*bytes.Buffer, error) {
+	qpdf, err := lookupQPDF()
+
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := ioutil.TempDir("", "pdfire-linearize")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "in.pdf")
+	out := filepath.Join(dir, "out.pdf")
+
+	if err := ioutil.WriteFile(in, buf.Bytes(), 0600); err != nil {
+		return nil, err
+	}
+
+	args := []string{"--linearize"}
+
+	// qpdf generates a new document ID from the current time otherwise.
+	if options.Deterministic {
+		args = append(args, "--deterministic-id")
+	}
+
+	// The owner password opens the PDF even if the user password is set. It's
+	// passed in a file, so that it doesn't show up in the process list.
+	password := options.OwnerPassword
+
+	if password == "" {
+		password = options.UserPassword
+	}
+
+	if password != "" {
+		file := filepath.Join(dir, "password")
+
+		if err := ioutil.WriteFile(file, []byte(password), 0600); err != nil {
+			return nil, err
+		}
+
+		args = append(args, "--password-file="+file)
+	}
+
+	cmd := exec.Command(qpdf, append(args, in, out)...)
+	output, err := cmd.CombinedOutput()
+
+	// qpdf exits with 3 if it succeeded with warnings.
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 3 {
+		err = nil
+	}
+
+	if err != nil {
+		return nil, &LinearizeError{Output: strings.TrimSpace(string(output)), Err: err}
+	}
+
+	data, err := ioutil.ReadFile(out)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewBuffer(data), nil
+}
+
+func lookupQPDF() (string, error) {
+	for _, candidate := range qpdfExecutables {
+		if path, err := exec.LookPath(candidate); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", ErrQPDFNotFound
+}
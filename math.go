@@ -0,0 +1,43 @@
+package pdfire
+
+import (
+	"context"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// waitForMathScript resolves when MathJax 2 or 3 finished typesetting and the
+// fonts of KaTeX formulas are loaded. It resolves right away if the page uses
+// neither. A configured MathJax that doesn't load within 5 seconds is ignored.
+const waitForMathScript = `new Promise(function (resolve) {
+	var deadline = Date.now() + 5000;
+
+	(function check() {
+		var mj = window.MathJax;
+		var typeset = null;
+
+		if (mj && mj.startup && mj.startup.promise) {
+			typeset = mj.startup.promise;
+		} else if (mj && mj.Hub && mj.Hub.Queue) {
+			typeset = new Promise(function (done) { mj.Hub.Queue(done); });
+		} else if (mj && Date.now() < deadline) {
+			return setTimeout(check, 50);
+		}
+
+		Promise.resolve(typeset).then(function () {
+			if ((window.katex || document.querySelector('.katex')) && document.fonts) {
+				return document.fonts.ready;
+			}
+		}).then(function () { resolve(true); }, function () { resolve(true); });
+	})();
+})`
+
+// waitForMath waits until the formulas of the page are typeset.
+func waitForMath(ctx context.Context) error {
+	var done bool
+
+	return chromedp.Evaluate(waitForMathScript, &done, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+		return p.WithAwaitPromise(true)
+	}).Do(ctx)
+}
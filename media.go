@@ -0,0 +1,103 @@
+package pdfire
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/chromedp"
+)
+
+var (
+	// ErrCompareMediaCrawl is returned when a crawl is combined with CompareMedia.
+	ErrCompareMediaCrawl = errors.New("media comparison is not supported when crawling")
+)
+
+var (
+	// ColorSchemeLight emulates a preference for a light color scheme.
+	ColorSchemeLight = ColorScheme("light")
+	// ColorSchemeDark emulates a preference for a dark color scheme.
+	ColorSchemeDark = ColorScheme("dark")
+)
+
+// ColorScheme is the emulated value of the prefers-color-scheme media feature.
+// The empty color scheme keeps the preference of the browser.
+type ColorScheme string
+
+// printMediaAction prints the page once with screen and once with print media
+// emulated. Afterwards, the media of the options is emulated again.
+func printMediaAction(screen, printed io.Writer, options *ConversionOptions) chromedp.ActionFunc {
+	return func(ctx context.Context) error {
+		for _, media := range []struct {
+			media Media
+			w     io.Writer
+		}{
+			{MediaScreen, screen},
+			{MediaPrint, printed},
+		} {
+			if err := emulateMedia(ctx, media.media, options); err != nil {
+				return err
+			}
+
+			if err := printToPDFAction(media.w, options, nil).Do(ctx); err != nil {
+				return err
+			}
+		}
+
+		return emulateMedia(ctx, options.EmulateMedia, options)
+	}
+}
+
+// emulateMedia emulates the media type and the media features of the options.
+func emulateMedia(ctx context.Context, media Media, options *ConversionOptions) error {
+	features := make([]*emulation.MediaFeature, 0)
+
+	if options.ForcedColors {
+		features = append(features, &emulation.MediaFeature{Name: "forced-colors", Value: "active"})
+	}
+
+	if options.ColorScheme != "" {
+		features = append(features, &emulation.MediaFeature{Name: "prefers-color-scheme", Value: string(options.ColorScheme)})
+	}
+
+	return emulation.SetEmulatedMedia().WithMedia(string(media)).WithFeatures(features).Do(ctx)
+}
+
+// zipMediaPDFs returns a ZIP archive of the PDFs printed with screen and print media.
+func zipMediaPDFs(screen, printed *bytes.Buffer) (*bytes.Buffer, error) {
+	buf := bytes.NewBuffer([]byte{})
+	zw := zip.NewWriter(buf)
+
+	for _, file := range []struct {
+		name string
+		pdf  *bytes.Buffer
+	}{
+		{"screen.pdf", screen},
+		{"print.pdf", printed},
+	} {
+		fw, err := zw.Create(file.name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := io.Copy(fw, file.pdf); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+func parseColorScheme(jsonMap map[string]interface{}) (ColorScheme, error) {
+	scheme, err := parseStringOnly(jsonMap, "colorScheme", "", "", string(ColorSchemeLight), string(ColorSchemeDark))
+
+	return ColorScheme(scheme), err
+}
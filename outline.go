@@ -0,0 +1,305 @@
+package pdfire
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/chromedp/chromedp"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+var (
+	// OutlineModeNone adds no document outline.
+	OutlineModeNone = OutlineMode("none")
+	// OutlineModeChrome lets Chrome generate the outline from the headings of
+	// the tagged PDF. Older Chrome versions ignore it.
+	OutlineModeChrome = OutlineMode("chrome")
+	// OutlineModeHeadings adds an outline of the h1, h2 and h3 headings
+	// itself, which works with every Chrome version.
+	OutlineModeHeadings = OutlineMode("headings")
+)
+
+// OutlineMode decides how the document outline, the bookmarks of a PDF, is
+// generated.
+type OutlineMode string
+
+func parseOutlineMode(jsonMap map[string]interface{}, def OutlineMode) (OutlineMode, error) {
+	mode, err := parseStringOnly(jsonMap, "outline", string(def),
+		string(OutlineModeNone), string(OutlineModeChrome), string(OutlineModeHeadings))
+
+	return OutlineMode(mode), err
+}
+
+// markHeadingsScript prepends an anchor to every visible h1, h2 and h3 and
+// links to them from a hidden element. Chrome writes a named destination for
+// every element that a link of the document points to, which tells on which
+// page the heading is printed.
+const markHeadingsScript = `(function () {
+	var headings = [];
+	var links = document.createElement('div');
+	links.hidden = true;
+
+	document.querySelectorAll('h1, h2, h3').forEach(function (heading, i) {
+		var title = (heading.innerText || '').replace(/\s+/g, ' ').trim();
+
+		if (!title || !heading.getClientRects().length) {
+			return;
+		}
+
+		var anchor = document.createElement('a');
+		anchor.id = 'pdfire-heading-' + i;
+		heading.insertBefore(anchor, heading.firstChild);
+
+		var link = document.createElement('a');
+		link.href = '#' + anchor.id;
+		links.appendChild(link);
+
+		headings.push({level: Number(heading.tagName.charAt(1)), title: title, dest: anchor.id});
+	});
+
+	document.body.appendChild(links);
+
+	return headings;
+})()`
+
+// heading is a heading marked by markHeadingsScript.
+type heading struct {
+	Level int    `json:"level"`
+	Title string `json:"title"`
+	Dest  string `json:"dest"`
+}
+
+func markHeadings(ctx context.Context) ([]*heading, error) {
+	var headings []*heading
+
+	if err := chromedp.Evaluate(markHeadingsScript, &headings).Do(ctx); err != nil {
+		return nil, err
+	}
+
+	return headings, nil
+}
+
+// headingOutline collects the bookmarks of the headings of the printed
+// documents of a conversion.
+type headingOutline struct {
+	bookmarks []*Bookmark
+	// pages is the number of pages of the documents printed so far.
+	pages int
+	// stack are the last bookmarks of each level, to nest the next ones.
+	stack []*outlineLevel
+}
+
+type outlineLevel struct {
+	level    int
+	bookmark *Bookmark
+}
+
+// addDocument adds the headings of a document, which was printed as one or
+// more PDFs, e.g. for the segments of its page ranges. Headings without a
+// destination in the PDFs, e.g. on pages that weren't printed, are skipped.
+func (o *headingOutline) addDocument(headings []*heading, bufs []*bytes.Buffer) error {
+	pages := make(map[string]int)
+	offset := o.pages
+
+	for _, buf := range bufs {
+		doc, err := readPDF(bytes.NewReader(buf.Bytes()))
+
+		if err != nil {
+			return err
+		}
+
+		dests, err := namedDestinations(doc)
+
+		if err != nil {
+			return err
+		}
+
+		for name, page := range dests {
+			if _, ok := pages[name]; !ok {
+				pages[name] = offset + page
+			}
+		}
+
+		printed, err := doc.pages()
+
+		if err != nil {
+			return err
+		}
+
+		offset += len(printed)
+	}
+
+	for _, h := range headings {
+		if page, ok := pages[h.Dest]; ok {
+			o.add(h.Level, &Bookmark{Title: h.Title, Page: page})
+		}
+	}
+
+	o.pages = offset
+
+	return nil
+}
+
+// add nests a bookmark below the last bookmark of a lower level.
+func (o *headingOutline) add(level int, bookmark *Bookmark) {
+	for len(o.stack) > 0 && o.stack[len(o.stack)-1].level >= level {
+		o.stack = o.stack[:len(o.stack)-1]
+	}
+
+	if len(o.stack) == 0 {
+		o.bookmarks = append(o.bookmarks, bookmark)
+	} else {
+		parent := o.stack[len(o.stack)-1].bookmark
+		parent.Children = append(parent.Children, bookmark)
+	}
+
+	o.stack = append(o.stack, &outlineLevel{level: level, bookmark: bookmark})
+}
+
+// addBookmarks adds the outline to the concatenated PDF of the documents,
+// which is written with the pdfcpu configuration cfg.
+func (o *headingOutline) addBookmarks(buf *bytes.Buffer, cfg *pdfcpu.Configuration) (*bytes.Buffer, error) {
+	if len(o.bookmarks) == 0 {
+		return buf, nil
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, buf.Len()+1024))
+
+	if err := addBookmarks(buf, out, o.bookmarks, cfg); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// namedDestinations returns the numbers of the pages, starting at 1, of the
+// named destinations of a PDF. Both the Dests dictionary of PDF 1.1 and the
+// Dests name tree are read.
+func namedDestinations(doc *pdfDocument) (map[string]int, error) {
+	pages, err := doc.pages()
+
+	if err != nil {
+		return nil, err
+	}
+
+	numbers := make(map[pdfRef]int, len(pages))
+
+	for i, ref := range pages {
+		numbers[ref] = i + 1
+	}
+
+	catalog, err := doc.dict(doc.trailer["Root"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	dests := make(map[string]int)
+
+	add := func(name string, dest interface{}) error {
+		dest, err := doc.resolve(dest)
+
+		if err != nil {
+			return err
+		}
+
+		if d, ok := dest.(pdfDict); ok {
+			if dest, err = doc.resolve(d["D"]); err != nil {
+				return err
+			}
+		}
+
+		if arr, ok := dest.([]interface{}); ok && len(arr) > 0 {
+			if ref, ok := arr[0].(pdfRef); ok && numbers[ref] > 0 {
+				dests[name] = numbers[ref]
+			}
+		}
+
+		return nil
+	}
+
+	if _, ok := catalog["Dests"]; ok {
+		dict, err := doc.dict(catalog["Dests"])
+
+		if err != nil {
+			return nil, err
+		}
+
+		for name, dest := range dict {
+			if err := add(name, dest); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if _, ok := catalog["Names"]; !ok {
+		return dests, nil
+	}
+
+	names, err := doc.dict(catalog["Names"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := names["Dests"]; !ok {
+		return dests, nil
+	}
+
+	visited := make(map[pdfRef]bool)
+
+	var walk func(node interface{}) error
+	walk = func(node interface{}) error {
+		if ref, ok := node.(pdfRef); ok {
+			if visited[ref] {
+				return ErrInvalidPDF
+			}
+
+			visited[ref] = true
+		}
+
+		tree, err := doc.dict(node)
+
+		if err != nil {
+			return err
+		}
+
+		flat, err := doc.resolve(tree["Names"])
+
+		if err != nil {
+			return err
+		}
+
+		arr, _ := flat.([]interface{})
+
+		for i := 0; i+1 < len(arr); i += 2 {
+			if name, ok := arr[i].(pdfString); ok {
+				if err := add(string(name), arr[i+1]); err != nil {
+					return err
+				}
+			}
+		}
+
+		kids, err := doc.resolve(tree["Kids"])
+
+		if err != nil {
+			return err
+		}
+
+		arr, _ = kids.([]interface{})
+
+		for _, kid := range arr {
+			if err := walk(kid); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := walk(names["Dests"]); err != nil {
+		return nil, err
+	}
+
+	return dests, nil
+}
@@ -0,0 +1,262 @@
+package pdfire
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+var (
+	// ErrObjectStreamsWithoutXRefStreams is returned when object streams are
+	// turned on and cross-reference streams are turned off. Objects in object
+	// streams can only be referenced by a cross-reference stream.
+	ErrObjectStreamsWithoutXRefStreams = errors.New("object streams require xref streams")
+)
+
+var (
+	// StreamModeAuto keeps the structure of the writer: Chrome writes neither
+	// object streams nor cross-reference streams, encryption writes both.
+	StreamModeAuto = StreamMode("auto")
+	// StreamModeOn rewrites the PDF with the streams.
+	StreamModeOn = StreamMode("on")
+	// StreamModeOff rewrites the PDF without the streams.
+	StreamModeOff = StreamMode("off")
+)
+
+// StreamMode decides whether a PDF is written with object streams or
+// cross-reference streams, which some legacy viewers can't read.
+type StreamMode string
+
+// PDFVersions are the versions accepted by PDFVersion.
+var PDFVersions = []string{"1.3", "1.4", "1.5", "1.6", "1.7", "2.0"}
+
+// PDFVersionError is returned when the requested PDF version doesn't support
+// a feature of the output.
+type PDFVersionError struct {
+	Version string
+	Feature string
+}
+
+func (e *PDFVersionError) Error() string {
+	return fmt.Sprintf("PDF version %s does not support %s.", e.Version, e.Feature)
+}
+
+var pdfHeader = regexp.MustCompile(`^%PDF-\d\.\d`)
+
+func parsePDFVersion(jsonMap map[string]interface{}, def string) (string, error) {
+	return parseStringOnly(jsonMap, "pdfVersion", def, append([]string{""}, PDFVersions...)...)
+}
+
+func parseStreamMode(jsonMap map[string]interface{}, key string, def StreamMode) (StreamMode, error) {
+	mode, err := parseStringOnly(jsonMap, key, string(def),
+		string(StreamModeAuto), string(StreamModeOn), string(StreamModeOff))
+
+	return StreamMode(mode), err
+}
+
+// validateOutput checks that the write settings of the options fit together.
+func validateOutput(options *PostProcessOptions) error {
+	if options.PDFVersion != "" && !pdfVersionAllowed(options.PDFVersion) {
+		return &ParseError{Key: "pdfVersion", Value: options.PDFVersion}
+	}
+
+	if options.ArchiveFormat != "" {
+		if _, err := archivePart(options.ArchiveFormat); err != nil {
+			return err
+		}
+
+		if options.OwnerPassword != "" || options.UserPassword != "" {
+			return ErrArchiveEncryption
+		}
+
+		if options.archiveLegacy() && (options.ObjectStreams == StreamModeOn || options.XRefStreams == StreamModeOn) {
+			return ErrArchiveStreams
+		}
+	}
+
+	if options.Deterministic && (options.OwnerPassword != "" || options.UserPassword != "") {
+		return ErrDeterministicEncryption
+	}
+
+	if options.Signature != nil {
+		if options.OwnerPassword != "" || options.UserPassword != "" {
+			return ErrSignatureEncryption
+		}
+
+		if options.Deterministic {
+			return ErrDeterministicSignature
+		}
+
+		if _, err := options.Signature.signer(); err != nil {
+			return err
+		}
+	}
+
+	if options.ObjectStreams == StreamModeOn && options.XRefStreams == StreamModeOff {
+		return ErrObjectStreamsWithoutXRefStreams
+	}
+
+	if options.PDFVersion == "" {
+		return nil
+	}
+
+	if options.PDFVersion < "1.5" {
+		if options.ObjectStreams == StreamModeOn {
+			return &PDFVersionError{Version: options.PDFVersion, Feature: "object streams"}
+		}
+
+		if options.XRefStreams == StreamModeOn {
+			return &PDFVersionError{Version: options.PDFVersion, Feature: "xref streams"}
+		}
+	}
+
+	if options.PDFVersion < "1.7" && (options.OwnerPassword != "" || options.UserPassword != "") {
+		return &PDFVersionError{Version: options.PDFVersion, Feature: "AES-256 encryption"}
+	}
+
+	return nil
+}
+
+func pdfVersionAllowed(version string) bool {
+	for _, v := range PDFVersions {
+		if v == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rewrites reports whether the PDF has to be rewritten for the stream modes or
+// the optimization. Encryption always rewrites and optimizes the PDF.
+func (o *PostProcessOptions) rewrites() bool {
+	return o.Optimize || isExplicit(o.ObjectStreams) || isExplicit(o.XRefStreams)
+}
+
+func isExplicit(mode StreamMode) bool {
+	return mode == StreamModeOn || mode == StreamModeOff
+}
+
+// archiveLegacy reports whether the archive format is PDF/A-1, which is based
+// on PDF 1.4.
+func (o *PostProcessOptions) archiveLegacy() bool {
+	part, err := archivePart(o.ArchiveFormat)
+
+	return err == nil && part == 1
+}
+
+// configureWrite applies the stream modes to a pdfcpu configuration. Streams
+// in auto mode are turned off for versions that don't support them and for
+// PDF/A-1. Object streams in auto mode are also turned off for deterministic
+// PDFs, as the dates of compressed objects can't be normalized.
+func (o *PostProcessOptions) configureWrite(cfg *pdfcpu.Configuration) {
+	legacy := (o.PDFVersion != "" && o.PDFVersion < "1.5") || o.archiveLegacy()
+
+	switch {
+	case o.ObjectStreams == StreamModeOn:
+		cfg.WriteObjectStream = true
+	case o.ObjectStreams == StreamModeOff || legacy || o.Deterministic:
+		cfg.WriteObjectStream = false
+	}
+
+	switch {
+	case o.XRefStreams == StreamModeOn:
+		cfg.WriteXRefStream = true
+	case o.XRefStreams == StreamModeOff || legacy:
+		cfg.WriteXRefStream = false
+	}
+
+	// Object streams can't be written without an xref stream.
+	if cfg.WriteObjectStream && !cfg.WriteXRefStream {
+		cfg.WriteObjectStream = false
+	}
+}
+
+// rewrite optimizes the PDF and writes it again with the stream modes of the
+// options.
+func rewrite(buf *bytes.Buffer, options *PostProcessOptions) (*bytes.Buffer, error) {
+	cfg := pdfcpu.NewDefaultConfiguration()
+	cfg.Cmd = pdfcpu.OPTIMIZE
+	options.configureWrite(cfg)
+
+	out := bytes.NewBuffer([]byte{})
+
+	if err := api.Optimize(bytes.NewReader(buf.Bytes()), out, cfg); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// setPDFVersion declares the version in the header of the PDF. A version in
+// the catalog, which overrides the header, is replaced as well.
+func setPDFVersion(buf *bytes.Buffer, version string) (*bytes.Buffer, error) {
+	data := buf.Bytes()
+
+	if !pdfHeader.Match(data) {
+		return nil, ErrInvalidPDF
+	}
+
+	copy(data[len("%PDF-"):], version)
+
+	doc, err := readPDF(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := doc.trailer["Encrypt"]; ok {
+		return buf, nil
+	}
+
+	root := doc.trailer["Root"].(pdfRef)
+	catalog, err := doc.dict(root)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := catalog["Version"]; !ok {
+		return buf, nil
+	}
+
+	u, err := doc.update()
+
+	if err != nil {
+		return nil, err
+	}
+
+	updated := pdfDict{}
+
+	for key, v := range catalog {
+		updated[key] = v
+	}
+
+	updated["Version"] = pdfName(version)
+	u.set(root, updated)
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)+256))
+
+	if err := u.write(out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// writeConfiguration returns the pdfcpu configuration of the watermarks and
+// concatenations of deterministic PDFs, or nil for the default one.
+func (o *PostProcessOptions) writeConfiguration() *pdfcpu.Configuration {
+	if !o.Deterministic {
+		return nil
+	}
+
+	cfg := pdfcpu.NewDefaultConfiguration()
+	o.configureWrite(cfg)
+
+	return cfg
+}
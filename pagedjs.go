@@ -0,0 +1,88 @@
+package pdfire
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// PagedJSURL is the URL of the Paged.js polyfill that is injected into pages
+// converted with the PagedJS option.
+var PagedJSURL = "https://unpkg.com/pagedjs@0.1.43/dist/paged.polyfill.js"
+
+// pagedJSConfig keeps Paged.js from rendering the page on load, so it renders
+// the page as it's printed, i.e. after the selectors have been applied.
+const pagedJSConfig = `window.PagedConfig = { auto: false };`
+
+// pagedJSPreviewScript renders the page with Paged.js and resolves when it's done.
+const pagedJSPreviewScript = `window.PagedPolyfill.preview().then(function () { return true; })`
+
+// PagedJSError is returned when the Paged.js polyfill cannot be loaded.
+type PagedJSError struct {
+	Err error
+}
+
+func (e *PagedJSError) Error() string {
+	return fmt.Sprintf("Could not load Paged.js (%v).", e.Err)
+}
+
+var pagedJS struct {
+	sync.Mutex
+	url    string
+	script string
+}
+
+// loadPagedJS returns the source of the Paged.js polyfill. It's loaded once
+// and injected as a script, so it also works on pages whose content security
+// policy forbids external scripts and in offline mode.
+func loadPagedJS(ctx context.Context) (string, error) {
+	pagedJS.Lock()
+	defer pagedJS.Unlock()
+
+	if pagedJS.script != "" && pagedJS.url == PagedJSURL {
+		return pagedJS.script, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, PagedJSURL, nil)
+
+	if err != nil {
+		return "", &PagedJSError{Err: err}
+	}
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+
+	if err != nil {
+		return "", &PagedJSError{Err: err}
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", &PagedJSError{Err: fmt.Errorf("unexpected status %d", res.StatusCode)}
+	}
+
+	data, err := ioutil.ReadAll(res.Body)
+
+	if err != nil {
+		return "", &PagedJSError{Err: err}
+	}
+
+	pagedJS.url = PagedJSURL
+	pagedJS.script = string(data)
+
+	return pagedJS.script, nil
+}
+
+// renderPagedJS lays out the page with Paged.js and waits until it's done.
+func renderPagedJS(ctx context.Context) error {
+	var done bool
+
+	return chromedp.Evaluate(pagedJSPreviewScript, &done, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+		return p.WithAwaitPromise(true)
+	}).Do(ctx)
+}
@@ -0,0 +1,1120 @@
+package pdfire
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+var (
+	// ErrInvalidPDF is returned when a PDF cannot be read.
+	ErrInvalidPDF = errors.New("invalid pdf")
+	// ErrEncryptedPDF is returned when an encrypted PDF would have to be modified.
+	ErrEncryptedPDF = errors.New("encrypted pdfs cannot be modified")
+)
+
+// The PDF object types returned by the parser. Dictionaries, arrays, integers,
+// reals, booleans and null are represented by pdfDict, []interface{}, int64,
+// float64, bool and nil.
+type (
+	pdfDict   map[string]interface{}
+	pdfName   string
+	pdfString []byte
+	pdfRef    struct{ num, gen int }
+	pdfStream struct {
+		dict pdfDict
+		data []byte
+	}
+)
+
+// pdfDocument reads the object structure of a PDF and appends incremental
+// updates to it, leaving the original bytes untouched.
+type pdfDocument struct {
+	data       []byte
+	offsets    map[int]int64
+	compressed map[int][2]int
+	trailer    pdfDict
+	startxref  int64
+	xrefStream bool
+	objStms    map[int]*pdfObjStm
+	// depth counts the nested reads of objects, which a hostile PDF can make
+	// refer to each other, e.g. by the length of a stream.
+	depth int
+}
+
+// maxObjectDepth limits the nested reads of objects.
+const maxObjectDepth = 32
+
+type pdfObjStm struct {
+	data    []byte
+	first   int64
+	offsets []int64
+}
+
+// PageCount returns the number of pages of a PDF.
+func PageCount(r io.Reader) (int, error) {
+	doc, err := readPDF(r)
+
+	if err != nil {
+		return 0, err
+	}
+
+	pages, err := doc.pages()
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(pages), nil
+}
+
+func readPDF(r io.Reader) (*pdfDocument, error) {
+	data, err := ioutil.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	d := &pdfDocument{
+		data:       data,
+		offsets:    make(map[int]int64),
+		compressed: make(map[int][2]int),
+		objStms:    make(map[int]*pdfObjStm),
+	}
+
+	idx := bytes.LastIndex(data, []byte("startxref"))
+
+	if idx < 0 {
+		return nil, ErrInvalidPDF
+	}
+
+	p := &pdfParser{data: data, pos: idx + len("startxref")}
+	offset, ok := p.object().(int64)
+
+	if !ok || offset < 0 || offset >= int64(len(data)) {
+		return nil, ErrInvalidPDF
+	}
+
+	d.startxref = offset
+	seen := make(map[int64]bool)
+
+	for !seen[offset] {
+		seen[offset] = true
+		trailer, err := d.readXRef(offset)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if d.trailer == nil {
+			d.trailer = trailer
+		}
+
+		prev, ok := trailer["Prev"].(int64)
+
+		if !ok {
+			break
+		}
+
+		offset = prev
+	}
+
+	if _, ok := d.trailer["Root"].(pdfRef); !ok {
+		return nil, ErrInvalidPDF
+	}
+
+	return d, nil
+}
+
+// readXRef reads a cross-reference section and returns its trailer. Entries
+// of newer sections, which are read first, take precedence.
+func (d *pdfDocument) readXRef(offset int64) (pdfDict, error) {
+	p := &pdfParser{data: d.data, pos: int(offset)}
+
+	if p.keyword() != "xref" {
+		if offset == d.startxref {
+			d.xrefStream = true
+		}
+
+		return d.readXRefStream(offset)
+	}
+
+	for {
+		start, ok := p.object().(int64)
+
+		if !ok {
+			break
+		}
+
+		count, ok := p.object().(int64)
+
+		if !ok {
+			return nil, ErrInvalidPDF
+		}
+
+		for i := int64(0); i < count; i++ {
+			off, ok1 := p.object().(int64)
+			_, ok2 := p.object().(int64)
+			kind := p.keyword()
+
+			if !ok1 || !ok2 || (kind != "n" && kind != "f") {
+				return nil, ErrInvalidPDF
+			}
+
+			d.addEntry(int(start+i), kind == "n", off, 0, 0)
+		}
+	}
+
+	// The loop above stops at the "trailer" keyword.
+	trailer, ok := p.object().(pdfDict)
+
+	if !ok {
+		return nil, ErrInvalidPDF
+	}
+
+	if stm, ok := trailer["XRefStm"].(int64); ok {
+		if _, err := d.readXRefStream(stm); err != nil {
+			return nil, err
+		}
+	}
+
+	return trailer, nil
+}
+
+func (d *pdfDocument) readXRefStream(offset int64) (pdfDict, error) {
+	obj, err := d.objectAt(offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	stream, ok := obj.(*pdfStream)
+
+	if !ok {
+		return nil, ErrInvalidPDF
+	}
+
+	data, err := d.decode(stream)
+
+	if err != nil {
+		return nil, err
+	}
+
+	w, ok := stream.dict["W"].([]interface{})
+
+	if !ok || len(w) != 3 {
+		return nil, ErrInvalidPDF
+	}
+
+	widths := make([]int, 3)
+	rowLen := 0
+
+	for i, v := range w {
+		n, ok := v.(int64)
+
+		if !ok || n < 0 || n > 8 {
+			return nil, ErrInvalidPDF
+		}
+
+		widths[i] = int(n)
+		rowLen += int(n)
+	}
+
+	if rowLen == 0 {
+		return nil, ErrInvalidPDF
+	}
+
+	size, _ := stream.dict["Size"].(int64)
+	index := []interface{}{int64(0), size}
+
+	if i, ok := stream.dict["Index"].([]interface{}); ok {
+		index = i
+	}
+
+	pos := 0
+
+	for i := 0; i+1 < len(index); i += 2 {
+		start, ok1 := index[i].(int64)
+		count, ok2 := index[i+1].(int64)
+
+		if !ok1 || !ok2 {
+			return nil, ErrInvalidPDF
+		}
+
+		for n := int64(0); n < count; n++ {
+			if pos+rowLen > len(data) {
+				return nil, ErrInvalidPDF
+			}
+
+			fields := make([]int64, 3)
+
+			for f, width := range widths {
+				for b := 0; b < width; b++ {
+					fields[f] = fields[f]<<8 | int64(data[pos])
+					pos++
+				}
+			}
+
+			// The type defaults to 1 if its field is omitted.
+			if widths[0] == 0 {
+				fields[0] = 1
+			}
+
+			switch fields[0] {
+			case 0:
+				d.addEntry(int(start+n), false, 0, 0, 0)
+			case 1:
+				d.addEntry(int(start+n), true, fields[1], 0, 0)
+			case 2:
+				d.addEntry(int(start+n), true, -1, int(fields[1]), int(fields[2]))
+			}
+		}
+	}
+
+	return stream.dict, nil
+}
+
+func (d *pdfDocument) addEntry(num int, used bool, offset int64, stream, index int) {
+	if _, ok := d.offsets[num]; ok {
+		return
+	}
+
+	if _, ok := d.compressed[num]; ok {
+		return
+	}
+
+	switch {
+	case !used:
+		d.offsets[num] = -1
+	case offset >= 0:
+		d.offsets[num] = offset
+	default:
+		d.compressed[num] = [2]int{stream, index}
+	}
+}
+
+// object returns the object with the given number.
+func (d *pdfDocument) object(num int) (interface{}, error) {
+	if d.depth >= maxObjectDepth {
+		return nil, ErrInvalidPDF
+	}
+
+	d.depth++
+	defer func() { d.depth-- }()
+
+	if loc, ok := d.compressed[num]; ok {
+		return d.compressedObject(loc[0], loc[1])
+	}
+
+	offset, ok := d.offsets[num]
+
+	if !ok || offset < 0 {
+		return nil, nil
+	}
+
+	return d.objectAt(offset)
+}
+
+func (d *pdfDocument) objectAt(offset int64) (interface{}, error) {
+	if offset < 0 || offset >= int64(len(d.data)) {
+		return nil, ErrInvalidPDF
+	}
+
+	p := &pdfParser{data: d.data, pos: int(offset)}
+	_, ok1 := p.object().(int64)
+	_, ok2 := p.object().(int64)
+
+	if !ok1 || !ok2 || p.keyword() != "obj" {
+		return nil, ErrInvalidPDF
+	}
+
+	obj := p.object()
+	dict, ok := obj.(pdfDict)
+
+	if !ok {
+		return obj, nil
+	}
+
+	save := p.pos
+
+	if p.keyword() != "stream" {
+		p.pos = save
+		return dict, nil
+	}
+
+	// The stream data starts after the end of line following the keyword.
+	if p.pos < len(d.data) && d.data[p.pos] == '\r' {
+		p.pos++
+	}
+
+	if p.pos < len(d.data) && d.data[p.pos] == '\n' {
+		p.pos++
+	}
+
+	length, err := d.resolve(dict["Length"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	n, ok := length.(int64)
+
+	if !ok || n < 0 || n > int64(len(d.data)-p.pos) {
+		return nil, ErrInvalidPDF
+	}
+
+	return &pdfStream{
+		dict: dict,
+		data: d.data[p.pos : p.pos+int(n)],
+	}, nil
+}
+
+func (d *pdfDocument) compressedObject(stream, index int) (interface{}, error) {
+	stm, ok := d.objStms[stream]
+
+	if !ok {
+		obj, err := d.object(stream)
+
+		if err != nil {
+			return nil, err
+		}
+
+		s, ok := obj.(*pdfStream)
+
+		if !ok {
+			return nil, ErrInvalidPDF
+		}
+
+		data, err := d.decode(s)
+
+		if err != nil {
+			return nil, err
+		}
+
+		n, _ := s.dict["N"].(int64)
+		first, _ := s.dict["First"].(int64)
+		stm = &pdfObjStm{data: data, first: first}
+		p := &pdfParser{data: data}
+
+		for i := int64(0); i < n; i++ {
+			_, ok1 := p.object().(int64)
+			off, ok2 := p.object().(int64)
+
+			if !ok1 || !ok2 {
+				return nil, ErrInvalidPDF
+			}
+
+			stm.offsets = append(stm.offsets, off)
+		}
+
+		d.objStms[stream] = stm
+	}
+
+	if index < 0 || index >= len(stm.offsets) {
+		return nil, ErrInvalidPDF
+	}
+
+	pos := stm.first + stm.offsets[index]
+
+	if stm.first < 0 || stm.offsets[index] < 0 || pos >= int64(len(stm.data)) {
+		return nil, ErrInvalidPDF
+	}
+
+	p := &pdfParser{data: stm.data, pos: int(pos)}
+
+	return p.object(), nil
+}
+
+// resolve follows an indirect reference.
+func (d *pdfDocument) resolve(obj interface{}) (interface{}, error) {
+	for i := 0; i < 32; i++ {
+		ref, ok := obj.(pdfRef)
+
+		if !ok {
+			return obj, nil
+		}
+
+		var err error
+
+		if obj, err = d.object(ref.num); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, ErrInvalidPDF
+}
+
+func (d *pdfDocument) dict(obj interface{}) (pdfDict, error) {
+	obj, err := d.resolve(obj)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := obj.(type) {
+	case pdfDict:
+		return v, nil
+	case *pdfStream:
+		return v.dict, nil
+	}
+
+	return nil, ErrInvalidPDF
+}
+
+// decode returns the decoded data of a stream. Only the FlateDecode filter and
+// the PNG predictors used by cross-reference streams are supported.
+func (d *pdfDocument) decode(s *pdfStream) ([]byte, error) {
+	filter, _ := d.resolve(s.dict["Filter"])
+
+	if arr, ok := filter.([]interface{}); ok && len(arr) == 1 {
+		filter = arr[0]
+	}
+
+	switch filter {
+	case nil:
+		return s.data, nil
+	case pdfName("FlateDecode"):
+	default:
+		return nil, ErrInvalidPDF
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(s.data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(zr)
+
+	if err != nil && len(data) == 0 {
+		return nil, err
+	}
+
+	parms, _ := d.dict(s.dict["DecodeParms"])
+	predictor, _ := parms["Predictor"].(int64)
+
+	if predictor < 10 {
+		return data, nil
+	}
+
+	columns, ok := parms["Columns"].(int64)
+
+	if !ok {
+		columns = 1
+	}
+
+	return unpredictPNG(data, int(columns))
+}
+
+func unpredictPNG(data []byte, columns int) ([]byte, error) {
+	if columns < 1 || columns > len(data) {
+		return nil, ErrInvalidPDF
+	}
+
+	rowLen := columns + 1
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, columns)
+
+	for pos := 0; pos+rowLen <= len(data); pos += rowLen {
+		row := make([]byte, columns)
+		copy(row, data[pos+1:pos+rowLen])
+
+		switch data[pos] {
+		case 0:
+		case 1:
+			for i := 1; i < columns; i++ {
+				row[i] += row[i-1]
+			}
+		case 2:
+			for i := range row {
+				row[i] += prev[i]
+			}
+		default:
+			return nil, ErrInvalidPDF
+		}
+
+		out = append(out, row...)
+		prev = row
+	}
+
+	return out, nil
+}
+
+// pages returns the references of all pages, in order.
+func (d *pdfDocument) pages() ([]pdfRef, error) {
+	catalog, err := d.dict(d.trailer["Root"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	root, ok := catalog["Pages"].(pdfRef)
+
+	if !ok {
+		return nil, ErrInvalidPDF
+	}
+
+	pages := make([]pdfRef, 0)
+	visited := make(map[pdfRef]bool)
+
+	var walk func(ref pdfRef) error
+	walk = func(ref pdfRef) error {
+		if visited[ref] {
+			return ErrInvalidPDF
+		}
+
+		visited[ref] = true
+		node, err := d.dict(ref)
+
+		if err != nil {
+			return err
+		}
+
+		if node["Type"] != pdfName("Pages") {
+			pages = append(pages, ref)
+			return nil
+		}
+
+		kids, err := d.resolve(node["Kids"])
+
+		if err != nil {
+			return err
+		}
+
+		arr, _ := kids.([]interface{})
+
+		for _, kid := range arr {
+			kidRef, ok := kid.(pdfRef)
+
+			if !ok {
+				return ErrInvalidPDF
+			}
+
+			if err := walk(kidRef); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := walk(root); err != nil {
+		return nil, err
+	}
+
+	return pages, nil
+}
+
+// size returns the number of objects of the document, including the free
+// object 0. New objects are numbered from it.
+func (d *pdfDocument) size() int {
+	size, _ := d.trailer["Size"].(int64)
+
+	for num := range d.offsets {
+		if num >= int(size) {
+			size = int64(num + 1)
+		}
+	}
+
+	for num := range d.compressed {
+		if num >= int(size) {
+			size = int64(num + 1)
+		}
+	}
+
+	return int(size)
+}
+
+// pdfUpdate collects the objects of an incremental update.
+type pdfUpdate struct {
+	doc     *pdfDocument
+	next    int
+	objects map[int]interface{}
+	trailer pdfDict
+}
+
+func (d *pdfDocument) update() (*pdfUpdate, error) {
+	if _, ok := d.trailer["Encrypt"]; ok {
+		return nil, ErrEncryptedPDF
+	}
+
+	return &pdfUpdate{
+		doc:     d,
+		next:    d.size(),
+		objects: make(map[int]interface{}),
+		trailer: make(pdfDict),
+	}, nil
+}
+
+// add adds a new object and returns its reference.
+func (u *pdfUpdate) add(obj interface{}) pdfRef {
+	ref := pdfRef{num: u.next}
+	u.next++
+	u.objects[ref.num] = obj
+
+	return ref
+}
+
+// set replaces an existing object.
+func (u *pdfUpdate) set(ref pdfRef, obj interface{}) {
+	u.objects[ref.num] = obj
+}
+
+// write writes the original document followed by the update.
+func (u *pdfUpdate) write(w io.Writer) error {
+	buf := bytes.NewBuffer(make([]byte, 0, len(u.doc.data)+4096))
+	buf.Write(u.doc.data)
+
+	if len(u.doc.data) > 0 && u.doc.data[len(u.doc.data)-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+
+	nums := make([]int, 0, len(u.objects))
+
+	for num := range u.objects {
+		nums = append(nums, num)
+	}
+
+	sort.Ints(nums)
+	offsets := make(map[int]int64, len(nums)+1)
+
+	for _, num := range nums {
+		offsets[num] = int64(buf.Len())
+		fmt.Fprintf(buf, "%d 0 obj\n", num)
+		writePDFObject(buf, u.objects[num])
+		buf.WriteString("\nendobj\n")
+	}
+
+	trailer := pdfDict{
+		"Size": int64(u.next),
+		"Root": u.doc.trailer["Root"],
+		"Prev": u.doc.startxref,
+	}
+
+	for _, key := range []string{"Info", "ID"} {
+		if v, ok := u.doc.trailer[key]; ok {
+			trailer[key] = v
+		}
+	}
+
+	for key, v := range u.trailer {
+		trailer[key] = v
+	}
+
+	xref := int64(buf.Len())
+
+	if u.doc.xrefStream {
+		num := u.next
+		trailer["Size"] = int64(num + 1)
+		offsets[num] = xref
+		nums = append(nums, num)
+
+		index := make([]interface{}, 0, len(nums)*2)
+		entries := bytes.NewBuffer(nil)
+
+		for _, n := range nums {
+			index = append(index, int64(n), int64(1))
+			off := offsets[n]
+			entries.Write([]byte{1, byte(off >> 24), byte(off >> 16), byte(off >> 8), byte(off), 0, 0})
+		}
+
+		trailer["Type"] = pdfName("XRef")
+		trailer["W"] = []interface{}{int64(1), int64(4), int64(2)}
+		trailer["Index"] = index
+
+		fmt.Fprintf(buf, "%d 0 obj\n", num)
+		writePDFObject(buf, &pdfStream{dict: trailer, data: entries.Bytes()})
+		buf.WriteString("\nendobj\n")
+	} else {
+		buf.WriteString("xref\n")
+
+		for _, n := range nums {
+			fmt.Fprintf(buf, "%d 1\n%010d 00000 n\r\n", n, offsets[n])
+		}
+
+		buf.WriteString("trailer\n")
+		writePDFObject(buf, trailer)
+		buf.WriteString("\n")
+	}
+
+	fmt.Fprintf(buf, "startxref\n%d\n%%%%EOF\n", xref)
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+func writePDFObject(buf *bytes.Buffer, obj interface{}) {
+	switch v := obj.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case int:
+		buf.WriteString(strconv.Itoa(v))
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	case pdfName:
+		buf.WriteByte('/')
+
+		for _, c := range []byte(v) {
+			if c <= ' ' || c > '~' || bytes.IndexByte([]byte("#/%()<>[]{}"), c) >= 0 {
+				fmt.Fprintf(buf, "#%02X", c)
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	case pdfString:
+		fmt.Fprintf(buf, "<%X>", []byte(v))
+	case pdfRef:
+		fmt.Fprintf(buf, "%d %d R", v.num, v.gen)
+	case []interface{}:
+		buf.WriteByte('[')
+
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+
+			writePDFObject(buf, item)
+		}
+
+		buf.WriteByte(']')
+	case pdfDict:
+		keys := make([]string, 0, len(v))
+
+		for key := range v {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+		buf.WriteString("<<")
+
+		for _, key := range keys {
+			writePDFObject(buf, pdfName(key))
+			buf.WriteByte(' ')
+			writePDFObject(buf, v[key])
+		}
+
+		buf.WriteString(">>")
+	case *pdfStream:
+		dict := make(pdfDict, len(v.dict)+1)
+
+		for key, val := range v.dict {
+			dict[key] = val
+		}
+
+		dict["Length"] = int64(len(v.data))
+		writePDFObject(buf, dict)
+		buf.WriteString("\nstream\n")
+		buf.Write(v.data)
+		buf.WriteString("\nendstream")
+	}
+}
+
+// pdfText encodes a text string, using UTF-16 if it isn't plain ASCII.
+func pdfText(s string) pdfString {
+	ascii := true
+
+	for _, r := range s {
+		if r > '~' {
+			ascii = false
+			break
+		}
+	}
+
+	if ascii {
+		return pdfString(s)
+	}
+
+	b := []byte{0xFE, 0xFF}
+
+	for _, r := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(r>>8), byte(r))
+	}
+
+	return pdfString(b)
+}
+
+// pdfParser parses PDF objects.
+type pdfParser struct {
+	data []byte
+	pos  int
+}
+
+func isPDFWhitespace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isPDFDelimiter(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+func (p *pdfParser) skip() {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+
+		if c == '%' {
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+
+			continue
+		}
+
+		if !isPDFWhitespace(c) {
+			return
+		}
+
+		p.pos++
+	}
+}
+
+// keyword reads a regular token, e.g. "obj" or "trailer".
+func (p *pdfParser) keyword() string {
+	p.skip()
+	start := p.pos
+
+	for p.pos < len(p.data) && !isPDFWhitespace(p.data[p.pos]) && !isPDFDelimiter(p.data[p.pos]) {
+		p.pos++
+	}
+
+	return string(p.data[start:p.pos])
+}
+
+// object parses the next object. It returns nil for null, invalid input and
+// keywords that aren't objects, which leaves the parser behind the keyword.
+func (p *pdfParser) object() interface{} {
+	p.skip()
+
+	if p.pos >= len(p.data) {
+		return nil
+	}
+
+	switch c := p.data[p.pos]; {
+	case c == '/':
+		p.pos++
+		return p.name()
+	case c == '(':
+		p.pos++
+		return p.literalString()
+	case c == '<' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '<':
+		p.pos += 2
+		return p.dictionary()
+	case c == '<':
+		p.pos++
+		return p.hexString()
+	case c == '[':
+		p.pos++
+		return p.array()
+	case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+		p.pos++
+		return nil
+	}
+
+	save := p.pos
+	token := p.keyword()
+
+	switch token {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+
+	if n, err := strconv.ParseInt(token, 10, 64); err == nil {
+		// Two integers followed by "R" are an indirect reference.
+		after := p.pos
+
+		if gen, err := strconv.ParseInt(p.keyword(), 10, 64); err == nil && p.keyword() == "R" {
+			return pdfRef{num: int(n), gen: int(gen)}
+		}
+
+		p.pos = after
+
+		return n
+	}
+
+	if f, err := strconv.ParseFloat(token, 64); err == nil {
+		return f
+	}
+
+	if token == "" {
+		p.pos = save + 1
+	}
+
+	return nil
+}
+
+func (p *pdfParser) name() pdfName {
+	var b []byte
+
+	for p.pos < len(p.data) && !isPDFWhitespace(p.data[p.pos]) && !isPDFDelimiter(p.data[p.pos]) {
+		c := p.data[p.pos]
+
+		if c == '#' && p.pos+2 < len(p.data) {
+			if v, err := strconv.ParseUint(string(p.data[p.pos+1:p.pos+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				p.pos += 3
+				continue
+			}
+		}
+
+		b = append(b, c)
+		p.pos++
+	}
+
+	return pdfName(b)
+}
+
+func (p *pdfParser) literalString() pdfString {
+	var b []byte
+	depth := 1
+
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return pdfString(b)
+			}
+		case '\\':
+			if p.pos >= len(p.data) {
+				return pdfString(b)
+			}
+
+			e := p.data[p.pos]
+			p.pos++
+
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+					p.pos++
+				}
+
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+
+					for i := 0; i < 2 && p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '7'; i++ {
+						v = v*8 + int(p.data[p.pos]-'0')
+						p.pos++
+					}
+
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+
+		b = append(b, c)
+	}
+
+	return pdfString(b)
+}
+
+func (p *pdfParser) hexString() pdfString {
+	var b []byte
+	var digits []byte
+
+	for p.pos < len(p.data) && p.data[p.pos] != '>' {
+		if c := p.data[p.pos]; !isPDFWhitespace(c) {
+			digits = append(digits, c)
+		}
+
+		p.pos++
+	}
+
+	// The string may be unterminated.
+	if p.pos < len(p.data) {
+		p.pos++
+	}
+
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	for i := 0; i < len(digits); i += 2 {
+		v, _ := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		b = append(b, byte(v))
+	}
+
+	return pdfString(b)
+}
+
+func (p *pdfParser) array() []interface{} {
+	arr := make([]interface{}, 0)
+
+	for {
+		p.skip()
+
+		if p.pos >= len(p.data) {
+			return arr
+		}
+
+		if p.data[p.pos] == ']' {
+			p.pos++
+			return arr
+		}
+
+		arr = append(arr, p.object())
+	}
+}
+
+func (p *pdfParser) dictionary() pdfDict {
+	dict := make(pdfDict)
+
+	for {
+		p.skip()
+
+		if p.pos >= len(p.data) {
+			return dict
+		}
+
+		if p.data[p.pos] == '>' {
+			p.pos++
+
+			if p.pos < len(p.data) && p.data[p.pos] == '>' {
+				p.pos++
+			}
+
+			return dict
+		}
+
+		key, ok := p.object().(pdfName)
+
+		if !ok {
+			continue
+		}
+
+		dict[string(key)] = p.object()
+	}
+}
@@ -0,0 +1,399 @@
+package pdfire_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/imkiptoo/pdfire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageCount(t *testing.T) {
+	assert := assert.New(t)
+	wd, _ := os.Getwd()
+	src, _ := ioutil.ReadFile(filepath.Join(wd, "testdata/pages.pdf"))
+
+	pages, err := pdfire.PageCount(bytes.NewReader(src))
+
+	assert.Nil(err)
+	assert.Equal(2, pages)
+
+	pages, err = pdfire.PageCount(strings.NewReader("<html></html>"))
+
+	assert.Equal(0, pages)
+	assert.Equal(pdfire.ErrInvalidPDF, err)
+}
+
+func TestInspectPages(t *testing.T) {
+	assert := assert.New(t)
+	wd, _ := os.Getwd()
+	src, _ := ioutil.ReadFile(filepath.Join(wd, "testdata/pages.pdf"))
+
+	pages, err := pdfire.InspectPages(bytes.NewReader(src))
+
+	assert.Nil(err)
+	assert.Len(pages, 2)
+	assert.Equal(612.0, pages[0].Width)
+	assert.Equal(792.0, pages[0].Height)
+	assert.Len(pages[0].ContentHash, 64)
+}
+
+// pageObjects are the objects of a PDF with two pages of different sizes. The
+// first page draws a compressed content stream.
+func pageObjects() []string {
+	return []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /MediaBox [0 0 612 792] >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595.5 842] >>",
+		string(flateStream("<< /Filter /FlateDecode", []byte("q 1 0 0 1 72 720 cm Q"))),
+	}
+}
+
+// flateStream returns a compressed stream object with the entries of dict,
+// which is left open.
+func flateStream(dict string, data []byte) []byte {
+	compressed := bytes.NewBuffer(nil)
+	zw := zlib.NewWriter(compressed)
+	zw.Write(data)
+	zw.Close()
+
+	return []byte(fmt.Sprintf("%s /Length %d >>\nstream\n%s\nendstream", dict, compressed.Len(), compressed.Bytes()))
+}
+
+// buildPDF numbers the objects from 1 and writes them with a cross-reference
+// table and a trailer with the given extra entries.
+func buildPDF(objects []string, trailer string) []byte {
+	buf := bytes.NewBufferString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f\r\n", len(objects)+1)
+
+	for _, offset := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n\r\n", offset)
+	}
+
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R %s>>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, trailer, xref)
+
+	return buf.Bytes()
+}
+
+// buildXRefStreamPDF numbers the objects from 1 and writes them with a
+// compressed cross-reference stream, which uses the PNG Up predictor. The
+// objects at the packed indexes are stored in a compressed object stream.
+func buildXRefStreamPDF(objects []string, packed ...int) []byte {
+	buf := bytes.NewBufferString("%PDF-1.5\n")
+	stm := len(objects) + 1
+	xrefNum := len(objects) + 2
+	rows := make([][]byte, xrefNum+1)
+	rows[0] = []byte{0, 0, 0, 0, 0, 0xFF, 0xFF}
+	isPacked := make(map[int]bool)
+	header := bytes.NewBuffer(nil)
+	body := bytes.NewBuffer(nil)
+
+	for index, i := range packed {
+		isPacked[i] = true
+		fmt.Fprintf(header, "%d %d ", i+1, body.Len())
+		fmt.Fprintf(body, "%s\n", objects[i])
+		rows[i+1] = []byte{2, 0, 0, byte(stm >> 8), byte(stm), 0, byte(index)}
+	}
+
+	row := func(offset int) []byte {
+		return []byte{1, byte(offset >> 24), byte(offset >> 16), byte(offset >> 8), byte(offset), 0, 0}
+	}
+
+	for i, obj := range objects {
+		if !isPacked[i] {
+			rows[i+1] = row(buf.Len())
+			fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+		}
+	}
+
+	rows[stm] = row(buf.Len())
+	dict := fmt.Sprintf("<< /Type /ObjStm /N %d /First %d /Filter /FlateDecode", len(packed), header.Len())
+	fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", stm, flateStream(dict, append(header.Bytes(), body.Bytes()...)))
+
+	xref := buf.Len()
+	rows[xrefNum] = row(xref)
+	predicted := make([]byte, 0, len(rows)*8)
+	prev := make([]byte, 7)
+
+	for _, r := range rows {
+		predicted = append(predicted, 2)
+
+		for i := range r {
+			predicted = append(predicted, r[i]-prev[i])
+		}
+
+		prev = r
+	}
+
+	dict = fmt.Sprintf("<< /Type /XRef /Size %d /Root 1 0 R /W [1 4 2] /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 7 >>", xrefNum+1)
+	fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\nstartxref\n%d\n%%%%EOF\n", xrefNum, flateStream(dict, predicted), xref)
+
+	return buf.Bytes()
+}
+
+// appendUpdate appends an incremental update replacing the objects, whose
+// trailer points to the cross-reference section of the PDF at prev.
+func appendUpdate(src []byte, objects map[int]string, size, prev int) []byte {
+	buf := bytes.NewBuffer(append([]byte(nil), src...))
+	nums := make([]int, 0, len(objects))
+
+	for num := range objects {
+		nums = append(nums, num)
+	}
+
+	sort.Ints(nums)
+	offsets := make(map[int]int, len(nums))
+
+	for _, num := range nums {
+		offsets[num] = buf.Len()
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", num, objects[num])
+	}
+
+	xref := buf.Len()
+	buf.WriteString("xref\n")
+
+	for _, num := range nums {
+		fmt.Fprintf(buf, "%d 1\n%010d 00000 n\r\n", num, offsets[num])
+	}
+
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R /Prev %d >>\nstartxref\n%d\n%%%%EOF\n", size, prev, xref)
+
+	return buf.Bytes()
+}
+
+// startxref returns the offset of the last cross-reference section.
+func startxref(src []byte) int {
+	fields := bytes.Fields(src[bytes.LastIndex(src, []byte("startxref"))+len("startxref"):])
+	offset, _ := strconv.Atoi(string(fields[0]))
+
+	return offset
+}
+
+func assertPages(assert *assert.Assertions, src []byte) {
+	pages, err := pdfire.InspectPages(bytes.NewReader(src))
+
+	if !assert.Nil(err) || !assert.Len(pages, 2) {
+		return
+	}
+
+	content := sha256.Sum256([]byte("q 1 0 0 1 72 720 cm Q"))
+	empty := sha256.Sum256(nil)
+
+	assert.Equal(&pdfire.PageInfo{Width: 612, Height: 792, ContentHash: hex.EncodeToString(content[:])}, pages[0])
+	assert.Equal(&pdfire.PageInfo{Width: 595.5, Height: 842, ContentHash: hex.EncodeToString(empty[:])}, pages[1])
+}
+
+func TestReadPDFXRefTable(t *testing.T) {
+	assert := assert.New(t)
+
+	assertPages(assert, buildPDF(pageObjects(), ""))
+}
+
+func TestReadPDFXRefStream(t *testing.T) {
+	assert := assert.New(t)
+
+	assertPages(assert, buildXRefStreamPDF(pageObjects()))
+}
+
+func TestReadPDFObjectStream(t *testing.T) {
+	assert := assert.New(t)
+
+	// The catalog, the page tree and the pages are compressed, the content
+	// stream can't be.
+	assertPages(assert, buildXRefStreamPDF(pageObjects(), 0, 1, 2, 3))
+	assertPages(assert, buildXRefStreamPDF(pageObjects(), 3, 1))
+}
+
+func TestReadPDFIncrementalUpdate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, src := range [][]byte{buildPDF(pageObjects(), ""), buildXRefStreamPDF(pageObjects(), 1)} {
+		updated := appendUpdate(src, map[int]string{
+			2: "<< /Type /Pages /Kids [4 0 R 3 0 R 6 0 R] /Count 3 /MediaBox [0 0 612 792] >>",
+			6: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 100 200] >>",
+		}, 10, startxref(src))
+
+		pages, err := pdfire.InspectPages(bytes.NewReader(updated))
+
+		if assert.Nil(err) && assert.Len(pages, 3) {
+			assert.Equal(595.5, pages[0].Width)
+			assert.Equal(612.0, pages[1].Width)
+			assert.Equal(100.0, pages[2].Width)
+		}
+
+		// The original revision is still readable.
+		assertPages(assert, src)
+	}
+}
+
+func TestReadPDFBrokenXRef(t *testing.T) {
+	assert := assert.New(t)
+	src := buildPDF(pageObjects(), "")
+	xref := startxref(src)
+
+	for name, broken := range map[string][]byte{
+		"missing startxref":        bytes.Replace(src, []byte("startxref"), []byte("startxrex"), 1),
+		"startxref past the end":   bytes.Replace(src, []byte(fmt.Sprintf("startxref\n%d", xref)), []byte("startxref\n99999999"), 1),
+		"startxref into an object": bytes.Replace(src, []byte(fmt.Sprintf("startxref\n%d", xref)), []byte("startxref\n9"), 1),
+		"negative startxref":       bytes.Replace(src, []byte(fmt.Sprintf("startxref\n%d", xref)), []byte("startxref\n-1"), 1),
+		"invalid entry type":       bytes.Replace(src, []byte("00000 n\r\n"), []byte("00000 x\r\n"), 1),
+		"truncated section":        src[:xref+30],
+		"missing root":             bytes.Replace(src, []byte("/Root 1 0 R"), []byte("/Roots 1 0 R"), 1),
+		"offset into nothing":      bytes.Replace(src, []byte(fmt.Sprintf("%010d 00000 n", bytes.Index(src, []byte("1 0 obj")))), []byte("0000099999 00000 n"), 1),
+	} {
+		pages, err := pdfire.PageCount(bytes.NewReader(broken))
+
+		assert.Equal(0, pages, name)
+		assert.Equal(pdfire.ErrInvalidPDF, err, name)
+	}
+
+	// A section that refers to itself as its previous section is read once.
+	looped := appendUpdate(src, map[int]string{}, 6, startxref(src))
+	looped = bytes.Replace(looped, []byte(fmt.Sprintf("/Prev %d", xref)), []byte(fmt.Sprintf("/Prev %d", startxref(looped))), 1)
+	pages, err := pdfire.PageCount(bytes.NewReader(looped))
+
+	assert.Equal(0, pages)
+	assert.Equal(pdfire.ErrInvalidPDF, err)
+}
+
+func TestReadPDFHostile(t *testing.T) {
+	assert := assert.New(t)
+
+	for name, objects := range map[string][]string{
+		"page tree cycle": {
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Pages /Kids [2 0 R] /Count 1 >>",
+		},
+		"reference cycle": {
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"3 0 R",
+			"2 0 R",
+		},
+		"stream length of itself": {
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /Contents 4 0 R >>",
+			"<< /Length 4 0 R >>\nstream\nq Q\nendstream",
+		},
+		"stream past the end": {
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /MediaBox [0 0 1 1] /Contents 4 0 R >>",
+			"<< /Length 9223372036854775807 >>\nstream\nq Q\nendstream",
+		},
+		"unsupported filter": {
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /MediaBox [0 0 1 1] /Contents 4 0 R >>",
+			"<< /Length 3 /Filter /LZWDecode >>\nstream\nq Q\nendstream",
+		},
+		"invalid predictor": {
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /MediaBox [0 0 1 1] /Contents 4 0 R >>",
+			string(flateStream("<< /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 0 >>", []byte("q Q"))),
+		},
+		"missing media box": {
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /Parent 2 0 R >>",
+		},
+	} {
+		_, err := pdfire.InspectPages(bytes.NewReader(buildPDF(objects, "")))
+
+		assert.Equal(pdfire.ErrInvalidPDF, err, name)
+	}
+
+	// An object stream that contains itself.
+	src := buildXRefStreamPDF(pageObjects(), 1)
+	selfContained := bytes.Replace(src, []byte("/N 1 /First"), []byte("/N 2 /First"), 1)
+	_, err := pdfire.PageCount(bytes.NewReader(selfContained))
+
+	assert.Equal(pdfire.ErrInvalidPDF, err)
+
+	for name, src := range map[string]string{
+		"empty":             "",
+		"only startxref":    "startxref",
+		"huge xref section": "xref\n0 9223372036854775807\ntrailer\n<< /Root 1 0 R >>\nstartxref\n0\n%%EOF",
+		"empty xref stream": "1 0 obj\n<< /Type /XRef /Size 9223372036854775807 /W [0 0 0] /Length 0 >>\nstream\n\nendstream\nendobj\nstartxref\n0\n%%EOF",
+		"unterminated":      "1 0 obj\n<< /Root [[[[(((<<<</\nstartxref\n0",
+	} {
+		pages, err := pdfire.PageCount(strings.NewReader(src))
+
+		assert.Equal(0, pages, name)
+		assert.Equal(pdfire.ErrInvalidPDF, err, name)
+	}
+}
+
+// TestReadPDFFuzz reads truncated and mutated variants of valid PDFs, which
+// must fail with an error instead of a panic or a hang. The module targets Go
+// versions without native fuzzing, so the mutations are seeded.
+func TestReadPDFFuzz(t *testing.T) {
+	wd, _ := os.Getwd()
+	pages, _ := ioutil.ReadFile(filepath.Join(wd, "testdata/pages.pdf"))
+	seeds := [][]byte{
+		pages,
+		buildPDF(pageObjects(), ""),
+		buildXRefStreamPDF(pageObjects()),
+		buildXRefStreamPDF(pageObjects(), 0, 1, 2, 3),
+	}
+	random := rand.New(rand.NewSource(1))
+	tokens := [][]byte{[]byte("0"), []byte("-1"), []byte("9999999999"), []byte(" R"), []byte("<<"), []byte("["), []byte("("), []byte("stream")}
+
+	read := func(src []byte) {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Fatalf("panic reading %q: %v", src, r)
+			}
+		}()
+
+		pdfire.InspectPages(bytes.NewReader(src))
+	}
+
+	for _, seed := range seeds {
+		for i := 0; i < len(seed); i += 1 + len(seed)/500 {
+			read(seed[:i])
+		}
+
+		for i := 0; i < 2000; i++ {
+			src := append([]byte(nil), seed...)
+
+			for n := 1 + random.Intn(4); n > 0; n-- {
+				pos := random.Intn(len(src))
+
+				switch random.Intn(3) {
+				case 0:
+					src[pos] = byte(random.Intn(256))
+				case 1:
+					token := tokens[random.Intn(len(tokens))]
+					src = append(src[:pos], append(append([]byte(nil), token...), src[pos:]...)...)
+				default:
+					src = append(src[:pos], src[pos+random.Intn(len(src)-pos):]...)
+				}
+			}
+
+			read(src)
+		}
+	}
+}
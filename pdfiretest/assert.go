@@ -0,0 +1,33 @@
+package pdfiretest
+
+import (
+	"strings"
+	"testing"
+)
+
+// AssertEqualPDF compares two PDFs like Compare and reports the differences
+// as a test failure. It returns whether the PDFs match.
+func AssertEqualPDF(t testing.TB, expected, actual []byte, options *CompareOptions) bool {
+	t.Helper()
+
+	diffs, err := Compare(expected, actual, options)
+
+	if err != nil {
+		t.Errorf("Could not compare PDFs: %v", err)
+		return false
+	}
+
+	if len(diffs) == 0 {
+		return true
+	}
+
+	lines := make([]string, len(diffs))
+
+	for i, d := range diffs {
+		lines[i] = d.String()
+	}
+
+	t.Errorf("PDFs differ:\n%s", strings.Join(lines, "\n"))
+
+	return false
+}
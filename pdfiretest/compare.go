@@ -0,0 +1,258 @@
+// Package pdfiretest provides helpers for testing applications that create
+// PDFs with pdfire.
+package pdfiretest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/imkiptoo/pdfire"
+)
+
+var (
+	// ErrRendererNotFound is returned when a raster comparison is requested but pdftoppm is not installed.
+	ErrRendererNotFound = errors.New("pdftoppm not found")
+)
+
+// CompareOptions are the options of Compare.
+type CompareOptions struct {
+	// Raster compares the pages as rendered images instead of their content
+	// streams, which tolerates differences that don't change the rendering.
+	// It requires pdftoppm of poppler-utils.
+	Raster bool
+	// DPI is the resolution of rendered pages.
+	DPI int
+	// Threshold is the maximum difference of a color channel, from 0 to 255,
+	// of pixels that are considered equal.
+	Threshold uint8
+	// Tolerance is the fraction of the pixels of a page, from 0 to 1, that
+	// may differ.
+	Tolerance float64
+	// SizeTolerance is the difference of page sizes in points that is ignored.
+	SizeTolerance float64
+}
+
+// NewCompareOptions returns new compare options with default values.
+func NewCompareOptions() *CompareOptions {
+	return &CompareOptions{
+		DPI:           72,
+		Threshold:     16,
+		Tolerance:     0.001,
+		SizeTolerance: 0.5,
+	}
+}
+
+// Difference is a difference between two PDFs.
+type Difference struct {
+	// Page is the page number, starting at 1, or 0 for the whole document.
+	Page    int
+	Message string
+}
+
+func (d *Difference) String() string {
+	if d.Page == 0 {
+		return d.Message
+	}
+
+	return fmt.Sprintf("page %d: %s", d.Page, d.Message)
+}
+
+// Compare compares the structure of two PDFs: their page count, page sizes
+// and, depending on the options, the content streams or rendered images of
+// their pages. It returns the differences, which are empty if the PDFs match.
+func Compare(expected, actual []byte, options *CompareOptions) ([]*Difference, error) {
+	if options == nil {
+		options = NewCompareOptions()
+	}
+
+	expectedPages, err := pdfire.InspectPages(bytes.NewReader(expected))
+
+	if err != nil {
+		return nil, err
+	}
+
+	actualPages, err := pdfire.InspectPages(bytes.NewReader(actual))
+
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := make([]*Difference, 0)
+
+	if len(expectedPages) != len(actualPages) {
+		diffs = append(diffs, &Difference{
+			Message: fmt.Sprintf("expected %d pages, got %d", len(expectedPages), len(actualPages)),
+		})
+	}
+
+	n := len(expectedPages)
+
+	if len(actualPages) < n {
+		n = len(actualPages)
+	}
+
+	for i := 0; i < n; i++ {
+		e, a := expectedPages[i], actualPages[i]
+
+		if math.Abs(e.Width-a.Width) > options.SizeTolerance || math.Abs(e.Height-a.Height) > options.SizeTolerance {
+			diffs = append(diffs, &Difference{
+				Page:    i + 1,
+				Message: fmt.Sprintf("expected size %.1fx%.1f, got %.1fx%.1f", e.Width, e.Height, a.Width, a.Height),
+			})
+		} else if !options.Raster && e.ContentHash != a.ContentHash {
+			diffs = append(diffs, &Difference{
+				Page:    i + 1,
+				Message: "content differs",
+			})
+		}
+	}
+
+	if !options.Raster || len(diffs) > 0 {
+		return diffs, nil
+	}
+
+	return compareRaster(expected, actual, options)
+}
+
+// compareRaster renders the pages of both PDFs and compares their pixels.
+func compareRaster(expected, actual []byte, options *CompareOptions) ([]*Difference, error) {
+	expectedImages, err := render(expected, options.DPI)
+
+	if err != nil {
+		return nil, err
+	}
+
+	actualImages, err := render(actual, options.DPI)
+
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := make([]*Difference, 0)
+
+	for i := 0; i < len(expectedImages) && i < len(actualImages); i++ {
+		ratio := diffRatio(expectedImages[i], actualImages[i], options.Threshold)
+
+		if ratio > options.Tolerance {
+			diffs = append(diffs, &Difference{
+				Page:    i + 1,
+				Message: fmt.Sprintf("%.2f%% of the pixels differ", ratio*100),
+			})
+		}
+	}
+
+	return diffs, nil
+}
+
+// render renders the pages of a PDF with pdftoppm.
+func render(pdf []byte, dpi int) ([]image.Image, error) {
+	bin, err := exec.LookPath("pdftoppm")
+
+	if err != nil {
+		return nil, ErrRendererNotFound
+	}
+
+	dir, err := ioutil.TempDir("", "pdfiretest")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "document.pdf")
+
+	if err := ioutil.WriteFile(src, pdf, 0600); err != nil {
+		return nil, err
+	}
+
+	if out, err := exec.Command(bin, "-png", "-r", strconv.Itoa(dpi), src, filepath.Join(dir, "page")).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("pdftoppm failed: %v: %s", err, out)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "page-*.png"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// pdftoppm pads the page numbers to the same width, so they sort by name.
+	sort.Strings(files)
+	images := make([]image.Image, len(files))
+
+	for i, file := range files {
+		f, err := os.Open(file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		images[i], err = png.Decode(f)
+		f.Close()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return images, nil
+}
+
+// diffRatio returns the fraction of pixels whose color channels differ by
+// more than threshold. Pixels outside of one of the images count as different.
+func diffRatio(a, b image.Image, threshold uint8) float64 {
+	ab, bb := a.Bounds(), b.Bounds()
+	width, height := ab.Dx(), ab.Dy()
+
+	if bb.Dx() > width {
+		width = bb.Dx()
+	}
+
+	if bb.Dy() > height {
+		height = bb.Dy()
+	}
+
+	if width == 0 || height == 0 {
+		return 0
+	}
+
+	different := 0
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			pa, pb := image.Pt(ab.Min.X+x, ab.Min.Y+y), image.Pt(bb.Min.X+x, bb.Min.Y+y)
+
+			if !pa.In(ab) || !pb.In(bb) || !similarColor(a.At(pa.X, pa.Y), b.At(pb.X, pb.Y), threshold) {
+				different++
+			}
+		}
+	}
+
+	return float64(different) / float64(width*height)
+}
+
+func similarColor(a, b interface{ RGBA() (r, g, b, a uint32) }, threshold uint8) bool {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	limit := uint32(threshold) << 8
+
+	return absDiff(ar, br) <= limit && absDiff(ag, bg) <= limit && absDiff(ab, bb) <= limit && absDiff(aa, ba) <= limit
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+
+	return b - a
+}
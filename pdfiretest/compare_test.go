@@ -0,0 +1,48 @@
+package pdfiretest_test
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"testing"
+
+	"github.com/imkiptoo/pdfire/pdfiretest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompare(t *testing.T) {
+	assert := assert.New(t)
+	pdf, err := ioutil.ReadFile("../testdata/pages.pdf")
+
+	assert.Nil(err)
+
+	diffs, err := pdfiretest.Compare(pdf, pdf, nil)
+
+	assert.Nil(err)
+	assert.Empty(diffs)
+}
+
+func TestCompareInvalid(t *testing.T) {
+	assert := assert.New(t)
+	pdf, _ := ioutil.ReadFile("../testdata/pages.pdf")
+
+	diffs, err := pdfiretest.Compare(pdf, []byte("not a pdf"), nil)
+
+	assert.Nil(diffs)
+	assert.NotNil(err)
+}
+
+func TestCompareRaster(t *testing.T) {
+	if _, err := exec.LookPath("pdftoppm"); err != nil {
+		t.Skip("pdftoppm is not installed")
+	}
+
+	assert := assert.New(t)
+	pdf, _ := ioutil.ReadFile("../testdata/pages.pdf")
+	options := pdfiretest.NewCompareOptions()
+	options.Raster = true
+
+	diffs, err := pdfiretest.Compare(pdf, pdf, options)
+
+	assert.Nil(err)
+	assert.Empty(diffs)
+}
@@ -0,0 +1,203 @@
+package pdfiretest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/imkiptoo/pdfire"
+)
+
+var _ pdfire.Engine = (*FakeConverter)(nil)
+
+// FakeConverter is a deterministic stand-in for *pdfire.Converter that doesn't
+// need Chrome. Conversions validate their options like the real converter and
+// write a canned PDF instead of rendering the page.
+type FakeConverter struct {
+	// PDF is written by conversions. If it is empty, a blank page in the paper
+	// size of the conversion options is written.
+	PDF []byte
+	// PNG is written by previews. If it is empty, a blank image of the requested
+	// width is written.
+	PNG []byte
+	// Err is returned by conversions and previews if it is set.
+	Err error
+
+	mu          sync.Mutex
+	conversions []*pdfire.ConversionOptions
+	validator   *pdfire.Converter
+}
+
+// NewFakeConverter returns a new fake converter that writes blank documents.
+func NewFakeConverter() *FakeConverter {
+	return &FakeConverter{
+		conversions: make([]*pdfire.ConversionOptions, 0),
+		validator:   pdfire.NewConverter(pdfire.NewConverterOptions()),
+	}
+}
+
+// Conversions returns the options of all conversions and previews so far.
+func (c *FakeConverter) Conversions() []*pdfire.ConversionOptions {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]*pdfire.ConversionOptions{}, c.conversions...)
+}
+
+// Warmup does nothing.
+func (c *FakeConverter) Warmup(ctx context.Context) error {
+	return nil
+}
+
+// Healthy reports the fake converter as healthy.
+func (c *FakeConverter) Healthy(ctx context.Context) error {
+	return nil
+}
+
+// Version returns a fixed browser version.
+func (c *FakeConverter) Version(ctx context.Context) (*pdfire.BrowserVersion, error) {
+	return &pdfire.BrowserVersion{
+		Product:   "pdfiretest/1.0",
+		UserAgent: "pdfiretest",
+	}, nil
+}
+
+// Validate validates the options like the real converter.
+func (c *FakeConverter) Validate(options *pdfire.ConversionOptions) error {
+	return c.validator.Validate(options)
+}
+
+// Convert records the options and writes the canned PDF.
+func (c *FakeConverter) Convert(ctx context.Context, w io.Writer, options *pdfire.ConversionOptions) error {
+	if err := c.record(options); err != nil {
+		return err
+	}
+
+	pdf := c.PDF
+
+	if len(pdf) == 0 {
+		width, height := paperSize(options)
+		pdf = BlankPDF(1, width, height)
+	}
+
+	_, err := w.Write(pdf)
+
+	return err
+}
+
+// Merge records the options of the documents and writes a PDF with a blank
+// page for each of them, unless a canned PDF is set.
+func (c *FakeConverter) Merge(ctx context.Context, w io.Writer, options *pdfire.MergeOptions) error {
+	for _, doc := range options.Documents {
+		if err := c.record(doc); err != nil {
+			return err
+		}
+	}
+
+	pdf := c.PDF
+
+	if len(pdf) == 0 {
+		width, height := 612.0, 792.0
+
+		if len(options.Documents) > 0 {
+			width, height = paperSize(options.Documents[0])
+		}
+
+		pdf = BlankPDF(len(options.Documents), width, height)
+	}
+
+	_, err := w.Write(pdf)
+
+	return err
+}
+
+// Preview records the options and writes the canned PNG.
+func (c *FakeConverter) Preview(ctx context.Context, w io.Writer, options *pdfire.ConversionOptions, width int64) error {
+	if width <= 0 || width > pdfire.MaxPreviewWidth {
+		return pdfire.ErrInvalidPreviewWidth
+	}
+
+	if err := c.record(options); err != nil {
+		return err
+	}
+
+	if len(c.PNG) > 0 {
+		_, err := w.Write(c.PNG)
+		return err
+	}
+
+	paperWidth, paperHeight := paperSize(options)
+	img := image.NewRGBA(image.Rect(0, 0, int(width), int(float64(width)*paperHeight/paperWidth)))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	return png.Encode(w, img)
+}
+
+func (c *FakeConverter) record(options *pdfire.ConversionOptions) error {
+	c.mu.Lock()
+	c.conversions = append(c.conversions, options)
+	c.mu.Unlock()
+
+	if c.Err != nil {
+		return c.Err
+	}
+
+	return c.Validate(options)
+}
+
+// paperSize returns the size of a page of the options in points.
+func paperSize(options *pdfire.ConversionOptions) (float64, float64) {
+	width, height := options.PDFParams.PaperWidth*72, options.PDFParams.PaperHeight*72
+
+	if options.PDFParams.Landscape {
+		return height, width
+	}
+
+	return width, height
+}
+
+// BlankPDF returns a PDF with the given number of blank pages, whose size is
+// given in points.
+func BlankPDF(pages int, width, height float64) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+	}
+
+	kids := make([]string, pages)
+
+	for i := range kids {
+		kids[i] = fmt.Sprintf("%d 0 R", i+3)
+	}
+
+	objects = append(objects, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pages))
+
+	for i := 0; i < pages; i++ {
+		objects = append(objects, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %g %g] /Resources << >> >>", width, height))
+	}
+
+	buf := bytes.NewBufferString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+
+	for _, offset := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n \n", offset)
+	}
+
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return buf.Bytes()
+}
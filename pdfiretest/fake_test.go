@@ -0,0 +1,99 @@
+package pdfiretest_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/imkiptoo/pdfire"
+	"github.com/imkiptoo/pdfire/pdfiretest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeConverter(t *testing.T) {
+	assert := assert.New(t)
+	converter := pdfiretest.NewFakeConverter()
+	options := pdfire.NewConversionOptions()
+	options.HTML = "<p>Test</p>"
+	options.PDFParams.Landscape = true
+	buf := bytes.NewBuffer([]byte{})
+
+	err := converter.Convert(context.Background(), buf, options)
+
+	assert.Nil(err)
+	assert.Equal([]*pdfire.ConversionOptions{options}, converter.Conversions())
+
+	pages, err := pdfire.InspectPages(bytes.NewReader(buf.Bytes()))
+
+	assert.Nil(err)
+	assert.Len(pages, 1)
+	assert.Equal(792.0, pages[0].Width)
+	assert.Equal(612.0, pages[0].Height)
+}
+
+func TestFakeConverterError(t *testing.T) {
+	assert := assert.New(t)
+	converter := pdfiretest.NewFakeConverter()
+	converter.Err = errors.New("chrome crashed")
+	options := pdfire.NewConversionOptions()
+
+	err := converter.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(converter.Err, err)
+
+	converter.Err = nil
+	options.PDFParams.PageRanges = "3-1"
+	err = converter.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(pdfire.ErrInvalidPageRanges, err)
+}
+
+func TestAssertGolden(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := ioutil.TempDir("", "pdfiretest")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "golden", "blank.pdf")
+	pdf := pdfiretest.BlankPDF(2, 612, 792)
+
+	os.Setenv(pdfiretest.UpdateGoldenEnv, "1")
+	assert.True(pdfiretest.AssertGolden(t, path, pdf, nil))
+	os.Unsetenv(pdfiretest.UpdateGoldenEnv)
+
+	assert.True(pdfiretest.AssertGolden(t, path, pdf, nil))
+
+	diffs, err := pdfiretest.Compare(pdf, pdfiretest.BlankPDF(1, 612, 792), nil)
+
+	assert.Nil(err)
+	assert.Len(diffs, 1)
+}
+
+func TestNewServer(t *testing.T) {
+	assert := assert.New(t)
+	srv := pdfiretest.NewServer(nil)
+	defer srv.Close()
+
+	res, err := http.Post(srv.URL+"/conversions", "application/json", strings.NewReader(`{"html": "<p>Test</p>"}`))
+
+	assert.Nil(err)
+	defer res.Body.Close()
+	assert.Equal(201, res.StatusCode)
+	assert.Equal("1", res.Header.Get("X-Pdfire-Pages"))
+}
+
+func TestNewServerReady(t *testing.T) {
+	assert := assert.New(t)
+	srv := pdfiretest.NewServer(nil)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/ready")
+
+	assert.Nil(err)
+	defer res.Body.Close()
+	assert.Equal(200, res.StatusCode)
+}
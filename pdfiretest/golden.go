@@ -0,0 +1,47 @@
+package pdfiretest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// UpdateGoldenEnv is the environment variable that makes AssertGolden write the
+// golden files instead of comparing them, e.g. PDFIRE_UPDATE_GOLDEN=1 go test ./...
+const UpdateGoldenEnv = "PDFIRE_UPDATE_GOLDEN"
+
+// AssertGolden compares a PDF with the golden file at path like AssertEqualPDF.
+// If the environment variable PDFIRE_UPDATE_GOLDEN is set, the golden file is
+// written instead. It returns whether the PDF matches.
+func AssertGolden(t testing.TB, path string, actual []byte, options *CompareOptions) bool {
+	t.Helper()
+
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Errorf("Could not create the directory of golden file %s: %v", path, err)
+			return false
+		}
+
+		if err := ioutil.WriteFile(path, actual, 0644); err != nil {
+			t.Errorf("Could not write golden file %s: %v", path, err)
+			return false
+		}
+
+		return true
+	}
+
+	expected, err := ioutil.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		t.Errorf("Golden file %s doesn't exist. Run the tests with %s=1 to create it.", path, UpdateGoldenEnv)
+		return false
+	}
+
+	if err != nil {
+		t.Errorf("Could not read golden file %s: %v", path, err)
+		return false
+	}
+
+	return AssertEqualPDF(t, expected, actual, options)
+}
@@ -0,0 +1,77 @@
+package pdfiretest
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/imkiptoo/pdfire"
+)
+
+var _ pdfire.Engine = (*MockEngine)(nil)
+
+// MockEngine is a mock of pdfire.Engine. Its methods call the functions of the
+// same name, which are typically set to return errors that are hard to provoke
+// with a real browser, and record the options they were called with. Methods
+// whose function is nil succeed without writing anything.
+type MockEngine struct {
+	ConvertFunc func(ctx context.Context, w io.Writer, options *pdfire.ConversionOptions) error
+	MergeFunc   func(ctx context.Context, w io.Writer, options *pdfire.MergeOptions) error
+
+	mu           sync.Mutex
+	convertCalls []*pdfire.ConversionOptions
+	mergeCalls   []*pdfire.MergeOptions
+}
+
+// Convert calls ConvertFunc.
+func (m *MockEngine) Convert(ctx context.Context, w io.Writer, options *pdfire.ConversionOptions) error {
+	m.mu.Lock()
+	m.convertCalls = append(m.convertCalls, options)
+	m.mu.Unlock()
+
+	if m.ConvertFunc == nil {
+		return nil
+	}
+
+	return m.ConvertFunc(ctx, w, options)
+}
+
+// Merge calls MergeFunc.
+func (m *MockEngine) Merge(ctx context.Context, w io.Writer, options *pdfire.MergeOptions) error {
+	m.mu.Lock()
+	m.mergeCalls = append(m.mergeCalls, options)
+	m.mu.Unlock()
+
+	if m.MergeFunc == nil {
+		return nil
+	}
+
+	return m.MergeFunc(ctx, w, options)
+}
+
+// ConvertCalls returns the options of all calls of Convert so far.
+func (m *MockEngine) ConvertCalls() []*pdfire.ConversionOptions {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]*pdfire.ConversionOptions{}, m.convertCalls...)
+}
+
+// MergeCalls returns the options of all calls of Merge so far.
+func (m *MockEngine) MergeCalls() []*pdfire.MergeOptions {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]*pdfire.MergeOptions{}, m.mergeCalls...)
+}
+
+// Returns returns a function for ConvertFunc that writes pdf and returns err.
+func Returns(pdf []byte, err error) func(context.Context, io.Writer, *pdfire.ConversionOptions) error {
+	return func(ctx context.Context, w io.Writer, options *pdfire.ConversionOptions) error {
+		if _, werr := w.Write(pdf); werr != nil {
+			return werr
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,43 @@
+package pdfiretest_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/imkiptoo/pdfire"
+	"github.com/imkiptoo/pdfire/pdfiretest"
+	"github.com/stretchr/testify/assert"
+)
+
+// render is an application function that depends on the engine interface.
+func render(engine pdfire.Engine, html string) ([]byte, error) {
+	options := pdfire.NewConversionOptions()
+	options.HTML = html
+	buf := bytes.NewBuffer([]byte{})
+	err := engine.Convert(context.Background(), buf, options)
+
+	return buf.Bytes(), err
+}
+
+func TestMockEngine(t *testing.T) {
+	assert := assert.New(t)
+	pdf := pdfiretest.BlankPDF(1, 612, 792)
+	engine := &pdfiretest.MockEngine{
+		ConvertFunc: pdfiretest.Returns(pdf, nil),
+	}
+
+	res, err := render(engine, "<p>Test</p>")
+
+	assert.Nil(err)
+	assert.Equal(pdf, res)
+
+	engine.ConvertFunc = pdfiretest.Returns(nil, pdfire.ErrTimeout)
+	res, err = render(engine, "<p>Test</p>")
+
+	assert.Equal(pdfire.ErrTimeout, err)
+	assert.Empty(res)
+	assert.Len(engine.ConvertCalls(), 2)
+	assert.Equal("<p>Test</p>", engine.ConvertCalls()[1].HTML)
+	assert.Empty(engine.MergeCalls())
+}
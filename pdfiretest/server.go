@@ -0,0 +1,21 @@
+package pdfiretest
+
+import (
+	"net/http/httptest"
+
+	"github.com/imkiptoo/pdfire/server"
+)
+
+// NewServer starts a PDFire server for tests, which converts documents with
+// the given engine. If engine is nil, a new fake converter is used. The caller
+// must close the server.
+func NewServer(engine server.Engine) *httptest.Server {
+	if engine == nil {
+		engine = NewFakeConverter()
+	}
+
+	options := server.NewOptions()
+	options.Converter = engine
+
+	return httptest.NewServer(server.NewWithOptions(options))
+}
@@ -0,0 +1,153 @@
+package pdfire
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+var (
+	// PhaseBrowser is the launch of the browser or the creation of the tab.
+	PhaseBrowser = Phase("browser")
+	// PhaseNavigation is the navigation to the document.
+	PhaseNavigation = Phase("navigation")
+	// PhaseWaitForSelector is the wait for the WaitForSelector(s).
+	PhaseWaitForSelector = Phase("waitForSelector")
+	// PhaseWaitUntil is the wait for the WaitUntil event.
+	PhaseWaitUntil = Phase("waitUntil")
+	// PhaseWaitForFunction is the wait for the WaitForFunction expression.
+	PhaseWaitForFunction = Phase("waitForFunction")
+	// PhaseWaitForResources is the wait for images, fonts and math formulas.
+	PhaseWaitForResources = Phase("waitForResources")
+	// PhaseActions is the execution of the Actions.
+	PhaseActions = Phase("actions")
+	// PhaseDelay is the Delay before printing.
+	PhaseDelay = Phase("delay")
+	// PhaseDOM is the modification of the document, e.g. for Selectors or PagedJS.
+	PhaseDOM = Phase("dom")
+	// PhasePrint is the printing of the PDF.
+	PhasePrint = Phase("print")
+	// PhasePostProcess is the post-processing of the printed PDF.
+	PhasePostProcess = Phase("postProcess")
+)
+
+// Phase is a step of a conversion.
+type Phase string
+
+// PhaseDuration is the duration of a completed phase.
+type PhaseDuration struct {
+	Phase    Phase
+	Duration time.Duration
+}
+
+// TimeoutError is returned when a conversion times out. It tells which phase
+// was in progress and how long the completed phases took.
+type TimeoutError struct {
+	Phase Phase
+	// Elapsed is the time spent in the phase in progress.
+	Elapsed   time.Duration
+	Completed []*PhaseDuration
+}
+
+func (e *TimeoutError) Error() string {
+	msg := fmt.Sprintf("Conversion timed out during the %s phase after %s", e.Phase, e.Elapsed.Round(time.Millisecond))
+
+	if len(e.Completed) == 0 {
+		return msg + "."
+	}
+
+	completed := make([]string, len(e.Completed))
+
+	for i, p := range e.Completed {
+		completed[i] = fmt.Sprintf("%s %s", p.Phase, p.Duration.Round(time.Millisecond))
+	}
+
+	return fmt.Sprintf("%s (completed: %s).", msg, strings.Join(completed, ", "))
+}
+
+// Unwrap returns ErrTimeout.
+func (e *TimeoutError) Unwrap() error {
+	return ErrTimeout
+}
+
+// phaseTimer records the phases of a conversion.
+type phaseTimer struct {
+	mu        sync.Mutex
+	phase     Phase
+	start     time.Time
+	completed []*PhaseDuration
+}
+
+type phaseTimerKey struct{}
+
+// withPhaseTimer returns a context whose actions record their phases in a new timer.
+func withPhaseTimer(ctx context.Context) (context.Context, *phaseTimer) {
+	t := &phaseTimer{
+		completed: make([]*PhaseDuration, 0),
+	}
+
+	return context.WithValue(ctx, phaseTimerKey{}, t), t
+}
+
+// enter completes the phase in progress, if any, and starts the given one.
+// Entering the phase in progress again has no effect.
+func (t *phaseTimer) enter(phase Phase) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.phase == phase {
+		return
+	}
+
+	now := time.Now()
+
+	if t.phase != "" {
+		t.completed = append(t.completed, &PhaseDuration{Phase: t.phase, Duration: now.Sub(t.start)})
+	}
+
+	t.phase = phase
+	t.start = now
+}
+
+func (t *phaseTimer) timeoutError() *TimeoutError {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return &TimeoutError{
+		Phase:     t.phase,
+		Elapsed:   time.Since(t.start),
+		Completed: append([]*PhaseDuration{}, t.completed...),
+	}
+}
+
+// durations returns the completed phases followed by the phase in progress.
+func (t *phaseTimer) durations() []*PhaseDuration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	durations := append([]*PhaseDuration{}, t.completed...)
+
+	if t.phase != "" {
+		durations = append(durations, &PhaseDuration{Phase: t.phase, Duration: time.Since(t.start)})
+	}
+
+	return durations
+}
+
+// enterPhase starts a phase in the timer of ctx, if it has one.
+func enterPhase(ctx context.Context, phase Phase) {
+	if t, ok := ctx.Value(phaseTimerKey{}).(*phaseTimer); ok {
+		t.enter(phase)
+	}
+}
+
+func phaseAction(phase Phase) chromedp.ActionFunc {
+	return func(ctx context.Context) error {
+		enterPhase(ctx, phase)
+		return nil
+	}
+}
@@ -0,0 +1,28 @@
+package pdfire_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/imkiptoo/pdfire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutError(t *testing.T) {
+	assert := assert.New(t)
+	err := &pdfire.TimeoutError{
+		Phase:   pdfire.PhaseWaitUntil,
+		Elapsed: 3200 * time.Millisecond,
+		Completed: []*pdfire.PhaseDuration{
+			{Phase: pdfire.PhaseBrowser, Duration: 1100 * time.Millisecond},
+			{Phase: pdfire.PhaseNavigation, Duration: 800 * time.Millisecond},
+		},
+	}
+
+	assert.Equal("Conversion timed out during the waitUntil phase after 3.2s (completed: browser 1.1s, navigation 800ms).", err.Error())
+	assert.Equal(pdfire.ErrTimeout, err.Unwrap())
+
+	err.Completed = nil
+
+	assert.Equal("Conversion timed out during the waitUntil phase after 3.2s.", err.Error())
+}
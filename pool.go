@@ -0,0 +1,387 @@
+package pdfire
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+)
+
+var (
+	// ErrConverterClosed is returned when a closed converter is used.
+	ErrConverterClosed = errors.New("converter is closed")
+	// ErrNoBrowser is returned by Healthy when no pooled browser is running.
+	ErrNoBrowser = errors.New("no browser is running")
+)
+
+// healthCheckTimeout is how long Healthy waits for the browsers to respond.
+const healthCheckTimeout = 5 * time.Second
+
+// browserPool keeps long-lived browser processes. Every conversion gets a new
+// tab inside a fresh browser context, so cookies, cache and storage never leak
+// between conversions while the expensive browser launch is paid only once.
+// Each browser hosts up to TabsPerBrowser tabs at once; idle holds one entry
+// per free tab.
+type browserPool struct {
+	options  *ConverterOptions
+	ctx      context.Context
+	cancel   context.CancelFunc
+	idle     chan *pooledBrowser
+	slots    chan struct{}
+	mu       sync.Mutex
+	browsers map[*pooledBrowser]struct{}
+	closed   bool
+}
+
+type pooledBrowser struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	discarded sync.Once
+}
+
+func newBrowserPool(options *ConverterOptions) *browserPool {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &browserPool{
+		options:  options,
+		ctx:      ctx,
+		cancel:   cancel,
+		idle:     make(chan *pooledBrowser, options.PoolSize*options.tabsPerBrowser()),
+		slots:    make(chan struct{}, options.PoolSize),
+		browsers: make(map[*pooledBrowser]struct{}),
+	}
+}
+
+// acquire returns a browser with a free tab, launches a new one if the pool
+// isn't full yet, or waits until a tab is released.
+func (p *browserPool) acquire(ctx context.Context) (*pooledBrowser, error) {
+	for {
+		if p.isClosed() {
+			return nil, ErrConverterClosed
+		}
+
+		var b *pooledBrowser
+
+		select {
+		case b = <-p.idle:
+		default:
+			select {
+			case b = <-p.idle:
+			case p.slots <- struct{}{}:
+				return p.launch()
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		if b.ctx.Err() == nil {
+			return b, nil
+		}
+
+		// The browser crashed or lost its connection while idle.
+		p.discard(b)
+	}
+}
+
+// release hands a tab of the browser back to the pool.
+func (p *browserPool) release(b *pooledBrowser) {
+	if p.isClosed() || b.ctx.Err() != nil {
+		p.discard(b)
+		return
+	}
+
+	p.idle <- b
+}
+
+// launch starts a browser, or connects to the remote Chrome of the options.
+func (p *browserPool) launch() (*pooledBrowser, error) {
+	b, err := p.start()
+
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		b.cancel()
+		<-p.slots
+		return nil, ErrConverterClosed
+	}
+
+	p.browsers[b] = struct{}{}
+
+	// The remaining tabs of the new browser are free.
+	for i := 1; i < p.options.tabsPerBrowser(); i++ {
+		p.idle <- b
+	}
+
+	return b, nil
+}
+
+func (p *browserPool) start() (*pooledBrowser, error) {
+	if p.options.ChromeWSURL != "" {
+		return connectRemote(p.ctx, p.options.ChromeWSURL)
+	}
+
+	opts, err := allocatorOptions(p.options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(p.ctx, opts...)
+	ctx, cancel := chromedp.NewContext(allocCtx)
+	b := &pooledBrowser{
+		ctx: ctx,
+		cancel: func() {
+			cancel()
+			cancelAlloc()
+		},
+	}
+
+	if err := chromedp.Run(ctx); err != nil {
+		b.cancel()
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// discard stops a browser. The pool may hold more of its tabs, so discarding
+// it again has no effect.
+func (p *browserPool) discard(b *pooledBrowser) {
+	b.discarded.Do(func() {
+		b.cancel()
+
+		p.mu.Lock()
+		delete(p.browsers, b)
+		p.mu.Unlock()
+
+		<-p.slots
+	})
+}
+
+// newTab creates a tab in a new browser context of a pooled browser. The
+// returned context is bound to the lifetime of ctx. Cancelling it closes the
+// tab, disposes the browser context and returns the tab to the pool.
+func (p *browserPool) newTab(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	b, err := p.acquire(ctx)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tabCtx, cancelTab, err := openTab(ctx, b)
+
+	if err != nil {
+		p.release(b)
+		return nil, nil, err
+	}
+
+	var once sync.Once
+
+	return tabCtx, func() {
+		once.Do(func() {
+			cancelTab()
+			p.release(b)
+		})
+	}, nil
+}
+
+// warmup launches every browser of the pool by acquiring all of its tabs. If
+// render is true, a trivial document is printed in each browser.
+func (p *browserPool) warmup(ctx context.Context, render bool) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	tabs := p.options.PoolSize * p.options.tabsPerBrowser()
+	errs := make(chan error, tabs)
+	browsers := make(chan *pooledBrowser, tabs)
+	rendered := make(map[*pooledBrowser]bool)
+
+	for i := 0; i < tabs; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			b, err := p.acquire(ctx)
+
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			browsers <- b
+
+			mu.Lock()
+			first := !rendered[b]
+			rendered[b] = true
+			mu.Unlock()
+
+			if render && first {
+				errs <- warmupRender(ctx, b)
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	close(browsers)
+
+	for b := range browsers {
+		p.release(b)
+	}
+
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// healthy pings every running browser of the pool. Browsers running
+// conversions respond as well, so it doesn't wait for a free tab.
+func (p *browserPool) healthy(ctx context.Context) error {
+	p.mu.Lock()
+	browsers := make([]*pooledBrowser, 0, len(p.browsers))
+
+	for b := range p.browsers {
+		browsers = append(browsers, b)
+	}
+
+	p.mu.Unlock()
+
+	if len(browsers) == 0 {
+		return ErrNoBrowser
+	}
+
+	for _, b := range browsers {
+		if err := ping(ctx, b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// running returns a running browser of the pool, if any.
+func (p *browserPool) running() *chromedp.Browser {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for b := range p.browsers {
+		if b.ctx.Err() == nil {
+			return chromedp.FromContext(b.ctx).Browser
+		}
+	}
+
+	return nil
+}
+
+// ping checks that the browser responds to the DevTools protocol.
+func ping(ctx context.Context, b *pooledBrowser) error {
+	_, _, _, _, _, err := browser.GetVersion().Do(cdp.WithExecutor(ctx, chromedp.FromContext(b.ctx).Browser))
+
+	return err
+}
+
+func warmupRender(ctx context.Context, b *pooledBrowser) error {
+	tabCtx, cancel, err := openTab(ctx, b)
+
+	if err != nil {
+		return err
+	}
+
+	defer cancel()
+
+	return chromedp.Run(tabCtx, warmupActions()...)
+}
+
+// openTab creates a tab in a new browser context of b. The returned context is
+// bound to the lifetime of ctx. Cancelling it closes the tab and disposes the
+// browser context.
+func openTab(ctx context.Context, b *pooledBrowser) (context.Context, context.CancelFunc, error) {
+	bctx := cdp.WithExecutor(ctx, chromedp.FromContext(b.ctx).Browser)
+	browserContextID, err := target.CreateBrowserContext().Do(bctx)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	targetID, err := target.CreateTarget("about:blank").WithBrowserContextID(browserContextID).Do(bctx)
+
+	if err != nil {
+		disposeBrowserContext(b, browserContextID)
+		return nil, nil, err
+	}
+
+	tabCtx, cancelTab := chromedp.NewContext(b.ctx, chromedp.WithTargetID(targetID))
+	tabCtx, cancelDeadline := withParentDeadline(tabCtx, ctx)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancelDeadline()
+		case <-done:
+		}
+	}()
+
+	return tabCtx, func() {
+		close(done)
+		cancelDeadline()
+		cancelTab()
+		disposeBrowserContext(b, browserContextID)
+	}, nil
+}
+
+func (p *browserPool) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.closed
+}
+
+// close stops all browsers of the pool.
+func (p *browserPool) close() {
+	p.mu.Lock()
+	p.closed = true
+	browsers := make([]*pooledBrowser, 0, len(p.browsers))
+
+	for b := range p.browsers {
+		browsers = append(browsers, b)
+	}
+
+	p.mu.Unlock()
+	p.cancel()
+
+	for _, b := range browsers {
+		b.cancel()
+	}
+}
+
+func disposeBrowserContext(b *pooledBrowser, id target.BrowserContextID) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	target.DisposeBrowserContext(id).Do(cdp.WithExecutor(ctx, chromedp.FromContext(b.ctx).Browser))
+}
+
+// withParentDeadline applies the deadline of parent, if any, to ctx.
+func withParentDeadline(ctx, parent context.Context) (context.Context, context.CancelFunc) {
+	if deadline, ok := parent.Deadline(); ok {
+		return context.WithDeadline(ctx, deadline)
+	}
+
+	return context.WithCancel(ctx)
+}
@@ -0,0 +1,401 @@
+package pdfire
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrNoPDFs is returned when MergeFiles is called without PDFs.
+	ErrNoPDFs = errors.New("no pdfs provided")
+)
+
+// MaxPDFSize is the maximum size of a PDF loaded from a URL for post-processing.
+const MaxPDFSize = 100 << 20
+
+// PostProcessOptions are the options for post-processing an existing PDF.
+type PostProcessOptions struct {
+	// URL is the URL of the PDF. It's only used if no PDF is passed to PostProcess.
+	URL           string
+	OwnerPassword string
+	UserPassword  string
+	Watermark     *WatermarkConfig
+	// PDFVersion is the version declared by the PDF, one of PDFVersions. The
+	// version of the writer is kept if it's empty.
+	PDFVersion    string
+	ObjectStreams StreamMode
+	XRefStreams   StreamMode
+	// ArchiveFormat is the PDF/A conformance level of the PDF, one of
+	// ArchiveFormats. The PDF isn't converted to PDF/A if it's empty.
+	ArchiveFormat string
+	// Linearize optimizes the PDF for fast web view with qpdf.
+	Linearize bool
+	// Optimize rewrites the PDF with pdfcpu, which removes duplicate fonts and
+	// images, e.g. an image repeated on every page, and packs the objects into
+	// compressed object streams, unless ObjectStreams is off.
+	Optimize bool
+	// Deterministic normalizes the dates, producers and document IDs, so that
+	// identical input results in byte-identical PDFs. It can't be combined
+	// with encryption.
+	Deterministic bool
+	// Signature signs the PDF after all other steps. The signature is added in
+	// an incremental update, which viewers don't read as linearized.
+	Signature *SignatureConfig
+	// URLPolicy restricts the URL of the PDF and the timestamp authority of
+	// the signature, like the URLPolicy of a Converter restricts the
+	// converted pages.
+	URLPolicy *URLPolicy
+	// BlockPrivateNetworks denies a URL of the PDF or timestamp authority
+	// that is or resolves to an address of a private network, also after
+	// redirects.
+	BlockPrivateNetworks bool
+
+	// warn reports the findings of the PDF/A conversion, if set.
+	warn func(format string, args ...interface{})
+}
+
+// PDFLoadError is returned when the PDF of a URL cannot be loaded.
+type PDFLoadError struct {
+	URL string
+	Err error
+}
+
+func (e *PDFLoadError) Error() string {
+	return fmt.Sprintf("Could not load PDF \"%s\" (%v).", e.URL, e.Err)
+}
+
+// NewPostProcessOptions returns new post-processing options with default values.
+func NewPostProcessOptions() *PostProcessOptions {
+	return &PostProcessOptions{
+		ObjectStreams: StreamModeAuto,
+		XRefStreams:   StreamModeAuto,
+	}
+}
+
+// NewPostProcessOptionsFromJSONString returns new post-processing options from JSON.
+func NewPostProcessOptionsFromJSONString(json string) (*PostProcessOptions, error) {
+	return NewPostProcessOptionsFromJSON(strings.NewReader(json))
+}
+
+// NewPostProcessOptionsFromJSON returns new post-processing options from JSON.
+func NewPostProcessOptionsFromJSON(r io.Reader) (*PostProcessOptions, error) {
+	jsonMap := make(map[string]interface{})
+
+	if err := json.NewDecoder(r).Decode(&jsonMap); err != nil {
+		return nil, ErrInvalidJSON
+	}
+
+	options := NewPostProcessOptions()
+
+	url, err := parseString(jsonMap, "url", options.URL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ownerPassword, err := parseString(jsonMap, "ownerPassword", options.OwnerPassword)
+
+	if err != nil {
+		return nil, err
+	}
+
+	userPassword, err := parseString(jsonMap, "userPassword", options.UserPassword)
+
+	if err != nil {
+		return nil, err
+	}
+
+	watermark, err := parseWatermark(jsonMap)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pdfVersion, err := parsePDFVersion(jsonMap, options.PDFVersion)
+
+	if err != nil {
+		return nil, err
+	}
+
+	objectStreams, err := parseStreamMode(jsonMap, "objectStreams", options.ObjectStreams)
+
+	if err != nil {
+		return nil, err
+	}
+
+	xrefStreams, err := parseStreamMode(jsonMap, "xrefStreams", options.XRefStreams)
+
+	if err != nil {
+		return nil, err
+	}
+
+	archiveFormat, err := parseArchiveFormat(jsonMap, options.ArchiveFormat)
+
+	if err != nil {
+		return nil, err
+	}
+
+	linearize, err := parseBool(jsonMap, "linearize", options.Linearize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	optimize, err := parseBool(jsonMap, "optimize", options.Optimize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	deterministic, err := parseBool(jsonMap, "deterministic", options.Deterministic)
+
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := parseSignature(jsonMap)
+
+	if err != nil {
+		return nil, err
+	}
+
+	options.URL = url
+	options.OwnerPassword = ownerPassword
+	options.UserPassword = userPassword
+	options.Watermark = watermark
+	options.PDFVersion = pdfVersion
+	options.ObjectStreams = objectStreams
+	options.XRefStreams = xrefStreams
+	options.ArchiveFormat = archiveFormat
+	options.Linearize = linearize
+	options.Optimize = optimize
+	options.Deterministic = deterministic
+	options.Signature = signature
+
+	return options, nil
+}
+
+// PostProcess applies the post-processing of conversions to an existing PDF
+// without a browser. If r is nil, the PDF is loaded from the URL of the options.
+func PostProcess(ctx context.Context, r io.Reader, w io.Writer, options *PostProcessOptions) error {
+	var data []byte
+	var err error
+
+	if r != nil {
+		data, err = ioutil.ReadAll(r)
+	} else {
+		data, err = loadPDF(ctx, options.urlGuard(), options.URL)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := PageCount(bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	buf, err := processPDF(ctx, bytes.NewBuffer(data), options)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, buf)
+
+	return err
+}
+
+// processPDF watermarks and encrypts a PDF, applies the write settings,
+// normalizes it, converts it to PDF/A, linearizes it and signs it.
+func processPDF(ctx context.Context, buf *bytes.Buffer, options *PostProcessOptions) (*bytes.Buffer, error) {
+	if err := validateOutput(options); err != nil {
+		return nil, err
+	}
+
+	var err error
+
+	if options.Watermark != nil {
+		if buf, err = watermark(buf, options.Watermark, options.writeConfiguration()); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.OwnerPassword != "" || options.UserPassword != "" {
+		buf, err = secure(buf, options)
+	} else if options.rewrites() {
+		buf, err = rewrite(buf, options)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if options.PDFVersion != "" {
+		if buf, err = setPDFVersion(buf, options.PDFVersion); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.Deterministic {
+		if buf, err = normalizePDF(buf); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.ArchiveFormat != "" {
+		if buf, err = toArchive(buf, options); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.Linearize {
+		if buf, err = linearize(buf, options); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.Signature == nil {
+		return buf, nil
+	}
+
+	return sign(ctx, buf, options.Signature, options.urlGuard())
+}
+
+// processes reports whether processPDF changes the PDF.
+func (o *PostProcessOptions) processes() bool {
+	return o.Watermark != nil || o.OwnerPassword != "" || o.UserPassword != "" || o.rewrites() ||
+		o.PDFVersion != "" || o.Deterministic || o.ArchiveFormat != "" || o.Linearize || o.Signature != nil
+}
+
+// toArchive converts a PDF to PDF/A and reports the findings as warnings.
+func toArchive(buf *bytes.Buffer, options *PostProcessOptions) (*bytes.Buffer, error) {
+	out := bytes.NewBuffer(make([]byte, 0, buf.Len()+8192))
+	findings, err := ConvertToArchive(buf, out, options.ArchiveFormat)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if options.warn != nil {
+		for _, finding := range findings {
+			options.warn("%s: %s", options.ArchiveFormat, finding)
+		}
+	}
+
+	return out, nil
+}
+
+// loadPDF loads a PDF with the client of the guard. A denied URL results in a
+// *URLNotAllowedError.
+func loadPDF(ctx context.Context, guard *urlGuard, rawurl string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, rawurl, nil)
+
+	if err != nil {
+		return nil, &PDFLoadError{URL: rawurl, Err: err}
+	}
+
+	res, err := guard.do(req.WithContext(ctx), true)
+
+	if _, ok := err.(*URLNotAllowedError); ok {
+		return nil, err
+	}
+
+	if err != nil {
+		return nil, &PDFLoadError{URL: rawurl, Err: err}
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, &PDFLoadError{URL: rawurl, Err: fmt.Errorf("unexpected status %d", res.StatusCode)}
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, MaxPDFSize+1))
+
+	if err != nil {
+		return nil, &PDFLoadError{URL: rawurl, Err: err}
+	}
+
+	if len(data) > MaxPDFSize {
+		return nil, &PDFLoadError{URL: rawurl, Err: fmt.Errorf("pdf exceeds %d bytes", MaxPDFSize)}
+	}
+
+	return data, nil
+}
+
+// MergeFile is an existing PDF merged by MergeFiles.
+type MergeFile struct {
+	PDF io.Reader
+	// Title is the title of a bookmark to the first page of the PDF. No
+	// bookmark is added if it's empty.
+	Title string
+}
+
+// MergeFiles merges existing PDFs in order and post-processes the result
+// without a browser.
+func MergeFiles(ctx context.Context, w io.Writer, files []*MergeFile, options *PostProcessOptions) error {
+	if len(files) == 0 {
+		return ErrNoPDFs
+	}
+
+	bufs := make([]*bytes.Buffer, len(files))
+	bookmarks := make([]*Bookmark, 0, len(files))
+	page := 1
+
+	for i, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		data, err := ioutil.ReadAll(file.PDF)
+
+		if err != nil {
+			return err
+		}
+
+		pages, err := PageCount(bytes.NewReader(data))
+
+		if err != nil {
+			return err
+		}
+
+		if file.Title != "" {
+			bookmarks = append(bookmarks, &Bookmark{Title: file.Title, Page: page})
+		}
+
+		bufs[i] = bytes.NewBuffer(data)
+		page += pages
+	}
+
+	buf, err := concatPDFs(bufs, options.writeConfiguration())
+
+	if err != nil {
+		return err
+	}
+
+	if len(bookmarks) > 0 {
+		out := bytes.NewBuffer([]byte{})
+
+		if err := addBookmarks(buf, out, bookmarks, options.writeConfiguration()); err != nil {
+			return err
+		}
+
+		buf = out
+	}
+
+	if buf, err = processPDF(ctx, buf, options); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, buf)
+
+	return err
+}
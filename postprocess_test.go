@@ -0,0 +1,470 @@
+package pdfire_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/imkiptoo/pdfire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPostProcessOptionsFromJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	options, err := pdfire.NewPostProcessOptionsFromJSONString(`{
+		"url": "https://example.com/invoice.pdf",
+		"ownerPassword": "ownerpw",
+		"userPassword": "userpw",
+		"watermark": {"query": "Draft", "onTop": true, "pages": ["1-2"]},
+		"pdfVersion": "1.7",
+		"objectStreams": "off",
+		"xrefStreams": "on",
+		"archiveFormat": "pdf/a-3b",
+		"linearize": true,
+		"optimize": true,
+		"deterministic": true
+	}`)
+
+	assert.Nil(err)
+	assert.Equal("https://example.com/invoice.pdf", options.URL)
+	assert.Equal("ownerpw", options.OwnerPassword)
+	assert.Equal("userpw", options.UserPassword)
+	assert.Equal(&pdfire.WatermarkConfig{Query: "Draft", OnTop: true, Pages: []string{"1-2"}}, options.Watermark)
+	assert.Equal("1.7", options.PDFVersion)
+	assert.Equal(pdfire.StreamModeOff, options.ObjectStreams)
+	assert.Equal(pdfire.StreamModeOn, options.XRefStreams)
+	assert.Equal("pdf/a-3b", options.ArchiveFormat)
+	assert.Equal(true, options.Linearize)
+	assert.Equal(true, options.Optimize)
+	assert.Equal(true, options.Deterministic)
+
+	options, err = pdfire.NewPostProcessOptionsFromJSONString(`{"watermark": "Draft"}`)
+
+	assert.Nil(options)
+	assert.IsType(&pdfire.ParseError{}, err)
+
+	options, err = pdfire.NewPostProcessOptionsFromJSONString(`{"pdfVersion": "1.8"}`)
+
+	assert.Nil(options)
+	assert.Equal(&pdfire.ParseError{Key: "pdfVersion", Value: "1.8"}, err)
+
+	options, err = pdfire.NewPostProcessOptionsFromJSONString(`{"archiveFormat": "pdf/a-1a"}`)
+
+	assert.Nil(options)
+	assert.Equal(&pdfire.ParseError{Key: "archiveFormat", Value: "pdf/a-1a"}, err)
+}
+
+func TestPostProcess(t *testing.T) {
+	assert := assert.New(t)
+	wd, _ := os.Getwd()
+	src, _ := ioutil.ReadFile(filepath.Join(wd, "testdata/pages.pdf"))
+
+	out := bytes.NewBuffer(make([]byte, 0))
+	err := pdfire.PostProcess(context.Background(), bytes.NewReader(src), out, pdfire.NewPostProcessOptions())
+
+	assert.Nil(err)
+	assert.Equal(src, out.Bytes())
+
+	err = pdfire.PostProcess(context.Background(), strings.NewReader("<html></html>"), ioutil.Discard, pdfire.NewPostProcessOptions())
+
+	assert.Equal(pdfire.ErrInvalidPDF, err)
+}
+
+func TestPostProcessURLGuard(t *testing.T) {
+	assert := assert.New(t)
+	wd, _ := os.Getwd()
+	src, _ := ioutil.ReadFile(filepath.Join(wd, "testdata/pages.pdf"))
+	var loads int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/invoice.pdf", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&loads, 1)
+		w.Write(src)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	redirect := strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/invoice.pdf"
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, redirect, http.StatusFound)
+	})
+
+	options := pdfire.NewPostProcessOptions()
+	options.URL = server.URL + "/invoice.pdf"
+	options.BlockPrivateNetworks = true
+
+	err := pdfire.PostProcess(context.Background(), nil, ioutil.Discard, options)
+
+	assert.Equal(&pdfire.URLNotAllowedError{URL: options.URL}, err)
+
+	options = pdfire.NewPostProcessOptions()
+	options.URL = server.URL + "/redirect"
+	options.URLPolicy = &pdfire.URLPolicy{Allow: []string{"127.0.0.1"}}
+
+	err = pdfire.PostProcess(context.Background(), nil, ioutil.Discard, options)
+
+	assert.Equal(&pdfire.URLNotAllowedError{URL: options.URL}, err)
+	assert.Equal(int32(0), atomic.LoadInt32(&loads))
+
+	options.URL = server.URL + "/invoice.pdf"
+	out := bytes.NewBuffer(make([]byte, 0))
+	err = pdfire.PostProcess(context.Background(), nil, out, options)
+
+	assert.Nil(err)
+	assert.Equal(src, out.Bytes())
+}
+
+func TestPostProcessPDFVersion(t *testing.T) {
+	assert := assert.New(t)
+	wd, _ := os.Getwd()
+	src, _ := ioutil.ReadFile(filepath.Join(wd, "testdata/pages.pdf"))
+
+	options := pdfire.NewPostProcessOptions()
+	options.PDFVersion = "1.7"
+	out := bytes.NewBuffer(make([]byte, 0))
+	err := pdfire.PostProcess(context.Background(), bytes.NewReader(src), out, options)
+
+	assert.Nil(err)
+	assert.True(bytes.HasPrefix(out.Bytes(), []byte("%PDF-1.7\n")))
+	assert.Equal(src[8:], out.Bytes()[8:])
+
+	options = pdfire.NewPostProcessOptions()
+	options.ObjectStreams = pdfire.StreamModeOn
+	options.XRefStreams = pdfire.StreamModeOff
+	err = pdfire.PostProcess(context.Background(), bytes.NewReader(src), ioutil.Discard, options)
+
+	assert.Equal(pdfire.ErrObjectStreamsWithoutXRefStreams, err)
+
+	options = pdfire.NewPostProcessOptions()
+	options.PDFVersion = "1.4"
+	options.XRefStreams = pdfire.StreamModeOn
+	err = pdfire.PostProcess(context.Background(), bytes.NewReader(src), ioutil.Discard, options)
+
+	assert.Equal(&pdfire.PDFVersionError{Version: "1.4", Feature: "xref streams"}, err)
+	assert.Equal("PDF version 1.4 does not support xref streams.", err.Error())
+
+	options = pdfire.NewPostProcessOptions()
+	options.PDFVersion = "1.6"
+	options.UserPassword = "userpw"
+	err = pdfire.PostProcess(context.Background(), bytes.NewReader(src), ioutil.Discard, options)
+
+	assert.Equal(&pdfire.PDFVersionError{Version: "1.6", Feature: "AES-256 encryption"}, err)
+}
+
+func TestPostProcessArchiveFormat(t *testing.T) {
+	assert := assert.New(t)
+	wd, _ := os.Getwd()
+	src, _ := ioutil.ReadFile(filepath.Join(wd, "testdata/pages.pdf"))
+
+	options := pdfire.NewPostProcessOptions()
+	options.ArchiveFormat = "pdf/a-2b"
+	out := bytes.NewBuffer(make([]byte, 0))
+	err := pdfire.PostProcess(context.Background(), bytes.NewReader(src), out, options)
+
+	assert.Nil(err)
+	assert.True(bytes.HasPrefix(out.Bytes(), src))
+	assert.Contains(out.String(), "<pdfaid:part>2</pdfaid:part>")
+	assert.Contains(out.String(), "<dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">Two pages</rdf:li></rdf:Alt></dc:title>")
+	assert.Contains(out.String(), "<xmp:CreateDate>2019-11-14T12:00:00+00:00</xmp:CreateDate>")
+	assert.Contains(out.String(), "/S /GTS_PDFA1")
+
+	findings, err := pdfire.CheckArchive(bytes.NewReader(out.Bytes()), "pdf/a-2b")
+
+	assert.Nil(err)
+	assert.Equal([]string{}, findings)
+
+	withFile := bytes.NewBuffer(make([]byte, 0))
+	pdfire.AddProvenance(bytes.NewReader(src), withFile, &pdfire.ProvenanceRecord{Version: "v1.0.0"})
+	findings, err = pdfire.ConvertToArchive(bytes.NewReader(withFile.Bytes()), ioutil.Discard, "pdf/a-1b")
+
+	assert.Nil(err)
+	assert.Equal([]string{"The PDF has attached files, which PDF/A-1 forbids."}, findings)
+
+	options = pdfire.NewPostProcessOptions()
+	options.ArchiveFormat = "pdf/a-1b"
+	options.Optimize = true
+	out = bytes.NewBuffer(make([]byte, 0))
+	err = pdfire.PostProcess(context.Background(), bytes.NewReader(src), out, options)
+
+	assert.Nil(err)
+	assert.Contains(out.String(), "<pdfaid:part>1</pdfaid:part>")
+	assert.NotContains(out.String(), "/ObjStm")
+	assert.NotContains(out.String(), "/XRef")
+
+	options.XRefStreams = pdfire.StreamModeOn
+	err = pdfire.PostProcess(context.Background(), bytes.NewReader(src), ioutil.Discard, options)
+
+	assert.Equal(pdfire.ErrArchiveStreams, err)
+
+	options.UserPassword = "userpw"
+	err = pdfire.PostProcess(context.Background(), bytes.NewReader(src), ioutil.Discard, options)
+
+	assert.Equal(pdfire.ErrArchiveEncryption, err)
+}
+
+func TestPostProcessOptimize(t *testing.T) {
+	assert := assert.New(t)
+	wd, _ := os.Getwd()
+	src, _ := ioutil.ReadFile(filepath.Join(wd, "testdata/pages.pdf"))
+
+	options := pdfire.NewPostProcessOptions()
+	options.Optimize = true
+	out := bytes.NewBuffer(make([]byte, 0))
+	err := pdfire.PostProcess(context.Background(), bytes.NewReader(src), out, options)
+
+	assert.Nil(err)
+	assert.NotEqual(src, out.Bytes())
+
+	pages, err := pdfire.PageCount(bytes.NewReader(out.Bytes()))
+
+	assert.Nil(err)
+	assert.Equal(2, pages)
+}
+
+func TestPostProcessDeterministic(t *testing.T) {
+	assert := assert.New(t)
+	wd, _ := os.Getwd()
+	src, _ := ioutil.ReadFile(filepath.Join(wd, "testdata/pages.pdf"))
+
+	options := pdfire.NewPostProcessOptions()
+	options.Optimize = true
+	options.Deterministic = true
+	outputs := make([][]byte, 2)
+
+	for i := range outputs {
+		// pdfcpu sets the modification date to the current second.
+		if i > 0 {
+			time.Sleep(time.Second)
+		}
+
+		out := bytes.NewBuffer(make([]byte, 0))
+		err := pdfire.PostProcess(context.Background(), bytes.NewReader(src), out, options)
+
+		assert.Nil(err)
+		outputs[i] = out.Bytes()
+	}
+
+	assert.Equal(outputs[0], outputs[1])
+	assert.Contains(string(outputs[0]), "(D:20000101000000Z)")
+	assert.Contains(string(outputs[0]), "(pdfire)")
+
+	pages, err := pdfire.PageCount(bytes.NewReader(outputs[0]))
+
+	assert.Nil(err)
+	assert.Equal(2, pages)
+
+	// Only the Info dictionaries of all revisions and the trailers change,
+	// not a stream that contains the same keys.
+	content := "/CreationDate (D:19990101000000Z) /Producer (Editor) /ID [<AB> <CD>]"
+	objects := append(pageObjects()[:4],
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		"<< /CreationDate (D:20191114120000+00'00') /Producer (Skia/PDF m78) >>")
+	revised := buildPDF(objects, "/Info 6 0 R /ID [<0123456789ABCDEF0123456789ABCDEF> <0123456789ABCDEF0123456789ABCDEF>] ")
+	revised = appendUpdate(revised, map[int]string{
+		6: "<< /CreationDate (D:20191114120000+00'00') /ModDate (D:20191115120000+00'00') /Producer (pdfcpu v0.2.5) >>",
+	}, 7, startxref(revised))
+	out := bytes.NewBuffer(make([]byte, 0))
+	err = pdfire.PostProcess(context.Background(), bytes.NewReader(revised), out, &pdfire.PostProcessOptions{Deterministic: true})
+
+	assert.Nil(err)
+	assert.Len(out.Bytes(), len(revised))
+	assert.Contains(out.String(), content)
+	assert.Equal(3, strings.Count(out.String(), "(D:20000101000000Z)"))
+	assert.Equal(2, strings.Count(out.String(), "(pdfire)"))
+	assert.NotContains(out.String(), "D:2019")
+	assert.NotContains(out.String(), "0123456789ABCDEF")
+
+	options.UserPassword = "userpw"
+	err = pdfire.PostProcess(context.Background(), bytes.NewReader(src), bytes.NewBuffer(make([]byte, 0)), options)
+
+	assert.Equal(pdfire.ErrDeterministicEncryption, err)
+}
+
+func TestPostProcessSignature(t *testing.T) {
+	assert := assert.New(t)
+	wd, _ := os.Getwd()
+	src, _ := ioutil.ReadFile(filepath.Join(wd, "testdata/pages.pdf"))
+	certificate, _ := ioutil.ReadFile(filepath.Join(wd, "testdata/signature.p12"))
+
+	options := pdfire.NewPostProcessOptions()
+	options.Signature = &pdfire.SignatureConfig{
+		Certificate: certificate,
+		Password:    "secret",
+		Reason:      "Invoice",
+	}
+	out := bytes.NewBuffer(make([]byte, 0))
+	err := pdfire.PostProcess(context.Background(), bytes.NewReader(src), out, options)
+
+	assert.Nil(err)
+	assert.True(bytes.HasPrefix(out.Bytes(), src))
+	assert.Contains(out.String(), "/SubFilter /adbe.pkcs7.detached")
+	assert.Contains(out.String(), "/FT /Sig")
+
+	pages, err := pdfire.PageCount(bytes.NewReader(out.Bytes()))
+
+	assert.Nil(err)
+	assert.Equal(2, pages)
+
+	options.Signature.Password = "wrong"
+	err = pdfire.PostProcess(context.Background(), bytes.NewReader(src), bytes.NewBuffer(make([]byte, 0)), options)
+
+	assert.IsType(&pdfire.SignatureError{}, err)
+
+	options.Signature.Password = "secret"
+	options.UserPassword = "userpw"
+	err = pdfire.PostProcess(context.Background(), bytes.NewReader(src), bytes.NewBuffer(make([]byte, 0)), options)
+
+	assert.Equal(pdfire.ErrSignatureEncryption, err)
+}
+
+func TestPostProcessSignatureTimestamp(t *testing.T) {
+	assert := assert.New(t)
+	wd, _ := os.Getwd()
+	src, _ := ioutil.ReadFile(filepath.Join(wd, "testdata/pages.pdf"))
+	certificate, _ := ioutil.ReadFile(filepath.Join(wd, "testdata/signature.p12"))
+	tsa := httptest.NewServer(timestampHandler(false))
+	defer tsa.Close()
+	replayingTSA := httptest.NewServer(timestampHandler(true))
+	defer replayingTSA.Close()
+
+	options := pdfire.NewPostProcessOptions()
+	options.Signature = &pdfire.SignatureConfig{
+		Certificate:  certificate,
+		Password:     "secret",
+		TimestampURL: tsa.URL,
+	}
+	out := bytes.NewBuffer(make([]byte, 0))
+	err := pdfire.PostProcess(context.Background(), bytes.NewReader(src), out, options)
+
+	assert.Nil(err)
+	assert.True(bytes.HasPrefix(out.Bytes(), src))
+
+	options.Signature.TimestampURL = replayingTSA.URL
+	err = pdfire.PostProcess(context.Background(), bytes.NewReader(src), ioutil.Discard, options)
+
+	assert.IsType(&pdfire.TimestampError{}, err)
+
+	options.Signature.TimestampURL = tsa.URL
+	options.BlockPrivateNetworks = true
+	err = pdfire.PostProcess(context.Background(), bytes.NewReader(src), ioutil.Discard, options)
+
+	assert.Equal(&pdfire.URLNotAllowedError{URL: tsa.URL}, err)
+}
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+// timestampHandler answers RFC 3161 timestamp queries with unsigned tokens.
+// If replay is set, the tokens have the nonce of another query.
+func timestampHandler(replay bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var query struct {
+			Version        int
+			MessageImprint messageImprint
+			Nonce          *big.Int `asn1:"optional"`
+			CertReq        bool     `asn1:"optional"`
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		if _, err := asn1.Unmarshal(body, &query); err != nil || query.Nonce == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if replay {
+			query.Nonce.Add(query.Nonce, big.NewInt(1))
+		}
+
+		info, _ := asn1.Marshal(struct {
+			Version        int
+			Policy         asn1.ObjectIdentifier
+			MessageImprint messageImprint
+			SerialNumber   *big.Int
+			GenTime        time.Time `asn1:"generalized"`
+			Nonce          *big.Int
+		}{1, asn1.ObjectIdentifier{1, 2, 3, 4}, query.MessageImprint, big.NewInt(1), time.Now().UTC().Truncate(time.Second), query.Nonce})
+
+		type encapContentInfo struct {
+			ContentType asn1.ObjectIdentifier
+			Content     []byte `asn1:"explicit,tag:0"`
+		}
+
+		signedData, _ := asn1.Marshal(struct {
+			Version          int
+			DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+			EncapContentInfo encapContentInfo
+			SignerInfos      []asn1.RawValue `asn1:"set"`
+		}{3, nil, encapContentInfo{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}, info}, nil})
+
+		token, _ := asn1.Marshal(struct {
+			ContentType asn1.ObjectIdentifier
+			Content     asn1.RawValue
+		}{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData}})
+
+		reply, _ := asn1.Marshal(struct {
+			Status struct{ Status int }
+			Token  asn1.RawValue
+		}{Token: asn1.RawValue{FullBytes: token}})
+
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		w.Write(reply)
+	}
+}
+
+func TestPostProcessLinearize(t *testing.T) {
+	assert := assert.New(t)
+	wd, _ := os.Getwd()
+	src, _ := ioutil.ReadFile(filepath.Join(wd, "testdata/pages.pdf"))
+
+	options := pdfire.NewPostProcessOptions()
+	options.Linearize = true
+	out := bytes.NewBuffer(make([]byte, 0))
+	err := pdfire.PostProcess(context.Background(), bytes.NewReader(src), out, options)
+
+	if _, lerr := exec.LookPath("qpdf"); lerr != nil {
+		assert.Equal(pdfire.ErrQPDFNotFound, err)
+		return
+	}
+
+	assert.Nil(err)
+	assert.Contains(out.String(), "/Linearized 1")
+
+	pages, err := pdfire.PageCount(bytes.NewReader(out.Bytes()))
+
+	assert.Nil(err)
+	assert.Equal(2, pages)
+}
+
+func TestMergeFiles(t *testing.T) {
+	assert := assert.New(t)
+	wd, _ := os.Getwd()
+	src, _ := ioutil.ReadFile(filepath.Join(wd, "testdata/pages.pdf"))
+
+	out := bytes.NewBuffer(make([]byte, 0))
+	err := pdfire.MergeFiles(context.Background(), out, []*pdfire.MergeFile{
+		{PDF: bytes.NewReader(src), Title: "Invoice"},
+	}, pdfire.NewPostProcessOptions())
+
+	assert.Nil(err)
+	assert.Equal([]string{"Invoice:1"}, outlineItems(t, out.Bytes()))
+
+	err = pdfire.MergeFiles(context.Background(), ioutil.Discard, []*pdfire.MergeFile{}, pdfire.NewPostProcessOptions())
+
+	assert.Equal(pdfire.ErrNoPDFs, err)
+}
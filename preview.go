@@ -0,0 +1,149 @@
+package pdfire
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+var (
+	// ErrInvalidPreviewWidth is returned when a preview is requested with a width outside of 1 to MaxPreviewWidth pixels.
+	ErrInvalidPreviewWidth = errors.New("invalid preview width")
+)
+
+// MaxPreviewWidth is the maximum width of a preview in pixels.
+const MaxPreviewWidth = 4096
+
+// Preview renders the document like Convert does and writes a PNG image of
+// its first page, scaled to width pixels. The page is rendered with print
+// media on a viewport of the paper size, so the image approximates the first
+// page of the PDF without the margins, headers and footers.
+func (c *Converter) Preview(ctx context.Context, w io.Writer, options *ConversionOptions, width int64) error {
+	if width <= 0 || width > MaxPreviewWidth {
+		return ErrInvalidPreviewWidth
+	}
+
+	ctx, done, err := c.track(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer done()
+
+	if urls := options.urls(); len(urls) > 0 {
+		if err := c.validateURLs(options); err != nil {
+			return err
+		}
+
+		if err := c.checkURLs(ctx, options); err != nil {
+			return err
+		}
+
+		return c.preview(ctx, w, options, width, urls[0])
+	}
+
+	options, err = withHTMLDocument(options)
+
+	if err != nil {
+		return err
+	}
+
+	return c.preview(ctx, w, options, width, htmlDocumentURL)
+}
+
+func (c *Converter) preview(ctx context.Context, w io.Writer, options *ConversionOptions, width int64, location string) error {
+	ctx, cancel := conversionContext(ctx, options)
+	defer cancel()
+
+	ctx, timer := withPhaseTimer(ctx)
+	timer.enter(PhaseBrowser)
+
+	options = c.withURLGuard(options)
+	options, err := inlineTemplateImages(ctx, options)
+
+	if err != nil {
+		return err
+	}
+
+	tabCtx, cancel, err := c.newTabContext(ctx, options.ChromeArgs, options.ChromeWSURL)
+
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return timer.timeoutError()
+		}
+
+		return err
+	}
+
+	ctx = tabCtx
+
+	defer cancel()
+
+	beforeNavAction, events := beforeNavigation(options)
+	var data []byte
+
+	err = chromedp.Run(ctx,
+		beforeNavAction,
+		phaseAction(PhaseNavigation),
+		navigate(location, options.NavigationTimeout),
+		afterNavigation(options, events),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			enterPhase(ctx, PhasePrint)
+
+			var err error
+			data, err = capturePreview(ctx, options, width)
+
+			return err
+		}),
+	)
+
+	if ferr := events.failure(); ferr != nil {
+		return ferr
+	}
+
+	if err != nil {
+		if err == context.DeadlineExceeded || ctx.Err() == context.DeadlineExceeded {
+			return timer.timeoutError()
+		}
+
+		return err
+	}
+
+	_, err = w.Write(data)
+
+	return err
+}
+
+// capturePreview captures the area of the first page in print media.
+func capturePreview(ctx context.Context, options *ConversionOptions, width int64) ([]byte, error) {
+	params := options.PDFParams
+	pageWidth, pageHeight := params.PaperWidth*UnitToPixels["in"], params.PaperHeight*UnitToPixels["in"]
+
+	if params.Landscape {
+		pageWidth, pageHeight = pageHeight, pageWidth
+	}
+
+	viewportWidth, viewportHeight := int64(math.Ceil(pageWidth)), int64(math.Ceil(pageHeight))
+
+	if err := emulateMedia(ctx, MediaPrint, options); err != nil {
+		return nil, err
+	}
+
+	if err := emulation.SetDeviceMetricsOverride(viewportWidth, viewportHeight, 1, false).Do(ctx); err != nil {
+		return nil, err
+	}
+
+	return page.CaptureScreenshot().WithClip(&page.Viewport{
+		X:      0,
+		Y:      0,
+		Width:  pageWidth,
+		Height: pageHeight,
+		Scale:  float64(width) / pageWidth,
+	}).Do(ctx)
+}
@@ -0,0 +1,50 @@
+package pdfire
+
+import (
+	"context"
+
+	"github.com/chromedp/chromedp"
+)
+
+var (
+	// StageBrowser is reported when the browser or tab for the conversion is being set up.
+	StageBrowser = ProgressStage("browser")
+	// StageNavigation is reported when the navigation to the document starts.
+	StageNavigation = ProgressStage("navigation")
+	// StageWait is reported while waiting for the document to be ready.
+	StageWait = ProgressStage("wait")
+	// StagePrint is reported when printing starts and whenever PDF bytes have been transferred.
+	StagePrint = ProgressStage("print")
+	// StagePostProcess is reported when the printed PDF is being post-processed.
+	StagePostProcess = ProgressStage("postprocess")
+	// StageDone is reported when the PDF has been written.
+	StageDone = ProgressStage("done")
+)
+
+// ProgressStage is a coarse stage of a conversion.
+type ProgressStage string
+
+// Progress is reported to ConversionOptions.OnProgress.
+type Progress struct {
+	Stage ProgressStage
+	// Bytes is the number of PDF bytes transferred so far.
+	Bytes int64
+}
+
+func (o *ConversionOptions) progress(stage ProgressStage, bytes int64) {
+	if o.OnProgress == nil {
+		return
+	}
+
+	o.OnProgress(Progress{
+		Stage: stage,
+		Bytes: bytes,
+	})
+}
+
+func progressAction(options *ConversionOptions, stage ProgressStage) chromedp.ActionFunc {
+	return func(ctx context.Context) error {
+		options.progress(stage, 0)
+		return nil
+	}
+}
@@ -0,0 +1,308 @@
+package pdfire
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	// ErrNoProvenance is returned when a PDF has no provenance record.
+	ErrNoProvenance = errors.New("pdf has no provenance record")
+)
+
+// provenanceKey is the key of the provenance record in the document information dictionary.
+const provenanceKey = "PdfireProvenance"
+
+// ProvenanceFile is the name of the file attached to PDFs with a provenance record.
+const ProvenanceFile = "pdfire-provenance.json"
+
+// ProvenanceRecord describes how a PDF was created.
+type ProvenanceRecord struct {
+	// URL and URLs are the converted URLs.
+	URL  string   `json:"url,omitempty"`
+	URLs []string `json:"urls,omitempty"`
+	// HTMLHash is the hex-encoded SHA-256 hash of the converted HTML.
+	HTMLHash string `json:"htmlHash,omitempty"`
+	// OptionsDigest is the hex-encoded SHA-256 hash of the conversion options
+	// in JSON, without the HTML, headers and passwords.
+	OptionsDigest string    `json:"optionsDigest"`
+	Version       string    `json:"version"`
+	Created       time.Time `json:"created"`
+}
+
+// newProvenanceRecord returns the provenance record of a conversion.
+func newProvenanceRecord(options *ConversionOptions) (*ProvenanceRecord, error) {
+	record := &ProvenanceRecord{
+		URL:     options.URL,
+		URLs:    options.URLs,
+		Version: pdfireVersion(),
+		Created: time.Now().UTC(),
+	}
+
+	if options.Deterministic {
+		record.Created = deterministicDate
+	}
+
+	if options.HTML != "" {
+		sum := sha256.Sum256([]byte(options.HTML))
+		record.HTMLHash = hex.EncodeToString(sum[:])
+	}
+
+	// Secrets are left out, so that the digest cannot be used to guess them.
+	digested := *options
+	digested.HTML = ""
+	digested.Headers = nil
+	digested.OwnerPassword = ""
+	digested.UserPassword = ""
+	data, err := json.Marshal(&digested)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	record.OptionsDigest = hex.EncodeToString(sum[:])
+
+	return record, nil
+}
+
+// pdfireVersion returns the module version of pdfire the binary was built with.
+func pdfireVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == "github.com/imkiptoo/pdfire" {
+				return dep.Version
+			}
+		}
+	}
+
+	return "(devel)"
+}
+
+// AddProvenance adds a provenance record to a PDF, both to the document
+// information dictionary and as the attached file pdfire-provenance.json. The
+// record is appended as an incremental update.
+func AddProvenance(r io.Reader, w io.Writer, record *ProvenanceRecord) error {
+	doc, err := readPDF(r)
+
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(record)
+
+	if err != nil {
+		return err
+	}
+
+	u, err := doc.update()
+
+	if err != nil {
+		return err
+	}
+
+	info := pdfDict{}
+
+	if ref, ok := doc.trailer["Info"]; ok {
+		existing, err := doc.dict(ref)
+
+		if err != nil {
+			return err
+		}
+
+		for key, v := range existing {
+			info[key] = v
+		}
+	}
+
+	info[provenanceKey] = pdfString(asciiJSON(data))
+
+	if ref, ok := doc.trailer["Info"].(pdfRef); ok {
+		u.set(ref, info)
+	} else {
+		u.trailer["Info"] = u.add(info)
+	}
+
+	if err := attachFile(doc, u, ProvenanceFile, "application/json", data); err != nil {
+		return err
+	}
+
+	return u.write(w)
+}
+
+func addProvenance(buf *bytes.Buffer, options *ConversionOptions) (*bytes.Buffer, error) {
+	record, err := newProvenanceRecord(options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, buf.Len()+1024))
+
+	if err := AddProvenance(buf, out, record); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// ReadProvenance returns the provenance record of a PDF.
+func ReadProvenance(r io.Reader) (*ProvenanceRecord, error) {
+	doc, err := readPDF(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ref, ok := doc.trailer["Info"]
+
+	if !ok {
+		return nil, ErrNoProvenance
+	}
+
+	info, err := doc.dict(ref)
+
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := doc.resolve(info[provenanceKey])
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := value.(pdfString)
+
+	if !ok {
+		return nil, ErrNoProvenance
+	}
+
+	record := &ProvenanceRecord{}
+
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, ErrNoProvenance
+	}
+
+	return record, nil
+}
+
+// attachFile adds an embedded file to the document's name tree of embedded
+// files. Existing name trees are only extended if they consist of a single node.
+func attachFile(doc *pdfDocument, u *pdfUpdate, name, mimeType string, data []byte) error {
+	catalog, err := doc.dict(doc.trailer["Root"])
+
+	if err != nil {
+		return err
+	}
+
+	names := pdfDict{}
+
+	if ref, ok := catalog["Names"]; ok {
+		existing, err := doc.dict(ref)
+
+		if err != nil {
+			return err
+		}
+
+		for key, v := range existing {
+			names[key] = v
+		}
+	}
+
+	entries := make([]interface{}, 0, 2)
+
+	if ref, ok := names["EmbeddedFiles"]; ok {
+		tree, err := doc.dict(ref)
+
+		if err != nil {
+			return err
+		}
+
+		flat, err := doc.resolve(tree["Names"])
+
+		if err != nil {
+			return err
+		}
+
+		arr, ok := flat.([]interface{})
+
+		if !ok {
+			return nil
+		}
+
+		entries = append(entries, arr...)
+	}
+
+	stream := u.add(&pdfStream{
+		dict: pdfDict{
+			"Type":    pdfName("EmbeddedFile"),
+			"Subtype": pdfName(mimeType),
+			"Params":  pdfDict{"Size": int64(len(data))},
+		},
+		data: data,
+	})
+
+	spec := u.add(pdfDict{
+		"Type":           pdfName("Filespec"),
+		"F":              pdfText(name),
+		"UF":             pdfText(name),
+		"EF":             pdfDict{"F": stream},
+		"AFRelationship": pdfName("Data"),
+	})
+
+	// The keys of a name tree are sorted.
+	key := []byte(name)
+	i := 0
+
+	for ; i+1 < len(entries); i += 2 {
+		if s, ok := entries[i].(pdfString); ok && bytes.Compare(s, key) > 0 {
+			break
+		}
+	}
+
+	entries = append(entries[:i], append([]interface{}{pdfString(key), spec}, entries[i:]...)...)
+	names["EmbeddedFiles"] = pdfDict{"Names": entries}
+
+	updated := make(pdfDict, len(catalog)+1)
+
+	for key, v := range catalog {
+		updated[key] = v
+	}
+
+	updated["Names"] = names
+	u.set(doc.trailer["Root"].(pdfRef), updated)
+
+	return nil
+}
+
+// asciiJSON escapes the non-ASCII characters of JSON, so that it can be stored
+// as a PDF string without a text encoding.
+func asciiJSON(data []byte) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)))
+
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		data = data[size:]
+
+		switch {
+		case r < utf8.RuneSelf:
+			buf.WriteRune(r)
+		case r > 0xFFFF:
+			r -= 0x10000
+			fmt.Fprintf(buf, `\u%04x\u%04x`, 0xD800+(r>>10), 0xDC00+(r&0x3FF))
+		default:
+			fmt.Fprintf(buf, `\u%04x`, r)
+		}
+	}
+
+	return buf.Bytes()
+}
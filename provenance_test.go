@@ -0,0 +1,46 @@
+package pdfire_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/imkiptoo/pdfire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvenance(t *testing.T) {
+	assert := assert.New(t)
+	wd, _ := os.Getwd()
+	src, _ := ioutil.ReadFile(filepath.Join(wd, "testdata/pages.pdf"))
+	record := &pdfire.ProvenanceRecord{
+		URL:           "https://example.com/rechnung/äöü",
+		OptionsDigest: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		Version:       "v1.0.0",
+		Created:       time.Date(2019, 11, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	_, err := pdfire.ReadProvenance(bytes.NewReader(src))
+
+	assert.Equal(pdfire.ErrNoProvenance, err)
+
+	out := bytes.NewBuffer(make([]byte, 0))
+	err = pdfire.AddProvenance(bytes.NewReader(src), out, record)
+
+	assert.Nil(err)
+	assert.True(bytes.HasPrefix(out.Bytes(), src))
+	assert.Contains(out.String(), "/Type /EmbeddedFile")
+
+	read, err := pdfire.ReadProvenance(bytes.NewReader(out.Bytes()))
+
+	assert.Nil(err)
+	assert.Equal(record, read)
+
+	pages, err := pdfire.PageCount(bytes.NewReader(out.Bytes()))
+
+	assert.Nil(err)
+	assert.Equal(2, pages)
+}
@@ -0,0 +1,113 @@
+package pdfire
+
+import (
+	"fmt"
+	"sync"
+)
+
+// TooManyRedirectsError is returned when a converted URL redirected more often
+// than MaxRedirects allows.
+type TooManyRedirectsError struct {
+	URL          string
+	MaxRedirects int64
+}
+
+func (e *TooManyRedirectsError) Error() string {
+	return fmt.Sprintf("The URL \"%s\" redirected more than %d times.", e.URL, e.MaxRedirects)
+}
+
+// RedirectError is returned when a converted URL redirected to a URL that
+// matches FailOnRedirectTo, e.g. a login page.
+type RedirectError struct {
+	URL      string
+	Location string
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("The URL \"%s\" redirected to \"%s\".", e.URL, e.Location)
+}
+
+// redirectTracker follows the redirects of the main document and checks them
+// against MaxRedirects and FailOnRedirectTo.
+type redirectTracker struct {
+	max   int64
+	rules []*urlRule
+	mu    sync.Mutex
+	// url is the URL that started the current chain of redirects.
+	url   string
+	count int64
+}
+
+func newRedirectTracker(options *ConversionOptions) (*redirectTracker, error) {
+	rules, err := compileURLPatterns("failOnRedirectTo", options.FailOnRedirectTo)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if options.MaxRedirects < 0 {
+		return nil, &ParseError{Key: "maxRedirects", Value: options.MaxRedirects}
+	}
+
+	return &redirectTracker{max: options.MaxRedirects, rules: rules}, nil
+}
+
+// enabled reports whether the redirects are checked at all.
+func (t *redirectTracker) enabled() bool {
+	return t.max > 0 || len(t.rules) > 0
+}
+
+// start starts a new chain of redirects with the request of a document.
+func (t *redirectTracker) start(rawurl string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.url = rawurl
+	t.count = 0
+}
+
+// follow checks a redirect of the current chain to location.
+func (t *redirectTracker) follow(location string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.count++
+
+	if t.max > 0 && t.count > t.max {
+		return &TooManyRedirectsError{URL: t.url, MaxRedirects: t.max}
+	}
+
+	if matchesURL(t.rules, location) {
+		return &RedirectError{URL: t.url, Location: location}
+	}
+
+	return nil
+}
+
+func parseMaxRedirects(jsonMap map[string]interface{}) (int64, error) {
+	maxRedirects, err := parseInt64(jsonMap, "maxRedirects", 0)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if maxRedirects < 0 {
+		return 0, &ParseError{Key: "maxRedirects", Value: maxRedirects}
+	}
+
+	return maxRedirects, nil
+}
+
+func parseFailOnRedirectTo(jsonMap map[string]interface{}) ([]string, error) {
+	rules, err := parseStrings(jsonMap, "failOnRedirectTo", make([]string, 0))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := compileURLPatterns("failOnRedirectTo", rules); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,137 @@
+package pdfire
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/chromedp/cdproto/network"
+)
+
+// ResourceError is returned when FailOnResourceErrors is set and stylesheets,
+// fonts or images of the page failed to load.
+type ResourceError struct {
+	// Failures describe the failed resources, e.g.
+	// "https://example.com/logo.png (404)".
+	Failures []string
+}
+
+func (e *ResourceError) Error() string {
+	return fmt.Sprintf("The page failed to load resources: %s.", strings.Join(e.Failures, "; "))
+}
+
+// checkedResources are the resource types whose failures fail the conversion.
+var checkedResources = map[network.ResourceType]bool{
+	network.ResourceTypeStylesheet: true,
+	network.ResourceTypeFont:       true,
+	network.ResourceTypeImage:      true,
+}
+
+// resourceTracker records the failed stylesheets, fonts and images of a page
+// for FailOnResourceErrors.
+type resourceTracker struct {
+	enabled bool
+	ignore  []*urlRule
+	mu      sync.Mutex
+	// urls are the URLs of the pending checked requests.
+	urls     map[network.RequestID]string
+	failures []string
+}
+
+func newResourceTracker(options *ConversionOptions) (*resourceTracker, error) {
+	ignore, err := compileURLPatterns("ignoreResourceErrors", options.IgnoreResourceErrors)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &resourceTracker{
+		enabled: options.FailOnResourceErrors,
+		ignore:  ignore,
+		urls:    make(map[network.RequestID]string),
+	}, nil
+}
+
+// request records the URL of a request, as the failure events don't name it.
+func (t *resourceTracker) request(ev *network.EventRequestWillBeSent) {
+	if !checkedResources[ev.Type] || matchesURL(t.ignore, ev.Request.URL) {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.urls[ev.RequestID] = ev.Request.URL
+}
+
+// respond records a response with an error status, which Chrome doesn't
+// report as a failure.
+func (t *resourceTracker) respond(ev *network.EventResponseReceived) {
+	if ev.Response.Status < 400 {
+		return
+	}
+
+	t.failed(ev.RequestID, fmt.Sprintf("%d", ev.Response.Status))
+}
+
+// fail records a request that failed to load. Requests canceled by the page
+// or blocked on purpose, e.g. by BlockResources, are not failures.
+func (t *resourceTracker) fail(ev *network.EventLoadingFailed) {
+	if ev.Canceled || ev.ErrorText == "net::ERR_BLOCKED_BY_CLIENT" {
+		t.finish(ev.RequestID)
+		return
+	}
+
+	t.failed(ev.RequestID, ev.ErrorText)
+}
+
+// finish forgets a request that loaded.
+func (t *resourceTracker) finish(id network.RequestID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.urls, id)
+}
+
+func (t *resourceTracker) failed(id network.RequestID, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	url, ok := t.urls[id]
+
+	if !ok {
+		return
+	}
+
+	delete(t.urls, id)
+	t.failures = append(t.failures, fmt.Sprintf("%s (%s)", url, reason))
+}
+
+// resourceError returns the failures recorded so far, if any.
+func (t *resourceTracker) resourceError() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.failures) == 0 {
+		return nil
+	}
+
+	failures := make([]string, len(t.failures))
+	copy(failures, t.failures)
+
+	return &ResourceError{Failures: failures}
+}
+
+func parseIgnoreResourceErrors(jsonMap map[string]interface{}) ([]string, error) {
+	patterns, err := parseStrings(jsonMap, "ignoreResourceErrors", make([]string, 0))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := compileURLPatterns("ignoreResourceErrors", patterns); err != nil {
+		return nil, err
+	}
+
+	return patterns, nil
+}
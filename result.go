@@ -0,0 +1,162 @@
+package pdfire
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Result describes a PDF created by ConvertWithResult or MergeWithResult.
+type Result struct {
+	// Pages is the number of pages of the PDF.
+	Pages int
+	// Size is the size of the PDF in bytes.
+	Size int64
+	// Duration is the time the conversion took.
+	Duration time.Duration
+	// FinalURL is the URL of the last converted document after redirects. It's
+	// empty for HTML conversions.
+	FinalURL string
+	// Status is the HTTP status code of the last converted document. It's zero
+	// for HTML conversions.
+	Status int64
+	// Phases are the durations of the phases of the conversion, in order.
+	Phases []*PhaseDuration
+	// Warnings describe problems that didn't fail the conversion, e.g. crashed
+	// tabs that were replaced or blocked downloads.
+	Warnings []string
+	// Console are the messages that the page logged to the console and its
+	// uncaught exceptions, in order. At most maxConsoleMessages are kept.
+	Console []*ConsoleMessage
+	// Options are the effective options of a conversion, with the header and
+	// footer templates loaded and their images inlined.
+	Options *ConversionOptions
+	// Documents are the results of the documents of a merge, in order.
+	Documents []*Result
+
+	mu sync.Mutex
+}
+
+type resultKey struct{}
+
+// withResult returns a context whose conversion records its result in a new Result.
+func withResult(ctx context.Context) (context.Context, *Result) {
+	r := &Result{
+		Phases:   make([]*PhaseDuration, 0),
+		Warnings: make([]string, 0),
+		Console:  make([]*ConsoleMessage, 0),
+	}
+
+	return context.WithValue(ctx, resultKey{}, r), r
+}
+
+// resultFrom returns the result of ctx, or nil if the caller doesn't want one.
+func resultFrom(ctx context.Context) *Result {
+	r, _ := ctx.Value(resultKey{}).(*Result)
+
+	return r
+}
+
+// warn adds a warning. It's safe to call on a nil result and from event listeners.
+func (r *Result) warn(format string, args ...interface{}) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// maxConsoleMessages limits the console messages of a result, as a page may
+// log in a loop.
+const maxConsoleMessages = 1000
+
+// logConsole adds a console message. It's safe to call on a nil result and
+// from event listeners.
+func (r *Result) logConsole(message *ConsoleMessage) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.Console) < maxConsoleMessages {
+		r.Console = append(r.Console, message)
+	}
+}
+
+// setDocument records the response of a converted document.
+func (r *Result) setDocument(url string, status int64) {
+	if r == nil || isSameOrigin(url, htmlDocumentURL) {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.FinalURL = url
+	r.Status = status
+}
+
+// countPages returns the total number of pages of the PDFs.
+func countPages(bufs []*bytes.Buffer) (int, error) {
+	total := 0
+
+	for _, buf := range bufs {
+		pages, err := PageCount(bytes.NewReader(buf.Bytes()))
+
+		if err != nil {
+			return 0, err
+		}
+
+		total += pages
+	}
+
+	return total, nil
+}
+
+// ConvertWithResult creates a PDF like Convert and describes it.
+func ConvertWithResult(ctx context.Context, w io.Writer, options *ConversionOptions) (*Result, error) {
+	return defaultConverter.ConvertWithResult(ctx, w, options)
+}
+
+// MergeWithResult creates a PDF like Merge and describes it.
+func MergeWithResult(ctx context.Context, w io.Writer, options *MergeOptions) (*Result, error) {
+	return defaultConverter.MergeWithResult(ctx, w, options)
+}
+
+// ConvertWithResult creates a PDF like Convert and describes it.
+func (c *Converter) ConvertWithResult(ctx context.Context, w io.Writer, options *ConversionOptions) (*Result, error) {
+	ctx, result := withResult(ctx)
+	start := time.Now()
+
+	if err := c.Convert(ctx, w, options); err != nil {
+		return nil, err
+	}
+
+	result.Duration = time.Since(start)
+
+	return result, nil
+}
+
+// MergeWithResult creates a PDF like Merge and describes it. The phases of the
+// result are empty, as the documents are converted in parallel; they are
+// part of the results of the documents.
+func (c *Converter) MergeWithResult(ctx context.Context, w io.Writer, options *MergeOptions) (*Result, error) {
+	ctx, result := withResult(ctx)
+	start := time.Now()
+
+	if err := c.Merge(ctx, w, options); err != nil {
+		return nil, err
+	}
+
+	result.Duration = time.Since(start)
+
+	return result, nil
+}
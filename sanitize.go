@@ -0,0 +1,286 @@
+package pdfire
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// droppedElements are removed together with their content.
+var droppedElements = map[string]bool{
+	"applet":        true,
+	"base":          true,
+	"embed":         true,
+	"foreignobject": true,
+	"frame":         true,
+	"frameset":      true,
+	"iframe":        true,
+	"noembed":       true,
+	"noscript":      true,
+	"object":        true,
+	"script":        true,
+	"template":      true,
+}
+
+// allowedElements are kept by the sanitizer. Other elements are replaced by their content.
+var allowedElements = map[string]bool{
+	"a": true, "abbr": true, "address": true, "article": true, "aside": true,
+	"b": true, "bdi": true, "bdo": true, "blockquote": true, "body": true, "br": true,
+	"caption": true, "cite": true, "code": true, "col": true, "colgroup": true,
+	"dd": true, "del": true, "details": true, "dfn": true, "div": true, "dl": true, "dt": true,
+	"em": true, "figcaption": true, "figure": true, "font": true, "footer": true, "form": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"head": true, "header": true, "hr": true, "html": true, "i": true, "img": true,
+	"input": true, "ins": true, "kbd": true, "label": true, "legend": true, "li": true,
+	"main": true, "mark": true, "meta": true, "nav": true, "ol": true,
+	"p": true, "picture": true, "pre": true, "q": true, "s": true, "samp": true,
+	"section": true, "select": true, "option": true, "small": true, "source": true,
+	"span": true, "strike": true, "strong": true, "style": true, "sub": true,
+	"summary": true, "sup": true, "table": true, "tbody": true, "td": true,
+	"textarea": true, "tfoot": true, "th": true, "thead": true, "time": true,
+	"title": true, "tr": true, "u": true, "ul": true, "var": true, "wbr": true,
+	"fieldset": true,
+
+	// SVG
+	"svg": true, "g": true, "path": true, "rect": true, "circle": true, "ellipse": true,
+	"line": true, "polyline": true, "polygon": true, "text": true, "tspan": true,
+	"defs": true, "lineargradient": true, "radialgradient": true, "stop": true,
+	"clippath": true, "mask": true, "pattern": true, "symbol": true, "desc": true,
+}
+
+// allowedAttributes are kept by the sanitizer, in addition to aria-* and data-* attributes.
+var allowedAttributes = map[string]bool{
+	"align": true, "alt": true, "bgcolor": true, "border": true, "cellpadding": true,
+	"cellspacing": true, "charset": true, "checked": true, "cite": true, "class": true,
+	"color": true, "cols": true, "colspan": true, "datetime": true, "dir": true,
+	"disabled": true, "face": true, "for": true, "headers": true, "height": true,
+	"href": true, "id": true, "lang": true, "media": true, "name": true, "open": true,
+	"placeholder": true, "readonly": true, "rel": true, "reversed": true, "role": true,
+	"rows": true, "rowspan": true, "scope": true, "selected": true, "size": true,
+	"sizes": true, "span": true, "src": true, "srcset": true, "start": true,
+	"style": true, "summary": true, "title": true, "type": true, "valign": true,
+	"value": true, "width": true, "action": true, "method": true,
+
+	// SVG
+	"viewbox": true, "xmlns": true, "d": true, "fill": true, "fill-opacity": true,
+	"fill-rule": true, "stroke": true, "stroke-width": true, "stroke-opacity": true,
+	"stroke-linecap": true, "stroke-linejoin": true, "stroke-dasharray": true,
+	"transform": true, "x": true, "y": true, "x1": true, "y1": true, "x2": true,
+	"y2": true, "cx": true, "cy": true, "r": true, "rx": true, "ry": true,
+	"points": true, "offset": true, "stop-color": true, "stop-opacity": true,
+	"opacity": true, "font-size": true, "font-family": true, "font-weight": true,
+	"text-anchor": true, "dominant-baseline": true, "clip-path": true,
+	"gradientunits": true, "gradienttransform": true, "preserveaspectratio": true,
+}
+
+// urlAttributes are attributes whose value is a URL.
+var urlAttributes = map[string]bool{
+	"action":     true,
+	"background": true,
+	"cite":       true,
+	"formaction": true,
+	"href":       true,
+	"poster":     true,
+	"src":        true,
+}
+
+// allowedSchemes are the URL schemes kept by the sanitizer. Relative URLs are always allowed.
+var allowedSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+	"tel":    true,
+}
+
+// SanitizeHTML removes scripts, event handlers, external form actions and
+// dangerous URL protocols from an HTML document using an allowlist of elements
+// and attributes.
+func SanitizeHTML(src string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(src))
+
+	if err != nil {
+		return "", err
+	}
+
+	sanitizeNode(doc)
+
+	buf := bytes.NewBuffer([]byte{})
+
+	if err := html.Render(buf, doc); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+func sanitizeNode(n *html.Node) {
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+
+		switch child.Type {
+		case html.CommentNode:
+			n.RemoveChild(child)
+		case html.ElementNode:
+			name := strings.ToLower(child.Data)
+
+			if droppedElements[name] {
+				n.RemoveChild(child)
+				break
+			}
+
+			// Style elements in SVG or MathML are parsed differently from those
+			// in HTML, so their text could become markup when the sanitized
+			// document is parsed again.
+			if name == "style" && (child.Namespace != "" || !isSafeStyleSheet(child)) {
+				n.RemoveChild(child)
+				break
+			}
+
+			sanitizeNode(child)
+
+			if !allowedElements[name] || (name == "meta" && hasAttribute(child, "http-equiv")) {
+				unwrapNode(n, child)
+				break
+			}
+
+			child.Attr = sanitizeAttributes(name, child.Attr)
+		default:
+			sanitizeNode(child)
+		}
+
+		child = next
+	}
+}
+
+// unwrapNode replaces child with its own children.
+func unwrapNode(parent, child *html.Node) {
+	for grandchild := child.FirstChild; grandchild != nil; {
+		next := grandchild.NextSibling
+		child.RemoveChild(grandchild)
+		parent.InsertBefore(grandchild, child)
+		grandchild = next
+	}
+
+	parent.RemoveChild(child)
+}
+
+func sanitizeAttributes(element string, attrs []html.Attribute) []html.Attribute {
+	sanitized := make([]html.Attribute, 0, len(attrs))
+
+	for _, attr := range attrs {
+		key := strings.ToLower(attr.Key)
+
+		if !allowedAttributes[key] && !strings.HasPrefix(key, "aria-") && !strings.HasPrefix(key, "data-") {
+			continue
+		}
+
+		if urlAttributes[key] && !isSafeURL(attr.Val, element == "img" && key == "src") {
+			continue
+		}
+
+		// Forms may only submit to the document's own origin.
+		if key == "action" && isAbsoluteURL(attr.Val) {
+			continue
+		}
+
+		if key == "srcset" && !isSafeSrcset(attr.Val) {
+			continue
+		}
+
+		if key == "style" && !isSafeStyle(attr.Val) {
+			continue
+		}
+
+		sanitized = append(sanitized, attr)
+	}
+
+	return sanitized
+}
+
+func hasAttribute(n *html.Node, key string) bool {
+	for _, attr := range n.Attr {
+		if strings.EqualFold(attr.Key, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isSafeURL reports whether a URL has an allowed scheme. Data URLs are only
+// allowed for raster images.
+func isSafeURL(raw string, image bool) bool {
+	raw = strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+
+		return r
+	}, raw)
+
+	u, err := url.Parse(raw)
+
+	if err != nil {
+		return false
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+
+	if scheme == "" {
+		return true
+	}
+
+	if scheme == "data" {
+		opaque := strings.ToLower(u.Opaque)
+		return image && strings.HasPrefix(opaque, "image/") && !strings.HasPrefix(opaque, "image/svg")
+	}
+
+	return allowedSchemes[scheme]
+}
+
+func isAbsoluteURL(raw string) bool {
+	u, err := url.Parse(strings.TrimSpace(raw))
+
+	return err != nil || u.Scheme != "" || u.Host != ""
+}
+
+func isSafeSrcset(srcset string) bool {
+	for _, candidate := range strings.Split(srcset, ",") {
+		fields := strings.Fields(candidate)
+
+		if len(fields) > 0 && !isSafeURL(fields[0], true) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isSafeStyle(style string) bool {
+	style = strings.ToLower(style)
+
+	return !strings.Contains(style, "expression(") &&
+		!strings.Contains(style, "javascript:") &&
+		!strings.Contains(style, "vbscript:") &&
+		!strings.Contains(style, "@import")
+}
+
+// isSafeStyleSheet reports whether the text of a style element doesn't load
+// other resources. Escapes are refused, as they could hide a url().
+func isSafeStyleSheet(n *html.Node) bool {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.TextNode {
+			return false
+		}
+
+		text := strings.ToLower(child.Data)
+
+		if !isSafeStyle(text) || strings.Contains(text, "url(") || strings.Contains(text, `\`) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,43 @@
+package pdfire_test
+
+import (
+	"testing"
+
+	"github.com/imkiptoo/pdfire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	assert := assert.New(t)
+
+	html, err := pdfire.SanitizeHTML(`<html><head><script>alert(1)</script><meta http-equiv="refresh" content="0;url=https://example.com"></head>` +
+		`<body><p class="intro" onclick="alert(2)">Hello <custom>World</custom></p>` +
+		`<a href="javascript:alert(3)">link</a><a href="https://example.com">safe</a>` +
+		`<img src="data:image/png;base64,AAAA"><img src="data:text/html;base64,AAAA">` +
+		`<form action="https://evil.example.com/collect"><input name="q"></form>` +
+		`<iframe src="https://example.com"></iframe></body></html>`)
+
+	assert.Nil(err)
+	assert.Equal(`<html><head></head>`+
+		`<body><p class="intro">Hello World</p>`+
+		`<a>link</a><a href="https://example.com">safe</a>`+
+		`<img src="data:image/png;base64,AAAA"/><img/>`+
+		`<form><input name="q"/></form>`+
+		`</body></html>`, html)
+}
+
+func TestSanitizeHTMLStyle(t *testing.T) {
+	assert := assert.New(t)
+
+	html, err := pdfire.SanitizeHTML(`<svg><style>&lt;img src=x onerror=alert(1)&gt;</style></svg>` +
+		`<math><style>&lt;img src=x onerror=alert(2)&gt;</style></math>` +
+		`<style>@import "https://evil.example.com/a.css";</style>` +
+		`<style>p { background: u\72l(https://evil.example.com/b.png) }</style>` +
+		`<link rel="stylesheet" href="https://evil.example.com/c.css">` +
+		`<style>p { color: red }</style>`)
+
+	assert.Nil(err)
+	assert.NotContains(html, "<img")
+	assert.NotContains(html, "evil.example.com")
+	assert.Equal(`<html><head></head><body><svg></svg><style>p { color: red }</style></body></html>`, html)
+}
@@ -0,0 +1,66 @@
+package pdfire
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// autoScrollTimeout is the maximum time spent scrolling, since pages with
+// infinite scrolling never reach the bottom.
+const autoScrollTimeout = 15 * time.Second
+
+// autoScrollStepDelay is the time given to lazy content after each step.
+const autoScrollStepDelay = 100 * time.Millisecond
+
+// autoScrollScript scrolls the page to the bottom, one viewport at a time, so
+// that IntersectionObserver-based lazy loading fires for the whole page. It
+// scrolls back to the top afterwards.
+const autoScrollScript = `(function (timeout, delay) {
+	var deadline = Date.now() + timeout;
+
+	function frame() {
+		return new Promise(function (resolve) {
+			requestAnimationFrame(function () { setTimeout(resolve, delay); });
+		});
+	}
+
+	function step() {
+		return frame().then(function () {
+			var height = Math.max(document.body ? document.body.scrollHeight : 0, document.documentElement.scrollHeight);
+
+			if (window.scrollY + window.innerHeight >= height || Date.now() > deadline) {
+				return;
+			}
+
+			var before = window.scrollY;
+			window.scrollBy(0, window.innerHeight);
+
+			// The page cannot scroll any further.
+			if (window.scrollY === before) {
+				return;
+			}
+
+			return step();
+		});
+	}
+
+	return step().then(frame).then(function () {
+		window.scrollTo(0, 0);
+		return true;
+	});
+})(%d, %d)`
+
+// autoScroll scrolls through the page to trigger its lazy content.
+func autoScroll(ctx context.Context) error {
+	var done bool
+
+	script := fmt.Sprintf(autoScrollScript, autoScrollTimeout/time.Millisecond, autoScrollStepDelay/time.Millisecond)
+
+	return chromedp.Evaluate(script, &done, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+		return p.WithAwaitPromise(true)
+	}).Do(ctx)
+}
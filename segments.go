@@ -0,0 +1,265 @@
+package pdfire
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidPageRanges is returned when page ranges like "1-5, 8" cannot be parsed.
+	ErrInvalidPageRanges = errors.New("invalid page ranges")
+)
+
+// blankTemplate hides Chrome's default header or footer.
+const blankTemplate = "<span></span>"
+
+// lastPage stands for the open end of a page range like "3-".
+const lastPage = math.MaxInt32
+
+type pageRange struct {
+	from int
+	to   int
+}
+
+// printSegment is a run of consecutive pages printed with the same header,
+// footer and orientation.
+type printSegment struct {
+	ranges              []pageRange
+	headerTemplate      string
+	footerTemplate      string
+	displayHeaderFooter bool
+	landscape           bool
+}
+
+// printSegments splits the document into segments that need different headers,
+// footers or orientations. A single segment means that the document can be
+// printed at once. Chrome lays out the document anew for every orientation, so
+// the LandscapePageRanges should begin and end at forced page breaks.
+func printSegments(options *ConversionOptions) ([]*printSegment, error) {
+	params := options.PDFParams
+	selected := []pageRange{{from: 1, to: lastPage}}
+
+	if params.PageRanges != "" {
+		var err error
+
+		if selected, err = parsePageRangesLenient(params.PageRanges, params.IgnoreInvalidPageRanges); err != nil {
+			return nil, err
+		}
+	}
+
+	var headerFooter []pageRange
+
+	if options.HeaderFooterPageRanges != "" {
+		var err error
+
+		if headerFooter, err = parsePageRanges(options.HeaderFooterPageRanges); err != nil {
+			return nil, err
+		}
+	}
+
+	var landscape []pageRange
+
+	if options.LandscapePageRanges != "" {
+		var err error
+
+		if landscape, err = parsePageRanges(options.LandscapePageRanges); err != nil {
+			return nil, err
+		}
+	}
+
+	firstPage := options.FirstPageHeaderTemplate != "" || options.FirstPageFooterTemplate != ""
+	boundaries := []int{1}
+
+	if firstPage {
+		boundaries = append(boundaries, 2)
+	}
+
+	for _, r := range append(headerFooter, landscape...) {
+		boundaries = append(boundaries, r.from)
+
+		if r.to != lastPage {
+			boundaries = append(boundaries, r.to+1)
+		}
+	}
+
+	sort.Ints(boundaries)
+	boundaries = uniqueInts(boundaries)
+	segments := make([]*printSegment, 0, len(boundaries))
+
+	for i, from := range boundaries {
+		to := lastPage
+
+		if i+1 < len(boundaries) {
+			to = boundaries[i+1] - 1
+		}
+
+		if from > to {
+			continue
+		}
+
+		segment := &printSegment{
+			headerTemplate:      params.HeaderTemplate,
+			footerTemplate:      params.FooterTemplate,
+			displayHeaderFooter: params.DisplayHeaderFooter,
+			landscape:           params.Landscape || len(intersectPageRanges(landscape, pageRange{from: from, to: from})) > 0,
+		}
+
+		// Boundaries split the ranges, so a segment is either inside of a range or outside of all ranges.
+		if headerFooter != nil && len(intersectPageRanges(headerFooter, pageRange{from: from, to: from})) == 0 {
+			segment.displayHeaderFooter = false
+		}
+
+		if firstPage && from == 1 {
+			header, footer := params.HeaderTemplate, params.FooterTemplate
+
+			if !params.DisplayHeaderFooter {
+				header, footer = "", ""
+			}
+
+			segment.displayHeaderFooter = true
+			segment.headerTemplate = firstNonEmpty(options.FirstPageHeaderTemplate, header, blankTemplate)
+			segment.footerTemplate = firstNonEmpty(options.FirstPageFooterTemplate, footer, blankTemplate)
+		}
+
+		segment.ranges = intersectPageRanges(selected, pageRange{from: from, to: to})
+
+		if len(segment.ranges) == 0 {
+			continue
+		}
+
+		// Adjacent segments with the same params are printed together.
+		if n := len(segments); n > 0 && segments[n-1].sameParams(segment) {
+			segments[n-1].ranges = append(segments[n-1].ranges, segment.ranges...)
+			continue
+		}
+
+		segments = append(segments, segment)
+	}
+
+	return segments, nil
+}
+
+func (s *printSegment) sameParams(other *printSegment) bool {
+	return s.displayHeaderFooter == other.displayHeaderFooter &&
+		s.landscape == other.landscape &&
+		s.headerTemplate == other.headerTemplate &&
+		s.footerTemplate == other.footerTemplate
+}
+
+// parsePageRanges parses page ranges in Chrome's syntax, e.g. "1-5, 8, 11-".
+func parsePageRanges(s string) ([]pageRange, error) {
+	return parsePageRangesLenient(s, false)
+}
+
+// parsePageRangesLenient parses page ranges like parsePageRanges. If lenient is
+// true, ranges that are syntactically valid but select no page, like "3-2",
+// are skipped like Chrome does with IgnoreInvalidPageRanges.
+func parsePageRangesLenient(s string, lenient bool) ([]pageRange, error) {
+	ranges := make([]pageRange, 0)
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+
+		if part == "" {
+			continue
+		}
+
+		bounds := strings.SplitN(part, "-", 2)
+		r := pageRange{from: 1, to: lastPage}
+		var err error
+
+		if from := strings.TrimSpace(bounds[0]); from != "" {
+			if r.from, err = strconv.Atoi(from); err != nil {
+				return nil, ErrInvalidPageRanges
+			}
+		}
+
+		if len(bounds) == 1 {
+			r.to = r.from
+		} else if to := strings.TrimSpace(bounds[1]); to != "" {
+			if r.to, err = strconv.Atoi(to); err != nil {
+				return nil, ErrInvalidPageRanges
+			}
+		}
+
+		if lenient && r.from >= 1 && r.to < r.from {
+			continue
+		}
+
+		if r.from < 1 || r.to < r.from {
+			return nil, ErrInvalidPageRanges
+		}
+
+		ranges = append(ranges, r)
+	}
+
+	if len(ranges) == 0 {
+		return nil, ErrInvalidPageRanges
+	}
+
+	return ranges, nil
+}
+
+func formatPageRanges(ranges []pageRange) string {
+	parts := make([]string, len(ranges))
+
+	for i, r := range ranges {
+		switch {
+		case r.to == lastPage:
+			parts[i] = fmt.Sprintf("%d-", r.from)
+		case r.from == r.to:
+			parts[i] = strconv.Itoa(r.from)
+		default:
+			parts[i] = fmt.Sprintf("%d-%d", r.from, r.to)
+		}
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func intersectPageRanges(ranges []pageRange, bounds pageRange) []pageRange {
+	res := make([]pageRange, 0)
+
+	for _, r := range ranges {
+		if r.from < bounds.from {
+			r.from = bounds.from
+		}
+
+		if r.to > bounds.to {
+			r.to = bounds.to
+		}
+
+		if r.from <= r.to {
+			res = append(res, r)
+		}
+	}
+
+	return res
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// uniqueInts removes duplicates from sorted ints.
+func uniqueInts(ints []int) []int {
+	res := ints[:0]
+
+	for i, n := range ints {
+		if i == 0 || n != ints[i-1] {
+			res = append(res, n)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,398 @@
+package pdfire
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+var (
+	// ErrWaitForSelectorTimeout is returned when the WaitForSelector elements don't reach their state within WaitForSelectorTimeout.
+	ErrWaitForSelectorTimeout = errors.New("WaitForSelector timed out")
+)
+
+var (
+	// SelectorStateAttached waits until the element is in the DOM.
+	SelectorStateAttached = SelectorState("attached")
+	// SelectorStateVisible waits until the element is in the DOM and visible.
+	SelectorStateVisible = SelectorState("visible")
+	// SelectorStateHidden waits until the element is hidden or not in the DOM.
+	SelectorStateHidden = SelectorState("hidden")
+)
+
+// SelectorState is the state of the WaitForSelector element to wait for.
+type SelectorState string
+
+var (
+	// SelectorPolicyAllOf waits until all WaitForSelector elements are in the awaited state.
+	SelectorPolicyAllOf = SelectorPolicy("allOf")
+	// SelectorPolicyAnyOf waits until one of the WaitForSelector elements is in the awaited state.
+	SelectorPolicyAnyOf = SelectorPolicy("anyOf")
+)
+
+// SelectorPolicy decides whether all or any of the WaitForSelector elements are awaited.
+type SelectorPolicy string
+
+var (
+	// SelectorModeExtract replaces the content of the body with the selected
+	// elements, wrapped in copies of their ancestors. The elements are printed
+	// in the order of the selectors.
+	SelectorModeExtract = SelectorMode("extract")
+	// SelectorModeIsolate hides everything but the selected elements and their
+	// ancestors, so the elements keep their stylesheets and computed styles.
+	// The elements are printed in document order.
+	SelectorModeIsolate = SelectorMode("isolate")
+)
+
+// SelectorMode is how the elements of Selector and Selectors are printed.
+type SelectorMode string
+
+// selectorPollInterval is how often the WaitForSelector element is checked.
+const selectorPollInterval = 100 * time.Millisecond
+
+// selectorStateScript reports whether all or any of the first elements
+// matching the selectors are in the given state. Invalid selectors throw.
+const selectorStateScript = `(function (selectors, state, any) {
+	function ready(selector) {
+		var el = document.querySelector(selector);
+		var visible = !!el && getComputedStyle(el).visibility !== 'hidden' &&
+			!!(el.offsetWidth || el.offsetHeight || el.getClientRects().length);
+
+		switch (state) {
+		case 'visible':
+			return visible;
+		case 'hidden':
+			return !visible;
+		default:
+			return !!el;
+		}
+	}
+
+	return any ? selectors.some(ready) : selectors.every(ready);
+})(%s, %s, %t)`
+
+// waitForSelectors polls the page until all or, depending on the policy, any
+// of the elements matching the selectors are in the given state. A timeout of
+// zero waits as long as the conversion may take.
+func waitForSelectors(ctx context.Context, selectors []string, policy SelectorPolicy, state SelectorState, timeout time.Duration) error {
+	waitCtx, cancel := ctx, context.CancelFunc(func() {})
+
+	if timeout > 0 {
+		waitCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	defer cancel()
+
+	sels, err := json.Marshal(selectors)
+
+	if err != nil {
+		return err
+	}
+
+	st, err := json.Marshal(string(state))
+
+	if err != nil {
+		return err
+	}
+
+	script := fmt.Sprintf(selectorStateScript, sels, st, policy == SelectorPolicyAnyOf)
+
+	for {
+		var ok bool
+
+		if err := chromedp.Evaluate(script, &ok).Do(waitCtx); err != nil {
+			if ctx.Err() == nil && waitCtx.Err() == context.DeadlineExceeded {
+				return ErrWaitForSelectorTimeout
+			}
+
+			return err
+		}
+
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-time.After(selectorPollInterval):
+		case <-waitCtx.Done():
+			if ctx.Err() == nil {
+				return ErrWaitForSelectorTimeout
+			}
+
+			return ctx.Err()
+		}
+	}
+}
+
+// scrollIntoViewTimeout is the maximum time spent waiting for the lazy content
+// of the selected elements.
+const scrollIntoViewTimeout = 10 * time.Second
+
+// scrollIntoViewScript scrolls through the elements matching the selectors, one
+// viewport at a time, so that virtualized and lazy content inside of them is
+// rendered. It waits for the images of the elements and scrolls back to the
+// top afterwards.
+const scrollIntoViewScript = `(function (selectors, timeout) {
+	var deadline = Date.now() + timeout;
+
+	function frame() {
+		return new Promise(function (resolve) {
+			requestAnimationFrame(function () { setTimeout(resolve, 0); });
+		});
+	}
+
+	function images(el) {
+		var pending = Array.prototype.map.call(el.querySelectorAll('img'), function (img) {
+			if (img.loading === 'lazy') {
+				img.loading = 'eager';
+			}
+
+			if (img.complete) {
+				return null;
+			}
+
+			return new Promise(function (resolve) {
+				img.addEventListener('load', resolve, { once: true });
+				img.addEventListener('error', resolve, { once: true });
+			});
+		});
+
+		return Promise.race([
+			Promise.all(pending),
+			new Promise(function (resolve) { setTimeout(resolve, Math.max(0, deadline - Date.now())); })
+		]);
+	}
+
+	var elements = [];
+
+	selectors.forEach(function (selector) {
+		var el = document.querySelector(selector);
+
+		if (el) {
+			elements.push(el);
+		}
+	});
+
+	return elements.reduce(function (done, el) {
+		return done.then(function () {
+			el.scrollIntoView({ block: 'start' });
+
+			var top = window.scrollY;
+			var bottom = top + el.getBoundingClientRect().height;
+
+			function step() {
+				return frame().then(frame).then(function () {
+					if (window.scrollY + window.innerHeight >= bottom || Date.now() > deadline) {
+						return;
+					}
+
+					var before = window.scrollY;
+					window.scrollBy(0, window.innerHeight);
+
+					// The page cannot scroll any further.
+					if (window.scrollY === before) {
+						return;
+					}
+
+					return step();
+				});
+			}
+
+			return step().then(function () { return images(el); });
+		});
+	}, Promise.resolve()).then(function () {
+		window.scrollTo(0, 0);
+		return true;
+	});
+})(%s, %d)`
+
+// scrollIntoView scrolls the elements matching the selectors into view and
+// waits for their lazy content, since virtualized components only render what
+// has been in the viewport.
+func scrollIntoView(ctx context.Context, selectors []string) error {
+	sels, err := json.Marshal(selectors)
+
+	if err != nil {
+		return err
+	}
+
+	var done bool
+
+	return chromedp.Evaluate(fmt.Sprintf(scrollIntoViewScript, sels, scrollIntoViewTimeout/time.Millisecond), &done, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+		return p.WithAwaitPromise(true)
+	}).Do(ctx)
+}
+
+// extractSelectorsScript replaces the children of the body with the selected
+// elements, in the order of the selectors. Each element is wrapped in shallow
+// copies of its ancestors, so that the body keeps its attributes and the rules
+// of the style sheets that depend on the ancestors, like ".dashboard .chart",
+// still match. The elements are moved rather than copied to keep the state of
+// canvases and form fields.
+const extractSelectorsScript = `(function (selectors, pageBreaks) {
+	var parts = selectors.map(function (selector) {
+		var el = document.querySelector(selector);
+
+		if (!el) {
+			throw new Error('No element matches selector ' + JSON.stringify(selector) + '.');
+		}
+
+		var chain = [];
+
+		for (var node = el.parentElement; node && node !== document.body && node !== document.documentElement; node = node.parentElement) {
+			chain.push(node.cloneNode(false));
+		}
+
+		return { el: el, chain: chain };
+	});
+
+	var body = document.body;
+
+	while (body.firstChild) {
+		body.removeChild(body.firstChild);
+	}
+
+	parts.forEach(function (part, i) {
+		var wrapped = part.el;
+
+		part.chain.forEach(function (shell) {
+			shell.appendChild(wrapped);
+			wrapped = shell;
+		});
+
+		if (pageBreaks && i > 0) {
+			var br = document.createElement('div');
+			br.style.setProperty('break-before', 'page');
+			br.style.setProperty('page-break-before', 'always');
+			body.appendChild(br);
+		}
+
+		body.appendChild(wrapped);
+	});
+
+	return true;
+})(%s, %t)`
+
+// extractSelectors replaces the content of the body with the elements matching
+// the selectors.
+func extractSelectors(ctx context.Context, selectors []string, pageBreaks bool) error {
+	sels, err := json.Marshal(selectors)
+
+	if err != nil {
+		return err
+	}
+
+	var done bool
+
+	return chromedp.Evaluate(fmt.Sprintf(extractSelectorsScript, sels, pageBreaks), &done).Do(ctx)
+}
+
+// isolateSelectorsScript hides the siblings of the selected elements and of
+// their ancestors, unless they contain a selected element themselves.
+const isolateSelectorsScript = `(function (selectors, pageBreaks) {
+	var keep = selectors.map(function (selector, i) {
+		var el = document.querySelector(selector);
+
+		if (!el) {
+			throw new Error('No element matches selector ' + JSON.stringify(selector) + '.');
+		}
+
+		if (pageBreaks && i > 0) {
+			el.style.setProperty('break-before', 'page', 'important');
+		}
+
+		return el;
+	});
+
+	function kept(node) {
+		return keep.some(function (el) { return node.contains(el) || el.contains(node); });
+	}
+
+	keep.forEach(function (el) {
+		for (var node = el; node.parentElement; node = node.parentElement) {
+			Array.prototype.forEach.call(node.parentElement.children, function (sibling) {
+				if (!kept(sibling)) {
+					sibling.style.setProperty('display', 'none', 'important');
+				}
+			});
+		}
+	});
+
+	return true;
+})(%s, %t)`
+
+// isolateSelectors hides everything but the elements matching the selectors.
+func isolateSelectors(ctx context.Context, selectors []string, pageBreaks bool) error {
+	sels, err := json.Marshal(selectors)
+
+	if err != nil {
+		return err
+	}
+
+	var done bool
+
+	return chromedp.Evaluate(fmt.Sprintf(isolateSelectorsScript, sels, pageBreaks), &done).Do(ctx)
+}
+
+// hideSelectorsScript hides the elements matching the selectors with inline
+// styles, which unlike style sheets aren't restricted by the content security
+// policy of the page, or removes them from the DOM.
+const hideSelectorsScript = `(function (selectors, remove) {
+	selectors.forEach(function (selector) {
+		document.querySelectorAll(selector).forEach(function (el) {
+			if (remove) {
+				el.remove();
+			} else {
+				el.style.setProperty('display', 'none', 'important');
+			}
+		});
+	});
+
+	return true;
+})(%s, %t)`
+
+// hideSelectors hides all elements matching the selectors. If remove is true,
+// the elements are removed instead, so that they don't affect the layout in
+// any way, e.g. sticky headers that reserve space.
+func hideSelectors(ctx context.Context, selectors []string, remove bool) error {
+	sels, err := json.Marshal(selectors)
+
+	if err != nil {
+		return err
+	}
+
+	var done bool
+
+	return chromedp.Evaluate(fmt.Sprintf(hideSelectorsScript, sels, remove), &done).Do(ctx)
+}
+
+// replaceContentScript sets the inner HTML of the elements matching the
+// selectors.
+const replaceContentScript = `(function (contents) {
+	Object.keys(contents).forEach(function (selector) {
+		document.querySelectorAll(selector).forEach(function (el) {
+			el.innerHTML = contents[selector];
+		});
+	});
+
+	return true;
+})(%s)`
+
+// replaceContent replaces the content of all elements matching the keys of
+// contents with the HTML of the values.
+func replaceContent(ctx context.Context, contents map[string]string) error {
+	data, err := json.Marshal(contents)
+
+	if err != nil {
+		return err
+	}
+
+	var done bool
+
+	return chromedp.Evaluate(fmt.Sprintf(replaceContentScript, data), &done).Do(ctx)
+}
@@ -2,7 +2,19 @@ package server
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
 	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/imkiptoo/pdfire"
 	"github.com/go-chi/chi"
@@ -10,9 +22,95 @@ import (
 	"github.com/unrolled/render"
 )
 
+var (
+	// ErrUploadTooLarge is returned when the uploaded files of a merge exceed
+	// the MaxUploadSize of the server.
+	ErrUploadTooLarge = errors.New("upload too large")
+)
+
+// Engine creates the documents of the server. It is implemented by
+// *pdfire.Converter and by the fake converter of package pdfiretest, which
+// doesn't need Chrome.
+type Engine interface {
+	Warmup(ctx context.Context) error
+	Healthy(ctx context.Context) error
+	Version(ctx context.Context) (*pdfire.BrowserVersion, error)
+	Validate(options *pdfire.ConversionOptions) error
+	Preview(ctx context.Context, w io.Writer, options *pdfire.ConversionOptions, width int64) error
+	Convert(ctx context.Context, w io.Writer, options *pdfire.ConversionOptions) error
+}
+
+// Options are the server options.
+type Options struct {
+	Converter Engine
+	// Warmup launches the converter's browsers in the background when the server
+	// is created. The health and ready endpoints report the server as
+	// unavailable until the warm-up has finished.
+	Warmup bool
+	// ForwardHeaders are the headers of a conversion or preview request, like
+	// Authorization or Accept-Language, that are passed on to the converted
+	// page. They are only sent with requests to the origin of the converted URL.
+	ForwardHeaders []string
+	// ForwardAcceptLanguage uses the Accept-Language header of a conversion
+	// request as the language of conversions without a language option.
+	ForwardAcceptLanguage bool
+	// Profiler mounts the pprof and expvar handlers at /debug. They expose
+	// internals of the process, so they should only be reachable internally.
+	Profiler bool
+	// URLPolicy restricts the URLs that the server loads itself, like the
+	// PDFs of post-processing requests and the timestamp authorities of
+	// their signatures.
+	URLPolicy *pdfire.URLPolicy
+	// BlockPrivateNetworks denies the URLs that the server loads itself if
+	// they are or resolve to addresses of private networks.
+	BlockPrivateNetworks bool
+	// MaxUploadSize limits the request body of a merge of uploaded files, in
+	// bytes. If zero, it's unlimited.
+	MaxUploadSize int64
+}
+
+// NewOptions returns new server options with default values. Neither the
+// converter nor the server load URLs of private networks, so that requests
+// can't reach internal endpoints or local files.
+func NewOptions() *Options {
+	converterOptions := pdfire.NewConverterOptions()
+	converterOptions.BlockPrivateNetworks = true
+
+	return &Options{
+		Converter:            pdfire.NewConverter(converterOptions),
+		BlockPrivateNetworks: true,
+		MaxUploadSize:        defaultMaxUploadSize,
+	}
+}
+
 // New returns a new PDFire server.
 func New() *chi.Mux {
+	return NewWithOptions(NewOptions())
+}
+
+// NewWithOptions returns a new PDFire server with the given options.
+func NewWithOptions(options *Options) *chi.Mux {
 	router := chi.NewRouter()
+	converter := options.Converter
+	forwardHeaders := options.ForwardHeaders
+	forwardAcceptLanguage := options.ForwardAcceptLanguage
+	urlPolicy := options.URLPolicy
+	blockPrivateNetworks := options.BlockPrivateNetworks
+	maxUploadSize := options.MaxUploadSize
+	client := pdfire.NewHTTPClient(urlPolicy, blockPrivateNetworks)
+	ready := int32(1)
+
+	if options.Warmup {
+		ready = 0
+
+		go func() {
+			if err := converter.Warmup(context.Background()); err != nil {
+				log.Printf("pdfire: warm-up failed: %v", err)
+			}
+
+			atomic.StoreInt32(&ready, 1)
+		}()
+	}
 
 	router.Use(
 		middleware.RequestID,
@@ -21,10 +119,71 @@ func New() *chi.Mux {
 		middleware.Recoverer,
 	)
 
-	router.Post("/conversions", func(w http.ResponseWriter, r *http.Request) {
+	if options.Profiler {
+		router.Mount("/debug", middleware.Profiler())
+	}
+
+	router.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+		render := render.New()
+
+		if atomic.LoadInt32(&ready) == 0 {
+			render.JSON(w, 503, map[string]interface{}{
+				"status": "warming up",
+			})
+
+			return
+		}
+
+		version, err := converter.Version(r.Context())
+
+		if err != nil {
+			render.JSON(w, 503, map[string]interface{}{
+				"status": "unavailable",
+				"error":  err.Error(),
+			})
+
+			return
+		}
+
+		render.JSON(w, 200, map[string]interface{}{
+			"status":  "ok",
+			"browser": version,
+		})
+	})
+
+	router.Get("/ready", func(w http.ResponseWriter, r *http.Request) {
+		render := render.New()
+
+		if atomic.LoadInt32(&ready) == 0 {
+			render.JSON(w, 503, map[string]interface{}{
+				"status": "warming up",
+			})
+
+			return
+		}
+
+		if err := converter.Healthy(r.Context()); err != nil {
+			render.JSON(w, 503, map[string]interface{}{
+				"status": "unavailable",
+				"error":  err.Error(),
+			})
+
+			return
+		}
+
+		render.JSON(w, 200, map[string]interface{}{
+			"status": "ok",
+		})
+	})
+
+	router.Post("/conversions/validate", func(w http.ResponseWriter, r *http.Request) {
 		render := render.New()
 		options, err := pdfire.NewConversionOptionsFromJSON(r.Body)
 
+		if err == nil {
+			err = converter.Validate(options)
+		}
+
 		if err != nil {
 			render.JSON(w, 400, map[string]interface{}{
 				"error": err.Error(),
@@ -33,8 +192,136 @@ func New() *chi.Mux {
 			return
 		}
 
+		res := map[string]interface{}{
+			"options": options,
+		}
+
+		if r.URL.Query().Get("checkURLs") == "true" {
+			res["urls"] = checkURLs(r.Context(), options, client)
+		}
+
+		render.JSON(w, 200, res)
+	})
+
+	router.Post("/previews", func(w http.ResponseWriter, r *http.Request) {
+		render := render.New()
+		options, err := pdfire.NewConversionOptionsFromJSON(r.Body)
+
+		if err != nil {
+			render.JSON(w, 400, map[string]interface{}{
+				"error": err.Error(),
+			})
+
+			return
+		}
+
+		if forwardAcceptLanguage && options.Language == "" {
+			options.Language = r.Header.Get("Accept-Language")
+		}
+
+		forwardRequestHeaders(r, options, forwardHeaders)
+		width := int64(defaultPreviewWidth)
+
+		if raw := r.URL.Query().Get("width"); raw != "" {
+			if width, err = strconv.ParseInt(raw, 10, 64); err != nil {
+				render.JSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+					"error": (&pdfire.ParseError{Key: "width", Value: raw}).Error(),
+				})
+
+				return
+			}
+		}
+
+		console := &consoleLog{}
+		options.OnConsoleMessage = console.add
+		buf := bytes.NewBuffer(make([]byte, 0))
+
+		if err := converter.Preview(r.Context(), buf, options, width); err != nil {
+			render.JSON(w, errorStatus(err), console.errorPayload(err))
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.WriteHeader(200)
+		w.Write(buf.Bytes())
+	})
+
+	router.Post("/post-processing", func(w http.ResponseWriter, r *http.Request) {
+		render := render.New()
+		options, file, err := postProcessRequest(r)
+
+		if err != nil {
+			render.JSON(w, 400, map[string]interface{}{
+				"error": err.Error(),
+			})
+
+			return
+		}
+
+		if file != nil {
+			defer file.Close()
+		}
+
+		options.URLPolicy = urlPolicy
+		options.BlockPrivateNetworks = blockPrivateNetworks
 		buf := bytes.NewBuffer(make([]byte, 0))
-		err = pdfire.Convert(r.Context(), buf, options)
+		start := time.Now()
+
+		if err := pdfire.PostProcess(r.Context(), file, buf, options); err != nil {
+			render.JSON(w, 400, map[string]interface{}{
+				"error": err.Error(),
+			})
+
+			return
+		}
+
+		setResultHeaders(w, buf.Bytes(), time.Since(start), true)
+		render.Data(w, 201, buf.Bytes())
+	})
+
+	router.Post("/merges/files", func(w http.ResponseWriter, r *http.Request) {
+		render := render.New()
+		options, files, closeFiles, err := mergeFilesRequest(w, r, maxUploadSize)
+
+		if err == ErrUploadTooLarge {
+			render.JSON(w, http.StatusRequestEntityTooLarge, map[string]interface{}{
+				"error": err.Error(),
+			})
+
+			return
+		}
+
+		if err != nil {
+			render.JSON(w, 400, map[string]interface{}{
+				"error": err.Error(),
+			})
+
+			return
+		}
+
+		options.URLPolicy = urlPolicy
+		options.BlockPrivateNetworks = blockPrivateNetworks
+		buf := bytes.NewBuffer(make([]byte, 0))
+		start := time.Now()
+		err = pdfire.MergeFiles(r.Context(), buf, files, options)
+		closeFiles()
+
+		if err != nil {
+			render.JSON(w, 400, map[string]interface{}{
+				"error": err.Error(),
+			})
+
+			return
+		}
+
+		setResultHeaders(w, buf.Bytes(), time.Since(start), true)
+		render.Data(w, 201, buf.Bytes())
+	})
+
+	router.Post("/conversions", func(w http.ResponseWriter, r *http.Request) {
+		render := render.New()
+		options, err := pdfire.NewConversionOptionsFromJSON(r.Body)
 
 		if err != nil {
 			render.JSON(w, 400, map[string]interface{}{
@@ -44,8 +331,324 @@ func New() *chi.Mux {
 			return
 		}
 
+		options.OnDownloadBlocked = func(url string) {
+			log.Printf("pdfire: blocked download of %s (request %s)", url, middleware.GetReqID(r.Context()))
+		}
+
+		if forwardAcceptLanguage && options.Language == "" {
+			options.Language = r.Header.Get("Accept-Language")
+		}
+
+		forwardRequestHeaders(r, options, forwardHeaders)
+
+		console := &consoleLog{}
+		options.OnConsoleMessage = console.add
+		buf := bytes.NewBuffer(make([]byte, 0))
+		start := time.Now()
+		err = converter.Convert(r.Context(), buf, options)
+
+		if err != nil {
+			render.JSON(w, errorStatus(err), console.errorPayload(err))
+
+			return
+		}
+
+		setResultHeaders(w, buf.Bytes(), time.Since(start), !options.CompareMedia)
+
+		if options.CompareMedia {
+			w.Header().Set("Content-Type", "application/zip")
+			w.WriteHeader(201)
+			w.Write(buf.Bytes())
+
+			return
+		}
+
 		render.Data(w, 201, buf.Bytes())
 	})
 
 	return router
 }
+
+// setResultHeaders describes a conversion result, so that clients can log and
+// verify it without parsing it. The page count is only set for PDFs.
+func setResultHeaders(w http.ResponseWriter, data []byte, duration time.Duration, isPDF bool) {
+	sum := sha256.Sum256(data)
+
+	w.Header().Set("X-Pdfire-Duration-Ms", strconv.FormatInt(int64(duration/time.Millisecond), 10))
+	w.Header().Set("X-Pdfire-Bytes", strconv.Itoa(len(data)))
+	w.Header().Set("X-Pdfire-Checksum", "sha256="+hex.EncodeToString(sum[:]))
+
+	if !isPDF {
+		return
+	}
+
+	if pages, err := pdfire.PageCount(bytes.NewReader(data)); err == nil {
+		w.Header().Set("X-Pdfire-Pages", strconv.Itoa(pages))
+	}
+}
+
+// forwardRequestHeaders passes the named headers of a request on to the
+// converted page.
+func forwardRequestHeaders(r *http.Request, options *pdfire.ConversionOptions, names []string) {
+	for _, name := range names {
+		if value := r.Header.Get(name); value != "" {
+			options.OriginHeaders[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+}
+
+// defaultPreviewWidth is the width of previews in pixels unless requested otherwise.
+const defaultPreviewWidth = 800
+
+// maxUploadMemory is the maximum size of uploads held in memory. Larger
+// uploads are stored in temporary files.
+const maxUploadMemory = 32 << 20
+
+// defaultMaxUploadSize is the MaxUploadSize of NewOptions.
+const defaultMaxUploadSize = 256 << 20
+
+// postProcessRequest reads the options and the uploaded PDF of a multipart
+// request with the fields "options" and "file", or the options of a JSON
+// request that refer to the PDF by URL. The file is nil for JSON requests.
+func postProcessRequest(r *http.Request) (*pdfire.PostProcessOptions, io.ReadCloser, error) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		options, err := pdfire.NewPostProcessOptionsFromJSON(r.Body)
+
+		return options, nil, err
+	}
+
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+		return nil, nil, err
+	}
+
+	options := pdfire.NewPostProcessOptions()
+
+	if raw := r.FormValue("options"); raw != "" {
+		var err error
+
+		if options, err = pdfire.NewPostProcessOptionsFromJSONString(raw); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	file, _, err := r.FormFile("file")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return options, file, nil
+}
+
+// mergeFilesRequest reads the options and the uploaded PDFs of a multipart
+// request with the fields "options" and "file", which may be repeated. If the
+// field "bookmarks" is "true", a bookmark is added for every file, titled with
+// its file name. Requests larger than limit fail with ErrUploadTooLarge,
+// unless limit is zero.
+func mergeFilesRequest(w http.ResponseWriter, r *http.Request, limit int64) (*pdfire.PostProcessOptions, []*pdfire.MergeFile, func(), error) {
+	if limit > 0 {
+		if r.ContentLength > limit {
+			return nil, nil, nil, ErrUploadTooLarge
+		}
+
+		r.Body = &limitedBody{
+			ReadCloser: http.MaxBytesReader(w, r.Body, limit),
+			limit:      limit,
+		}
+	}
+
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+		if body, ok := r.Body.(*limitedBody); ok && body.exceeded {
+			return nil, nil, nil, ErrUploadTooLarge
+		}
+
+		return nil, nil, nil, err
+	}
+
+	options := pdfire.NewPostProcessOptions()
+
+	if raw := r.FormValue("options"); raw != "" {
+		var err error
+
+		if options, err = pdfire.NewPostProcessOptionsFromJSONString(raw); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	bookmarks := r.FormValue("bookmarks") == "true"
+	headers := r.MultipartForm.File["file"]
+	files := make([]*pdfire.MergeFile, 0, len(headers))
+	opened := make([]io.Closer, 0, len(headers))
+	closeFiles := func() {
+		for _, file := range opened {
+			file.Close()
+		}
+	}
+
+	for _, header := range headers {
+		file, err := header.Open()
+
+		if err != nil {
+			closeFiles()
+			return nil, nil, nil, err
+		}
+
+		opened = append(opened, file)
+		merged := &pdfire.MergeFile{PDF: file}
+
+		if bookmarks {
+			merged.Title = strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
+		}
+
+		files = append(files, merged)
+	}
+
+	return options, files, closeFiles, nil
+}
+
+// limitedBody is the body of a request read by http.MaxBytesReader. It
+// records whether reading failed at the limit, which the reader only reports
+// with an unexported error.
+type limitedBody struct {
+	io.ReadCloser
+	limit    int64
+	n        int64
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+
+	if err != nil && err != io.EOF && b.n >= b.limit {
+		b.exceeded = true
+	}
+
+	return n, err
+}
+
+// URLCheck is the result of a reachability check of a converted URL.
+type URLCheck struct {
+	URL       string `json:"url"`
+	Reachable bool   `json:"reachable"`
+	Status    int    `json:"status,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// urlCheckTimeout is the maximum duration of a reachability check.
+const urlCheckTimeout = 10 * time.Second
+
+// checkURLs checks whether the remote URLs of a conversion respond without an
+// error status. HEAD requests are retried with GET if the server rejects them.
+// The guarded client doesn't follow redirects to denied URLs, whose status
+// isn't reported.
+func checkURLs(ctx context.Context, options *pdfire.ConversionOptions, guarded *http.Client) []*URLCheck {
+	urls := options.URLs
+
+	if options.URL != "" {
+		urls = append([]string{options.URL}, urls...)
+	}
+
+	client := *guarded
+	client.Timeout = urlCheckTimeout
+	checks := make([]*URLCheck, 0, len(urls))
+
+	for _, u := range urls {
+		check := &URLCheck{URL: u}
+		checks = append(checks, check)
+		res, err := checkURL(ctx, &client, http.MethodHead, u)
+
+		if err == nil && (res.StatusCode == http.StatusMethodNotAllowed || res.StatusCode == http.StatusNotImplemented) {
+			res, err = checkURL(ctx, &client, http.MethodGet, u)
+		}
+
+		if err != nil {
+			check.Error = err.Error()
+			continue
+		}
+
+		check.Status = res.StatusCode
+		check.Reachable = res.StatusCode < 400
+	}
+
+	return checks
+}
+
+func checkURL(ctx context.Context, client *http.Client, method, rawurl string) (*http.Response, error) {
+	req, err := http.NewRequest(method, rawurl, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.Do(req.WithContext(ctx))
+
+	if err != nil {
+		return nil, err
+	}
+
+	res.Body.Close()
+
+	return res, nil
+}
+
+// maxConsoleMessages limits the console messages of an error payload.
+const maxConsoleMessages = 100
+
+// consoleLog collects the console messages of a conversion, so that a failed
+// conversion can be debugged from its error payload.
+type consoleLog struct {
+	mu       sync.Mutex
+	messages []*pdfire.ConsoleMessage
+}
+
+func (l *consoleLog) add(message *pdfire.ConsoleMessage) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.messages) < maxConsoleMessages {
+		l.messages = append(l.messages, message)
+	}
+}
+
+// errorPayload returns the payload of a failed conversion with the console
+// messages, if any.
+func (l *consoleLog) errorPayload(err error) map[string]interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	payload := map[string]interface{}{
+		"error": err.Error(),
+	}
+
+	if len(l.messages) > 0 {
+		payload["console"] = l.messages
+	}
+
+	return payload
+}
+
+// errorStatus returns the status code of a failed conversion or preview.
+func errorStatus(err error) int {
+	if err == pdfire.ErrTooManyConversions {
+		return http.StatusTooManyRequests
+	}
+
+	if _, ok := err.(*pdfire.URLNotAllowedError); ok {
+		return http.StatusForbidden
+	}
+
+	if _, ok := err.(*pdfire.HTTPError); ok {
+		return http.StatusBadGateway
+	}
+
+	if _, ok := err.(*pdfire.ResourceError); ok {
+		return http.StatusBadGateway
+	}
+
+	if _, ok := err.(*pdfire.TimestampError); ok {
+		return http.StatusBadGateway
+	}
+
+	return 400
+}
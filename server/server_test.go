@@ -0,0 +1,332 @@
+package server_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/imkiptoo/pdfire"
+	"github.com/imkiptoo/pdfire/pdfiretest"
+	"github.com/imkiptoo/pdfire/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func newServer(converter *pdfiretest.FakeConverter) http.Handler {
+	options := server.NewOptions()
+	options.Converter = converter
+
+	return server.NewWithOptions(options)
+}
+
+func decodeJSON(t *testing.T, res *httptest.ResponseRecorder) map[string]interface{} {
+	var body map[string]interface{}
+
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Could not decode response %q: %v", res.Body.String(), err)
+	}
+
+	return body
+}
+
+func TestConversionResultHeaders(t *testing.T) {
+	assert := assert.New(t)
+	converter := pdfiretest.NewFakeConverter()
+	converter.PDF = pdfiretest.BlankPDF(3, 612, 792)
+	req := httptest.NewRequest("POST", "/conversions", strings.NewReader(`{"html": "<p>Invoice</p>"}`))
+	res := httptest.NewRecorder()
+
+	newServer(converter).ServeHTTP(res, req)
+
+	sum := sha256.Sum256(converter.PDF)
+	duration, err := strconv.Atoi(res.Header().Get("X-Pdfire-Duration-Ms"))
+
+	assert.Equal(201, res.Code)
+	assert.Equal(converter.PDF, res.Body.Bytes())
+	assert.Equal("3", res.Header().Get("X-Pdfire-Pages"))
+	assert.Equal(strconv.Itoa(len(converter.PDF)), res.Header().Get("X-Pdfire-Bytes"))
+	assert.Equal("sha256="+hex.EncodeToString(sum[:]), res.Header().Get("X-Pdfire-Checksum"))
+	assert.Nil(err)
+	assert.True(duration >= 0)
+}
+
+func TestValidateConversion(t *testing.T) {
+	assert := assert.New(t)
+	converter := pdfiretest.NewFakeConverter()
+	req := httptest.NewRequest("POST", "/conversions/validate", strings.NewReader(`{"url": "https://example.com/report", "pageRanges": "1-3"}`))
+	res := httptest.NewRecorder()
+
+	newServer(converter).ServeHTTP(res, req)
+
+	body := decodeJSON(t, res)
+	options := body["options"].(map[string]interface{})
+
+	assert.Equal(200, res.Code)
+	assert.Equal("https://example.com/report", options["URL"])
+	assert.Equal("1-3", options["pdfParams"].(map[string]interface{})["pageRanges"])
+	assert.NotContains(body, "urls")
+	assert.Empty(converter.Conversions())
+}
+
+func TestValidateConversionInvalid(t *testing.T) {
+	assert := assert.New(t)
+	handler := newServer(pdfiretest.NewFakeConverter())
+
+	for _, options := range []string{`{"html": "<p>Invoice</p>", "pageRanges": "3-1"}`, `{"html": "<p>Invoice</p>", "timeout": "soon"}`, `{"html": `} {
+		req := httptest.NewRequest("POST", "/conversions/validate", strings.NewReader(options))
+		res := httptest.NewRecorder()
+
+		handler.ServeHTTP(res, req)
+
+		assert.Equal(400, res.Code, options)
+		assert.NotEmpty(decodeJSON(t, res)["error"], options)
+	}
+}
+
+func TestValidateConversionCheckURLs(t *testing.T) {
+	assert := assert.New(t)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/report" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer target.Close()
+
+	options := server.NewOptions()
+	options.Converter = pdfiretest.NewFakeConverter()
+	options.BlockPrivateNetworks = false
+	body := `{"url": "` + target.URL + `/report", "urls": ["` + target.URL + `/missing"]}`
+	req := httptest.NewRequest("POST", "/conversions/validate?checkURLs=true", strings.NewReader(body))
+	res := httptest.NewRecorder()
+
+	server.NewWithOptions(options).ServeHTTP(res, req)
+
+	assert.Equal(200, res.Code)
+	assert.Equal([]interface{}{
+		map[string]interface{}{"url": target.URL + "/report", "reachable": true, "status": 200.0},
+		map[string]interface{}{"url": target.URL + "/missing", "reachable": false, "status": 404.0},
+	}, decodeJSON(t, res)["urls"])
+
+	req = httptest.NewRequest("POST", "/conversions/validate?checkURLs=true", strings.NewReader(body))
+	res = httptest.NewRecorder()
+
+	newServer(pdfiretest.NewFakeConverter()).ServeHTTP(res, req)
+
+	urls := decodeJSON(t, res)["urls"].([]interface{})
+
+	assert.Equal(200, res.Code)
+	assert.Len(urls, 2)
+	assert.Equal(false, urls[0].(map[string]interface{})["reachable"])
+	assert.NotEmpty(urls[0].(map[string]interface{})["error"])
+}
+
+func TestPreview(t *testing.T) {
+	assert := assert.New(t)
+	handler := newServer(pdfiretest.NewFakeConverter())
+
+	for query, width := range map[string]int{"": 800, "?width=320": 320} {
+		req := httptest.NewRequest("POST", "/previews"+query, strings.NewReader(`{"html": "<p>Invoice</p>"}`))
+		res := httptest.NewRecorder()
+
+		handler.ServeHTTP(res, req)
+
+		assert.Equal(200, res.Code, query)
+		assert.Equal("image/png", res.Header().Get("Content-Type"), query)
+
+		img, err := png.Decode(res.Body)
+
+		if assert.Nil(err, query) {
+			assert.Equal(width, img.Bounds().Dx(), query)
+		}
+	}
+}
+
+func TestPreviewInvalidWidth(t *testing.T) {
+	assert := assert.New(t)
+	converter := pdfiretest.NewFakeConverter()
+	req := httptest.NewRequest("POST", "/previews?width=wide", strings.NewReader(`{"html": "<p>Invoice</p>"}`))
+	res := httptest.NewRecorder()
+
+	newServer(converter).ServeHTTP(res, req)
+
+	assert.Equal(422, res.Code)
+	assert.Equal(`Could not parse param "width" (wide).`, decodeJSON(t, res)["error"])
+	assert.Empty(converter.Conversions())
+
+	req = httptest.NewRequest("POST", "/previews?width=0", strings.NewReader(`{"html": "<p>Invoice</p>"}`))
+	res = httptest.NewRecorder()
+
+	newServer(converter).ServeHTTP(res, req)
+
+	assert.Equal(400, res.Code)
+	assert.Equal(pdfire.ErrInvalidPreviewWidth.Error(), decodeJSON(t, res)["error"])
+}
+
+// mergeFilesRequest returns a multipart request of the files by file name.
+func mergeFilesRequest(t *testing.T, files map[string][]byte, fields map[string]string) (*bytes.Buffer, string) {
+	body := bytes.NewBuffer(make([]byte, 0))
+	mw := multipart.NewWriter(body)
+
+	for name, value := range fields {
+		if err := mw.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, data := range files {
+		fw, err := mw.CreateFormFile("file", name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fw.Write(data)
+	}
+
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return body, mw.FormDataContentType()
+}
+
+func TestMergeFiles(t *testing.T) {
+	assert := assert.New(t)
+	body, contentType := mergeFilesRequest(t, map[string][]byte{
+		"cover.pdf":  pdfiretest.BlankPDF(4, 612, 792),
+		"report.pdf": pdfiretest.BlankPDF(5, 612, 792),
+	}, map[string]string{
+		"options":   `{"optimize": true}`,
+		"bookmarks": "true",
+	})
+	req := httptest.NewRequest("POST", "/merges/files", body)
+	req.Header.Set("Content-Type", contentType)
+	res := httptest.NewRecorder()
+
+	newServer(pdfiretest.NewFakeConverter()).ServeHTTP(res, req)
+
+	assert.Equal(201, res.Code)
+	assert.Equal("9", res.Header().Get("X-Pdfire-Pages"))
+}
+
+func TestMergeFilesMissingFile(t *testing.T) {
+	assert := assert.New(t)
+	body, contentType := mergeFilesRequest(t, nil, map[string]string{"bookmarks": "true"})
+	req := httptest.NewRequest("POST", "/merges/files", body)
+	req.Header.Set("Content-Type", contentType)
+	res := httptest.NewRecorder()
+
+	newServer(pdfiretest.NewFakeConverter()).ServeHTTP(res, req)
+
+	assert.Equal(400, res.Code)
+	assert.Equal(pdfire.ErrNoPDFs.Error(), decodeJSON(t, res)["error"])
+
+	req = httptest.NewRequest("POST", "/merges/files", strings.NewReader(`{"bookmarks": true}`))
+	req.Header.Set("Content-Type", "application/json")
+	res = httptest.NewRecorder()
+
+	newServer(pdfiretest.NewFakeConverter()).ServeHTTP(res, req)
+
+	assert.Equal(400, res.Code)
+}
+
+func TestMergeFilesTooLarge(t *testing.T) {
+	assert := assert.New(t)
+	options := server.NewOptions()
+	options.Converter = pdfiretest.NewFakeConverter()
+	options.MaxUploadSize = 1024
+	handler := server.NewWithOptions(options)
+	body, contentType := mergeFilesRequest(t, map[string][]byte{
+		"large.pdf": bytes.Repeat([]byte("%PDF-1.4\n"), 512),
+	}, nil)
+	data := body.Bytes()
+
+	// The second request has no content length, so the body is only cut off
+	// while it's read.
+	for _, r := range []io.Reader{bytes.NewReader(data), io.MultiReader(bytes.NewReader(data))} {
+		req := httptest.NewRequest("POST", "/merges/files", r)
+		req.Header.Set("Content-Type", contentType)
+		res := httptest.NewRecorder()
+
+		handler.ServeHTTP(res, req)
+
+		assert.Equal(413, res.Code)
+		assert.Equal(server.ErrUploadTooLarge.Error(), decodeJSON(t, res)["error"])
+	}
+}
+
+func TestForwardHeaders(t *testing.T) {
+	assert := assert.New(t)
+	converter := pdfiretest.NewFakeConverter()
+	options := server.NewOptions()
+	options.Converter = converter
+	options.ForwardHeaders = []string{"Authorization", "x-tenant", "X-Missing"}
+	handler := server.NewWithOptions(options)
+
+	for _, path := range []string{"/conversions", "/previews"} {
+		req := httptest.NewRequest("POST", path, strings.NewReader(`{"url": "https://example.com/report"}`))
+		req.Header.Set("Authorization", "Bearer token")
+		req.Header.Set("X-Tenant", "acme")
+		req.Header.Set("X-Other", "ignored")
+		res := httptest.NewRecorder()
+
+		handler.ServeHTTP(res, req)
+
+		assert.True(res.Code < 300, path)
+	}
+
+	conversions := converter.Conversions()
+
+	if assert.Len(conversions, 2) {
+		for _, conversion := range conversions {
+			assert.Equal(map[string]string{
+				"Authorization": "Bearer token",
+				"X-Tenant":      "acme",
+			}, conversion.OriginHeaders)
+		}
+	}
+}
+
+func TestForwardAcceptLanguage(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, forward := range []bool{true, false} {
+		converter := pdfiretest.NewFakeConverter()
+		options := server.NewOptions()
+		options.Converter = converter
+		options.ForwardAcceptLanguage = forward
+		handler := server.NewWithOptions(options)
+
+		for _, path := range []string{"/conversions", "/previews"} {
+			for _, body := range []string{`{"html": "<p>Invoice</p>"}`, `{"html": "<p>Invoice</p>", "language": "fr-CH"}`} {
+				req := httptest.NewRequest("POST", path, strings.NewReader(body))
+				req.Header.Set("Accept-Language", "de-CH, de;q=0.9")
+				res := httptest.NewRecorder()
+
+				handler.ServeHTTP(res, req)
+
+				assert.True(res.Code < 300, path)
+			}
+		}
+
+		languages := make([]string, 0)
+
+		for _, conversion := range converter.Conversions() {
+			languages = append(languages, conversion.Language)
+		}
+
+		if forward {
+			assert.Equal([]string{"de-CH, de;q=0.9", "fr-CH", "de-CH, de;q=0.9", "fr-CH"}, languages)
+		} else {
+			assert.Equal([]string{"", "fr-CH", "", "fr-CH"}, languages)
+		}
+	}
+}
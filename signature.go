@@ -0,0 +1,724 @@
+package pdfire
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+var (
+	// ErrSignatureEncryption is returned when a signature is combined with a
+	// password. Encrypted PDFs can't be updated, so they can't be signed.
+	ErrSignatureEncryption = errors.New("signed pdfs can't be encrypted")
+	// ErrDeterministicSignature is returned when a signature is combined with
+	// Deterministic, as a signature contains the time of signing.
+	ErrDeterministicSignature = errors.New("signed pdfs can't be deterministic")
+	// ErrSignatureTooLarge is returned when the signature doesn't fit into the
+	// space reserved for it, e.g. due to a large timestamp token.
+	ErrSignatureTooLarge = errors.New("signature too large")
+)
+
+// SignatureConfig signs a PDF with the certificate and private key of a
+// PKCS#12 file. The certificate and the password are left out of the JSON of
+// the options.
+type SignatureConfig struct {
+	// Certificate is the content of the PKCS#12 file (.p12 or .pfx) with the
+	// certificate, its chain and the private key.
+	Certificate []byte `json:"-"`
+	Password    string `json:"-"`
+	// TimestampURL is the URL of an RFC 3161 timestamp authority, which
+	// certifies the time of signing. The clock of the server is used if it's
+	// empty.
+	TimestampURL string
+	Reason       string
+	Location     string
+}
+
+// SignatureError is returned when the PKCS#12 file of a signature can't be
+// used.
+type SignatureError struct {
+	Err error
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("Could not load signing certificate (%v).", e.Err)
+}
+
+// TimestampError is returned when the timestamp authority of a signature
+// fails.
+type TimestampError struct {
+	URL string
+	Err error
+}
+
+func (e *TimestampError) Error() string {
+	return fmt.Sprintf("Could not timestamp signature with \"%s\" (%v).", e.URL, e.Err)
+}
+
+func parseSignature(jsonMap map[string]interface{}) (*SignatureConfig, error) {
+	raw, ok := jsonMap["signature"]
+
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	signatureMap, ok := raw.(map[string]interface{})
+
+	if !ok {
+		return nil, &ParseError{
+			Key:   "signature",
+			Value: raw,
+		}
+	}
+
+	encoded, err := parseString(signatureMap, "certificate", "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := parseString(signatureMap, "password", "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	timestampURL, err := parseString(signatureMap, "timestampURL", "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	reason, err := parseString(signatureMap, "reason", "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	location, err := parseString(signatureMap, "location", "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The certificate contains the private key, so it isn't part of the error.
+	certificate, err := base64.StdEncoding.DecodeString(encoded)
+
+	if err == nil && len(certificate) == 0 {
+		err = errors.New("missing")
+	}
+
+	if err != nil {
+		return nil, &ParseError{
+			Key:   "certificate",
+			Value: err,
+		}
+	}
+
+	return &SignatureConfig{
+		Certificate:  certificate,
+		Password:     password,
+		TimestampURL: timestampURL,
+		Reason:       reason,
+		Location:     location,
+	}, nil
+}
+
+// signer is the private key and the certificates of a SignatureConfig.
+type signer struct {
+	key   crypto.Signer
+	cert  *x509.Certificate
+	chain []*x509.Certificate
+}
+
+// signer decodes the PKCS#12 file. The certificate of the key is the signing
+// certificate, the others are embedded as its chain.
+func (c *SignatureConfig) signer() (*signer, error) {
+	blocks, err := pkcs12.ToPEM(c.Certificate, c.Password)
+
+	if err != nil {
+		return nil, &SignatureError{Err: err}
+	}
+
+	s := &signer{}
+
+	for _, block := range blocks {
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+
+			if err != nil {
+				return nil, &SignatureError{Err: err}
+			}
+
+			s.chain = append(s.chain, cert)
+		case "PRIVATE KEY":
+			// ToPEM encodes RSA keys as PKCS #1 and EC keys as SEC 1, despite
+			// the block type.
+			if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+				s.key = key
+			} else if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+				s.key = key
+			} else {
+				return nil, &SignatureError{Err: err}
+			}
+		}
+	}
+
+	if s.key == nil {
+		return nil, &SignatureError{Err: errors.New("no private key")}
+	}
+
+	public, err := x509.MarshalPKIXPublicKey(s.key.Public())
+
+	if err != nil {
+		return nil, &SignatureError{Err: err}
+	}
+
+	for i, cert := range s.chain {
+		if bytes.Equal(cert.RawSubjectPublicKeyInfo, public) {
+			s.cert = cert
+			s.chain = append(s.chain[:i:i], s.chain[i+1:]...)
+			break
+		}
+	}
+
+	if s.cert == nil {
+		return nil, &SignatureError{Err: errors.New("no certificate for the private key")}
+	}
+
+	return s, nil
+}
+
+// signatureSize is the space reserved for the signature, without the
+// certificates and the timestamp token.
+const signatureSize = 4096
+
+// timestampSize is the space reserved for a timestamp token, which contains
+// the certificates of the timestamp authority.
+const timestampSize = 16384
+
+// signatureByteRange is the placeholder of the byte range, which is replaced
+// by the actual range once the offsets of the signature are known.
+var signatureByteRange = []interface{}{int64(0), int64(9999999999), int64(9999999999), int64(9999999999)}
+
+// sign adds an invisible signature field to the first page and signs the PDF
+// with a detached CMS signature, in an incremental update. It has to be the
+// last step, as every later change invalidates the signature. The timestamp
+// authority is requested with the client of the guard.
+func sign(ctx context.Context, buf *bytes.Buffer, config *SignatureConfig, guard *urlGuard) (*bytes.Buffer, error) {
+	s, err := config.signer()
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := readPDF(bytes.NewReader(buf.Bytes()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := doc.update()
+
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := doc.pages()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pages) == 0 {
+		return nil, ErrInvalidPDF
+	}
+
+	size := signatureSize + len(s.cert.Raw)
+
+	for _, cert := range s.chain {
+		size += len(cert.Raw)
+	}
+
+	if config.TimestampURL != "" {
+		size += timestampSize
+	}
+
+	now := time.Now()
+	value := pdfDict{
+		"Type":      pdfName("Sig"),
+		"Filter":    pdfName("Adobe.PPKLite"),
+		"SubFilter": pdfName("adbe.pkcs7.detached"),
+		"ByteRange": signatureByteRange,
+		"Contents":  pdfString(make([]byte, size)),
+		"M":         pdfString(pdfDate(now)),
+	}
+
+	if name := s.cert.Subject.CommonName; name != "" {
+		value["Name"] = pdfText(name)
+	}
+
+	if config.Reason != "" {
+		value["Reason"] = pdfText(config.Reason)
+	}
+
+	if config.Location != "" {
+		value["Location"] = pdfText(config.Location)
+	}
+
+	if err := addSignatureField(doc, u, pages[0], u.add(value)); err != nil {
+		return nil, err
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, buf.Len()+2*size+4096))
+
+	if err := u.write(out); err != nil {
+		return nil, err
+	}
+
+	data := out.Bytes()
+	placeholder := new(bytes.Buffer)
+	writePDFObject(placeholder, value["Contents"])
+	start := len(doc.data) + bytes.Index(data[len(doc.data):], placeholder.Bytes())
+	end := start + placeholder.Len()
+
+	placeholder.Reset()
+	writePDFObject(placeholder, signatureByteRange)
+	byteRange := len(doc.data) + bytes.Index(data[len(doc.data):], placeholder.Bytes())
+
+	overwrite(data, byteRange, byteRange, byteRange+placeholder.Len(),
+		[]byte(fmt.Sprintf("[0 %d %d %d]", start, end, len(data)-end)))
+
+	digest := sha256.New()
+	digest.Write(data[:start])
+	digest.Write(data[end:])
+
+	signature, err := s.sign(ctx, digest.Sum(nil), now, &timestampAuthority{url: config.TimestampURL, guard: guard})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(signature) > size {
+		return nil, ErrSignatureTooLarge
+	}
+
+	hex.Encode(data[start+1:], signature)
+
+	return out, nil
+}
+
+// addSignatureField adds the widget of a signature to a page and to the form
+// of the document.
+func addSignatureField(doc *pdfDocument, u *pdfUpdate, page pdfRef, value pdfRef) error {
+	catalog, err := doc.dict(doc.trailer["Root"])
+
+	if err != nil {
+		return err
+	}
+
+	form := pdfDict{}
+
+	if _, ok := catalog["AcroForm"]; ok {
+		if form, err = doc.dict(catalog["AcroForm"]); err != nil {
+			return err
+		}
+	}
+
+	fields, err := doc.resolve(form["Fields"])
+
+	if err != nil {
+		return err
+	}
+
+	existing, _ := fields.([]interface{})
+	widget := u.add(pdfDict{
+		"Type":    pdfName("Annot"),
+		"Subtype": pdfName("Widget"),
+		"FT":      pdfName("Sig"),
+		"Rect":    []interface{}{int64(0), int64(0), int64(0), int64(0)},
+		// Print and locked.
+		"F": int64(132),
+		"P": page,
+		"T": pdfText(fmt.Sprintf("Signature%d", len(existing)+1)),
+		"V": value,
+	})
+
+	pageDict, err := doc.dict(page)
+
+	if err != nil {
+		return err
+	}
+
+	annots, err := doc.resolve(pageDict["Annots"])
+
+	if err != nil {
+		return err
+	}
+
+	updatedPage := copyDict(pageDict)
+	arr, _ := annots.([]interface{})
+	updatedPage["Annots"] = append(append([]interface{}{}, arr...), widget)
+	u.set(page, updatedPage)
+
+	updatedForm := copyDict(form)
+	updatedForm["Fields"] = append(append([]interface{}{}, existing...), widget)
+	updatedForm["SigFlags"] = int64(3)
+
+	if ref, ok := catalog["AcroForm"].(pdfRef); ok {
+		u.set(ref, updatedForm)
+
+		return nil
+	}
+
+	updatedCatalog := copyDict(catalog)
+	updatedCatalog["AcroForm"] = updatedForm
+	u.set(doc.trailer["Root"].(pdfRef), updatedCatalog)
+
+	return nil
+}
+
+func copyDict(dict pdfDict) pdfDict {
+	copied := make(pdfDict, len(dict)+1)
+
+	for key, value := range dict {
+		copied[key] = value
+	}
+
+	return copied
+}
+
+var (
+	oidData            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidTimestampToken  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+	oidTSTInfo         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidSHA256          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+// timestampAuthority is the RFC 3161 timestamp authority of a signature,
+// which is requested with the client of the guard.
+type timestampAuthority struct {
+	url   string
+	guard *urlGuard
+}
+
+// sign creates a detached CMS SignedData (RFC 5652) of a SHA-256 digest,
+// timestamped by the timestamp authority, if it has a URL.
+func (s *signer) sign(ctx context.Context, digest []byte, now time.Time, tsa *timestampAuthority) ([]byte, error) {
+	var algorithm []byte
+
+	switch s.key.(type) {
+	case *rsa.PrivateKey:
+		algorithm = derSequence(derOID(oidRSAEncryption), derNull)
+	case *ecdsa.PrivateKey:
+		algorithm = derSequence(derOID(oidECDSAWithSHA256))
+	default:
+		return nil, &SignatureError{Err: fmt.Errorf("unsupported key %T", s.key)}
+	}
+
+	signingTime, err := asn1.Marshal(now.UTC())
+
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := derSet(
+		derAttribute(oidContentType, derOID(oidData)),
+		derAttribute(oidSigningTime, signingTime),
+		derAttribute(oidMessageDigest, derTLV(0x04, digest)),
+	)
+	attrsDigest := sha256.Sum256(attrs)
+	signature, err := s.key.Sign(rand.Reader, attrsDigest[:], crypto.SHA256)
+
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := asn1.Marshal(s.cert.SerialNumber)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sha256Algorithm := derSequence(derOID(oidSHA256), derNull)
+	signerInfo := [][]byte{
+		derInteger(1),
+		derSequence(s.cert.RawIssuer, serial),
+		sha256Algorithm,
+		// The signed attributes are signed as a SET and embedded as [0].
+		append([]byte{0xA0}, attrs[1:]...),
+		algorithm,
+		derTLV(0x04, signature),
+	}
+
+	if tsa.url != "" {
+		token, err := tsa.timestamp(ctx, signature)
+
+		if err != nil {
+			return nil, err
+		}
+
+		signerInfo = append(signerInfo, derTLV(0xA1, derAttribute(oidTimestampToken, token)))
+	}
+
+	certs := [][]byte{s.cert.Raw}
+
+	for _, cert := range s.chain {
+		certs = append(certs, cert.Raw)
+	}
+
+	signedData := derSequence(
+		derInteger(1),
+		derSet(sha256Algorithm),
+		derSequence(derOID(oidData)),
+		derTLV(0xA0, certs...),
+		derSet(derSequence(signerInfo...)),
+	)
+
+	return derSequence(derOID(oidSignedData), derTLV(0xA0, signedData)), nil
+}
+
+// timestamp requests an RFC 3161 timestamp token of a signature value. A
+// denied URL results in a *URLNotAllowedError.
+func (tsa *timestampAuthority) timestamp(ctx context.Context, signature []byte) ([]byte, error) {
+	imprint := sha256.Sum256(signature)
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 63))
+
+	if err != nil {
+		return nil, err
+	}
+
+	encodedNonce, err := asn1.Marshal(nonce)
+
+	if err != nil {
+		return nil, err
+	}
+
+	query := derSequence(
+		derInteger(1),
+		derSequence(derSequence(derOID(oidSHA256), derNull), derTLV(0x04, imprint[:])),
+		encodedNonce,
+		// certReq, so that the token contains the certificate of the authority.
+		[]byte{0x01, 0x01, 0xFF},
+	)
+
+	req, err := http.NewRequest(http.MethodPost, tsa.url, bytes.NewReader(query))
+
+	if err != nil {
+		return nil, &TimestampError{URL: tsa.url, Err: err}
+	}
+
+	req.Header.Set("Content-Type", "application/timestamp-query")
+	res, err := tsa.guard.do(req.WithContext(ctx), true)
+
+	if _, ok := err.(*URLNotAllowedError); ok {
+		return nil, err
+	}
+
+	if err != nil {
+		return nil, &TimestampError{URL: tsa.url, Err: err}
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, &TimestampError{URL: tsa.url, Err: fmt.Errorf("unexpected status %d", res.StatusCode)}
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, timestampSize))
+
+	if err != nil {
+		return nil, &TimestampError{URL: tsa.url, Err: err}
+	}
+
+	var reply struct {
+		Status asn1.RawValue
+		Token  asn1.RawValue `asn1:"optional"`
+	}
+
+	if _, err := asn1.Unmarshal(body, &reply); err != nil {
+		return nil, &TimestampError{URL: tsa.url, Err: err}
+	}
+
+	// The status is granted (0) or granted with modifications (1).
+	var status int
+
+	if _, err := asn1.Unmarshal(reply.Status.Bytes, &status); err != nil {
+		return nil, &TimestampError{URL: tsa.url, Err: err}
+	}
+
+	if status > 1 || len(reply.Token.FullBytes) == 0 {
+		return nil, &TimestampError{URL: tsa.url, Err: fmt.Errorf("request rejected with status %d", status)}
+	}
+
+	if err := checkTimestampToken(reply.Token.FullBytes, imprint[:], nonce); err != nil {
+		return nil, &TimestampError{URL: tsa.url, Err: err}
+	}
+
+	return reply.Token.FullBytes, nil
+}
+
+// tstInfo is the content of a timestamp token (RFC 3161), up to the nonce.
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint struct {
+		HashAlgorithm struct {
+			Algorithm asn1.ObjectIdentifier
+		}
+		HashedMessage []byte
+	}
+	SerialNumber *big.Int
+	GenTime      asn1.RawValue
+	Accuracy     struct {
+		Seconds int `asn1:"optional"`
+		Millis  int `asn1:"optional,tag:0"`
+		Micros  int `asn1:"optional,tag:1"`
+	} `asn1:"optional"`
+	Ordering bool     `asn1:"optional"`
+	Nonce    *big.Int `asn1:"optional"`
+}
+
+// checkTimestampToken checks that a timestamp token certifies the SHA-256
+// imprint and contains the nonce of the request, so that a token of another
+// request isn't embedded.
+func checkTimestampToken(token, imprint []byte, nonce *big.Int) error {
+	var contentInfo struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}
+
+	if _, err := asn1.Unmarshal(token, &contentInfo); err != nil {
+		return err
+	}
+
+	var signedData struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		EncapContentInfo struct {
+			ContentType asn1.ObjectIdentifier
+			Content     asn1.RawValue
+		}
+	}
+
+	if !contentInfo.ContentType.Equal(oidSignedData) {
+		return errors.New("token isn't signed data")
+	}
+
+	if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, &signedData); err != nil {
+		return err
+	}
+
+	if !signedData.EncapContentInfo.ContentType.Equal(oidTSTInfo) {
+		return errors.New("token doesn't contain a timestamp")
+	}
+
+	var content []byte
+
+	if _, err := asn1.Unmarshal(signedData.EncapContentInfo.Content.Bytes, &content); err != nil {
+		return err
+	}
+
+	var info tstInfo
+
+	if _, err := asn1.Unmarshal(content, &info); err != nil {
+		return err
+	}
+
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) || !bytes.Equal(info.MessageImprint.HashedMessage, imprint) {
+		return errors.New("timestamp of another message")
+	}
+
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return errors.New("timestamp of another request")
+	}
+
+	return nil
+}
+
+var derNull = []byte{0x05, 0x00}
+
+// derTLV encodes a DER element of a tag and its content.
+func derTLV(tag byte, content ...[]byte) []byte {
+	n := 0
+
+	for _, c := range content {
+		n += len(c)
+	}
+
+	b := []byte{tag}
+
+	if n < 0x80 {
+		b = append(b, byte(n))
+	} else {
+		var length []byte
+
+		for m := n; m > 0; m >>= 8 {
+			length = append([]byte{byte(m)}, length...)
+		}
+
+		b = append(append(b, 0x80|byte(len(length))), length...)
+	}
+
+	for _, c := range content {
+		b = append(b, c...)
+	}
+
+	return b
+}
+
+func derSequence(elements ...[]byte) []byte {
+	return derTLV(0x30, elements...)
+}
+
+// derSet encodes a SET OF, whose elements DER sorts by their encoding.
+func derSet(elements ...[]byte) []byte {
+	sorted := append([][]byte(nil), elements...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+
+	return derTLV(0x31, sorted...)
+}
+
+func derAttribute(oid asn1.ObjectIdentifier, values ...[]byte) []byte {
+	return derSequence(derOID(oid), derSet(values...))
+}
+
+// derOID encodes an object identifier, which can't fail for the constants.
+func derOID(oid asn1.ObjectIdentifier) []byte {
+	b, _ := asn1.Marshal(oid)
+
+	return b
+}
+
+func derInteger(i int) []byte {
+	b, _ := asn1.Marshal(i)
+
+	return b
+}
@@ -0,0 +1,136 @@
+package pdfire
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/performance"
+	"github.com/chromedp/cdproto/systeminfo"
+	"github.com/chromedp/chromedp"
+)
+
+// Stats are the resource usage statistics of a conversion.
+type Stats struct {
+	JSHeapUsedSize      int64
+	JSHeapTotalSize     int64
+	LayoutDuration      time.Duration
+	RecalcStyleDuration time.Duration
+	ScriptDuration      time.Duration
+	TaskDuration        time.Duration
+	// CPUTime is the CPU time used by the browser processes during the conversion.
+	// For pooled browsers running several conversions at once, it includes the
+	// usage of the concurrent conversions.
+	CPUTime time.Duration
+	// Memory is the resident memory of the browser processes after printing, in
+	// bytes. It is only available on Linux.
+	Memory int64
+	// Metrics are all metrics reported by Chrome's Performance domain.
+	Metrics map[string]float64
+}
+
+type statsCollector struct {
+	stats   *Stats
+	cpuTime float64
+}
+
+// before enables the performance domain and records the CPU time of the browser processes.
+func (s *statsCollector) before() chromedp.ActionFunc {
+	return func(ctx context.Context) error {
+		if err := performance.Enable().Do(ctx); err != nil {
+			return err
+		}
+
+		processes, err := processInfo(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		for _, p := range processes {
+			s.cpuTime += p.CPUTime
+		}
+
+		return nil
+	}
+}
+
+// after collects the page metrics and the resource usage of the browser processes.
+func (s *statsCollector) after() chromedp.ActionFunc {
+	return func(ctx context.Context) error {
+		metrics, err := performance.GetMetrics().Do(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		stats := &Stats{
+			Metrics: make(map[string]float64, len(metrics)),
+		}
+
+		for _, m := range metrics {
+			stats.Metrics[m.Name] = m.Value
+		}
+
+		stats.JSHeapUsedSize = int64(stats.Metrics["JSHeapUsedSize"])
+		stats.JSHeapTotalSize = int64(stats.Metrics["JSHeapTotalSize"])
+		stats.LayoutDuration = seconds(stats.Metrics["LayoutDuration"])
+		stats.RecalcStyleDuration = seconds(stats.Metrics["RecalcStyleDuration"])
+		stats.ScriptDuration = seconds(stats.Metrics["ScriptDuration"])
+		stats.TaskDuration = seconds(stats.Metrics["TaskDuration"])
+
+		processes, err := processInfo(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		var cpuTime float64
+
+		for _, p := range processes {
+			cpuTime += p.CPUTime
+			stats.Memory += processMemory(p.ID)
+		}
+
+		stats.CPUTime = seconds(cpuTime - s.cpuTime)
+		s.stats = stats
+
+		return nil
+	}
+}
+
+func processInfo(ctx context.Context) ([]*systeminfo.ProcessInfo, error) {
+	return systeminfo.GetProcessInfo().Do(cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Browser))
+}
+
+// processMemory returns the resident memory of a process in bytes, or zero if
+// it cannot be determined.
+func processMemory(pid int64) int64 {
+	data, err := ioutil.ReadFile("/proc/" + strconv.FormatInt(pid, 10) + "/statm")
+
+	if err != nil {
+		return 0
+	}
+
+	fields := strings.Fields(string(data))
+
+	if len(fields) < 2 {
+		return 0
+	}
+
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+
+	if err != nil {
+		return 0
+	}
+
+	return pages * int64(os.Getpagesize())
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
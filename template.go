@@ -0,0 +1,349 @@
+package pdfire
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// placeholderRegexp matches template placeholders like "{{customerName}}" and
+// "{{generatedAt | 2006-01-02}}".
+var placeholderRegexp = regexp.MustCompile(`\{\{\s*([\w.-]+)\s*(?:\|\s*(.*?)\s*)?\}\}`)
+
+// renderTemplate substitutes the placeholders of a header or footer template
+// with the HTML-escaped values of data. "generatedAt" is the time of the
+// conversion unless data contains it. A format after "|" is a Go time layout
+// for times and RFC 3339 strings, or a fmt verb like "%.2f" for other values.
+// Unknown placeholders are left untouched.
+func renderTemplate(tpl string, data map[string]interface{}, now time.Time) string {
+	if !strings.Contains(tpl, "{{") {
+		return tpl
+	}
+
+	return placeholderRegexp.ReplaceAllStringFunc(tpl, func(placeholder string) string {
+		match := placeholderRegexp.FindStringSubmatch(placeholder)
+		key, format := match[1], match[2]
+		value, ok := data[key]
+
+		if !ok && key == "generatedAt" {
+			value, ok = now, true
+		}
+
+		if !ok {
+			return placeholder
+		}
+
+		return html.EscapeString(formatTemplateValue(value, format))
+	})
+}
+
+func formatTemplateValue(value interface{}, format string) string {
+	if s, ok := value.(string); ok && format != "" && !strings.Contains(format, "%") {
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			value = t
+		}
+	}
+
+	if t, ok := value.(time.Time); ok {
+		if format == "" || strings.Contains(format, "%") {
+			format = time.RFC3339
+		}
+
+		return t.Format(format)
+	}
+
+	if strings.Contains(format, "%") {
+		return fmt.Sprintf(format, value)
+	}
+
+	return fmt.Sprint(value)
+}
+
+// maxTemplateImageSize is the maximum size of an image inlined into a header or footer template.
+const maxTemplateImageSize = 5 << 20
+
+var (
+	templateImageRegexp = regexp.MustCompile(`(?i)(<img\b[^>]*?\bsrc\s*=\s*["']?)(https?://[^"'\s>]+)`)
+	templateURLRegexp   = regexp.MustCompile(`(?i)(url\(\s*["']?)(https?://[^"')\s]+)`)
+)
+
+// TemplateImageError is returned when an image of a header or footer template cannot be loaded.
+type TemplateImageError struct {
+	URL string
+	Err error
+}
+
+func (e *TemplateImageError) Error() string {
+	return fmt.Sprintf("Could not load header/footer image \"%s\" (%v).", e.URL, e.Err)
+}
+
+// inlineTemplateImages returns a copy of the options whose header and footer
+// templates reference their images as data URIs, as Chrome doesn't load any
+// resources of these templates. The TemplateImages are added to the template
+// data as data URIs, so they can be referenced like <img src="{{logo}}">.
+func inlineTemplateImages(ctx context.Context, options *ConversionOptions) (*ConversionOptions, error) {
+	params := options.PDFParams
+
+	if !params.DisplayHeaderFooter || options.Offline {
+		return options, nil
+	}
+
+	images := make(map[string]string)
+	load := func(rawurl string) (string, error) {
+		if uri, ok := images[rawurl]; ok {
+			return uri, nil
+		}
+
+		uri, err := loadTemplateImage(ctx, options.urlGuard, rawurl)
+
+		if _, ok := err.(*URLNotAllowedError); ok {
+			return "", err
+		}
+
+		if err != nil {
+			return "", &TemplateImageError{URL: rawurl, Err: err}
+		}
+
+		images[rawurl] = uri
+
+		return uri, nil
+	}
+
+	data := make(map[string]interface{}, len(options.TemplateData)+len(options.TemplateImages))
+
+	for key, value := range options.TemplateImages {
+		uri, err := templateImageURI(value, load)
+
+		if err != nil {
+			return nil, err
+		}
+
+		data[key] = uri
+	}
+
+	for key, value := range options.TemplateData {
+		data[key] = value
+	}
+
+	header, err := inlineTemplateURLs(params.HeaderTemplate, load)
+
+	if err != nil {
+		return nil, err
+	}
+
+	footer, err := inlineTemplateURLs(params.FooterTemplate, load)
+
+	if err != nil {
+		return nil, err
+	}
+
+	copied := *options
+	copiedParams := *params
+	copiedParams.HeaderTemplate = header
+	copiedParams.FooterTemplate = footer
+	copied.PDFParams = &copiedParams
+	copied.TemplateData = data
+
+	return &copied, nil
+}
+
+// templateImageURI returns the data URI of an uploaded image, which is either a
+// URL, a data URI or base64-encoded image data.
+func templateImageURI(value string, load func(string) (string, error)) (string, error) {
+	value = strings.TrimSpace(value)
+	lower := strings.ToLower(value)
+
+	switch {
+	case strings.HasPrefix(lower, "data:"):
+		return value, nil
+	case strings.HasPrefix(lower, "http://"), strings.HasPrefix(lower, "https://"):
+		return load(value)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(value)
+
+	if err != nil {
+		return "", &TemplateImageError{URL: "base64", Err: err}
+	}
+
+	return "data:" + http.DetectContentType(data) + ";base64," + value, nil
+}
+
+func inlineTemplateURLs(tpl string, load func(string) (string, error)) (string, error) {
+	var err error
+
+	for _, re := range []*regexp.Regexp{templateImageRegexp, templateURLRegexp} {
+		tpl = re.ReplaceAllStringFunc(tpl, func(match string) string {
+			parts := re.FindStringSubmatch(match)
+			uri, lerr := load(html.UnescapeString(parts[2]))
+
+			if lerr != nil {
+				err = lerr
+				return match
+			}
+
+			return parts[1] + uri
+		})
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return tpl, nil
+}
+
+// loadTemplateImage loads an image with the client of the URL guard and
+// returns it as a data URI. Responses that aren't images are refused, so that
+// no other content ends up in the PDF.
+func loadTemplateImage(ctx context.Context, guard *urlGuard, rawurl string) (string, error) {
+	data, contentType, err := fetchTemplateResource(ctx, guard, rawurl, maxTemplateImageSize)
+
+	if err != nil {
+		return "", err
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	if err != nil || !strings.HasPrefix(mediaType, "image/") {
+		return "", fmt.Errorf("unexpected content type \"%s\"", contentType)
+	}
+
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// maxTemplateSize is the maximum size of a header or footer template loaded from a URL.
+const maxTemplateSize = 1 << 20
+
+// TemplateLoadError is returned when a header or footer template cannot be loaded from its URL.
+type TemplateLoadError struct {
+	URL string
+	Err error
+}
+
+func (e *TemplateLoadError) Error() string {
+	return fmt.Sprintf("Could not load header/footer template \"%s\" (%v).", e.URL, e.Err)
+}
+
+// UnknownTemplateError is returned when a conversion references a header or
+// footer template that isn't stored in the converter.
+type UnknownTemplateError struct {
+	ID string
+}
+
+func (e *UnknownTemplateError) Error() string {
+	return fmt.Sprintf("Unknown header/footer template \"%s\".", e.ID)
+}
+
+// loadTemplates returns a copy of the options whose header and footer
+// templates are loaded from HeaderTemplateURL and FooterTemplateURL, or taken
+// from the stored templates by HeaderTemplateID and FooterTemplateID if there
+// is no URL. Both take precedence over the templates of the PDF params. The
+// URLs are checked against the URL guard of the options.
+func loadTemplates(ctx context.Context, options *ConversionOptions, stored map[string]string) (*ConversionOptions, error) {
+	params := options.PDFParams
+
+	if !params.DisplayHeaderFooter || (options.HeaderTemplateURL == "" && options.FooterTemplateURL == "" && options.HeaderTemplateID == "" && options.FooterTemplateID == "") {
+		return options, nil
+	}
+
+	if options.Offline && (options.HeaderTemplateURL != "" || options.FooterTemplateURL != "") {
+		return nil, ErrOfflineURL
+	}
+
+	header, err := resolveTemplate(ctx, options.urlGuard, stored, options.HeaderTemplateURL, options.HeaderTemplateID, params.HeaderTemplate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	footer, err := resolveTemplate(ctx, options.urlGuard, stored, options.FooterTemplateURL, options.FooterTemplateID, params.FooterTemplate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	copied := *options
+	copiedParams := *params
+	copiedParams.HeaderTemplate = header
+	copiedParams.FooterTemplate = footer
+	copied.PDFParams = &copiedParams
+
+	return &copied, nil
+}
+
+// resolveTemplate returns the template at rawurl, the stored template id or
+// else tpl.
+func resolveTemplate(ctx context.Context, guard *urlGuard, stored map[string]string, rawurl, id, tpl string) (string, error) {
+	if rawurl != "" {
+		return loadTemplate(ctx, guard, rawurl)
+	}
+
+	if id == "" {
+		return tpl, nil
+	}
+
+	stpl, ok := stored[id]
+
+	if !ok {
+		return "", &UnknownTemplateError{ID: id}
+	}
+
+	return stpl, nil
+}
+
+func loadTemplate(ctx context.Context, guard *urlGuard, rawurl string) (string, error) {
+	data, _, err := fetchTemplateResource(ctx, guard, rawurl, maxTemplateSize)
+
+	if _, ok := err.(*URLNotAllowedError); ok {
+		return "", err
+	}
+
+	if err != nil {
+		return "", &TemplateLoadError{URL: rawurl, Err: err}
+	}
+
+	return string(data), nil
+}
+
+// fetchTemplateResource loads a resource of at most limit bytes with the
+// client of the URL guard and returns it with its content type.
+func fetchTemplateResource(ctx context.Context, guard *urlGuard, rawurl string, limit int64) ([]byte, string, error) {
+	req, err := http.NewRequest(http.MethodGet, rawurl, nil)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	res, err := guard.do(req.WithContext(ctx), true)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, limit+1))
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if int64(len(data)) > limit {
+		return nil, "", fmt.Errorf("response exceeds %d bytes", limit)
+	}
+
+	return data, res.Header.Get("Content-Type"), nil
+}
@@ -0,0 +1,194 @@
+package pdfire
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"strconv"
+
+	"github.com/chromedp/cdproto/cdp"
+	cdpio "github.com/chromedp/cdproto/io"
+	"github.com/chromedp/cdproto/page"
+	"github.com/mailru/easyjson/jwriter"
+)
+
+// pdfStreamChunkSize is the number of bytes read from a PDF stream at once.
+const pdfStreamChunkSize = 1 << 20
+
+// parseTransferMode parses how Chrome transfers the printed PDF: "base64"
+// returns it in a single message, "stream" in chunks read from a stream,
+// which are written straight to the writer of the conversion if the PDF
+// doesn't have to be buffered, see streamsDirectly.
+func parseTransferMode(jsonMap map[string]interface{}, def page.PrintToPDFTransferMode) (page.PrintToPDFTransferMode, error) {
+	if _, ok := jsonMap["transferMode"]; !ok {
+		return def, nil
+	}
+
+	mode, err := parseStringOnly(jsonMap, "transferMode", "", "base64", "stream")
+
+	if err != nil {
+		return def, err
+	}
+
+	if mode == "stream" {
+		return page.PrintToPDFTransferModeReturnAsStream, nil
+	}
+
+	return page.PrintToPDFTransferModeReturnAsBase64, nil
+}
+
+// printToPDFParams adds the parameters of newer Chrome versions, which the
+// protocol package doesn't know, to the PrintToPDF command.
+type printToPDFParams struct {
+	params *page.PrintToPDFParams
+	// taggedPDF sets generateTaggedPDF, which adds the structure tags of an
+	// accessible PDF. It's always sent, as newer Chrome versions tag PDFs by
+	// default.
+	taggedPDF bool
+	// outline sets generateDocumentOutline, which adds an outline of the
+	// headings of the tagged PDF.
+	outline bool
+}
+
+func (p *printToPDFParams) MarshalEasyJSON(w *jwriter.Writer) {
+	data, err := p.params.MarshalJSON()
+
+	if err != nil {
+		w.Error = err
+		return
+	}
+
+	data = appendJSONField(data, `"generateTaggedPDF":`+strconv.FormatBool(p.taggedPDF))
+
+	if p.outline {
+		data = appendJSONField(data, `"generateDocumentOutline":true`)
+	}
+
+	w.Raw(data, nil)
+}
+
+func (p *printToPDFParams) MarshalJSON() ([]byte, error) {
+	w := jwriter.Writer{}
+	p.MarshalEasyJSON(&w)
+
+	return w.BuildBytes()
+}
+
+// appendJSONField adds a field to the end of a JSON object.
+func appendJSONField(object []byte, field string) []byte {
+	out := make([]byte, 0, len(object)+len(field)+1)
+	out = append(out, object[:len(object)-1]...)
+
+	if len(bytes.TrimSpace(object[1:len(object)-1])) > 0 {
+		out = append(out, ',')
+	}
+
+	out = append(out, field...)
+
+	return append(out, '}')
+}
+
+// printPDF prints the page with the given params to w. In stream mode, the
+// chunks of the stream are written to w as they're read.
+func printPDF(ctx context.Context, params *page.PrintToPDFParams, options *ConversionOptions, w io.Writer) error {
+	var res page.PrintToPDFReturns
+
+	// Chrome derives the outline from the structure tags.
+	chromeOutline := options.Outline == OutlineModeChrome
+	p := &printToPDFParams{
+		params:    params,
+		taggedPDF: options.TaggedPDF || chromeOutline,
+		outline:   chromeOutline,
+	}
+
+	if err := cdp.Execute(ctx, page.CommandPrintToPDF, p, &res); err != nil {
+		return err
+	}
+
+	if params.TransferMode == page.PrintToPDFTransferModeReturnAsStream {
+		return readStream(ctx, res.Stream, w, options)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(res.Data)
+
+	if err != nil {
+		return err
+	}
+
+	options.progress(StagePrint, int64(len(data)))
+	_, err = w.Write(data)
+
+	return err
+}
+
+// readStream copies a stream of the browser to w in chunks and closes it.
+// The transferred bytes are reported as print progress.
+func readStream(ctx context.Context, handle cdpio.StreamHandle, w io.Writer, options *ConversionOptions) error {
+	defer cdpio.Close(handle).Do(ctx)
+
+	var total int64
+
+	for {
+		var res cdpio.ReadReturns
+
+		if err := cdp.Execute(ctx, cdpio.CommandRead, cdpio.Read(handle).WithSize(pdfStreamChunkSize), &res); err != nil {
+			return err
+		}
+
+		data := []byte(res.Data)
+
+		if res.Base64encoded {
+			var err error
+
+			if data, err = base64.StdEncoding.DecodeString(res.Data); err != nil {
+				return err
+			}
+		}
+
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+
+		total += int64(len(data))
+		options.progress(StagePrint, total)
+
+		if res.EOF {
+			return nil
+		}
+	}
+}
+
+// streamsDirectly reports whether the PDF of a conversion is streamed from the
+// browser straight into the writer of the caller, without holding it in
+// memory. That's only the case for a single location printed in stream mode
+// at once. Otherwise, buffering the whole PDF is unavoidable, as segments,
+// multiple locations and crawls are concatenated, headings are added as an
+// outline, post-processing and provenance rewrite the PDF and a result
+// counts its pages.
+func (o *ConversionOptions) streamsDirectly(ctx context.Context, locations []string) bool {
+	if o.PDFParams.TransferMode != page.PrintToPDFTransferModeReturnAsStream || len(locations) != 1 {
+		return false
+	}
+
+	if o.Crawl != nil || o.CompareMedia || o.Outline == OutlineModeHeadings || o.Provenance || resultFrom(ctx) != nil {
+		return false
+	}
+
+	segments, err := printSegments(o)
+
+	return err == nil && len(segments) == 1 && !o.postProcessOptions().processes()
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,528 @@
+package pdfire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrURLNotAllowed is wrapped by the *URLNotAllowedError of a URL that the
+	// URLPolicy or BlockPrivateNetworks of the converter rejects.
+	ErrURLNotAllowed = errors.New("url not allowed")
+)
+
+// URLPolicy restricts the URLs that a converter renders, e.g. to guard a
+// public service against server-side request forgery. A rule is
+//
+//   - a regular expression between slashes, e.g. "/^https:\/\/example\.com\//",
+//     which is matched against the URL,
+//   - a CIDR, e.g. "10.0.0.0/8", which is matched against the addresses that
+//     the host resolves to,
+//   - or a glob, where * matches any characters, which is matched against the
+//     URL if it contains "://", e.g. "https://*.example.com/*", and against the
+//     host otherwise, e.g. "*.example.com".
+//
+// Allow rules apply to the converted URLs, the documents they redirect to and
+// the documents of their frames. Deny rules apply to every request of the
+// page.
+type URLPolicy struct {
+	// Allow are the rules of which a document URL must match one, if any.
+	Allow []string
+	// Deny are the rules that no URL may match.
+	Deny []string
+
+	once    sync.Once
+	allow   []*urlRule
+	deny    []*urlRule
+	initErr error
+}
+
+// URLNotAllowedError is returned when a URL is rejected by the URLPolicy or
+// BlockPrivateNetworks.
+type URLNotAllowedError struct {
+	URL string
+}
+
+func (e *URLNotAllowedError) Error() string {
+	return fmt.Sprintf("The URL \"%s\" is not allowed.", e.URL)
+}
+
+func (e *URLNotAllowedError) Unwrap() error {
+	return ErrURLNotAllowed
+}
+
+// URLPolicyError is returned when a rule of the URLPolicy is invalid.
+type URLPolicyError struct {
+	Rule string
+}
+
+func (e *URLPolicyError) Error() string {
+	return fmt.Sprintf("Invalid URL policy rule \"%s\".", e.Rule)
+}
+
+// resolveTimeout limits the DNS lookup of a host for the CIDR rules.
+const resolveTimeout = 5 * time.Second
+
+type urlRule struct {
+	pattern *regexp.Regexp
+	network *net.IPNet
+	// host is set if the glob is matched against the host.
+	host bool
+}
+
+func compileURLRules(rules []string) ([]*urlRule, error) {
+	compiled := make([]*urlRule, 0, len(rules))
+
+	for _, rule := range rules {
+		r, err := compileURLRule(rule)
+
+		if err != nil {
+			return nil, err
+		}
+
+		compiled = append(compiled, r)
+	}
+
+	return compiled, nil
+}
+
+func compileURLRule(rule string) (*urlRule, error) {
+	if len(rule) > 1 && strings.HasPrefix(rule, "/") && strings.HasSuffix(rule, "/") {
+		pattern, err := regexp.Compile(rule[1 : len(rule)-1])
+
+		if err != nil {
+			return nil, &URLPolicyError{Rule: rule}
+		}
+
+		return &urlRule{pattern: pattern}, nil
+	}
+
+	if _, network, err := net.ParseCIDR(rule); err == nil {
+		return &urlRule{network: network}, nil
+	}
+
+	if rule == "" {
+		return nil, &URLPolicyError{Rule: rule}
+	}
+
+	parts := strings.Split(rule, "*")
+
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+
+	pattern, err := regexp.Compile("(?i)^" + strings.Join(parts, ".*") + "$")
+
+	if err != nil {
+		return nil, &URLPolicyError{Rule: rule}
+	}
+
+	return &urlRule{pattern: pattern, host: !strings.Contains(rule, "://")}, nil
+}
+
+// compileURLPatterns compiles the URL patterns of a conversion option. They
+// have the syntax of the URLPolicy rules, except that CIDRs aren't supported,
+// as they would need a DNS lookup while the page loads.
+func compileURLPatterns(key string, patterns []string) ([]*urlRule, error) {
+	compiled := make([]*urlRule, 0, len(patterns))
+
+	for _, pattern := range patterns {
+		rule, err := compileURLRule(pattern)
+
+		if err != nil || rule.network != nil {
+			return nil, &ParseError{Key: key, Value: pattern}
+		}
+
+		compiled = append(compiled, rule)
+	}
+
+	return compiled, nil
+}
+
+// matchesURL reports whether a URL matches one of the rules without a CIDR.
+func matchesURL(rules []*urlRule, rawurl string) bool {
+	target := &policyTarget{url: rawurl, host: hostname(rawurl)}
+
+	for _, rule := range rules {
+		if rule.matches(context.Background(), target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compile compiles the rules once.
+func (p *URLPolicy) compile() error {
+	p.once.Do(func() {
+		if p.allow, p.initErr = compileURLRules(p.Allow); p.initErr != nil {
+			return
+		}
+
+		p.deny, p.initErr = compileURLRules(p.Deny)
+	})
+
+	return p.initErr
+}
+
+// check returns a *URLNotAllowedError if the policy rejects the URL. If
+// document is false, only the Deny rules are applied.
+func (p *URLPolicy) check(ctx context.Context, rawurl string, document bool) error {
+	if err := p.compile(); err != nil {
+		return err
+	}
+
+	target := &policyTarget{url: rawurl}
+
+	if u, err := url.Parse(rawurl); err == nil {
+		target.host = strings.ToLower(u.Hostname())
+	}
+
+	for _, rule := range p.deny {
+		if rule.matches(ctx, target) {
+			return &URLNotAllowedError{URL: rawurl}
+		}
+	}
+
+	if !document || len(p.allow) == 0 {
+		return nil
+	}
+
+	for _, rule := range p.allow {
+		if rule.matches(ctx, target) {
+			return nil
+		}
+	}
+
+	return &URLNotAllowedError{URL: rawurl}
+}
+
+// policyTarget is a URL that is checked against the rules. The addresses of
+// its host are resolved once, by the first CIDR rule.
+type policyTarget struct {
+	url      string
+	host     string
+	resolved bool
+	ips      []net.IP
+}
+
+func (t *policyTarget) addresses(ctx context.Context) []net.IP {
+	if t.resolved {
+		return t.ips
+	}
+
+	t.resolved = true
+	t.ips = resolveHost(ctx, t.host)
+
+	return t.ips
+}
+
+// resolveHost returns the addresses of a host. A host that doesn't resolve has
+// none.
+func resolveHost(ctx context.Context, host string) []net.IP {
+	if host == "" {
+		return nil
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+
+	if err != nil {
+		return nil
+	}
+
+	ips := make([]net.IP, len(addrs))
+
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+
+	return ips
+}
+
+func (r *urlRule) matches(ctx context.Context, target *policyTarget) bool {
+	if r.network != nil {
+		for _, ip := range target.addresses(ctx) {
+			if r.network.Contains(ip) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if r.host {
+		return r.pattern.MatchString(target.host)
+	}
+
+	return r.pattern.MatchString(target.url)
+}
+
+// privateNetworks are the address ranges that BlockPrivateNetworks denies:
+// loopback, private, shared, link-local and unspecified addresses.
+var privateNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+
+		if err != nil {
+			panic(err)
+		}
+
+		networks[i] = network
+	}
+
+	return networks
+}
+
+// isPrivateIP reports whether an address belongs to a private network.
+func isPrivateIP(ip net.IP) bool {
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isLocalhost reports whether a host names the loopback interface.
+func isLocalhost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	return host == "localhost" || strings.HasSuffix(host, ".localhost")
+}
+
+// urlGuard checks the URLs that a conversion requests against the URLPolicy
+// and BlockPrivateNetworks of the converter.
+type urlGuard struct {
+	policy          *URLPolicy
+	privateNetworks bool
+}
+
+// urlGuard returns the guard of the converter, or nil if it allows every URL.
+func (c *Converter) urlGuard() *urlGuard {
+	return newURLGuard(c.options.URLPolicy, c.options.BlockPrivateNetworks)
+}
+
+// urlGuard returns the guard of the post-processing options, or nil if they
+// allow every URL.
+func (o *PostProcessOptions) urlGuard() *urlGuard {
+	return newURLGuard(o.URLPolicy, o.BlockPrivateNetworks)
+}
+
+// newURLGuard returns a guard, or nil if it would allow every URL.
+func newURLGuard(policy *URLPolicy, privateNetworks bool) *urlGuard {
+	if policy == nil && !privateNetworks {
+		return nil
+	}
+
+	return &urlGuard{
+		policy:          policy,
+		privateNetworks: privateNetworks,
+	}
+}
+
+// check returns a *URLNotAllowedError if the URL is denied. Documents must be
+// allowed by the policy and use http or https as well.
+func (g *urlGuard) check(ctx context.Context, rawurl string, document bool) error {
+	if g.privateNetworks {
+		if err := checkPrivateNetwork(ctx, rawurl, document); err != nil {
+			return err
+		}
+	}
+
+	if g.policy != nil {
+		return g.policy.check(ctx, rawurl, document)
+	}
+
+	return nil
+}
+
+// checkPrivateNetwork denies the URLs whose host is or resolves to an address
+// of a private network and documents of other schemes than http and https.
+func checkPrivateNetwork(ctx context.Context, rawurl string, document bool) error {
+	u, err := url.Parse(rawurl)
+
+	if err != nil {
+		return &URLNotAllowedError{URL: rawurl}
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+
+	if scheme != "http" && scheme != "https" {
+		if document {
+			return &URLNotAllowedError{URL: rawurl}
+		}
+
+		return nil
+	}
+
+	if isLocalhost(u.Hostname()) {
+		return &URLNotAllowedError{URL: rawurl}
+	}
+
+	for _, ip := range resolveHost(ctx, u.Hostname()) {
+		if isPrivateIP(ip) {
+			return &URLNotAllowedError{URL: rawurl}
+		}
+	}
+
+	return nil
+}
+
+// checkRemoteAddress denies a response of a private network. The host of a
+// document may resolve differently for Chrome than it did for the guard.
+func (g *urlGuard) checkRemoteAddress(rawurl, address string) error {
+	ip := net.ParseIP(strings.Trim(address, "[]"))
+
+	if g.privateNetworks && ip != nil && isPrivateIP(ip) {
+		return &URLNotAllowedError{URL: rawurl}
+	}
+
+	return nil
+}
+
+// maxGuardedRedirects is the number of redirects that a guarded client follows.
+const maxGuardedRedirects = 10
+
+// NewHTTPClient returns a client for the requests that pdfire makes itself,
+// e.g. for header templates or reachability checks. It applies the policy and
+// BlockPrivateNetworks to every redirect, and denies connections to private
+// networks, so that a host can't resolve to a private address after it was
+// checked. It doesn't use a proxy, as the proxy would be the address that is
+// checked. Without a policy and BlockPrivateNetworks, it returns
+// http.DefaultClient.
+func NewHTTPClient(policy *URLPolicy, blockPrivateNetworks bool) *http.Client {
+	return newURLGuard(policy, blockPrivateNetworks).client(true)
+}
+
+// client returns an HTTP client that applies the guard, or http.DefaultClient
+// if g is nil.
+func (g *urlGuard) client(document bool) *http.Client {
+	if g == nil {
+		return http.DefaultClient
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   g.checkDial,
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxGuardedRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxGuardedRedirects)
+			}
+
+			return g.check(req.Context(), req.URL.String(), document)
+		},
+	}
+}
+
+// checkDial denies connections to private networks. It's called with the
+// resolved address, right before the connection is made.
+func (g *urlGuard) checkDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return err
+	}
+
+	return g.checkRemoteAddress(address, host)
+}
+
+// do sends a request with the client of the guard, after checking its URL. A
+// denied URL, redirect or address results in a *URLNotAllowedError of the URL.
+func (g *urlGuard) do(req *http.Request, document bool) (*http.Response, error) {
+	rawurl := req.URL.String()
+
+	if g != nil {
+		if err := g.check(req.Context(), rawurl, document); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := g.client(document).Do(req)
+
+	if err != nil && isURLNotAllowed(err) {
+		return nil, &URLNotAllowedError{URL: rawurl}
+	}
+
+	return res, err
+}
+
+// isURLNotAllowed reports whether an error is or wraps a *URLNotAllowedError.
+func isURLNotAllowed(err error) bool {
+	for err != nil {
+		if _, ok := err.(*URLNotAllowedError); ok {
+			return true
+		}
+
+		wrapper, ok := err.(interface{ Unwrap() error })
+
+		if !ok {
+			return false
+		}
+
+		err = wrapper.Unwrap()
+	}
+
+	return false
+}
+
+// checkURLs checks the converted URLs of the options against the URL guard of
+// the converter.
+func (c *Converter) checkURLs(ctx context.Context, options *ConversionOptions) error {
+	guard := c.urlGuard()
+
+	if guard == nil {
+		return nil
+	}
+
+	for _, u := range options.urls() {
+		if err := guard.check(ctx, u, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package pdfire_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/imkiptoo/pdfire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURLPolicy(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConverterOptions()
+	options.URLPolicy = &pdfire.URLPolicy{
+		Allow: []string{"*.example.com", "https://example.org/docs/*", `/^https://example\.net/\d+$/`},
+		Deny:  []string{"10.0.0.0/8", "secret.example.com"},
+	}
+	converter := pdfire.NewConverter(options)
+
+	convopts := pdfire.NewConversionOptions()
+
+	for _, u := range []string{"https://www.example.com/", "https://example.org/docs/a", "https://example.net/42"} {
+		convopts.URL = u
+		assert.Nil(converter.Validate(convopts), u)
+	}
+
+	for _, u := range []string{"https://example.org/blog", "https://example.net/a", "https://secret.example.com/", "http://10.1.2.3/", "https://example.com.evil.com/"} {
+		convopts.URL = u
+		assert.Equal(&pdfire.URLNotAllowedError{URL: u}, converter.Validate(convopts), u)
+	}
+
+	options.URLPolicy = &pdfire.URLPolicy{Allow: []string{"/(/"}}
+	converter = pdfire.NewConverter(options)
+	convopts.URL = "https://example.com/"
+
+	assert.Equal(&pdfire.URLPolicyError{Rule: "/(/"}, converter.Validate(convopts))
+}
+
+func TestConvertURLPolicy(t *testing.T) {
+	assert := assert.New(t)
+	var trackers int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<img src="/tracker.png"><p>Article</p>`))
+	})
+	mux.HandleFunc("/tracker.png", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&trackers, 1)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	redirect := strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/"
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, redirect, http.StatusFound)
+	})
+
+	converterOptions := pdfire.NewConverterOptions()
+	converterOptions.URLPolicy = &pdfire.URLPolicy{
+		Allow: []string{"127.0.0.1"},
+		Deny:  []string{"http://*/tracker.png"},
+	}
+	converter := pdfire.NewConverter(converterOptions)
+
+	options := pdfire.NewConversionOptions()
+	options.URL = server.URL
+
+	err := converter.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Nil(err)
+	assert.Equal(int32(0), atomic.LoadInt32(&trackers))
+
+	options.URL = server.URL + "/redirect"
+	err = converter.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(&pdfire.URLNotAllowedError{URL: redirect}, err)
+}
+
+func TestBlockPrivateNetworks(t *testing.T) {
+	assert := assert.New(t)
+	options := pdfire.NewConverterOptions()
+	options.BlockPrivateNetworks = true
+	converter := pdfire.NewConverter(options)
+
+	convopts := pdfire.NewConversionOptions()
+	convopts.URL = "http://93.184.216.34/"
+
+	assert.Nil(converter.Validate(convopts))
+
+	for _, u := range []string{
+		"file:///etc/passwd",
+		"ftp://93.184.216.34/",
+		"http://localhost:8080/",
+		"http://api.localhost/",
+		"http://127.0.0.1/",
+		"http://10.0.0.1/",
+		"http://172.16.5.4/",
+		"http://192.168.1.1/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::1]/",
+		"http://[fd00::1]/",
+	} {
+		convopts.URL = u
+		assert.Equal(&pdfire.URLNotAllowedError{URL: u}, converter.Validate(convopts), u)
+	}
+}
+
+func TestConvertTemplateURLGuard(t *testing.T) {
+	assert := assert.New(t)
+	var loads int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/header.html", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&loads, 1)
+		w.Write([]byte(`<div>Secret</div>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	redirect := strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/header.html"
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, redirect, http.StatusFound)
+	})
+
+	converterOptions := pdfire.NewConverterOptions()
+	converterOptions.BlockPrivateNetworks = true
+	converter := pdfire.NewConverter(converterOptions)
+
+	options := pdfire.NewConversionOptions()
+	options.HTML = "<p>Invoice</p>"
+	options.PDFParams.DisplayHeaderFooter = true
+	options.HeaderTemplateURL = server.URL + "/header.html"
+
+	err := converter.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(&pdfire.URLNotAllowedError{URL: options.HeaderTemplateURL}, err)
+
+	converterOptions = pdfire.NewConverterOptions()
+	converterOptions.URLPolicy = &pdfire.URLPolicy{Allow: []string{"127.0.0.1"}}
+	converter = pdfire.NewConverter(converterOptions)
+	options.HeaderTemplateURL = server.URL + "/redirect"
+
+	err = converter.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(&pdfire.URLNotAllowedError{URL: options.HeaderTemplateURL}, err)
+	assert.Equal(int32(0), atomic.LoadInt32(&loads))
+}
+
+func TestConvertTemplateImageURLGuard(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	}))
+	defer server.Close()
+
+	converterOptions := pdfire.NewConverterOptions()
+	converterOptions.BlockPrivateNetworks = true
+	converter := pdfire.NewConverter(converterOptions)
+
+	options := pdfire.NewConversionOptions()
+	options.HTML = "<p>Invoice</p>"
+	options.PDFParams.DisplayHeaderFooter = true
+	options.TemplateImages = map[string]string{"logo": server.URL + "/logo.png"}
+
+	err := converter.Convert(context.Background(), ioutil.Discard, options)
+
+	assert.Equal(&pdfire.URLNotAllowedError{URL: server.URL + "/logo.png"}, err)
+}